@@ -0,0 +1,652 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// mp3SearchWindow is how far past the ID3 tag we look for the first MPEG frame
+const mp3SearchWindow = 64 * 1024
+
+// oggTailWindow is how much of the end of an Ogg file is searched for the last page
+const oggTailWindow = 64 * 1024
+
+// errNoAudioInfo is returned when a file's stream properties can't be determined
+var errNoAudioInfo = errors.New("no audio stream information found")
+
+// AudioInfo holds the stream properties read from the audio data itself (not the tags)
+type AudioInfo struct {
+	Duration   time.Duration
+	Bitrate    int // average, in kbps
+	SampleRate int // in Hz
+	Channels   int
+}
+
+// ReadAudioInfo parses a file's audio headers for duration, bitrate, sample rate and channels
+func ReadAudioInfo(filePath string, format *AudioFormat) (AudioInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return AudioInfo{}, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return AudioInfo{}, err
+	}
+	size := stat.Size()
+
+	var info AudioInfo
+	switch format {
+	case FormatMP3:
+		info, err = readMP3Info(file, size)
+	case FormatFLAC:
+		info, err = readFLACInfo(file, size)
+	case FormatM4A:
+		info, err = readMP4Info(file, size)
+	case FormatAAC:
+		info, err = readADTSInfo(file, size)
+	case FormatOgg, FormatOpus:
+		info, err = readOggInfo(file, size)
+	case FormatWAV:
+		info, err = readWAVInfo(file, size)
+	default:
+		return AudioInfo{}, fmt.Errorf("no audio info parser for %v", format)
+	}
+	if err != nil {
+		return AudioInfo{}, err
+	}
+	if info.Duration <= 0 {
+		return AudioInfo{}, errNoAudioInfo
+	}
+	return info, nil
+}
+
+// durationFromSamples converts a sample count at a given rate to a duration
+func durationFromSamples(samples int64, sampleRate int) time.Duration {
+	if sampleRate <= 0 || samples <= 0 {
+		return 0
+	}
+	return time.Duration(float64(samples) / float64(sampleRate) * float64(time.Second))
+}
+
+// averageBitrate returns the average bitrate in kbps of audioBytes played over duration
+func averageBitrate(audioBytes int64, duration time.Duration) int {
+	if duration <= 0 || audioBytes <= 0 {
+		return 0
+	}
+	return int(float64(audioBytes) * 8 / duration.Seconds() / 1000)
+}
+
+// skipID3v2 returns the offset just past a leading ID3v2 tag (0 if there is none)
+func skipID3v2(r io.ReaderAt) int64 {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return 0
+	}
+	return id3v2Size(header)
+}
+
+// --- MP3 ---
+
+// MPEG audio layer III lookup tables, indexed by the header's bitrate/sample rate fields
+var (
+	mp3BitratesV1  = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2  = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3SampleRates = map[byte][3]int{
+		0x03: {44100, 48000, 32000}, // MPEG 1
+		0x02: {22050, 24000, 16000}, // MPEG 2
+		0x00: {11025, 12000, 8000},  // MPEG 2.5
+	}
+)
+
+// mp3Frame is a decoded MPEG layer III frame header
+type mp3Frame struct {
+	version    byte // 0x03 = MPEG 1, 0x02 = MPEG 2, 0x00 = MPEG 2.5
+	bitrate    int  // kbps
+	sampleRate int
+	channels   int
+	length     int // bytes, including the header
+}
+
+// samplesPerFrame returns how many PCM samples one frame decodes to
+func (f mp3Frame) samplesPerFrame() int {
+	if f.version == 0x03 {
+		return 1152
+	}
+	return 576
+}
+
+// sideInfoSize returns the size of the side information that follows the header
+func (f mp3Frame) sideInfoSize() int {
+	if f.version == 0x03 {
+		if f.channels == 1 {
+			return 17
+		}
+		return 32
+	}
+	if f.channels == 1 {
+		return 9
+	}
+	return 17
+}
+
+// parseMP3Frame decodes a 4-byte MPEG audio frame header, accepting layer III only
+func parseMP3Frame(header []byte) (mp3Frame, bool) {
+	if len(header) < 4 || header[0] != 0xff || header[1]&0xe0 != 0xe0 {
+		return mp3Frame{}, false
+	}
+
+	version := (header[1] >> 3) & 0x03
+	layer := (header[1] >> 1) & 0x03
+	bitrateIndex := header[2] >> 4
+	rateIndex := (header[2] >> 2) & 0x03
+	padding := int((header[2] >> 1) & 0x01)
+	channelMode := header[3] >> 6
+
+	rates, ok := mp3SampleRates[version]
+	if !ok || layer != 0x01 || rateIndex == 0x03 || bitrateIndex == 0 || bitrateIndex == 0x0f {
+		return mp3Frame{}, false
+	}
+
+	frame := mp3Frame{
+		version:    version,
+		sampleRate: rates[rateIndex],
+		channels:   2,
+	}
+	if channelMode == 0x03 {
+		frame.channels = 1
+	}
+
+	if version == 0x03 {
+		frame.bitrate = mp3BitratesV1[bitrateIndex]
+		frame.length = 144*frame.bitrate*1000/frame.sampleRate + padding
+	} else {
+		frame.bitrate = mp3BitratesV2[bitrateIndex]
+		frame.length = 72*frame.bitrate*1000/frame.sampleRate + padding
+	}
+	return frame, true
+}
+
+// readMP3Info finds the first MPEG frame and derives the duration from a Xing/Info
+// or VBRI header when present (VBR files), or from the frame bitrate otherwise (CBR)
+func readMP3Info(file *os.File, size int64) (AudioInfo, error) {
+	start := skipID3v2(file)
+
+	buf := make([]byte, mp3SearchWindow)
+	n, err := file.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return AudioInfo{}, err
+	}
+	buf = buf[:n]
+
+	// Find the first frame whose successor is also a valid frame, so stray 0xFF bytes
+	// in junk or unsynchronised tags aren't mistaken for audio
+	offset := -1
+	var frame mp3Frame
+	for i := 0; i+4 <= len(buf); i++ {
+		candidate, ok := parseMP3Frame(buf[i:])
+		if !ok {
+			continue
+		}
+		next := i + candidate.length
+		if next+4 <= len(buf) {
+			following, ok := parseMP3Frame(buf[next:])
+			if !ok || following.version != candidate.version || following.sampleRate != candidate.sampleRate {
+				continue
+			}
+		}
+		offset, frame = i, candidate
+		break
+	}
+	if offset < 0 {
+		return AudioInfo{}, errors.New("no MPEG audio frame found")
+	}
+
+	audioStart := start + int64(offset)
+	audioEnd := size
+	if hasID3v1(file, size) {
+		audioEnd -= 128
+	}
+
+	info := AudioInfo{SampleRate: frame.sampleRate, Channels: frame.channels}
+	frameData := buf[offset:]
+
+	// VBR: the first frame carries a Xing/Info or VBRI header with the total frame count
+	if frames, audioBytes, delay, ok := parseXingHeader(frameData, frame); ok {
+		samples := int64(frames)*int64(frame.samplesPerFrame()) - int64(delay)
+		info.Duration = durationFromSamples(samples, frame.sampleRate)
+		if audioBytes == 0 {
+			audioBytes = audioEnd - audioStart
+		}
+		info.Bitrate = averageBitrate(audioBytes, info.Duration)
+		return info, nil
+	}
+
+	if frames, audioBytes, ok := parseVBRIHeader(frameData); ok {
+		samples := int64(frames) * int64(frame.samplesPerFrame())
+		info.Duration = durationFromSamples(samples, frame.sampleRate)
+		info.Bitrate = averageBitrate(audioBytes, info.Duration)
+		return info, nil
+	}
+
+	// CBR: every frame has the same bitrate
+	info.Bitrate = frame.bitrate
+	audioBytes := audioEnd - audioStart
+	if audioBytes > 0 && frame.bitrate > 0 {
+		info.Duration = time.Duration(float64(audioBytes) * 8 / float64(frame.bitrate*1000) * float64(time.Second))
+	}
+	return info, nil
+}
+
+// parseXingHeader reads a Xing/Info header (and the LAME extension's encoder delay
+// and padding, for gapless-accurate durations) from the first frame
+func parseXingHeader(frameData []byte, frame mp3Frame) (frames uint32, audioBytes int64, delay int, ok bool) {
+	pos := 4 + frame.sideInfoSize()
+	if pos+8 > len(frameData) {
+		return 0, 0, 0, false
+	}
+
+	tag := string(frameData[pos : pos+4])
+	if tag != "Xing" && tag != "Info" {
+		return 0, 0, 0, false
+	}
+
+	flags := binary.BigEndian.Uint32(frameData[pos+4:])
+	pos += 8
+
+	if flags&0x01 == 0 {
+		return 0, 0, 0, false // no frame count, nothing useful
+	}
+	if pos+4 > len(frameData) {
+		return 0, 0, 0, false
+	}
+	frames = binary.BigEndian.Uint32(frameData[pos:])
+	pos += 4
+
+	if flags&0x02 != 0 && pos+4 <= len(frameData) {
+		audioBytes = int64(binary.BigEndian.Uint32(frameData[pos:]))
+		pos += 4
+	}
+	if flags&0x04 != 0 {
+		pos += 100 // seek table
+	}
+	if flags&0x08 != 0 {
+		pos += 4 // quality indicator
+	}
+
+	// LAME (or ffmpeg's compatible Lavf/Lavc) tag: 12-bit delay and padding at offset 21
+	if pos+24 <= len(frameData) {
+		encoder := string(frameData[pos : pos+4])
+		if encoder == "LAME" || encoder == "Lavf" || encoder == "Lavc" {
+			d := frameData[pos+21:]
+			encoderDelay := int(d[0])<<4 | int(d[1])>>4
+			encoderPadding := int(d[1]&0x0f)<<8 | int(d[2])
+			delay = encoderDelay + encoderPadding
+		}
+	}
+
+	return frames, audioBytes, delay, frames > 0
+}
+
+// parseVBRIHeader reads a Fraunhofer VBRI header, which sits 32 bytes after the frame header
+func parseVBRIHeader(frameData []byte) (frames uint32, audioBytes int64, ok bool) {
+	const pos = 4 + 32
+	if pos+18 > len(frameData) || string(frameData[pos:pos+4]) != "VBRI" {
+		return 0, 0, false
+	}
+	audioBytes = int64(binary.BigEndian.Uint32(frameData[pos+10:]))
+	frames = binary.BigEndian.Uint32(frameData[pos+14:])
+	return frames, audioBytes, frames > 0
+}
+
+// hasID3v1 reports whether the file ends with a 128-byte ID3v1 tag
+func hasID3v1(file *os.File, size int64) bool {
+	if size < 128 {
+		return false
+	}
+	marker := make([]byte, 3)
+	if _, err := file.ReadAt(marker, size-128); err != nil {
+		return false
+	}
+	return string(marker) == "TAG"
+}
+
+// --- FLAC ---
+
+// readFLACInfo reads the STREAMINFO block, which carries the exact total sample count
+func readFLACInfo(file *os.File, size int64) (AudioInfo, error) {
+	pos := skipID3v2(file)
+
+	marker := make([]byte, 4)
+	if _, err := file.ReadAt(marker, pos); err != nil {
+		return AudioInfo{}, err
+	}
+	if string(marker) != "fLaC" {
+		return AudioInfo{}, errors.New("missing fLaC marker")
+	}
+	pos += 4
+
+	var info AudioInfo
+	var totalSamples int64
+	header := make([]byte, 4)
+	for {
+		if _, err := file.ReadAt(header, pos); err != nil {
+			return AudioInfo{}, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		pos += 4
+
+		if blockType == 0 {
+			streamInfo := make([]byte, 18)
+			if _, err := file.ReadAt(streamInfo, pos); err != nil {
+				return AudioInfo{}, err
+			}
+			// Bytes 10-17: 20 bits sample rate, 3 bits channels-1, 5 bits bits-per-sample-1, 36 bits total samples
+			packed := binary.BigEndian.Uint64(streamInfo[10:])
+			info.SampleRate = int(packed >> 44)
+			info.Channels = int((packed>>41)&0x07) + 1
+			totalSamples = int64(packed & 0xfffffffff)
+		}
+
+		pos += length
+		if last || pos >= size {
+			break
+		}
+	}
+
+	if info.SampleRate == 0 {
+		return AudioInfo{}, errors.New("missing STREAMINFO block")
+	}
+
+	info.Duration = durationFromSamples(totalSamples, info.SampleRate)
+	info.Bitrate = averageBitrate(size-pos, info.Duration)
+	return info, nil
+}
+
+// --- MP4 / M4A ---
+
+// mp4Containers are the boxes readMP4Info descends into on the way to mvhd and stsd
+var mp4Containers = map[string]bool{"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true}
+
+// readMP4Info reads the duration from mvhd and the sample rate and channels from the
+// first audio sample entry in stsd
+func readMP4Info(file *os.File, size int64) (AudioInfo, error) {
+	var info AudioInfo
+	var mdatBytes int64
+
+	var walk func(start, end int64, depth int) error
+	walk = func(start, end int64, depth int) error {
+		header := make([]byte, 16)
+		for pos := start; pos+8 <= end; {
+			if _, err := file.ReadAt(header[:8], pos); err != nil {
+				return err
+			}
+			boxSize := int64(binary.BigEndian.Uint32(header[0:4]))
+			boxType := string(header[4:8])
+			headerLen := int64(8)
+
+			switch boxSize {
+			case 0: // box extends to the end of its parent
+				boxSize = end - pos
+			case 1: // 64-bit size follows the type
+				if _, err := file.ReadAt(header[8:16], pos+8); err != nil {
+					return err
+				}
+				boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+				headerLen = 16
+			}
+			if boxSize < headerLen || pos+boxSize > end {
+				return fmt.Errorf("malformed %q box at offset %d", boxType, pos)
+			}
+
+			payload := pos + headerLen
+			switch {
+			case depth == 0 && boxType == "mdat":
+				mdatBytes += boxSize - headerLen
+			case mp4Containers[boxType]:
+				if err := walk(payload, pos+boxSize, depth+1); err != nil {
+					return err
+				}
+			case boxType == "mvhd":
+				if err := readMVHD(file, payload, &info); err != nil {
+					return err
+				}
+			case boxType == "stsd" && info.SampleRate == 0:
+				readSTSD(file, payload, pos+boxSize, &info)
+			}
+
+			pos += boxSize
+		}
+		return nil
+	}
+
+	if err := walk(0, size, 0); err != nil {
+		return AudioInfo{}, err
+	}
+
+	if info.Duration <= 0 {
+		return AudioInfo{}, errors.New("missing mvhd box")
+	}
+	if mdatBytes == 0 {
+		mdatBytes = size
+	}
+	info.Bitrate = averageBitrate(mdatBytes, info.Duration)
+	return info, nil
+}
+
+// readMVHD reads the movie timescale and duration
+func readMVHD(file *os.File, pos int64, info *AudioInfo) error {
+	data := make([]byte, 32)
+	if _, err := file.ReadAt(data, pos); err != nil && err != io.EOF {
+		return err
+	}
+
+	var timescale uint32
+	var duration uint64
+	if data[0] == 1 {
+		// Version 1: 64-bit creation/modification times and duration
+		timescale = binary.BigEndian.Uint32(data[20:24])
+		duration = binary.BigEndian.Uint64(data[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(data[12:16])
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	}
+
+	if timescale > 0 {
+		info.Duration = durationFromSamples(int64(duration), int(timescale))
+	}
+	return nil
+}
+
+// readSTSD reads channels and sample rate from the first audio sample entry
+func readSTSD(file *os.File, pos, end int64, info *AudioInfo) {
+	// version/flags (4) + entry count (4), then the first entry: size (4) + format (4)
+	// + reserved (6) + data reference index (2) + AudioSampleEntry fields
+	data := make([]byte, 44)
+	if end-pos < int64(len(data)) {
+		return
+	}
+	if _, err := file.ReadAt(data, pos); err != nil {
+		return
+	}
+
+	switch string(data[12:16]) {
+	case "mp4a", "alac", "ac-3", "ec-3", "Opus", "fLaC":
+	default:
+		return
+	}
+
+	entry := data[16:]
+	info.Channels = int(binary.BigEndian.Uint16(entry[16:18]))
+	info.SampleRate = int(binary.BigEndian.Uint32(entry[24:28]) >> 16) // 16.16 fixed point
+}
+
+// --- AAC (ADTS) ---
+
+// adtsSampleRates maps the ADTS sampling frequency index to Hz
+var adtsSampleRates = [13]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// readADTSInfo walks the ADTS frame headers; raw AAC has no global header with a length
+func readADTSInfo(file *os.File, size int64) (AudioInfo, error) {
+	start := skipID3v2(file)
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return AudioInfo{}, err
+	}
+	reader := bufio.NewReaderSize(file, 64*1024)
+
+	var info AudioInfo
+	var frames, audioBytes int64
+	header := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+		if !isADTSFrame(header) {
+			break
+		}
+
+		rateIndex := (header[2] >> 2) & 0x0f
+		if int(rateIndex) >= len(adtsSampleRates) {
+			break
+		}
+		frameLength := int(header[3]&0x03)<<11 | int(header[4])<<3 | int(header[5])>>5
+		if frameLength < 7 {
+			break
+		}
+
+		if frames == 0 {
+			info.SampleRate = adtsSampleRates[rateIndex]
+			info.Channels = int(header[2]&0x01)<<2 | int(header[3])>>6
+		}
+		frames++
+		audioBytes += int64(frameLength)
+
+		if _, err := reader.Discard(frameLength - 7); err != nil {
+			break
+		}
+	}
+
+	if frames == 0 {
+		return AudioInfo{}, errors.New("no ADTS frames found")
+	}
+
+	// Every AAC frame decodes to 1024 samples
+	info.Duration = durationFromSamples(frames*1024, info.SampleRate)
+	info.Bitrate = averageBitrate(audioBytes, info.Duration)
+	return info, nil
+}
+
+// --- Ogg Vorbis / Opus ---
+
+// readOggInfo reads the codec identification header from the first page and the
+// final granule position (total samples) from the last page
+func readOggInfo(file *os.File, size int64) (AudioInfo, error) {
+	first := make([]byte, 27+255+64)
+	n, err := file.ReadAt(first, 0)
+	if err != nil && err != io.EOF {
+		return AudioInfo{}, err
+	}
+	first = first[:n]
+	if len(first) < 27 || !isOggPage(first) {
+		return AudioInfo{}, errors.New("missing Ogg page")
+	}
+	packetStart := 27 + int(first[26])
+	if packetStart >= len(first) {
+		return AudioInfo{}, errors.New("truncated Ogg page")
+	}
+	packet := first[packetStart:]
+
+	var info AudioInfo
+	var sampleRate, preSkip int
+	switch {
+	case len(packet) >= 16 && bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		info.Channels = int(packet[11])
+		sampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		info.SampleRate = sampleRate
+	case len(packet) >= 16 && bytes.HasPrefix(packet, []byte("OpusHead")):
+		info.Channels = int(packet[9])
+		preSkip = int(binary.LittleEndian.Uint16(packet[10:12]))
+		// Opus always decodes at 48 kHz; the header's rate is only the original input rate
+		sampleRate = 48000
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		if info.SampleRate == 0 {
+			info.SampleRate = sampleRate
+		}
+	default:
+		return AudioInfo{}, errors.New("unsupported Ogg codec")
+	}
+
+	// The granule position of the last page is the total sample count
+	tailStart := size - oggTailWindow
+	if tailStart < 0 {
+		tailStart = 0
+	}
+	tail := make([]byte, size-tailStart)
+	if _, err := file.ReadAt(tail, tailStart); err != nil && err != io.EOF {
+		return AudioInfo{}, err
+	}
+	last := bytes.LastIndex(tail, []byte("OggS"))
+	if last < 0 || last+14 > len(tail) {
+		return AudioInfo{}, errors.New("missing final Ogg page")
+	}
+	granule := int64(binary.LittleEndian.Uint64(tail[last+6 : last+14]))
+
+	info.Duration = durationFromSamples(granule-int64(preSkip), sampleRate)
+	info.Bitrate = averageBitrate(size, info.Duration)
+	return info, nil
+}
+
+// --- WAV ---
+
+// readWAVInfo reads the fmt and data chunks of a RIFF/WAVE file
+func readWAVInfo(file *os.File, size int64) (AudioInfo, error) {
+	var info AudioInfo
+	var byteRate, dataBytes int64
+
+	chunk := make([]byte, 8)
+	for pos := int64(12); pos+8 <= size; {
+		if _, err := file.ReadAt(chunk, pos); err != nil {
+			return AudioInfo{}, err
+		}
+		chunkID := string(chunk[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		pos += 8
+
+		switch chunkID {
+		case "fmt ":
+			format := make([]byte, 16)
+			if _, err := file.ReadAt(format, pos); err != nil {
+				return AudioInfo{}, err
+			}
+			info.Channels = int(binary.LittleEndian.Uint16(format[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(format[4:8]))
+			byteRate = int64(binary.LittleEndian.Uint32(format[8:12]))
+		case "data":
+			dataBytes = chunkSize
+			// Streaming encoders sometimes leave the size as 0 or 0xFFFFFFFF
+			if dataBytes == 0 || pos+dataBytes > size {
+				dataBytes = size - pos
+			}
+		}
+
+		// Chunks are padded to an even length
+		pos += chunkSize + chunkSize%2
+	}
+
+	if byteRate == 0 || dataBytes == 0 {
+		return AudioInfo{}, errors.New("missing fmt or data chunk")
+	}
+
+	info.Duration = time.Duration(float64(dataBytes) / float64(byteRate) * float64(time.Second))
+	info.Bitrate = int(byteRate * 8 / 1000)
+	return info, nil
+}
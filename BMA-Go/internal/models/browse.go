@@ -0,0 +1,165 @@
+package models
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// unknownArtistName groups songs with neither an artist tag nor an Artist/Album folder layout
+const unknownArtistName = "Unknown Artist"
+
+// Artist groups every song credited to one artist, plus the albums they appear on
+type Artist struct {
+	ID     uuid.UUID `json:"id"`
+	Name   string    `json:"name"`
+	Albums []*Album  `json:"albums"`
+	Songs  []*Song   `json:"songs"`
+}
+
+// Folder groups the songs of one directory that don't belong to any album
+type Folder struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Path  string    `json:"path"`
+	Songs []*Song   `json:"songs"`
+}
+
+// TotalDuration returns the combined length of all songs in the folder
+func (f *Folder) TotalDuration() time.Duration {
+	var total time.Duration
+	for _, song := range f.Songs {
+		total += song.Duration
+	}
+	return total
+}
+
+// artistName returns the name a song is filed under on the artists page
+func artistName(song *Song) string {
+	if name := strings.TrimSpace(song.InferredArtist()); name != "" {
+		return name
+	}
+	return unknownArtistName
+}
+
+// GetAlbumByID finds an album by its stable ID
+func (ml *MusicLibrary) GetAlbumByID(id string) *Album {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+
+	for _, album := range ml.Albums {
+		if album.ID.String() == id {
+			return album
+		}
+	}
+	return nil
+}
+
+// GetArtists groups the library by artist, sorted by name. Song order follows the
+// library order, so tracks stay grouped by album and sorted within each album.
+func (ml *MusicLibrary) GetArtists() []*Artist {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+	return groupArtists(ml.Songs, ml.Albums)
+}
+
+// groupArtists builds the artist list from sorted songs and their albums
+func groupArtists(songs []*Song, albums []*Album) []*Artist {
+	artistsByID := make(map[uuid.UUID]*Artist)
+	var artists []*Artist
+	for _, song := range songs {
+		name := artistName(song)
+		id := StableArtistID(name)
+
+		artist, exists := artistsByID[id]
+		if !exists {
+			artist = &Artist{ID: id, Name: name}
+			artistsByID[id] = artist
+			artists = append(artists, artist)
+		}
+		artist.Songs = append(artist.Songs, song)
+	}
+
+	// An album is listed under its album artist and every artist with at least one song on it
+	for _, album := range albums {
+		seen := make(map[uuid.UUID]bool)
+		if id := StableArtistID(album.Artist); album.Artist != "" {
+			if artist, exists := artistsByID[id]; exists {
+				seen[id] = true
+				artist.Albums = append(artist.Albums, album)
+			}
+		}
+		for _, song := range album.Songs {
+			id := StableArtistID(artistName(song))
+			if artist, exists := artistsByID[id]; exists && !seen[id] {
+				seen[id] = true
+				artist.Albums = append(artist.Albums, album)
+			}
+		}
+	}
+
+	sort.SliceStable(artists, func(i, j int) bool {
+		return strings.ToLower(artists[i].Name) < strings.ToLower(artists[j].Name)
+	})
+	return artists
+}
+
+// GetArtistByID finds an artist by its stable ID
+func (ml *MusicLibrary) GetArtistByID(id string) *Artist {
+	for _, artist := range ml.GetArtists() {
+		if artist.ID.String() == id {
+			return artist
+		}
+	}
+	return nil
+}
+
+// GetFolders returns the songs that aren't part of any album, grouped by directory
+// and sorted by folder name
+func (ml *MusicLibrary) GetFolders() []*Folder {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+	return ml.standaloneFoldersUnsafe()
+}
+
+// standaloneFoldersUnsafe groups songs outside of albums by parent directory (assumes lock held)
+func (ml *MusicLibrary) standaloneFoldersUnsafe() []*Folder {
+	albumSongIDs := make(map[uuid.UUID]bool)
+	for _, album := range ml.Albums {
+		for _, song := range album.Songs {
+			albumSongIDs[song.ID] = true
+		}
+	}
+
+	foldersByPath := make(map[string]*Folder)
+	var folders []*Folder
+	for _, song := range ml.Songs {
+		if albumSongIDs[song.ID] {
+			continue
+		}
+
+		folder, exists := foldersByPath[song.ParentDirectory]
+		if !exists {
+			name := filepath.Base(song.ParentDirectory)
+			if name == "" || name == "." {
+				name = "Unknown Folder"
+			}
+			folder = &Folder{
+				ID:   StableFolderID(song.ParentDirectory),
+				Name: name,
+				Path: song.ParentDirectory,
+			}
+			foldersByPath[song.ParentDirectory] = folder
+			folders = append(folders, folder)
+		}
+		folder.Songs = append(folder.Songs, song)
+	}
+
+	sort.SliceStable(folders, func(i, j int) bool {
+		return strings.ToLower(folders[i].Name) < strings.ToLower(folders[j].Name)
+	})
+	return folders
+}
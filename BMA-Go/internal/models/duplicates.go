@@ -0,0 +1,262 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// DuplicatePolicy decides which copy of a song stays listed when several files
+// turn out to be the same track
+type DuplicatePolicy string
+
+const (
+	DuplicatesKeepFirst      DuplicatePolicy = "first"    // first in library order, as before policies existed
+	DuplicatesPreferBitrate  DuplicatePolicy = "bitrate"  // highest average bitrate
+	DuplicatesPreferLossless DuplicatePolicy = "lossless" // FLAC or WAV over lossy formats, then highest bitrate
+	DuplicatesPreferNewest   DuplicatePolicy = "newest"   // most recently modified file
+	DuplicatesKeepAll        DuplicatePolicy = "keep-all" // list every copy; duplicates are only reported
+)
+
+// DuplicatePolicies lists every policy, in the order settings screens offer them
+var DuplicatePolicies = []DuplicatePolicy{
+	DuplicatesKeepFirst, DuplicatesPreferBitrate, DuplicatesPreferLossless, DuplicatesPreferNewest, DuplicatesKeepAll,
+}
+
+// ParseDuplicatePolicy validates a policy name; empty means DuplicatesKeepFirst
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return DuplicatesKeepFirst, nil
+	}
+	for _, policy := range DuplicatePolicies {
+		if name == string(policy) {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown duplicate policy %q", name)
+}
+
+// DuplicateGroup is a set of files found to be the same song
+type DuplicateGroup struct {
+	Kept      *Song   // the copy the policy prefers
+	Songs     []*Song // every copy, Kept first
+	SameTags  bool    // copies share artist, title, album and disc
+	SameAudio bool    // copies have identical audio data (only with fingerprinting)
+}
+
+// DuplicateReport is the outcome of the last deduplication
+type DuplicateReport struct {
+	Policy         DuplicatePolicy
+	Fingerprinting bool
+	Groups         []DuplicateGroup
+}
+
+// IsLossless reports whether the song's format is always lossless
+func (s *Song) IsLossless() bool {
+	format := FormatByName(s.Format)
+	return format != nil && format.Lossless
+}
+
+// SetDuplicateHandling sets the duplicate policy and whether copies are also matched
+// by audio fingerprint, then regroups the library. Turning fingerprinting on rescans
+// so files indexed without a fingerprint get one.
+func (ml *MusicLibrary) SetDuplicateHandling(policyName string, fingerprinting bool) error {
+	policy, err := ParseDuplicatePolicy(policyName)
+	if err != nil {
+		return err
+	}
+
+	ml.mutex.Lock()
+	needFingerprints := fingerprinting && !ml.fingerprinting
+	ml.duplicatePolicy = policy
+	ml.fingerprinting = fingerprinting
+	hasSongs := len(ml.allSongs) > 0
+	ml.mutex.Unlock()
+
+	log.Printf("🚫 [DEDUP] Duplicate policy: %s (fingerprints: %v)", policy, fingerprinting)
+	if !hasSongs {
+		return nil
+	}
+	if needFingerprints {
+		ml.ScanFolder()
+		return nil
+	}
+
+	ml.scanMutex.Lock()
+	defer ml.scanMutex.Unlock()
+
+	ml.mutex.RLock()
+	current := ml.allSongs
+	ml.mutex.RUnlock()
+
+	if changes := ml.commitSongs(current); !changes.IsEmpty() {
+		ml.notifyLibraryChanged()
+	}
+	return nil
+}
+
+// duplicateHandling returns the current policy and fingerprint setting
+func (ml *MusicLibrary) duplicateHandling() (DuplicatePolicy, bool) {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+	return ml.duplicatePolicy, ml.fingerprinting
+}
+
+// GetDuplicates returns the duplicate groups found by the last scan or update
+func (ml *MusicLibrary) GetDuplicates() DuplicateReport {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+
+	policy := ml.duplicatePolicy
+	if policy == "" {
+		policy = DuplicatesKeepFirst
+	}
+	return DuplicateReport{
+		Policy:         policy,
+		Fingerprinting: ml.fingerprinting,
+		Groups:         append([]DuplicateGroup(nil), ml.duplicates...),
+	}
+}
+
+// duplicateKey identifies a song by its metadata (Artist + Title + Album + disc)
+func duplicateKey(song *Song) string {
+	// Create unique key from metadata (case-insensitive)
+	artist := strings.ToLower(strings.TrimSpace(song.Artist))
+	title := strings.ToLower(strings.TrimSpace(song.Title))
+	album := strings.ToLower(strings.TrimSpace(song.Album))
+
+	// Handle empty metadata gracefully
+	if artist == "" {
+		artist = "unknown_artist"
+	}
+	if title == "" {
+		title = "unknown_title"
+	}
+	if album == "" {
+		album = "unknown_album"
+	}
+
+	// The same title on another disc (a reprise, a live disc) is a different track
+	return artist + "|" + title + "|" + album + "|" + strconv.Itoa(song.SortingDisc())
+}
+
+// deduplicate groups copies of the same song, by metadata and optionally by audio
+// fingerprint, and keeps one copy of each according to the duplicate policy. Songs
+// arrive sorted and keep their order.
+func (ml *MusicLibrary) deduplicate(songs []*Song) ([]*Song, []DuplicateGroup) {
+	policy, fingerprinting := ml.duplicateHandling()
+
+	// Union-find over song positions; a set's root is always its first song
+	parent := make([]int, len(songs))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	union := func(a, b int) {
+		rootA, rootB := find(a), find(b)
+		if rootA < rootB {
+			parent[rootB] = rootA
+		} else if rootB < rootA {
+			parent[rootA] = rootB
+		}
+	}
+
+	sameTags := make(map[int]bool)
+	sameAudio := make(map[int]bool)
+	byKey := make(map[string]int)
+	byAudio := make(map[string]int)
+	for i, song := range songs {
+		key := duplicateKey(song)
+		if first, ok := byKey[key]; ok {
+			union(first, i)
+			sameTags[first], sameTags[i] = true, true
+		} else {
+			byKey[key] = i
+		}
+
+		if !fingerprinting || song.AudioHash == "" {
+			continue
+		}
+		if first, ok := byAudio[song.AudioHash]; ok {
+			union(first, i)
+			sameAudio[first], sameAudio[i] = true, true
+		} else {
+			byAudio[song.AudioHash] = i
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range songs {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+
+	dropped := make(map[int]bool)
+	var groups []DuplicateGroup
+	for i := range songs {
+		copies := members[i]
+		if len(copies) < 2 {
+			continue // not a root, or no duplicates
+		}
+
+		kept := copies[0]
+		for _, candidate := range copies[1:] {
+			if preferDuplicate(songs[candidate], songs[kept], policy) {
+				kept = candidate
+			}
+		}
+
+		group := DuplicateGroup{Kept: songs[kept], Songs: []*Song{songs[kept]}}
+		for _, index := range copies {
+			group.SameTags = group.SameTags || sameTags[index]
+			group.SameAudio = group.SameAudio || sameAudio[index]
+			if index == kept {
+				continue
+			}
+			group.Songs = append(group.Songs, songs[index])
+			if policy != DuplicatesKeepAll {
+				dropped[index] = true
+				log.Printf("🚫 [DEDUP] Skipping duplicate: %s - %s (Album: %s), keeping %s", songs[index].Artist, songs[index].Title, songs[index].Album, songs[kept].Path)
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	uniqueSongs := make([]*Song, 0, len(songs)-len(dropped))
+	for i, song := range songs {
+		if !dropped[i] {
+			uniqueSongs = append(uniqueSongs, song)
+		}
+	}
+
+	if len(groups) > 0 {
+		log.Printf("🚫 [DEDUP] Found %d duplicate groups, removed %d songs, kept %d unique songs (policy: %s)", len(groups), len(dropped), len(uniqueSongs), policy)
+	}
+	return uniqueSongs, groups
+}
+
+// preferDuplicate reports whether candidate should replace current as the kept copy;
+// ties keep the copy that comes first
+func preferDuplicate(candidate, current *Song, policy DuplicatePolicy) bool {
+	switch policy {
+	case DuplicatesPreferBitrate:
+		return candidate.Bitrate > current.Bitrate
+	case DuplicatesPreferLossless:
+		if candidate.IsLossless() != current.IsLossless() {
+			return candidate.IsLossless()
+		}
+		return candidate.Bitrate > current.Bitrate
+	case DuplicatesPreferNewest:
+		return candidate.ModTime.After(current.ModTime)
+	default:
+		return false
+	}
+}
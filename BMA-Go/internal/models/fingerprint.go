@@ -0,0 +1,234 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// AudioFingerprint hashes a file's audio data, leaving out every tag, so copies
+// that were only re-tagged (or had artwork added) get the same fingerprint. It
+// reads the whole file; the library index keeps the result.
+func AudioFingerprint(filePath string, format *AudioFormat) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := stat.Size()
+
+	hasher := sha1.New()
+	switch format {
+	case FormatMP3, FormatAAC:
+		err = hashMPEGAudio(hasher, file, size)
+	case FormatFLAC:
+		err = hashFLACAudio(hasher, file, size)
+	case FormatM4A:
+		err = hashMP4Audio(hasher, file, size)
+	case FormatOgg, FormatOpus:
+		err = hashOggAudio(hasher, file)
+	case FormatWAV:
+		err = hashWAVAudio(hasher, file, size)
+	default:
+		return "", fmt.Errorf("no audio fingerprint for %v", format)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hashRange feeds bytes [start, end) of a file to the hasher
+func hashRange(hasher hash.Hash, file *os.File, start, end int64) error {
+	if end <= start {
+		return errNoAudioInfo
+	}
+	_, err := io.Copy(hasher, io.NewSectionReader(file, start, end-start))
+	return err
+}
+
+// hashMPEGAudio hashes the frames between a leading ID3v2 tag and trailing APEv2
+// and ID3v1 tags
+func hashMPEGAudio(hasher hash.Hash, file *os.File, size int64) error {
+	start := skipID3v2(file)
+	end := size
+	if hasID3v1(file, end) {
+		end -= 128
+	}
+
+	// APEv2 ends in a 32-byte footer whose size field covers the items and footer,
+	// plus a 32-byte header when flagged
+	footer := make([]byte, 32)
+	if end-start >= 32 {
+		if _, err := file.ReadAt(footer, end-32); err == nil && bytes.HasPrefix(footer, []byte("APETAGEX")) {
+			tagSize := int64(binary.LittleEndian.Uint32(footer[12:16]))
+			if flags := binary.LittleEndian.Uint32(footer[20:24]); flags&(1<<31) != 0 {
+				tagSize += 32
+			}
+			if tagSize <= end-start {
+				end -= tagSize
+			}
+		}
+	}
+	return hashRange(hasher, file, start, end)
+}
+
+// hashFLACAudio hashes the frames after the metadata blocks (STREAMINFO, Vorbis
+// comments, pictures, padding)
+func hashFLACAudio(hasher hash.Hash, file *os.File, size int64) error {
+	pos := skipID3v2(file)
+
+	marker := make([]byte, 4)
+	if _, err := file.ReadAt(marker, pos); err != nil {
+		return err
+	}
+	if string(marker) != "fLaC" {
+		return errors.New("missing fLaC marker")
+	}
+	pos += 4
+
+	header := make([]byte, 4)
+	for {
+		if _, err := file.ReadAt(header, pos); err != nil {
+			return err
+		}
+		last := header[0]&0x80 != 0
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		pos += 4 + length
+		if last || pos >= size {
+			break
+		}
+	}
+
+	end := size
+	if hasID3v1(file, end) {
+		end -= 128
+	}
+	return hashRange(hasher, file, pos, end)
+}
+
+// hashMP4Audio hashes the top-level mdat boxes; tags live in moov/udta
+func hashMP4Audio(hasher hash.Hash, file *os.File, size int64) error {
+	found := false
+	header := make([]byte, 16)
+	for pos := int64(0); pos+8 <= size; {
+		if _, err := file.ReadAt(header[:8], pos); err != nil {
+			return err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[0:4]))
+		boxType := string(header[4:8])
+		headerLen := int64(8)
+
+		switch boxSize {
+		case 0: // box extends to the end of the file
+			boxSize = size - pos
+		case 1: // 64-bit size follows the type
+			if _, err := file.ReadAt(header[8:16], pos+8); err != nil {
+				return err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+		if boxSize < headerLen || pos+boxSize > size {
+			return fmt.Errorf("malformed %q box at offset %d", boxType, pos)
+		}
+
+		if boxType == "mdat" {
+			if err := hashRange(hasher, file, pos+headerLen, pos+boxSize); err != nil {
+				return err
+			}
+			found = true
+		}
+		pos += boxSize
+	}
+
+	if !found {
+		return errors.New("missing mdat box")
+	}
+	return nil
+}
+
+// hashOggAudio hashes the payload of every audio page. Header packets (including
+// the comment packet holding the tags) sit on pages with granule position 0, and
+// audio always starts on a fresh page, so re-tagging doesn't shift the audio pages.
+// Page headers are left out since their sequence numbers and checksums change when
+// the comment packet grows.
+func hashOggAudio(hasher hash.Hash, file *os.File) error {
+	reader := bufio.NewReaderSize(file, 64*1024)
+	header := make([]byte, 27)
+	segments := make([]byte, 255)
+	hashed := false
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF && hashed {
+				return nil
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errNoAudioInfo
+			}
+			return err
+		}
+		if !isOggPage(header) {
+			return errors.New("lost Ogg page sync")
+		}
+
+		count := int(header[26])
+		if _, err := io.ReadFull(reader, segments[:count]); err != nil {
+			return err
+		}
+		var payload int64
+		for _, segment := range segments[:count] {
+			payload += int64(segment)
+		}
+
+		granule := binary.LittleEndian.Uint64(header[6:14])
+		if granule == 0 {
+			if _, err := reader.Discard(int(payload)); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.CopyN(hasher, reader, payload); err != nil {
+			return err
+		}
+		hashed = true
+	}
+}
+
+// hashWAVAudio hashes the data chunk; LIST/INFO and id3 chunks are skipped
+func hashWAVAudio(hasher hash.Hash, file *os.File, size int64) error {
+	chunk := make([]byte, 8)
+	for pos := int64(12); pos+8 <= size; {
+		if _, err := file.ReadAt(chunk, pos); err != nil {
+			return err
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		pos += 8
+
+		if string(chunk[0:4]) == "data" {
+			end := pos + chunkSize
+			// Streaming encoders sometimes leave the size as 0 or 0xFFFFFFFF
+			if chunkSize == 0 || end > size {
+				end = size
+			}
+			return hashRange(hasher, file, pos, end)
+		}
+
+		// Chunks are padded to an even length
+		pos += chunkSize + chunkSize%2
+	}
+	return errors.New("missing data chunk")
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffHeaderSize is how many bytes (after any leading ID3v2 tag) are read to sniff a format
+const sniffHeaderSize = 64
+
+// AudioFormat describes one supported audio format
+type AudioFormat struct {
+	Name       string   // short identifier sent to clients ("mp3", "flac", ...)
+	MimeType   string   // Content-Type used when streaming
+	Extensions []string // lower-case file extensions, including the dot
+	Lossless   bool     // always lossless (FLAC, WAV); ALAC in .m4a can't be told apart without decoding
+	sniff      func(header []byte) bool
+}
+
+// Supported formats. Order matters for sniffing: more specific signatures
+// (Opus inside Ogg) must come before the generic ones (any Ogg stream).
+var (
+	FormatMP3 = &AudioFormat{
+		Name:       "mp3",
+		MimeType:   "audio/mpeg",
+		Extensions: []string{".mp3"},
+		sniff:      isMPEGAudioFrame,
+	}
+	FormatFLAC = &AudioFormat{
+		Name:       "flac",
+		MimeType:   "audio/flac",
+		Extensions: []string{".flac"},
+		Lossless:   true,
+		sniff: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte("fLaC"))
+		},
+	}
+	FormatM4A = &AudioFormat{
+		Name:       "m4a",
+		MimeType:   "audio/mp4",
+		Extensions: []string{".m4a", ".mp4", ".m4b"},
+		sniff: func(header []byte) bool {
+			return len(header) >= 8 && string(header[4:8]) == "ftyp"
+		},
+	}
+	FormatAAC = &AudioFormat{
+		Name:       "aac",
+		MimeType:   "audio/aac",
+		Extensions: []string{".aac"},
+		sniff:      isADTSFrame,
+	}
+	FormatOpus = &AudioFormat{
+		Name:       "opus",
+		MimeType:   "audio/ogg; codecs=opus",
+		Extensions: []string{".opus"},
+		sniff: func(header []byte) bool {
+			return isOggPage(header) && bytes.Contains(header, []byte("OpusHead"))
+		},
+	}
+	FormatOgg = &AudioFormat{
+		Name:       "ogg",
+		MimeType:   "audio/ogg",
+		Extensions: []string{".ogg", ".oga"},
+		sniff:      isOggPage,
+	}
+	FormatWAV = &AudioFormat{
+		Name:       "wav",
+		MimeType:   "audio/wav",
+		Extensions: []string{".wav"},
+		Lossless:   true,
+		sniff: func(header []byte) bool {
+			return len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE"
+		},
+	}
+)
+
+// audioFormats is the format registry, in sniffing order
+var audioFormats = []*AudioFormat{FormatFLAC, FormatM4A, FormatOpus, FormatOgg, FormatWAV, FormatMP3, FormatAAC}
+
+// FormatForExtension returns the format registered for a file extension, or nil
+func FormatForExtension(ext string) *AudioFormat {
+	ext = strings.ToLower(ext)
+	for _, format := range audioFormats {
+		for _, candidate := range format.Extensions {
+			if candidate == ext {
+				return format
+			}
+		}
+	}
+	return nil
+}
+
+// FormatByName returns the format with the given short name, or nil
+func FormatByName(name string) *AudioFormat {
+	for _, format := range audioFormats {
+		if format.Name == name {
+			return format
+		}
+	}
+	return nil
+}
+
+// IsSupportedAudioFile reports whether a file name has a supported audio extension
+func IsSupportedAudioFile(name string) bool {
+	// Skip Mac resource fork files (._filename.mp3)
+	if strings.HasPrefix(name, "._") {
+		return false
+	}
+	return FormatForExtension(filepath.Ext(name)) != nil
+}
+
+// DetectFormat works out a file's format from its contents, falling back to the
+// extension when the header isn't recognised. Content wins over the extension, so
+// an AAC stream saved as .mp3 is still served with the right MIME type.
+func DetectFormat(filePath string) *AudioFormat {
+	byExtension := FormatForExtension(filepath.Ext(filePath))
+
+	header, err := readAudioHeader(filePath)
+	if err != nil {
+		log.Printf("⚠️ [FORMAT] Failed to read header of %s: %v", filePath, err)
+		return byExtension
+	}
+
+	sniffed := sniffFormat(header)
+	if sniffed == nil {
+		return byExtension
+	}
+
+	if byExtension != nil && sniffed != byExtension {
+		log.Printf("⚠️ [FORMAT] %s looks like %s, not %s", filepath.Base(filePath), sniffed.Name, byExtension.Name)
+	}
+	return sniffed
+}
+
+// sniffFormat matches a file header against the registry
+func sniffFormat(header []byte) *AudioFormat {
+	for _, format := range audioFormats {
+		if format.sniff != nil && format.sniff(header) {
+			return format
+		}
+	}
+	return nil
+}
+
+// readAudioHeader reads the first bytes of a file, skipping a leading ID3v2 tag
+// (FLAC and AAC files are sometimes tagged that way too)
+func readAudioHeader(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffHeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	if tagSize := id3v2Size(header); tagSize > 0 {
+		if _, err := file.Seek(tagSize, io.SeekStart); err != nil {
+			return nil, err
+		}
+		header = header[:cap(header)]
+		n, err = io.ReadFull(file, header)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		header = header[:n]
+	}
+
+	return header, nil
+}
+
+// id3v2Size returns the total size of an ID3v2 tag at the start of header, or 0
+func id3v2Size(header []byte) int64 {
+	if len(header) < 10 || string(header[0:3]) != "ID3" {
+		return 0
+	}
+
+	// Synchsafe integer: 7 bits per byte
+	size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10 // footer present
+	}
+	return size
+}
+
+// isMPEGAudioFrame checks for an MPEG audio frame sync with layer III
+func isMPEGAudioFrame(header []byte) bool {
+	if len(header) < 4 || header[0] != 0xff || header[1]&0xe0 != 0xe0 {
+		return false
+	}
+	version := (header[1] >> 3) & 0x03
+	layer := (header[1] >> 1) & 0x03
+	bitrate := header[2] >> 4
+	return version != 0x01 && layer == 0x01 && bitrate != 0x0f
+}
+
+// isADTSFrame checks for an AAC ADTS frame sync (same sync word as MPEG, layer 0)
+func isADTSFrame(header []byte) bool {
+	return len(header) >= 7 && header[0] == 0xff && header[1]&0xf6 == 0xf0
+}
+
+// isOggPage checks for an Ogg page capture pattern
+func isOggPage(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("OggS"))
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// HLSSegmentDuration is the length of every HLS segment but a song's last one
+const HLSSegmentDuration = 6 * time.Second
+
+// HLSBitrates is the AAC bitrate ladder, in kbps, every song is offered at
+var HLSBitrates = []int{64, 128, 192}
+
+// FormatMPEGTS is the container HLS segments are sent in. It's only produced by
+// the transcoder, so it isn't in the registry scanned files are matched against.
+var FormatMPEGTS = &AudioFormat{
+	Name:       "ts",
+	MimeType:   "video/mp2t",
+	Extensions: []string{".ts"},
+}
+
+// HLSVariant is one stream of a song's HLS master playlist
+type HLSVariant struct {
+	Name      string // path element in the variant's URLs ("128k", "source")
+	Bitrate   int    // in kbps
+	Codecs    string // RFC 6381 codec string for the CODECS attribute
+	CopyAudio bool   // segments carry the original audio, only repackaged
+}
+
+// HLSVariants returns the streams a song is offered as: the AAC ladder, plus the
+// original audio when it's MP3 or AAC and can go into MPEG-TS unchanged
+func HLSVariants(song *Song) []HLSVariant {
+	variants := make([]HLSVariant, 0, len(HLSBitrates)+1)
+	for _, bitrate := range HLSBitrates {
+		variants = append(variants, HLSVariant{
+			Name:    fmt.Sprintf("%dk", bitrate),
+			Bitrate: bitrate,
+			Codecs:  "mp4a.40.2",
+		})
+	}
+
+	if song.Bitrate > 0 {
+		switch song.Format {
+		case FormatMP3.Name:
+			variants = append(variants, HLSVariant{Name: "source", Bitrate: song.Bitrate, Codecs: "mp4a.40.34", CopyAudio: true})
+		case FormatAAC.Name:
+			variants = append(variants, HLSVariant{Name: "source", Bitrate: song.Bitrate, Codecs: "mp4a.40.2", CopyAudio: true})
+		}
+	}
+	return variants
+}
+
+// HLSVariantByName returns the named variant of a song, if it's offered
+func HLSVariantByName(song *Song, name string) (HLSVariant, bool) {
+	for _, variant := range HLSVariants(song) {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return HLSVariant{}, false
+}
+
+// HLSSegmentCount returns how many segments a song is split into
+func HLSSegmentCount(song *Song) int {
+	if song.Duration <= 0 {
+		return 0
+	}
+	return int((song.Duration + HLSSegmentDuration - 1) / HLSSegmentDuration)
+}
+
+// HLSSegmentLength returns the length of one segment; only the last is shorter
+func HLSSegmentLength(song *Song, index int) time.Duration {
+	offset := time.Duration(index) * HLSSegmentDuration
+	if remaining := song.Duration - offset; remaining < HLSSegmentDuration {
+		return remaining
+	}
+	return HLSSegmentDuration
+}
+
+// SegmentOptions returns the transcode that produces one segment of the variant
+func (v HLSVariant) SegmentOptions(song *Song, index int) TranscodeOptions {
+	return TranscodeOptions{
+		Format:     FormatMPEGTS,
+		MaxBitrate: v.Bitrate,
+		CopyAudio:  v.CopyAudio,
+		Offset:     time.Duration(index) * HLSSegmentDuration,
+		Length:     HLSSegmentLength(song, index),
+	}
+}
@@ -0,0 +1,562 @@
+package models
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// libraryIndexVersion is bumped whenever the on-disk index format changes incompatibly
+const libraryIndexVersion = 1
+
+// indexEntryRevision is bumped when entries gain fields that can only be filled by
+// re-reading the file. Older entries are re-read on the next scan but keep their IDs.
+const indexEntryRevision = 5
+
+// contentHashChunk is how much of the head and tail of a file feeds its content hash
+const contentHashChunk = 64 * 1024
+
+// Namespaces for deterministic (UUIDv5) IDs. Never change these - every client
+// keys playlists, downloads and stats on the IDs derived from them.
+var (
+	songIDNamespace     = uuid.MustParse("5b1c6f0e-2d0a-4f6e-9a51-7c3f3f8e1b01")
+	albumIDNamespace    = uuid.MustParse("5b1c6f0e-2d0a-4f6e-9a51-7c3f3f8e1b02")
+	artistIDNamespace   = uuid.MustParse("5b1c6f0e-2d0a-4f6e-9a51-7c3f3f8e1b03")
+	folderIDNamespace   = uuid.MustParse("5b1c6f0e-2d0a-4f6e-9a51-7c3f3f8e1b04")
+	playlistIDNamespace = uuid.MustParse("5b1c6f0e-2d0a-4f6e-9a51-7c3f3f8e1b05")
+)
+
+// StableSongID derives a song ID from its file path, so the same file always gets the same ID
+func StableSongID(filePath string) uuid.UUID {
+	return uuid.NewSHA1(songIDNamespace, []byte(filepath.ToSlash(filepath.Clean(filePath))))
+}
+
+// StableAlbumID derives an album ID from its grouping key (case-insensitive)
+func StableAlbumID(key string) uuid.UUID {
+	return uuid.NewSHA1(albumIDNamespace, []byte(strings.ToLower(strings.TrimSpace(key))))
+}
+
+// StableArtistID derives an artist ID from the artist name (case-insensitive)
+func StableArtistID(name string) uuid.UUID {
+	return uuid.NewSHA1(artistIDNamespace, []byte(strings.ToLower(strings.TrimSpace(name))))
+}
+
+// StableFolderID derives a folder ID from its directory path
+func StableFolderID(dirPath string) uuid.UUID {
+	return uuid.NewSHA1(folderIDNamespace, []byte(filepath.ToSlash(filepath.Clean(dirPath))))
+}
+
+// StablePlaylistID derives the ID of a playlist imported from a file from its path
+func StablePlaylistID(filePath string) uuid.UUID {
+	return uuid.NewSHA1(playlistIDNamespace, []byte(filepath.ToSlash(filepath.Clean(filePath))))
+}
+
+// IndexEntry is the persisted record for one audio file. Title through Genre hold
+// the tag values as read; LibraryRules are applied when the entry is loaded, so
+// changing the rules never needs the files re-read.
+type IndexEntry struct {
+	Revision    int           `json:"rev,omitempty"`
+	ID          uuid.UUID     `json:"id"`
+	Path        string        `json:"path"`
+	Size        int64         `json:"size"`
+	ModTime     time.Time     `json:"modTime"`
+	ContentHash string        `json:"contentHash,omitempty"`
+	Title       string        `json:"title"`
+	Artist      string        `json:"artist,omitempty"`
+	Album       string        `json:"album,omitempty"`
+	TrackNumber int           `json:"trackNumber,omitempty"`
+	TrackTotal  int           `json:"trackTotal,omitempty"`
+	DiscNumber  int           `json:"discNumber,omitempty"`
+	DiscTotal   int           `json:"discTotal,omitempty"`
+	AlbumArtist string        `json:"albumArtist,omitempty"`
+	Year        int           `json:"year,omitempty"`
+	Genre       string        `json:"genre,omitempty"`
+	Composer    string        `json:"composer,omitempty"`
+	Compilation bool          `json:"compilation,omitempty"`
+	Format      string        `json:"format,omitempty"`
+	Duration    time.Duration `json:"duration,omitempty"`
+	Bitrate     int           `json:"bitrate,omitempty"`
+	SampleRate  int           `json:"sampleRate,omitempty"`
+	Channels    int           `json:"channels,omitempty"`
+	HasArtwork  bool          `json:"hasArtwork,omitempty"`
+	ArtworkHash string        `json:"artworkHash,omitempty"` // key into the artwork cache
+	AudioHash   string        `json:"audioHash,omitempty"`   // AudioFingerprint, filled in once fingerprinting is on
+	AddedAt     time.Time     `json:"addedAt"`               // when the file first appeared in the library
+}
+
+// LibraryIndex is the on-disk cache of scanned files and their stable IDs.
+// It lets a restart reuse IDs and tag data instead of re-reading every file.
+type LibraryIndex struct {
+	mutex   sync.RWMutex
+	path    string
+	dirty   bool
+	Version int                    `json:"version"`
+	Entries map[string]*IndexEntry `json:"entries"`          // keyed by absolute file path
+	Covers  map[string]*CoverEntry `json:"covers,omitempty"` // folder cover images, keyed by absolute file path
+}
+
+// CoverEntry remembers the artwork cache hash of a cover image, so unchanged
+// covers aren't re-read on every scan
+type CoverEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash"`
+}
+
+// GetLibraryIndexPath returns the path to the library index file
+func GetLibraryIndexPath() (string, error) {
+	dataDir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "library_index.json"), nil
+}
+
+// LoadLibraryIndex loads the library index from disk, returning an empty index if
+// none exists or it can't be read (the next scan simply rebuilds it)
+func LoadLibraryIndex() *LibraryIndex {
+	index := &LibraryIndex{
+		Version: libraryIndexVersion,
+		Entries: make(map[string]*IndexEntry),
+		Covers:  make(map[string]*CoverEntry),
+	}
+
+	indexPath, err := GetLibraryIndexPath()
+	if err != nil {
+		log.Printf("⚠️ [INDEX] Cannot resolve index path: %v", err)
+		return index
+	}
+	index.path = indexPath
+
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️ [INDEX] Failed to read library index: %v", err)
+		}
+		return index
+	}
+
+	var stored LibraryIndex
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Printf("⚠️ [INDEX] Library index is corrupt, starting fresh: %v", err)
+		return index
+	}
+
+	if stored.Version != libraryIndexVersion {
+		log.Printf("⚠️ [INDEX] Library index version %d unsupported, starting fresh", stored.Version)
+		return index
+	}
+
+	for path, entry := range stored.Entries {
+		if entry != nil {
+			index.Entries[path] = entry
+		}
+	}
+	for path, cover := range stored.Covers {
+		if cover != nil {
+			index.Covers[path] = cover
+		}
+	}
+
+	log.Printf("📇 [INDEX] Loaded library index with %d entries", len(index.Entries))
+	return index
+}
+
+// Save writes the index to disk if anything changed since the last save
+func (idx *LibraryIndex) Save() error {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	if !idx.dirty || idx.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed to encode library index: %w", err)
+	}
+
+	if err := WriteFileAtomic(idx.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write library index: %w", err)
+	}
+
+	idx.dirty = false
+	log.Printf("📇 [INDEX] Saved library index (%d entries)", len(idx.Entries))
+	return nil
+}
+
+// Lookup returns the entry for a path, or nil if the file hasn't been indexed
+func (idx *LibraryIndex) Lookup(filePath string) *IndexEntry {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return idx.Entries[filePath]
+}
+
+// Put records the current state of a song's file in the index
+func (idx *LibraryIndex) Put(song *Song, info os.FileInfo, contentHash string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.Entries[song.Path] = &IndexEntry{
+		Revision:    indexEntryRevision,
+		ID:          song.ID,
+		Path:        song.Path,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ContentHash: contentHash,
+		Title:       song.tags.Title,
+		Artist:      song.tags.Artist,
+		Album:       song.tags.Album,
+		TrackNumber: song.tags.TrackNumber,
+		TrackTotal:  song.TrackTotal,
+		DiscNumber:  song.tags.DiscNumber,
+		DiscTotal:   song.DiscTotal,
+		AlbumArtist: song.tags.AlbumArtist,
+		Year:        song.tags.Year,
+		Genre:       song.tags.Genre,
+		Composer:    song.Composer,
+		Compilation: song.Compilation,
+		Format:      song.Format,
+		Duration:    song.Duration,
+		Bitrate:     song.Bitrate,
+		SampleRate:  song.SampleRate,
+		Channels:    song.Channels,
+		HasArtwork:  song.HasArtwork(),
+		ArtworkHash: song.ArtworkHash,
+		AudioHash:   song.AudioHash,
+		AddedAt:     song.AddedAt,
+	}
+	idx.dirty = true
+}
+
+// setAudioHash stores a fingerprint computed for a file indexed without one
+func (idx *LibraryIndex) setAudioHash(filePath, audioHash string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	if entry := idx.Entries[filePath]; entry != nil && entry.AudioHash != audioHash {
+		entry.AudioHash = audioHash
+		idx.dirty = true
+	}
+}
+
+// claimMoved looks for an entry with the same content whose file no longer exists,
+// which means the file was moved or renamed and should keep its old ID. The entry
+// is removed in the same step, so two files read at once can't both claim it.
+func (idx *LibraryIndex) claimMoved(contentHash string) *IndexEntry {
+	if contentHash == "" {
+		return nil
+	}
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	for path, entry := range idx.Entries {
+		if entry.ContentHash != contentHash {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(idx.Entries, path)
+			idx.dirty = true
+			return entry
+		}
+	}
+	return nil
+}
+
+// Remove drops a single path from the index
+func (idx *LibraryIndex) Remove(filePath string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	if _, exists := idx.Entries[filePath]; exists {
+		delete(idx.Entries, filePath)
+		idx.dirty = true
+	}
+}
+
+// HasEntriesBelow reports whether any indexed song lives under root
+func (idx *LibraryIndex) HasEntriesBelow(root string) bool {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	for path := range idx.Entries {
+		if isWithinRoot(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prune removes entries under root that weren't seen in the latest scan
+func (idx *LibraryIndex) Prune(root string, seen map[string]bool) int {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	removed := 0
+	for path := range idx.Entries {
+		if !isWithinRoot(path, root) || seen[path] {
+			continue
+		}
+		delete(idx.Entries, path)
+		removed++
+	}
+	for path := range idx.Covers {
+		if !isWithinRoot(path, root) {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(idx.Covers, path)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		idx.dirty = true
+		log.Printf("📇 [INDEX] Pruned %d stale entries", removed)
+	}
+	return removed
+}
+
+// PruneOutside removes entries that aren't below any of the given roots, which is
+// what's left of a music folder removed from the library. Disabled and offline
+// roots should still be passed, so their entries survive until they're back.
+func (idx *LibraryIndex) PruneOutside(roots []string) int {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	within := func(path string) bool {
+		for _, root := range roots {
+			if isWithinRoot(path, root) {
+				return true
+			}
+		}
+		return false
+	}
+
+	removed := 0
+	for path := range idx.Entries {
+		if !within(path) {
+			delete(idx.Entries, path)
+			removed++
+		}
+	}
+	for path := range idx.Covers {
+		if !within(path) {
+			delete(idx.Covers, path)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		idx.dirty = true
+		log.Printf("📇 [INDEX] Pruned %d entries outside the music folders", removed)
+	}
+	return removed
+}
+
+// coverHash returns the cached hash of a cover image if the file hasn't changed
+func (idx *LibraryIndex) coverHash(coverPath string, info os.FileInfo) (string, bool) {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	cover := idx.Covers[coverPath]
+	if cover == nil || cover.Size != info.Size() || !cover.ModTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	return cover.Hash, true
+}
+
+// putCover records the hash of a cover image
+func (idx *LibraryIndex) putCover(coverPath string, info os.FileInfo, hash string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.Covers[coverPath] = &CoverEntry{Size: info.Size(), ModTime: info.ModTime(), Hash: hash}
+	idx.dirty = true
+}
+
+// artworkHashes returns every artwork hash an indexed file refers to
+func (idx *LibraryIndex) artworkHashes() map[string]bool {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	hashes := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		if entry.ArtworkHash != "" {
+			hashes[entry.ArtworkHash] = true
+		}
+	}
+	for _, cover := range idx.Covers {
+		hashes[cover.Hash] = true
+	}
+	return hashes
+}
+
+// matches reports whether the file on disk is unchanged since it was indexed
+// and the entry holds every field the current revision expects
+func (e *IndexEntry) matches(info os.FileInfo) bool {
+	return e.Revision == indexEntryRevision && e.Size == info.Size() && e.ModTime.Equal(info.ModTime())
+}
+
+// addedAt returns when the file joined the library. Entries written before this was
+// recorded fall back to the file's modification time.
+func (e *IndexEntry) addedAt() time.Time {
+	if e.AddedAt.IsZero() {
+		return e.ModTime
+	}
+	return e.AddedAt
+}
+
+// toSong rebuilds a Song from cached index data without touching the file's tags.
+// The caller still applies the library rules.
+func (e *IndexEntry) toSong() *Song {
+	song := &Song{
+		ID:              e.ID,
+		Filename:        filepath.Base(e.Path),
+		Path:            e.Path,
+		TrackTotal:      e.TrackTotal,
+		DiscTotal:       e.DiscTotal,
+		Composer:        e.Composer,
+		Compilation:     e.Compilation,
+		ParentDirectory: filepath.Dir(e.Path),
+		Format:          e.Format,
+		Duration:        e.Duration,
+		Bitrate:         e.Bitrate,
+		SampleRate:      e.SampleRate,
+		Channels:        e.Channels,
+		ArtworkHash:     e.ArtworkHash,
+		AudioHash:       e.AudioHash,
+		ModTime:         e.ModTime,
+		AddedAt:         e.addedAt(),
+		tags: songTags{
+			Title:       e.Title,
+			Artist:      e.Artist,
+			Album:       e.Album,
+			AlbumArtist: e.AlbumArtist,
+			Genre:       e.Genre,
+			TrackNumber: e.TrackNumber,
+			DiscNumber:  e.DiscNumber,
+			Year:        e.Year,
+		},
+	}
+	if format := FormatByName(e.Format); format != nil {
+		song.MimeType = format.MimeType
+	}
+	return song
+}
+
+// songForFile returns a Song for an audio file, reusing the index whenever possible.
+// Unchanged files are rebuilt from the index; changed files are re-read but keep their
+// ID; new files get a path-derived ID unless their content matches a moved file.
+func (ml *MusicLibrary) songForFile(filePath string) (*Song, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := ml.libraryRules()
+	_, fingerprinting := ml.duplicateHandling()
+	root := ml.rootFor(filePath)
+	entry := ml.index.Lookup(filePath)
+	if entry != nil && entry.matches(info) {
+		song := entry.toSong()
+		song.Root = root
+		song.applyRules(relativePath(filePath, root), rules)
+		if fingerprinting && song.AudioHash == "" {
+			song.AudioHash = fingerprintSong(song)
+			ml.index.setAudioHash(filePath, song.AudioHash)
+		}
+		return song, nil
+	}
+
+	song, err := readSongFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	song.Root = root
+	song.applyRules(relativePath(filePath, root), rules)
+	song.ModTime = info.ModTime()
+	song.AddedAt = time.Now()
+	if fingerprinting {
+		song.AudioHash = fingerprintSong(song)
+	}
+
+	contentHash, err := computeContentHash(filePath, info.Size())
+	if err != nil {
+		log.Printf("⚠️ [INDEX] Failed to hash %s: %v", filePath, err)
+	}
+
+	if entry != nil {
+		// Same path, new content (re-tagged or replaced) - keep the ID
+		song.ID = entry.ID
+		song.AddedAt = entry.addedAt()
+	} else if moved := ml.index.claimMoved(contentHash); moved != nil {
+		log.Printf("📇 [INDEX] Detected moved file: %s -> %s", moved.Path, filePath)
+		song.ID = moved.ID
+		song.AddedAt = moved.addedAt()
+	}
+
+	ml.index.Put(song, info, contentHash)
+	return song, nil
+}
+
+// fingerprintSong returns a song's audio fingerprint, or "" if it can't be computed
+func fingerprintSong(song *Song) string {
+	audioHash, err := AudioFingerprint(song.Path, FormatByName(song.Format))
+	if err != nil {
+		log.Printf("⚠️ [DEDUP] No audio fingerprint for %s: %v", song.Path, err)
+		return ""
+	}
+	return audioHash
+}
+
+// computeContentHash hashes the size plus the head and tail of a file. It's cheap
+// enough to run on every new file and stable across renames and moves.
+func computeContentHash(filePath string, size int64) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha1.New()
+	fmt.Fprintf(hasher, "%d:", size)
+
+	if _, err := io.CopyN(hasher, file, contentHashChunk); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	if size > 2*contentHashChunk {
+		if _, err := file.Seek(-contentHashChunk, io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(hasher, file, contentHashChunk); err != nil && err != io.EOF {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// isWithinRoot reports whether path is root itself or somewhere beneath it
+func isWithinRoot(path, root string) bool {
+	if root == "" {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
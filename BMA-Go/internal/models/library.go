@@ -1,10 +1,10 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -12,8 +12,6 @@ import (
 	"sync"
 	"time"
 
-	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/dialog"
 	"github.com/fsnotify/fsnotify"
 	"github.com/google/uuid"
 )
@@ -23,7 +21,13 @@ type Album struct {
 	ID     uuid.UUID `json:"id"`
 	Name   string    `json:"name"`
 	Songs  []*Song   `json:"songs"`
-	Artist string    `json:"artist,omitempty"`
+	Artist string    `json:"artist,omitempty"` // album artist
+	
+	// Summarized from the tracks' tags
+	Year        int    `json:"year,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	DiscCount   int    `json:"discCount,omitempty"`
+	Compilation bool   `json:"compilation,omitempty"`
 }
 
 // DisplayItem interface for items that can be displayed in the UI (albums or folders)
@@ -34,7 +38,9 @@ type DisplayItem interface {
 	GetSongs() []*Song
 	IsFolder() bool
 	HasArtwork() bool
+	ArtworkID() string
 	GetArtwork() []byte
+	GetArtworkVariant(size int) ([]byte, error)
 }
 
 // FolderItem represents a folder containing mixed songs for UI display
@@ -55,6 +61,15 @@ func (a *Album) TrackCount() int {
 	return len(a.Songs)
 }
 
+// TotalDuration returns the combined length of all songs in the album
+func (a *Album) TotalDuration() time.Duration {
+	var total time.Duration
+	for _, song := range a.Songs {
+		total += song.Duration
+	}
+	return total
+}
+
 // FolderItem implementation of DisplayItem interface
 func (f *FolderItem) GetID() string          { return f.ID }
 func (f *FolderItem) GetName() string        { return f.FolderName }
@@ -83,6 +98,22 @@ func (f *FolderItem) GetArtwork() []byte     {
 	}
 	return nil
 }
+func (f *FolderItem) ArtworkID() string      {
+	for _, song := range f.Songs {
+		if song.HasArtwork() {
+			return song.ArtworkID()
+		}
+	}
+	return ""
+}
+func (f *FolderItem) GetArtworkVariant(size int) ([]byte, error) {
+	for _, song := range f.Songs {
+		if song.HasArtwork() {
+			return song.GetArtworkVariant(size)
+		}
+	}
+	return nil, errNoArtwork
+}
 
 // AlbumItem implementation of DisplayItem interface  
 func (a *AlbumItem) GetID() string          { return a.Album.ID.String() }
@@ -92,31 +123,103 @@ func (a *AlbumItem) GetSubtitle() string    {
 	if a.Album.TrackCount() == 1 {
 		trackText = "track"
 	}
-	return a.Album.Artist + " • " + fmt.Sprintf("%d %s", a.Album.TrackCount(), trackText)
+	subtitle := a.Album.Artist + " • " + fmt.Sprintf("%d %s", a.Album.TrackCount(), trackText)
+	if length := formatAlbumLength(a.Album.TotalDuration()); length != "" {
+		subtitle += " • " + length
+	}
+	return subtitle
 }
 func (a *AlbumItem) GetSongs() []*Song      { return a.Album.Songs }
 func (a *AlbumItem) IsFolder() bool         { return false }
 func (a *AlbumItem) HasArtwork() bool       { return a.Album.HasArtwork() }
 func (a *AlbumItem) GetArtwork() []byte     { return a.Album.GetArtwork() }
+func (a *AlbumItem) ArtworkID() string      { return a.Album.ArtworkID() }
+func (a *AlbumItem) GetArtworkVariant(size int) ([]byte, error) { return a.Album.GetArtworkVariant(size) }
 
-// GetArtwork returns the artwork from the first song that has artwork
-func (a *Album) GetArtwork() []byte {
+// formatAlbumLength formats an album's total length as "48 min" or "1 hr 12 min"
+func formatAlbumLength(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	minutes := int(d.Round(time.Minute).Minutes())
+	if minutes < 60 {
+		return fmt.Sprintf("%d min", max(minutes, 1))
+	}
+	return fmt.Sprintf("%d hr %d min", minutes/60, minutes%60)
+}
+
+// summarizeTags fills in the album's year, genre, disc count and compilation flag
+// from its tracks: the earliest year, the most common genre, the highest disc number
+func (a *Album) summarizeTags() {
+	genres := make(map[string]int)
 	for _, song := range a.Songs {
-		if song.HasArtwork() {
-			return song.GetArtwork()
+		if song.Year > 0 && (a.Year == 0 || song.Year < a.Year) {
+			a.Year = song.Year
+		}
+		if song.Genre != "" {
+			genres[song.Genre]++
+			if genres[song.Genre] > genres[a.Genre] || (genres[song.Genre] == genres[a.Genre] && song.Genre < a.Genre) {
+				a.Genre = song.Genre
+			}
+		}
+		if song.DiscTotal > a.DiscCount {
+			a.DiscCount = song.DiscTotal
+		}
+		if song.DiscNumber > a.DiscCount {
+			a.DiscCount = song.DiscNumber
+		}
+		if song.Compilation {
+			a.Compilation = true
 		}
 	}
-	return nil
+	if a.Artist == variousArtistsName {
+		a.Compilation = true
+	}
 }
 
-// HasArtwork returns true if any song in the album has artwork
-func (a *Album) HasArtwork() bool {
+// artworkSource picks the album cover: a cover image in one of the album's folders
+// wins over pictures embedded in the tracks
+func (a *Album) artworkSource() (*Song, string) {
 	for _, song := range a.Songs {
-		if song.HasArtwork() {
-			return true
+		if song.FolderArtworkHash != "" {
+			return song, song.FolderArtworkHash
 		}
 	}
-	return false
+	for _, song := range a.Songs {
+		if song.ArtworkHash != "" {
+			return song, song.ArtworkHash
+		}
+	}
+	return nil, ""
+}
+
+// ArtworkID returns the artwork cache hash of the album cover
+func (a *Album) ArtworkID() string {
+	_, hash := a.artworkSource()
+	return hash
+}
+
+// GetArtwork returns the album cover bytes if available
+func (a *Album) GetArtwork() []byte {
+	song, hash := a.artworkSource()
+	if song == nil {
+		return nil
+	}
+	return song.loadArtwork(hash)
+}
+
+// GetArtworkVariant returns the album cover scaled to fit size x size as JPEG
+func (a *Album) GetArtworkVariant(size int) ([]byte, error) {
+	song, hash := a.artworkSource()
+	if song == nil {
+		return nil, errNoArtwork
+	}
+	return song.artworkVariant(hash, size)
+}
+
+// HasArtwork returns true if the album has a cover image or any song has artwork
+func (a *Album) HasArtwork() bool {
+	return a.ArtworkID() != ""
 }
 
 // MusicLibrary manages the collection of songs and albums (equivalent to MusicLibrary.swift)
@@ -124,92 +227,96 @@ type MusicLibrary struct {
 	mutex               sync.RWMutex
 	Songs               []*Song   `json:"songs"`
 	Albums              []*Album  `json:"albums"`
-	SelectedFolderPath  string    `json:"selectedFolderPath,omitempty"`
 	IsScanning          bool      `json:"isScanning"`
 	LibraryVersion      int64     `json:"libraryVersion"`  // NEW: Unix timestamp for version tracking
 	versionMutex        sync.RWMutex                       // NEW: Separate mutex for version operations
-	watcher             *fsnotify.Watcher
+	changeLog           []changeLogEntry                   // Recent version changes for /library/changes, guarded by versionMutex
+	allSongs            map[string]*Song                   // Every scanned song by path, before deduplication
+	roots               []LibraryRoot                      // Music folders, in the configured order (see roots.go)
+	offlineRoots        map[string]bool                    // Enabled roots that couldn't be read by the last scan
+	monitoringRoots     bool                               // monitorRoots is running
+	scanMutex           sync.Mutex                         // Serializes full scans and incremental updates
+	index               *LibraryIndex                      // Persistent file index (stable IDs, cached tags)
+	artworkFilenames    []string                           // Cover image names in priority order (see covers.go)
+	rules               *LibraryRules                      // Compiled grouping and inference rules (see rules.go)
+	duplicatePolicy     DuplicatePolicy                    // Which copy of a duplicated song is listed (see duplicates.go)
+	fingerprinting      bool                               // Also match copies by audio fingerprint
+	duplicates          []DuplicateGroup                   // Duplicate groups found by the last commit
+	searchIndex         *SearchIndex                       // Rebuilt with every commit (see search.go)
+	playlists           *PlaylistStore                     // Saved and imported playlists (see playlist.go)
+	history             *PlayHistory                       // Plays reported by the devices (see history.go)
+	playStats           func(uuid.UUID) PlayStats          // Play history for smart playlists (see smartplaylist.go)
+	smartMutex          sync.Mutex                         // Serializes smart playlist refreshes
+	lastSmartRefresh    time.Time                          // When smart playlists were last evaluated, guarded by smartMutex
+	scanStatus          ScanStatus                         // Running or last full scan (see scan.go)
+	cancelScan          context.CancelFunc                 // Cancels the running full scan
+	scanGeneration      int                                // Bumped by every full scan, so only the latest clears cancelScan
+	lastProgressNotify  time.Time                          // When progress callbacks last ran
+	watchers            map[string]*fsnotify.Watcher       // One per watched root (see watcher.go)
 	isWatching          bool
-	onScanningChanged   func(bool)
+	onScanningChanged   []func(bool)
+	onScanProgress      []func(ScanProgress)
 	onLibraryChanged    []func()  // Changed to slice to support multiple callbacks
 }
 
 // NewMusicLibrary creates a new music library instance
 func NewMusicLibrary() *MusicLibrary {
+	history := LoadPlayHistory()
 	return &MusicLibrary{
 		Songs:            make([]*Song, 0),
 		Albums:           make([]*Album, 0),
+		allSongs:         make(map[string]*Song),
+		index:            LoadLibraryIndex(),
+		rules:            DefaultLibraryRules(),
+		playlists:        LoadPlaylistStore(),
 		onLibraryChanged: make([]func(), 0),
+		history:          history,
+		playStats:        history.Stats,
 	}
 }
 
-// ShowFolderSelectionDialog opens a folder selection dialog (equivalent to selectFolder() in Swift)
-func (ml *MusicLibrary) ShowFolderSelectionDialog(parentWindow fyne.Window) {
-	log.Println("📁 [DEBUG] Opening folder selection dialog...")
-	
-	// Create folder open dialog
-	folderDialog := dialog.NewFolderOpen(func(folder fyne.ListableURI, err error) {
-		log.Println("📁 [DEBUG] Folder dialog callback triggered")
-		
-		if err != nil {
-			log.Printf("❌ [LIBRARY] Error selecting folder: %v", err)
-			return
-		}
-		
-		if folder == nil {
-			log.Println("📁 [LIBRARY] No folder selected (user cancelled)")
-			return
-		}
-		
-		// Get the folder path
-		folderPath := folder.Path()
-		log.Printf("📁 [LIBRARY] User selected folder: %s", folderPath)
-		
-		// Validate the folder path
-		if folderPath == "" {
-			log.Println("❌ [LIBRARY] Empty folder path received")
-			return
-		}
-		
-		// Check if folder exists and is accessible
-		if _, err := os.Stat(folderPath); err != nil {
-			log.Printf("❌ [LIBRARY] Cannot access selected folder: %v", err)
-			return
-		}
-		
-		log.Println("📁 [DEBUG] About to call SelectFolder...")
-		
-		// Start scanning the selected folder in a goroutine to avoid blocking UI
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("🔥 [CRASH] Panic in folder scanning: %v", r)
-				}
-			}()
-			
-			ml.SelectFolder(folderPath)
-		}()
-		
-	}, parentWindow)
-	
-	log.Println("📁 [DEBUG] Configuring dialog...")
-	
-	// Configure dialog
-	folderDialog.Resize(fyne.NewSize(800, 600))        // Reasonable dialog size
-	
-	log.Println("📁 [DEBUG] Showing dialog...")
-	
-	// Show the dialog
-	folderDialog.Show()
-	
-	log.Println("📁 [DEBUG] Dialog shown successfully")
+// SetScanningChangedCallback adds a callback for scanning state changes
+func (ml *MusicLibrary) SetScanningChangedCallback(callback func(bool)) {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	ml.onScanningChanged = append(ml.onScanningChanged, callback)
 }
 
-// SetScanningChangedCallback sets the callback for scanning state changes
-func (ml *MusicLibrary) SetScanningChangedCallback(callback func(bool)) {
+// SetScanProgressCallback adds a callback for progress during a full scan
+func (ml *MusicLibrary) SetScanProgressCallback(callback func(ScanProgress)) {
 	ml.mutex.Lock()
 	defer ml.mutex.Unlock()
-	ml.onScanningChanged = callback
+	ml.onScanProgress = append(ml.onScanProgress, callback)
+}
+
+// notifyScanningChanged calls every registered scanning-state callback.
+// Must be called without holding ml.mutex to avoid deadlocks.
+func (ml *MusicLibrary) notifyScanningChanged(isScanning bool) {
+	ml.mutex.RLock()
+	callbacks := make([]func(bool), len(ml.onScanningChanged))
+	copy(callbacks, ml.onScanningChanged)
+	ml.mutex.RUnlock()
+
+	for _, callback := range callbacks {
+		if callback != nil {
+			callback(isScanning)
+		}
+	}
+}
+
+// notifyScanProgress calls every registered scan progress callback.
+// Must be called without holding ml.mutex to avoid deadlocks.
+func (ml *MusicLibrary) notifyScanProgress(progress ScanProgress) {
+	ml.mutex.RLock()
+	callbacks := make([]func(ScanProgress), len(ml.onScanProgress))
+	copy(callbacks, ml.onScanProgress)
+	ml.mutex.RUnlock()
+	
+	for _, callback := range callbacks {
+		if callback != nil {
+			callback(progress)
+		}
+	}
 }
 
 // SetLibraryChangedCallback adds a callback for library updates
@@ -219,155 +326,262 @@ func (ml *MusicLibrary) SetLibraryChangedCallback(callback func()) {
 	ml.onLibraryChanged = append(ml.onLibraryChanged, callback)
 }
 
-// SelectFolder sets the selected folder path for music scanning
-func (ml *MusicLibrary) SelectFolder(folderPath string) {
-	log.Printf("📁 [DEBUG] SelectFolder called with: %s", folderPath)
-	
-	// Stop any existing watcher before changing folders
-	ml.StopWatching()
-	
-	ml.mutex.Lock()
-	ml.SelectedFolderPath = folderPath
-	ml.mutex.Unlock()
-	
-	log.Printf("📁 [LIBRARY] Selected folder: %s", folderPath)
-	
-	// Scan the folder first
-	ml.ScanFolder()
-	
-	// Start watching for new albums after initial scan
-	if err := ml.StartWatching(); err != nil {
-		log.Printf("❌ [LIBRARY] Failed to start watching folder: %v", err)
+// notifyLibraryChanged calls every registered library-changed callback.
+// Must be called without holding ml.mutex to avoid deadlocks.
+func (ml *MusicLibrary) notifyLibraryChanged() {
+	ml.mutex.RLock()
+	callbacks := make([]func(), len(ml.onLibraryChanged))
+	copy(callbacks, ml.onLibraryChanged)
+	ml.mutex.RUnlock()
+
+	// Smart playlists first, so callbacks see them up to date
+	ml.RefreshSmartPlaylists()
+
+	for _, callback := range callbacks {
+		if callback != nil {
+			callback()
+		}
 	}
 }
 
-// ScanFolder scans the selected folder for MP3 files (equivalent to scanFolder() in Swift)
-func (ml *MusicLibrary) ScanFolder() {
+// ScanFolder scans every enabled library root for audio files. Roots that can't be
+// read are marked offline and left out; their index entries are kept for when they
+// come back.
+// The previous library stays visible to clients until the new scan is committed.
+// Files are read by a pool of workers. Starting a scan cancels one that is still
+// running, in which case the older scan returns context.Canceled and commits nothing.
+func (ml *MusicLibrary) ScanFolder() error {
 	log.Println("🔍 [DEBUG] ScanFolder started")
 	
-	ml.mutex.RLock()
-	folderPath := ml.SelectedFolderPath
-	ml.mutex.RUnlock()
+	ctx, done := ml.beginScan()
+	defer done()
 	
-	if folderPath == "" {
-		log.Println("❌ [LIBRARY] No folder selected for scanning")
-		return
+	// Serialize with incremental updates from the file system watcher
+	ml.scanMutex.Lock()
+	defer ml.scanMutex.Unlock()
+	
+	// A newer scan may have started while this one waited for the last to finish
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 	
-	log.Printf("🔍 [DEBUG] About to scan folder: %s", folderPath)
+	roots := ml.enabledRoots()
+	if len(roots) == 0 {
+		log.Println("⚠️ [LIBRARY] No music folders enabled, the library will be empty")
+	}
+	
+	log.Printf("🔍 [DEBUG] About to scan %d folders: %v", len(roots), roots)
 	
 	// Set scanning state
 	ml.mutex.Lock()
 	ml.IsScanning = true
-	ml.Songs = make([]*Song, 0)
-	ml.Albums = make([]*Album, 0)
+	ml.scanStatus = ScanStatus{Scanning: true, Roots: roots, StartedAt: time.Now()}
 	ml.mutex.Unlock()
 	
 	log.Println("🔍 [DEBUG] Set scanning state to true")
 	
 	// Notify scanning started
-	if ml.onScanningChanged != nil {
-		log.Println("🔍 [DEBUG] Calling onScanningChanged(true)")
-		ml.onScanningChanged(true)
-	}
+	ml.notifyScanningChanged(true)
 	
 	log.Println("🔍 [LIBRARY] Starting enhanced music library scan...")
 	
 	// Scan for songs
-	var discoveredSongs []*Song
-	log.Println("🔍 [DEBUG] About to call scanDirectory")
-	err := ml.scanDirectory(folderPath, &discoveredSongs)
+	log.Println("🔍 [DEBUG] About to call scanFiles")
+	discoveredSongs, playlistFiles, online, err := ml.scanFiles(ctx, roots)
 	
-	log.Printf("🔍 [DEBUG] scanDirectory completed, found %d songs", len(discoveredSongs))
+	log.Printf("🔍 [DEBUG] scanFiles completed, found %d songs", len(discoveredSongs))
 	
 	// Handle scanning errors
 	if err != nil {
-		log.Printf("❌ [LIBRARY] Error scanning folder: %v", err)
+		if errors.Is(err, context.Canceled) {
+			log.Println("🛑 [LIBRARY] Scan cancelled")
+		} else {
+			log.Printf("❌ [LIBRARY] Error scanning folder: %v", err)
+		}
 		
 		// Update state without holding mutex during callback
 		ml.mutex.Lock()
 		ml.IsScanning = false
+		ml.scanStatus.Scanning = false
+		ml.scanStatus.FinishedAt = time.Now()
+		ml.scanStatus.Cancelled = errors.Is(err, context.Canceled)
+		if !ml.scanStatus.Cancelled {
+			ml.scanStatus.Error = err.Error()
+		}
 		ml.mutex.Unlock()
 		
 		// Call callback after releasing mutex
-		if ml.onScanningChanged != nil {
-			ml.onScanningChanged(false)
+		ml.notifyScanningChanged(false)
+		return err
+	}
+	
+	// Reconcile the index with what's on disk and persist it
+	scanned := make(map[string]*Song, len(discoveredSongs))
+	seen := make(map[string]bool, len(discoveredSongs))
+	for _, song := range discoveredSongs {
+		scanned[song.Path] = song
+		seen[song.Path] = true
+	}
+	offline := make(map[string]bool)
+	for _, root := range roots {
+		if online[root] {
+			ml.index.Prune(root, seen)
+		} else {
+			offline[root] = true
 		}
-		return
 	}
+	ml.mutex.RLock()
+	configured := make([]string, len(ml.roots))
+	for i, root := range ml.roots {
+		configured[i] = root.Path
+	}
+	ml.mutex.RUnlock()
+	ml.index.PruneOutside(configured)
+	if err := ml.index.Save(); err != nil {
+		log.Printf("⚠️ [INDEX] %v", err)
+	}
+	DefaultArtworkCache().Prune(ml.index.artworkHashes())
 	
-	// Apply enhanced sorting and organization BEFORE acquiring the final lock
-	log.Println("🔍 [DEBUG] About to organize and sort songs")
-	sortedSongs := ml.organizeAndSortSongs(discoveredSongs)
+	// Sort, organize and publish the new library in one step
+	changes := ml.commitSongs(scanned)
 	
-	log.Println("🔍 [DEBUG] About to organize into albums")
-	organizedAlbums := ml.organizeIntoAlbums(sortedSongs)
+	// Playlist files in offline roots can't be read, but their playlists are kept
+	ml.importPlaylists(playlistFiles, func(sourcePath string) bool {
+		root := rootOf(sourcePath, configured)
+		return root == "" || online[root]
+	})
 	
-	// Now acquire lock only to update the final state
 	ml.mutex.Lock()
-	ml.Songs = sortedSongs
-	ml.Albums = organizedAlbums
 	ml.IsScanning = false
+	ml.offlineRoots = offline
+	ml.scanStatus.Scanning = false
+	ml.scanStatus.FinishedAt = time.Now()
 	ml.mutex.Unlock()
 	
-	log.Printf("🔍 [LIBRARY] Scan complete: %d songs in %d albums", len(sortedSongs), len(organizedAlbums))
+	log.Printf("🔍 [LIBRARY] Scan complete: %d songs in %d albums (%s)", ml.GetSongCount(), ml.GetAlbumCount(), changes.Summary())
 	ml.printLibraryDebugInfo()
 	
-	log.Println("🔍 [DEBUG] About to call callbacks")
-	
-	// Update library version since content has changed
-	ml.updateLibraryVersion()
-	
 	// Call callbacks AFTER releasing the mutex to avoid deadlock
-	if ml.onScanningChanged != nil {
-		log.Println("🔍 [DEBUG] Calling onScanningChanged(false)")
-		ml.onScanningChanged(false)
-	}
-	if len(ml.onLibraryChanged) > 0 {
-		log.Printf("🔍 [DEBUG] Calling %d onLibraryChanged callbacks", len(ml.onLibraryChanged))
-		for i, callback := range ml.onLibraryChanged {
-			if callback != nil {
-				log.Printf("🔍 [DEBUG] Calling onLibraryChanged callback %d", i+1)
-				callback()
-			}
-		}
+	ml.notifyScanningChanged(false)
+	if !changes.IsEmpty() {
+		ml.notifyLibraryChanged()
 	}
 	
 	log.Println("🔍 [DEBUG] ScanFolder completed successfully")
+	return nil
 }
 
-// scanDirectory recursively scans a directory for MP3 files (equivalent to scanDirectory in Swift)
-func (ml *MusicLibrary) scanDirectory(dirPath string, songs *[]*Song) error {
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		return fmt.Errorf("failed to read directory %s: %w", dirPath, err)
+// isAudioFile reports whether a file name looks like a playable track
+func isAudioFile(name string) bool {
+	return IsSupportedAudioFile(name)
+}
+
+// LibraryChanges describes what a scan or file system update changed, by song
+type LibraryChanges struct {
+	Added   []*Song
+	Updated []*Song
+	Removed []*Song
+}
+
+// IsEmpty returns true if nothing visible to clients changed
+func (c LibraryChanges) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Updated) == 0 && len(c.Removed) == 0
+}
+
+// Summary returns a short human-readable description for logging
+func (c LibraryChanges) Summary() string {
+	if c.IsEmpty() {
+		return "no changes"
 	}
+	return fmt.Sprintf("+%d ~%d -%d", len(c.Added), len(c.Updated), len(c.Removed))
+}
+
+// diffSongs compares two song lists by ID
+func diffSongs(previous, current []*Song) LibraryChanges {
+	var changes LibraryChanges
 	
-	for _, entry := range entries {
-		fullPath := filepath.Join(dirPath, entry.Name())
-		
-		if entry.IsDir() {
-			// Recursively scan subdirectories (album folders)
-			if err := ml.scanDirectory(fullPath, songs); err != nil {
-				log.Printf("⚠️ [LIBRARY] Warning: failed to scan subdirectory %s: %v", fullPath, err)
-				continue
-			}
-		} else if strings.HasSuffix(strings.ToLower(entry.Name()), ".mp3") {
-			// Create song from MP3 file
-			song, err := NewSongFromFile(fullPath)
-			if err != nil {
-				log.Printf("⚠️ [LIBRARY] Warning: failed to process MP3 file %s: %v", fullPath, err)
-				continue
-			}
-			*songs = append(*songs, song)
+	previousByID := make(map[string]*Song, len(previous))
+	for _, song := range previous {
+		previousByID[song.ID.String()] = song
+	}
+	
+	for _, song := range current {
+		id := song.ID.String()
+		old, existed := previousByID[id]
+		switch {
+		case !existed:
+			changes.Added = append(changes.Added, song)
+		case !old.sameMetadata(song):
+			changes.Updated = append(changes.Updated, song)
 		}
+		delete(previousByID, id)
 	}
 	
-	return nil
+	for _, song := range previous {
+		if _, stillMissing := previousByID[song.ID.String()]; stillMissing {
+			changes.Removed = append(changes.Removed, song)
+		}
+	}
+	
+	return changes
+}
+
+// commitSongs sorts, deduplicates and groups the full set of scanned songs, then
+// publishes the result. The library version only moves when clients would see a
+// difference; callers are responsible for notifying library-changed listeners.
+func (ml *MusicLibrary) commitSongs(scanned map[string]*Song) LibraryChanges {
+	sortedSongs, organizedAlbums, duplicates := ml.organize(scanned, ml.libraryRules().MinAlbumSize)
+	
+	// Search index for /search, also built before taking the lock
+	searchIndex := BuildSearchIndex(sortedSongs, organizedAlbums, groupArtists(sortedSongs, organizedAlbums))
+	
+	// Acquire lock only to swap in the final state
+	ml.mutex.Lock()
+	changes := diffSongs(ml.Songs, sortedSongs)
+	ml.allSongs = scanned
+	ml.Songs = sortedSongs
+	ml.Albums = organizedAlbums
+	ml.duplicates = duplicates
+	ml.searchIndex = searchIndex
+	ml.mutex.Unlock()
+	
+	if !changes.IsEmpty() {
+		ml.updateLibraryVersion(changes)
+	}
+	
+	return changes
+}
+
+// organize sorts, deduplicates and groups scanned songs into albums of at least
+// minAlbumSize songs, without publishing anything
+func (ml *MusicLibrary) organize(scanned map[string]*Song, minAlbumSize int) ([]*Song, []*Album, []DuplicateGroup) {
+	// Feed the sort a deterministic order so ties don't shuffle between commits
+	paths := make([]string, 0, len(scanned))
+	for path := range scanned {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	
+	songs := make([]*Song, 0, len(paths))
+	for _, path := range paths {
+		songs = append(songs, scanned[path])
+	}
+	
+	// Album membership is decided once, so sorting and grouping agree
+	groups := albumGroups(songs)
+	
+	log.Println("🔍 [DEBUG] About to organize and sort songs")
+	sortedSongs, duplicates := ml.organizeAndSortSongs(songs, groups)
+	
+	log.Println("🔍 [DEBUG] About to organize into albums")
+	organizedAlbums := ml.organizeIntoAlbums(sortedSongs, groups, minAlbumSize)
+	
+	return sortedSongs, organizedAlbums, duplicates
 }
 
 // organizeAndSortSongs applies enhanced sorting with numbered track priority (equivalent to Swift)
-func (ml *MusicLibrary) organizeAndSortSongs(songs []*Song) []*Song {
+// and drops duplicates according to the duplicate policy
+func (ml *MusicLibrary) organizeAndSortSongs(songs []*Song, groups map[*Song]albumGroup) ([]*Song, []DuplicateGroup) {
 	log.Println("🔍 [LIBRARY] Applying enhanced sorting algorithm...")
 	
 	// Create a copy to avoid modifying the original slice
@@ -403,8 +617,13 @@ func (ml *MusicLibrary) organizeAndSortSongs(songs []*Song) []*Song {
 			album2 = "Unknown Album"
 		}
 		
-		if album1 != album2 {
-			return strings.ToLower(album1) < strings.ToLower(album2)
+		if lower1, lower2 := strings.ToLower(album1), strings.ToLower(album2); lower1 != lower2 {
+			return lower1 < lower2
+		}
+		
+		// Same album name from different album artists: keep each album together
+		if artist1, artist2 := strings.ToLower(groups[song1].Artist), strings.ToLower(groups[song2].Artist); artist1 != artist2 {
+			return artist1 < artist2
 		}
 		
 		// Within same album, apply numbered track priority
@@ -422,13 +641,16 @@ func (ml *MusicLibrary) organizeAndSortSongs(songs []*Song) []*Song {
 	
 	// Apply deduplication to remove duplicate songs
 	log.Println("🔍 [LIBRARY] Applying deduplication...")
-	deduplicatedSongs := ml.deduplicate(sortedSongs)
-	
-	return deduplicatedSongs
+	return ml.deduplicate(sortedSongs)
 }
 
 // compareTracksWithNumberPriority implements lexicographic sorting with numbered track priority (01, 02, 10)
 func (ml *MusicLibrary) compareTracksWithNumberPriority(song1, song2 *Song) bool {
+	// Multi-disc albums play disc by disc
+	if disc1, disc2 := song1.SortingDisc(), song2.SortingDisc(); disc1 != disc2 {
+		return disc1 < disc2
+	}
+	
 	// First priority: Use actual track numbers from ID3 tags if available
 	if song1.TrackNumber > 0 && song2.TrackNumber > 0 {
 		if song1.TrackNumber != song2.TrackNumber {
@@ -487,96 +709,129 @@ func (ml *MusicLibrary) extractLeadingNumber(title string) *int {
 	return nil
 }
 
-// deduplicate removes duplicate songs based on metadata (Artist + Title + Album)
-func (ml *MusicLibrary) deduplicate(songs []*Song) []*Song {
-	seen := make(map[string]bool)
-	var uniqueSongs []*Song
-	duplicateCount := 0
-	
+// variousArtistsName is the album artist of compilations that don't name one
+const variousArtistsName = "Various Artists"
+
+// albumGroup identifies the album a song belongs to
+type albumGroup struct {
+	Artist string // album artist, empty when unknown
+	Name   string
+}
+
+// key is the grouping key; albums of the same name by different album artists differ
+func (g albumGroup) key() string {
+	if g.Artist == "" {
+		return strings.ToLower(g.Name)
+	}
+	return strings.ToLower(g.Artist + "/" + g.Name)
+}
+
+// albumGroups decides which album every song with an album tag belongs to, grouping on
+// (album artist, album). Songs without an album artist tag are judged with the rest of
+// their album in the same folder: a single artist there is the album artist, several
+// make it a compilation.
+func albumGroups(songs []*Song) map[*Song]albumGroup {
+	type folderAlbum struct{ dir, album string }
+	folderArtists := make(map[folderAlbum]map[string]string) // lower-case name -> name
 	for _, song := range songs {
-		// Create unique key from metadata (case-insensitive)
-		artist := strings.ToLower(strings.TrimSpace(song.Artist))
-		title := strings.ToLower(strings.TrimSpace(song.Title))
-		album := strings.ToLower(strings.TrimSpace(song.Album))
-		
-		// Handle empty metadata gracefully
-		if artist == "" {
-			artist = "unknown_artist"
+		if song.Album == "" || song.AlbumArtist != "" || song.Compilation {
+			continue
 		}
-		if title == "" {
-			title = "unknown_title"
+		key := folderAlbum{song.ParentDirectory, strings.ToLower(song.Album)}
+		if folderArtists[key] == nil {
+			folderArtists[key] = make(map[string]string)
 		}
-		if album == "" {
-			album = "unknown_album"
-		}
-		
-		key := artist + "|" + title + "|" + album
-		
-		if !seen[key] {
-			seen[key] = true
-			uniqueSongs = append(uniqueSongs, song)
-		} else {
-			duplicateCount++
-			log.Printf("🚫 [DEDUP] Skipping duplicate: %s - %s (Album: %s)", song.Artist, song.Title, song.Album)
+		if artist := strings.TrimSpace(song.InferredArtist()); artist != "" {
+			folderArtists[key][strings.ToLower(artist)] = artist
 		}
 	}
 	
-	if duplicateCount > 0 {
-		log.Printf("🚫 [DEDUP] Removed %d duplicate songs, kept %d unique songs", duplicateCount, len(uniqueSongs))
+	groups := make(map[*Song]albumGroup, len(songs))
+	for _, song := range songs {
+		if song.Album == "" {
+			continue
+		}
+		
+		group := albumGroup{Name: song.Album}
+		switch {
+		case song.AlbumArtist != "":
+			group.Artist = song.AlbumArtist
+		case song.Compilation:
+			group.Artist = variousArtistsName
+		default:
+			artists := folderArtists[folderAlbum{song.ParentDirectory, strings.ToLower(song.Album)}]
+			for _, artist := range artists {
+				group.Artist = artist
+			}
+			if len(artists) > 1 {
+				group.Artist = variousArtistsName
+			}
+		}
+		groups[song] = group
 	}
-	
-	return uniqueSongs
+	return groups
 }
 
-// organizeIntoAlbums groups songs into albums (equivalent to Swift version)
-func (ml *MusicLibrary) organizeIntoAlbums(songs []*Song) []*Album {
+// organizeIntoAlbums groups songs into albums by album artist and album name. Songs
+// arrive sorted, so each album's tracks are already in disc and track order.
+// Groups smaller than minAlbumSize are left out and listed under their folder.
+func (ml *MusicLibrary) organizeIntoAlbums(songs []*Song, groups map[*Song]albumGroup, minAlbumSize int) []*Album {
 	log.Println("🔍 [LIBRARY] Organizing songs into albums...")
 	
-	// Group songs by album name (ONLY real ID3 album metadata, ignore folder names)
+	// Group songs by album artist and album (ONLY real album tags, ignore folder names)
 	albumMap := make(map[string][]*Song)
+	var keys []string
 	
 	for _, song := range songs {
-		albumName := song.Album
-		if albumName == "" {
+		group, ok := groups[song]
+		if !ok {
 			// Skip songs without real album tags - they'll remain as standalone songs
 			continue
 		}
 		
-		albumMap[albumName] = append(albumMap[albumName], song)
+		key := group.key()
+		if _, exists := albumMap[key]; !exists {
+			keys = append(keys, key)
+		}
+		albumMap[key] = append(albumMap[key], song)
 	}
 	
-	// Create Album structs ONLY for groups with 2+ songs
+	// Create Album structs ONLY for groups with at least minAlbumSize songs
 	var albums []*Album
-	for albumName, albumSongs := range albumMap {
-		if len(albumSongs) < 2 {
-			// Skip single songs - they should become folder items instead
-			log.Printf("🔍 [LIBRARY] Skipping single song album: %s (%d song)", albumName, len(albumSongs))
+	for _, key := range keys {
+		albumSongs := albumMap[key]
+		group := groups[albumSongs[0]]
+		if len(albumSongs) < minAlbumSize {
+			// Skip small groups - they should become folder items instead
+			log.Printf("🔍 [LIBRARY] Skipping small album: %s (%d songs, need %d)", group.Name, len(albumSongs), minAlbumSize)
 			continue
 		}
 		
-		log.Printf("🔍 [LIBRARY] Creating album: %s (%d songs)", albumName, len(albumSongs))
+		log.Printf("🔍 [LIBRARY] Creating album: %s by %s (%d songs)", group.Name, group.Artist, len(albumSongs))
 		
-		// Determine album artist (use first song's artist)
-		var artist string
-		if len(albumSongs) > 0 {
-			artist = albumSongs[0].Artist
-			if artist == "" {
-				artist = albumSongs[0].InferredArtist()
-			}
+		// Without an album artist, fall back to the first song's artist
+		artist := group.Artist
+		if artist == "" {
+			artist = albumSongs[0].InferredArtist()
 		}
 		
 		album := &Album{
-			ID:     uuid.New(),
-			Name:   albumName,
+			ID:     StableAlbumID(key),
+			Name:   group.Name,
 			Songs:  albumSongs,
 			Artist: artist,
 		}
+		album.summarizeTags()
 		albums = append(albums, album)
 	}
 	
-	// Sort albums by name
-	sort.Slice(albums, func(i, j int) bool {
-		return strings.ToLower(albums[i].Name) < strings.ToLower(albums[j].Name)
+	// Sort albums by name, then album artist
+	sort.SliceStable(albums, func(i, j int) bool {
+		name1, name2 := strings.ToLower(albums[i].Name), strings.ToLower(albums[j].Name)
+		if name1 != name2 {
+			return name1 < name2
+		}
+		return strings.ToLower(albums[i].Artist) < strings.ToLower(albums[j].Artist)
 	})
 	
 	log.Printf("🔍 [LIBRARY] Created %d albums from %d song groups", len(albums), len(albumMap))
@@ -613,7 +868,7 @@ func (ml *MusicLibrary) printLibraryDebugInfo() {
 	log.Println("🔍 [LIBRARY DEBUG] ===================================")
 }
 
-// GetSongByID finds a song by its UUID (equivalent to getSong(by:) in Swift)
+// GetSongByID finds a song by its stable ID (equivalent to getSong(by:) in Swift)
 func (ml *MusicLibrary) GetSongByID(id string) *Song {
 	ml.mutex.RLock()
 	defer ml.mutex.RUnlock()
@@ -675,155 +930,6 @@ func min(a, b int) int {
 	return b
 }
 
-// StartWatching initializes and starts the file system watcher for automatic album detection
-func (ml *MusicLibrary) StartWatching() error {
-	ml.mutex.Lock()
-	defer ml.mutex.Unlock()
-	
-	// Don't start if already watching
-	if ml.isWatching {
-		log.Println("👀 [WATCHER] Already watching folder")
-		return nil
-	}
-	
-	// Don't start if no folder selected
-	if ml.SelectedFolderPath == "" {
-		log.Println("👀 [WATCHER] No folder selected, cannot start watching")
-		return nil
-	}
-	
-	// Create new watcher
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Printf("❌ [WATCHER] Failed to create watcher: %v", err)
-		return err
-	}
-	
-	ml.watcher = watcher
-	ml.isWatching = true
-	
-	// Add the selected folder to watcher
-	err = ml.watcher.Add(ml.SelectedFolderPath)
-	if err != nil {
-		log.Printf("❌ [WATCHER] Failed to watch folder %s: %v", ml.SelectedFolderPath, err)
-		ml.watcher.Close()
-		ml.watcher = nil
-		ml.isWatching = false
-		return err
-	}
-	
-	log.Printf("👀 [WATCHER] Started watching folder: %s", ml.SelectedFolderPath)
-	
-	// Start the event processing goroutine
-	go ml.watchEvents()
-	
-	return nil
-}
-
-// StopWatching stops the file system watcher and cleans up resources
-func (ml *MusicLibrary) StopWatching() {
-	ml.mutex.Lock()
-	defer ml.mutex.Unlock()
-	
-	if !ml.isWatching || ml.watcher == nil {
-		return
-	}
-	
-	log.Println("👀 [WATCHER] Stopping file system watcher")
-	
-	// Close the watcher
-	ml.watcher.Close()
-	ml.watcher = nil
-	ml.isWatching = false
-	
-	log.Println("👀 [WATCHER] File system watcher stopped")
-}
-
-// watchEvents processes file system events in a separate goroutine
-func (ml *MusicLibrary) watchEvents() {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("🔥 [WATCHER] Panic in event processing: %v", r)
-		}
-	}()
-	
-	for {
-		ml.mutex.RLock()
-		watcher := ml.watcher
-		isWatching := ml.isWatching
-		ml.mutex.RUnlock()
-		
-		if !isWatching || watcher == nil {
-			log.Println("👀 [WATCHER] Stopping event loop - watcher closed")
-			return
-		}
-		
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				log.Println("👀 [WATCHER] Events channel closed")
-				return
-			}
-			ml.handleFileSystemEvent(event)
-			
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				log.Println("👀 [WATCHER] Errors channel closed")
-				return
-			}
-			log.Printf("❌ [WATCHER] File system error: %v", err)
-		}
-	}
-}
-
-// handleFileSystemEvent processes individual file system events
-func (ml *MusicLibrary) handleFileSystemEvent(event fsnotify.Event) {
-	log.Printf("👀 [WATCHER] Event: %s %s", event.Op.String(), event.Name)
-	
-	// Only handle directory creation events
-	if event.Op&fsnotify.Create == fsnotify.Create {
-		// Check if it's a directory
-		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-			log.Printf("👀 [WATCHER] New directory detected: %s", event.Name)
-			
-			// Check if the directory contains music files
-			if ml.isDirectoryWithMusic(event.Name) {
-				log.Printf("🎵 [WATCHER] New album detected: %s", event.Name)
-				
-				// Trigger a full library rescan
-				go func() {
-					log.Println("🔍 [WATCHER] Triggering automatic library rescan...")
-					ml.ScanFolder()
-				}()
-			} else {
-				log.Printf("📁 [WATCHER] Directory contains no music files: %s", event.Name)
-			}
-		}
-	}
-}
-
-// isDirectoryWithMusic checks if a directory contains MP3 files
-func (ml *MusicLibrary) isDirectoryWithMusic(dirPath string) bool {
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		log.Printf("❌ [WATCHER] Cannot read directory %s: %v", dirPath, err)
-		return false
-	}
-	
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			filename := strings.ToLower(entry.Name())
-			if strings.HasSuffix(filename, ".mp3") {
-				log.Printf("🎵 [WATCHER] Found MP3 file: %s", entry.Name())
-				return true
-			}
-		}
-	}
-	
-	log.Printf("📁 [WATCHER] No MP3 files found in: %s", dirPath)
-	return false
-}
-
 // Library Version Management Methods (NEW for automatic refresh detection)
 
 // GetLibraryVersion returns the current library version timestamp (thread-safe)
@@ -833,11 +939,18 @@ func (ml *MusicLibrary) GetLibraryVersion() int64 {
 	return ml.LibraryVersion
 }
 
-// updateLibraryVersion sets the library version to current timestamp (called internally)
-func (ml *MusicLibrary) updateLibraryVersion() {
+// updateLibraryVersion sets the library version to current timestamp and records the
+// changes in the changelog (called internally, only on real changes)
+func (ml *MusicLibrary) updateLibraryVersion(changes LibraryChanges) {
 	ml.versionMutex.Lock()
 	defer ml.versionMutex.Unlock()
-	ml.LibraryVersion = time.Now().Unix()
+	// Keep versions strictly increasing even when two changes land in the same second
+	next := time.Now().Unix()
+	if next <= ml.LibraryVersion {
+		next = ml.LibraryVersion + 1
+	}
+	ml.recordChangesUnsafe(ml.LibraryVersion, next, changes)
+	ml.LibraryVersion = next
 	log.Printf("📊 [VERSION] Library version updated to: %d", ml.LibraryVersion)
 }
 
@@ -855,41 +968,15 @@ func (ml *MusicLibrary) GetDisplayItems() []DisplayItem {
 	}
 	
 	// Group standalone songs by folder and create FolderItems
-	folderGroups := make(map[string][]*Song)
-	
-	// Find songs that are NOT in any album
-	albumSongIDs := make(map[string]bool)
-	for _, album := range ml.Albums {
-		for _, song := range album.Songs {
-			albumSongIDs[song.ID.String()] = true
-		}
-	}
-	
-	// Group standalone songs by parent directory
-	for _, song := range ml.Songs {
-		if !albumSongIDs[song.ID.String()] {
-			// This song is not in any album, add to folder group
-			folderPath := song.ParentDirectory
-			folderGroups[folderPath] = append(folderGroups[folderPath], song)
-		}
-	}
-	
-	// Create FolderItems for each folder group
-	for folderPath, songs := range folderGroups {
-		if len(songs) > 0 {
-			folderName := filepath.Base(folderPath)
-			if folderName == "" || folderName == "." {
-				folderName = "Unknown Folder"
-			}
-			
-			folderItem := &FolderItem{
-				ID:         folderPath, // Use path as unique ID
-				FolderName: folderName,
-				FolderPath: folderPath,
-				Songs:      songs,
-			}
-			displayItems = append(displayItems, folderItem)
+	folders := ml.standaloneFoldersUnsafe()
+	for _, folder := range folders {
+		folderItem := &FolderItem{
+			ID:         folder.Path, // Use path as unique ID
+			FolderName: folder.Name,
+			FolderPath: folder.Path,
+			Songs:      folder.Songs,
 		}
+		displayItems = append(displayItems, folderItem)
 	}
 	
 	// Sort display items by name for consistent UI
@@ -898,7 +985,7 @@ func (ml *MusicLibrary) GetDisplayItems() []DisplayItem {
 	})
 	
 	log.Printf("🔍 [LIBRARY] Created %d display items (%d albums, %d folders)", 
-		len(displayItems), len(ml.Albums), len(folderGroups))
+		len(displayItems), len(ml.Albums), len(folders))
 	
 	return displayItems
 }
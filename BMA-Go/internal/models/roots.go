@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// rootCheckInterval is how often library roots are checked for drives that were
+// unplugged and mounts that came back
+const rootCheckInterval = 30 * time.Second
+
+// LibraryRoot is one folder the library is built from, such as an internal disk,
+// a USB drive or a NAS mount
+type LibraryRoot struct {
+	Path     string `json:"path"`
+	Disabled bool   `json:"disabled,omitempty"` // kept in the list, but not scanned or watched
+}
+
+// RootStatus is a library root with its current state
+type RootStatus struct {
+	LibraryRoot
+	ID        string // StableFolderID of the path, also sent with every song
+	Online    bool   // the folder can be read; false while a drive or mount is missing
+	SongCount int    // listed songs from this root
+}
+
+// CleanLibraryRoots drops empty paths and repeats, keeping the first of each
+func CleanLibraryRoots(roots []LibraryRoot) []LibraryRoot {
+	cleaned := make([]LibraryRoot, 0, len(roots))
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		root.Path = strings.TrimSpace(root.Path)
+		if root.Path == "" {
+			continue
+		}
+		root.Path = filepath.Clean(root.Path)
+		if seen[root.Path] {
+			continue
+		}
+		seen[root.Path] = true
+		cleaned = append(cleaned, root)
+	}
+	return cleaned
+}
+
+// isRootOnline reports whether a root folder exists and can be listed. A missing
+// mount point fails, and so does an empty folder while the index still has songs
+// below it: an unplugged drive usually leaves its mount point behind, empty, and
+// taking that for a real folder would delete every song on the drive.
+func (ml *MusicLibrary) isRootOnline(path string) bool {
+	dir, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer dir.Close()
+
+	if info, err := dir.Stat(); err != nil || !info.IsDir() {
+		return false
+	}
+	if _, err := dir.Readdirnames(1); err != nil {
+		return err == io.EOF && !ml.index.HasEntriesBelow(path)
+	}
+	return true
+}
+
+// SetRoots replaces the library roots, then scans and watches the enabled ones.
+// Calling it again before the scan finishes cancels that scan.
+func (ml *MusicLibrary) SetRoots(roots []LibraryRoot) {
+	roots = CleanLibraryRoots(roots)
+	log.Printf("📁 [LIBRARY] Library roots: %d configured", len(roots))
+
+	ml.mutex.Lock()
+	ml.roots = roots
+	startMonitor := !ml.monitoringRoots
+	ml.monitoringRoots = true
+	ml.mutex.Unlock()
+
+	if startMonitor {
+		go ml.monitorRoots()
+	}
+	ml.reloadRoots()
+}
+
+// GetRoots returns every configured root with its current state
+func (ml *MusicLibrary) GetRoots() []RootStatus {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+
+	counts := make(map[string]int)
+	for _, song := range ml.Songs {
+		counts[song.Root]++
+	}
+
+	statuses := make([]RootStatus, len(ml.roots))
+	for i, root := range ml.roots {
+		statuses[i] = RootStatus{
+			LibraryRoot: root,
+			ID:          StableFolderID(root.Path).String(),
+			Online:      !root.Disabled && !ml.offlineRoots[root.Path],
+			SongCount:   counts[root.Path],
+		}
+	}
+	return statuses
+}
+
+// reloadRoots rescans every enabled root and watches the ones that are online
+func (ml *MusicLibrary) reloadRoots() {
+	// Stop any existing watchers before the roots are rescanned
+	ml.StopWatching()
+
+	// A root change made mid-scan cancels the older scan
+	if err := ml.ScanFolder(); errors.Is(err, context.Canceled) {
+		log.Println("📁 [LIBRARY] Scan was superseded, not watching")
+		return
+	}
+
+	// Start watching for changes after the scan
+	if err := ml.StartWatching(); err != nil {
+		log.Printf("❌ [LIBRARY] Failed to start watching folders: %v", err)
+	}
+}
+
+// enabledRoots returns the paths of the roots that are not disabled
+func (ml *MusicLibrary) enabledRoots() []string {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+
+	var paths []string
+	for _, root := range ml.roots {
+		if !root.Disabled {
+			paths = append(paths, root.Path)
+		}
+	}
+	return paths
+}
+
+// rootFor returns the enabled root a path lies under (the deepest one, should roots
+// be nested), or "" if it's outside all of them
+func (ml *MusicLibrary) rootFor(path string) string {
+	return rootOf(path, ml.enabledRoots())
+}
+
+// rootOf returns the root among roots a path lies under (the deepest one), or ""
+func rootOf(path string, roots []string) string {
+	best := ""
+	for _, root := range roots {
+		if isWithinRoot(path, root) && len(root) > len(best) {
+			best = root
+		}
+	}
+	return best
+}
+
+// monitorRoots periodically checks whether enabled roots went offline or came
+// back, and reloads the library when one did. In between it keeps smart playlists
+// with relative dates current.
+func (ml *MusicLibrary) monitorRoots() {
+	ticker := time.NewTicker(rootCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		changed := false
+		for _, root := range ml.enabledRoots() {
+			online := ml.isRootOnline(root)
+
+			ml.mutex.RLock()
+			wasOnline := !ml.offlineRoots[root]
+			ml.mutex.RUnlock()
+
+			if online == wasOnline {
+				continue
+			}
+			changed = true
+			if online {
+				log.Printf("🔌 [LIBRARY] Music folder is back online: %s", root)
+			} else {
+				log.Printf("🔌 [LIBRARY] Music folder went offline: %s", root)
+			}
+		}
+
+		if changed {
+			ml.reloadRoots()
+		} else if ml.smartPlaylistsStale() {
+			ml.RefreshSmartPlaylists()
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Metadata sources, in the order LibraryRules.Precedence may list them. For every
+// field the first source in the list that has a value wins.
+const (
+	SourceTags     = "tags"     // ID3, Vorbis comments, MP4 atoms
+	SourcePath     = "path"     // the first PathTemplates entry that matches
+	SourceFilename = "filename" // "Artist - Title", "01. Title" and "Artist_Album_Title"
+	SourceFolders  = "folders"  // parent folder as album, the one above it as artist
+)
+
+// defaultSkipFolders are folder names never taken for an album or artist
+var defaultSkipFolders = []string{"Music", "iTunes", "Songs", "MP3", "Audio", "Downloads"}
+
+// defaultPrecedence keeps the behaviour from before rules were configurable
+var defaultPrecedence = []string{SourceTags, SourcePath, SourceFilename, SourceFolders}
+
+// defaultMinAlbumSize is how many songs an album needs; smaller groups stay folder items
+const defaultMinAlbumSize = 2
+
+// LibraryRules decides how titles, artists and albums are inferred when tags are
+// missing and how songs are grouped into albums. Unset fields use the defaults.
+type LibraryRules struct {
+	// Layouts below the music folder, without extension, tried in order, e.g.
+	// "{artist}/{year} - {album}/{track} {title}". Placeholders: {artist},
+	// {albumartist}, {album}, {title}, {genre}, {year}, {track}, {disc} and {ignore}.
+	PathTemplates []string `json:"pathTemplates,omitempty"`
+
+	// Folder names (case-insensitive) never used as album or artist; replaces
+	// the default list (Music, iTunes, Downloads, ...)
+	SkipFolders []string `json:"skipFolders,omitempty"`
+
+	// Songs needed to form an album; fewer are listed under their folder
+	MinAlbumSize int `json:"minAlbumSize,omitempty"`
+
+	// Metadata sources, highest priority first (tags, path, filename, folders).
+	// Sources left out are not used at all.
+	Precedence []string `json:"precedence,omitempty"`
+
+	templates []*pathTemplate // compiled PathTemplates
+}
+
+// DefaultLibraryRules returns the rules used when the config has none
+func DefaultLibraryRules() *LibraryRules {
+	rules, _ := (&LibraryRules{}).Compile()
+	return rules
+}
+
+// Compile validates the rules and returns a copy with defaults filled in and path
+// templates compiled, ready to apply
+func (r *LibraryRules) Compile() (*LibraryRules, error) {
+	compiled := &LibraryRules{
+		PathTemplates: append([]string(nil), r.PathTemplates...),
+		SkipFolders:   append([]string(nil), r.SkipFolders...),
+		MinAlbumSize:  r.MinAlbumSize,
+		Precedence:    make([]string, 0, len(r.Precedence)),
+	}
+	if len(compiled.SkipFolders) == 0 {
+		compiled.SkipFolders = append(compiled.SkipFolders, defaultSkipFolders...)
+	}
+	if compiled.MinAlbumSize < 0 {
+		return nil, fmt.Errorf("minAlbumSize must not be negative")
+	}
+	if compiled.MinAlbumSize == 0 {
+		compiled.MinAlbumSize = defaultMinAlbumSize
+	}
+
+	precedence := r.Precedence
+	if len(precedence) == 0 {
+		precedence = defaultPrecedence
+	}
+	seen := make(map[string]bool)
+	for _, source := range precedence {
+		source = strings.ToLower(strings.TrimSpace(source))
+		switch source {
+		case SourceTags, SourcePath, SourceFilename, SourceFolders:
+		default:
+			return nil, fmt.Errorf("unknown metadata source %q", source)
+		}
+		if seen[source] {
+			return nil, fmt.Errorf("metadata source %q listed twice", source)
+		}
+		seen[source] = true
+		compiled.Precedence = append(compiled.Precedence, source)
+	}
+
+	for _, template := range compiled.PathTemplates {
+		parsed, err := parsePathTemplate(template)
+		if err != nil {
+			return nil, err
+		}
+		compiled.templates = append(compiled.templates, parsed)
+	}
+	return compiled, nil
+}
+
+// uses reports whether a metadata source is part of the precedence order
+func (r *LibraryRules) uses(source string) bool {
+	for _, listed := range r.Precedence {
+		if listed == source {
+			return true
+		}
+	}
+	return false
+}
+
+// isSkipFolder reports whether a folder name must not be taken for an album or artist
+func (r *LibraryRules) isSkipFolder(name string) bool {
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return true
+	}
+	for _, skip := range r.SkipFolders {
+		if strings.EqualFold(name, skip) {
+			return true
+		}
+	}
+	return false
+}
+
+// songTags is the metadata one source provides for a song
+type songTags struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Genre       string
+	TrackNumber int
+	DiscNumber  int
+	Year        int
+}
+
+// fillFrom copies every field other has and t is still missing
+func (t *songTags) fillFrom(other songTags) {
+	if t.Title == "" {
+		t.Title = other.Title
+	}
+	if t.Artist == "" {
+		t.Artist = other.Artist
+	}
+	if t.Album == "" {
+		t.Album = other.Album
+	}
+	if t.AlbumArtist == "" {
+		t.AlbumArtist = other.AlbumArtist
+	}
+	if t.Genre == "" {
+		t.Genre = other.Genre
+	}
+	if t.TrackNumber == 0 {
+		t.TrackNumber = other.TrackNumber
+	}
+	if t.DiscNumber == 0 {
+		t.DiscNumber = other.DiscNumber
+	}
+	if t.Year == 0 {
+		t.Year = other.Year
+	}
+}
+
+// pathTemplate is a compiled PathTemplates entry
+type pathTemplate struct {
+	pattern *regexp.Regexp
+	fields  []string // placeholder for each capture group
+}
+
+// templatePlaceholders maps each placeholder to the pattern it matches. No
+// placeholder crosses a folder boundary.
+var templatePlaceholders = map[string]string{
+	"artist":      `([^/]+?)`,
+	"albumartist": `([^/]+?)`,
+	"album":       `([^/]+?)`,
+	"title":       `([^/]+?)`,
+	"genre":       `([^/]+?)`,
+	"year":        `(\d{4})`,
+	"track":       `(\d+)`,
+	"disc":        `(\d+)`,
+	"ignore":      `([^/]*?)`,
+}
+
+// parsePathTemplate compiles a template into a pattern matched against the end of
+// a song's path, so "{album}/{track} {title}" works at any depth
+func parsePathTemplate(template string) (*pathTemplate, error) {
+	text := strings.Trim(filepath.ToSlash(strings.TrimSpace(template)), "/")
+	if text == "" {
+		return nil, fmt.Errorf("empty path template")
+	}
+
+	var pattern strings.Builder
+	var fields []string
+	pattern.WriteString(`(?i)(?:^|/)`)
+	for text != "" {
+		open := strings.IndexByte(text, '{')
+		if open < 0 {
+			pattern.WriteString(regexp.QuoteMeta(text))
+			break
+		}
+		pattern.WriteString(regexp.QuoteMeta(text[:open]))
+
+		end := strings.IndexByte(text[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("path template %q: unclosed placeholder", template)
+		}
+		name := strings.ToLower(text[open+1 : open+end])
+		placeholder, ok := templatePlaceholders[name]
+		if !ok {
+			return nil, fmt.Errorf("path template %q: unknown placeholder {%s}", template, name)
+		}
+		pattern.WriteString(placeholder)
+		fields = append(fields, name)
+		text = text[open+end+1:]
+	}
+	pattern.WriteString(`$`)
+
+	compiled, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("path template %q: %w", template, err)
+	}
+	return &pathTemplate{pattern: compiled, fields: fields}, nil
+}
+
+// pathTags returns what the first matching template says about a file; relPath is
+// the file's path below the music folder
+func (r *LibraryRules) pathTags(relPath string) songTags {
+	var tags songTags
+	relPath = filepath.ToSlash(strings.TrimSuffix(relPath, filepath.Ext(relPath)))
+	for _, template := range r.templates {
+		matches := template.pattern.FindStringSubmatch(relPath)
+		if matches == nil {
+			continue
+		}
+		for i, field := range template.fields {
+			value := strings.TrimSpace(matches[i+1])
+			number, _ := strconv.Atoi(value)
+			switch field {
+			case "artist":
+				tags.Artist = value
+			case "albumartist":
+				tags.AlbumArtist = value
+			case "album":
+				tags.Album = value
+			case "title":
+				tags.Title = value
+			case "genre":
+				tags.Genre = value
+			case "year":
+				tags.Year = number
+			case "track":
+				tags.TrackNumber = number
+			case "disc":
+				tags.DiscNumber = number
+			}
+		}
+		if r.isSkipFolder(tags.Artist) {
+			tags.Artist = ""
+		}
+		if r.isSkipFolder(tags.Album) {
+			tags.Album = ""
+		}
+		return tags
+	}
+	return tags
+}
+
+// filenameTags parses the built-in filename patterns (from Swift version)
+func filenameTags(filename string) songTags {
+	title := strings.TrimSuffix(filename, filepath.Ext(filename))
+	tags := songTags{Title: title}
+
+	// Pattern 1: "Artist - Song Title"
+	if strings.Contains(title, " - ") {
+		parts := strings.SplitN(title, " - ", 2)
+		if artist := strings.TrimSpace(parts[0]); artist != "" {
+			tags.Artist = artist
+			tags.Title = strings.TrimSpace(parts[1])
+		}
+		return tags
+	}
+
+	// Pattern 2: "01. Song Title" or "Track Number Song Title"
+	if matches := filenameTrackPattern.FindStringSubmatch(title); len(matches) == 3 {
+		if trackNum, err := strconv.Atoi(matches[1]); err == nil {
+			tags.TrackNumber = trackNum
+			tags.Title = strings.TrimSpace(matches[2])
+		}
+		return tags
+	}
+
+	// Pattern 3: "Artist_Album_Track" (underscore separated)
+	if parts := strings.Split(title, "_"); len(parts) >= 3 {
+		tags.Artist = strings.TrimSpace(parts[0])
+		tags.Album = strings.TrimSpace(parts[1])
+		tags.Title = strings.TrimSpace(parts[2])
+	}
+	return tags
+}
+
+// filenameTrackPattern matches "01. Song Title" and "01 Song Title"
+var filenameTrackPattern = regexp.MustCompile(`^(\d+)\.?\s*(.+)$`)
+
+// folderTags infers album and artist from an Artist/Album folder layout (from Swift version)
+func (r *LibraryRules) folderTags(parentDir string) songTags {
+	var tags songTags
+	if album := filepath.Base(parentDir); !r.isSkipFolder(album) {
+		tags.Album = album
+	}
+
+	pathComponents := strings.Split(parentDir, string(filepath.Separator))
+	if len(pathComponents) >= 2 {
+		if artist := pathComponents[len(pathComponents)-2]; !r.isSkipFolder(artist) {
+			tags.Artist = artist
+		}
+	}
+	return tags
+}
+
+// RulesPreview is what a set of LibraryRules would do to the current library
+type RulesPreview struct {
+	Albums          []*Album // every album the rules would produce, sorted like GetAlbums
+	StandaloneSongs int      // songs on no album, listed under their folder
+	ChangedSongs    int      // songs whose title, artist, album or numbering would change
+	AddedAlbums     []*Album // albums that don't exist with the current rules
+	RemovedAlbums   []*Album // current albums the rules would break up or rename
+}
+
+// libraryRules returns the rules currently in effect
+func (ml *MusicLibrary) libraryRules() *LibraryRules {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+	return ml.rules
+}
+
+// relativePath returns a file's path below its library root, which is what path
+// templates are matched against
+func relativePath(filePath, root string) string {
+	if root == "" || !isWithinRoot(filePath, root) {
+		return filePath
+	}
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return filePath
+	}
+	return rel
+}
+
+// resolveSongs applies rules to copies of the given songs; the originals may be
+// read concurrently and are left alone
+func (ml *MusicLibrary) resolveSongs(songs map[string]*Song, rules *LibraryRules) map[string]*Song {
+	resolved := make(map[string]*Song, len(songs))
+	for songPath, song := range songs {
+		updated := *song
+		updated.applyRules(relativePath(songPath, song.Root), rules)
+		resolved[songPath] = &updated
+	}
+	return resolved
+}
+
+// SetLibraryRules replaces the grouping and inference rules (nil restores the
+// defaults) and re-applies them to the songs already scanned. The index keeps the
+// raw tag values, so no file is read again.
+func (ml *MusicLibrary) SetLibraryRules(rules *LibraryRules) error {
+	if rules == nil {
+		rules = &LibraryRules{}
+	}
+	compiled, err := rules.Compile()
+	if err != nil {
+		return err
+	}
+
+	// Serialize with scans, which resolve songs with the rules as they go
+	ml.scanMutex.Lock()
+	defer ml.scanMutex.Unlock()
+
+	ml.mutex.Lock()
+	ml.rules = compiled
+	current := ml.allSongs
+	ml.mutex.Unlock()
+
+	if len(current) == 0 {
+		return nil
+	}
+
+	changes := ml.commitSongs(ml.resolveSongs(current, compiled))
+	log.Printf("📐 [RULES] Applied library rules: %d songs in %d albums (%s)", ml.GetSongCount(), ml.GetAlbumCount(), changes.Summary())
+	if !changes.IsEmpty() {
+		ml.notifyLibraryChanged()
+	}
+	return nil
+}
+
+// PreviewLibraryRules works out how the library would look with different rules
+// without changing anything
+func (ml *MusicLibrary) PreviewLibraryRules(rules *LibraryRules) (*RulesPreview, error) {
+	if rules == nil {
+		rules = &LibraryRules{}
+	}
+	compiled, err := rules.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	ml.mutex.RLock()
+	current := ml.allSongs
+	currentAlbums := ml.Albums
+	ml.mutex.RUnlock()
+
+	resolved := ml.resolveSongs(current, compiled)
+	songs, albums, _ := ml.organize(resolved, compiled.MinAlbumSize)
+
+	preview := &RulesPreview{Albums: albums, StandaloneSongs: len(songs)}
+	for songPath, song := range resolved {
+		if !song.sameMetadata(current[songPath]) {
+			preview.ChangedSongs++
+		}
+	}
+
+	existing := make(map[uuid.UUID]*Album, len(currentAlbums))
+	for _, album := range currentAlbums {
+		existing[album.ID] = album
+	}
+	for _, album := range albums {
+		preview.StandaloneSongs -= len(album.Songs)
+		if previous, ok := existing[album.ID]; ok && previous.Name == album.Name && previous.Artist == album.Artist {
+			delete(existing, album.ID)
+		} else {
+			preview.AddedAlbums = append(preview.AddedAlbums, album)
+		}
+	}
+	for _, album := range currentAlbums {
+		if _, ok := existing[album.ID]; ok {
+			preview.RemovedAlbums = append(preview.RemovedAlbums, album)
+		}
+	}
+	return preview, nil
+}
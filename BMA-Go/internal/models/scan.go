@@ -0,0 +1,257 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// maxScanWorkers caps how many files a scan reads at once. Tag reading is mostly
+// waiting on the disk, so more workers than this rarely helps.
+const maxScanWorkers = 8
+
+// scanProgressInterval is the least time between two progress callbacks
+const scanProgressInterval = 250 * time.Millisecond
+
+// ScanProgress reports how far a full scan has got
+type ScanProgress struct {
+	Seen      int  // audio files found so far
+	Processed int  // audio files read
+	Failed    int  // audio files that couldn't be read
+	Listed    bool // every folder has been listed, so Seen is the final count
+}
+
+// Fraction returns how much of the scan is done, from 0 to 1. It stays at 0 while
+// folders are still being listed.
+func (p ScanProgress) Fraction() float64 {
+	if !p.Listed || p.Seen == 0 {
+		return 0
+	}
+	return float64(p.Processed+p.Failed) / float64(p.Seen)
+}
+
+// ScanStatus describes the running scan, or the last one when none is running
+type ScanStatus struct {
+	Scanning   bool
+	Roots      []string // enabled roots the scan covers
+	Progress   ScanProgress
+	StartedAt  time.Time
+	FinishedAt time.Time // zero while scanning
+	Cancelled  bool      // a newer scan took over before this one finished
+	Error      string
+}
+
+// GetScanStatus returns the state of the running or last scan
+func (ml *MusicLibrary) GetScanStatus() ScanStatus {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+	return ml.scanStatus
+}
+
+// scanJob is an audio file found while listing, with its folder's cover image
+type scanJob struct {
+	path      string
+	coverPath string
+	coverHash string
+}
+
+// scanListing collects what listing a folder tree finds
+type scanListing struct {
+	jobs      []scanJob
+	playlists []string // playlist files, imported once the songs are read
+}
+
+// beginScan cancels the scan that is running, if any, and returns the context for a
+// new one. done must be called once the new scan has finished.
+func (ml *MusicLibrary) beginScan() (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ml.mutex.Lock()
+	if ml.cancelScan != nil {
+		log.Println("🛑 [LIBRARY] Cancelling the running scan")
+		ml.cancelScan()
+	}
+	ml.scanGeneration++
+	generation := ml.scanGeneration
+	ml.cancelScan = cancel
+	ml.mutex.Unlock()
+
+	return ctx, func() {
+		cancel()
+		ml.mutex.Lock()
+		if ml.scanGeneration == generation {
+			ml.cancelScan = nil
+		}
+		ml.mutex.Unlock()
+	}
+}
+
+// scanFiles lists every audio file below the roots, then reads them on a pool of
+// workers, reporting progress as it goes. Roots are listed independently: one that
+// can't be read is left out of the result map of online roots, and the others are
+// still scanned. Playlist files found along the way are returned unread. It gives
+// up as soon as ctx is cancelled.
+func (ml *MusicLibrary) scanFiles(ctx context.Context, roots []string) ([]*Song, []string, map[string]bool, error) {
+	var listing scanListing
+	onListed := func(found int) {
+		ml.updateScanProgress(func(p *ScanProgress) { p.Seen += found })
+	}
+	online := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		if !ml.isRootOnline(root) {
+			log.Printf("🔌 [LIBRARY] Music folder is offline, skipping: %s", root)
+			continue
+		}
+		if err := ml.listAudioFiles(ctx, root, &listing, onListed); err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, nil, err
+			}
+			log.Printf("🔌 [LIBRARY] Failed to list %s, treating it as offline: %v", root, err)
+			continue
+		}
+		online[root] = true
+	}
+	ml.updateScanProgress(func(p *ScanProgress) { p.Listed = true })
+	log.Printf("🔍 [LIBRARY] Found %d audio files and %d playlists in %d folders, reading tags", len(listing.jobs), len(listing.playlists), len(online))
+
+	songs, err := ml.readAudioFiles(ctx, listing.jobs, func(ok bool) {
+		ml.updateScanProgress(func(p *ScanProgress) {
+			if ok {
+				p.Processed++
+			} else {
+				p.Failed++
+			}
+		})
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return songs, listing.playlists, online, nil
+}
+
+// scanDirectory reads every audio file below dirPath without reporting progress,
+// for folders that appear while the library is being watched. The playlist files
+// it finds are returned unread.
+func (ml *MusicLibrary) scanDirectory(dirPath string) ([]*Song, []string, error) {
+	var listing scanListing
+	err := ml.listAudioFiles(context.Background(), dirPath, &listing, nil)
+	songs, _ := ml.readAudioFiles(context.Background(), listing.jobs, nil)
+	return songs, listing.playlists, err
+}
+
+// listAudioFiles recursively collects the audio and playlist files below dirPath,
+// calling onListed (if set) with the number of audio files found in each folder
+func (ml *MusicLibrary) listAudioFiles(ctx context.Context, dirPath string, listing *scanListing, onListed func(int)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %s: %w", dirPath, err)
+	}
+
+	// Cover image shared by every song in this folder (cover.jpg, folder.png, ...)
+	coverPath, coverHash := ml.findFolderCover(dirPath, entries)
+
+	found := 0
+	for _, entry := range entries {
+		fullPath := filepath.Join(dirPath, entry.Name())
+
+		if entry.IsDir() {
+			// Recursively scan subdirectories (album folders)
+			if err := ml.listAudioFiles(ctx, fullPath, listing, onListed); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Printf("⚠️ [LIBRARY] Warning: failed to scan subdirectory %s: %v", fullPath, err)
+			}
+		} else if isAudioFile(entry.Name()) {
+			listing.jobs = append(listing.jobs, scanJob{path: fullPath, coverPath: coverPath, coverHash: coverHash})
+			found++
+		} else if IsPlaylistFile(entry.Name()) {
+			listing.playlists = append(listing.playlists, fullPath)
+		}
+	}
+
+	if found > 0 && onListed != nil {
+		onListed(found)
+	}
+	return nil
+}
+
+// readAudioFiles turns files into songs on a pool of workers, calling onRead (if
+// set) after each file. Files that can't be read are logged and left out.
+func (ml *MusicLibrary) readAudioFiles(ctx context.Context, jobs []scanJob, onRead func(ok bool)) ([]*Song, error) {
+	workers := min(runtime.NumCPU(), maxScanWorkers)
+	queue := make(chan scanJob)
+	songs := make([]*Song, 0, len(jobs))
+	var songsMutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				// Create song from audio file (reusing the index where possible)
+				song, err := ml.songForFile(job.path)
+				if err != nil {
+					log.Printf("⚠️ [LIBRARY] Warning: failed to process audio file %s: %v", job.path, err)
+				} else {
+					song.FolderArtworkPath = job.coverPath
+					song.FolderArtworkHash = job.coverHash
+
+					songsMutex.Lock()
+					songs = append(songs, song)
+					songsMutex.Unlock()
+				}
+				if onRead != nil {
+					onRead(err == nil)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return songs, nil
+}
+
+// updateScanProgress applies a change to the running scan's progress and notifies
+// the progress callbacks, at most once per scanProgressInterval except when the
+// listing or the reading has just finished
+func (ml *MusicLibrary) updateScanProgress(change func(*ScanProgress)) {
+	ml.mutex.Lock()
+	before := ml.scanStatus.Progress
+	change(&ml.scanStatus.Progress)
+	progress := ml.scanStatus.Progress
+
+	finished := progress.Listed && progress.Processed+progress.Failed == progress.Seen
+	notify := finished || progress.Listed != before.Listed || time.Since(ml.lastProgressNotify) >= scanProgressInterval
+	if notify {
+		ml.lastProgressNotify = time.Now()
+	}
+	ml.mutex.Unlock()
+
+	if notify {
+		ml.notifyScanProgress(progress)
+	}
+}
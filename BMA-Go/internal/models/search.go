@@ -0,0 +1,342 @@
+package models
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchIndex is an inverted index over the library, rebuilt on every commit so it
+// always matches the published songs and albums. It is immutable once built, so
+// searches run without holding the library lock.
+//
+// Every searchable text is folded (lower case, diacritics stripped) and split into
+// tokens. A query token matches an indexed token exactly, as a prefix, or - for
+// longer words - within a small edit distance, so "beyonce", "beyo" and "beyonse"
+// all find "Beyoncé".
+type SearchIndex struct {
+	songs   []*Song
+	albums  []*Album
+	artists []*Artist
+
+	postings map[string][]searchPosting // token -> documents containing it
+	tokens   []string                   // sorted vocabulary, for prefix and fuzzy lookups
+}
+
+// SearchResults holds ranked matches grouped by kind, best match first
+type SearchResults struct {
+	Songs   []*Song
+	Albums  []*Album
+	Artists []*Artist
+}
+
+// Field weights: a hit in the title counts for more than one in the folder name
+const (
+	searchWeightName   = 3.0
+	searchWeightArtist = 2.0
+	searchWeightAlbum  = 2.0
+	searchWeightFile   = 1.0
+	searchWeightFolder = 1.0
+)
+
+// Match quality multipliers for the three kinds of token match
+const (
+	searchMatchExact  = 1.0
+	searchMatchPrefix = 0.7
+	searchMatchFuzzy  = 0.5
+)
+
+type searchDocKind uint8
+
+const (
+	searchDocSong searchDocKind = iota
+	searchDocAlbum
+	searchDocArtist
+)
+
+// searchDoc identifies one song, album or artist in the index
+type searchDoc struct {
+	kind  searchDocKind
+	index int
+}
+
+// searchPosting records that a document contains a token in a field of the given weight
+type searchPosting struct {
+	doc    searchDoc
+	weight float64
+}
+
+// BuildSearchIndex indexes songs (title, artist, album, album artist, composer,
+// filename, folder), albums
+// (name, artist) and artists (name)
+func BuildSearchIndex(songs []*Song, albums []*Album, artists []*Artist) *SearchIndex {
+	index := &SearchIndex{
+		songs:    songs,
+		albums:   albums,
+		artists:  artists,
+		postings: make(map[string][]searchPosting),
+	}
+
+	for i, song := range songs {
+		doc := searchDoc{kind: searchDocSong, index: i}
+		index.add(doc, song.Title, searchWeightName)
+		index.add(doc, song.InferredArtist(), searchWeightArtist)
+		index.add(doc, song.Album, searchWeightAlbum)
+		index.add(doc, song.AlbumArtist, searchWeightArtist)
+		index.add(doc, song.Composer, searchWeightFile)
+		index.add(doc, strings.TrimSuffix(song.Filename, filepath.Ext(song.Filename)), searchWeightFile)
+		index.add(doc, filepath.Base(song.ParentDirectory), searchWeightFolder)
+	}
+	for i, album := range albums {
+		doc := searchDoc{kind: searchDocAlbum, index: i}
+		index.add(doc, album.Name, searchWeightName)
+		index.add(doc, album.Artist, searchWeightArtist)
+	}
+	for i, artist := range artists {
+		index.add(searchDoc{kind: searchDocArtist, index: i}, artist.Name, searchWeightName)
+	}
+
+	index.tokens = make([]string, 0, len(index.postings))
+	for token := range index.postings {
+		index.tokens = append(index.tokens, token)
+	}
+	sort.Strings(index.tokens)
+
+	return index
+}
+
+// add indexes the tokens of one field, keeping the best weight per token and document
+func (idx *SearchIndex) add(doc searchDoc, text string, weight float64) {
+	for _, token := range tokenizeSearchText(text) {
+		postings := idx.postings[token]
+		if n := len(postings); n > 0 && postings[n-1].doc == doc {
+			if weight > postings[n-1].weight {
+				postings[n-1].weight = weight
+			}
+			continue
+		}
+		idx.postings[token] = append(postings, searchPosting{doc: doc, weight: weight})
+	}
+}
+
+// Search returns up to limit songs, albums and artists matching every word of the query
+func (idx *SearchIndex) Search(query string, limit int) SearchResults {
+	var results SearchResults
+	queryTokens := tokenizeSearchText(query)
+	if idx == nil || len(queryTokens) == 0 || limit <= 0 {
+		return results
+	}
+
+	// Every query token has to match somewhere in a document (AND semantics);
+	// a document scores the best match of each query token, summed
+	var scores map[searchDoc]float64
+	for _, queryToken := range queryTokens {
+		tokenScores := make(map[searchDoc]float64)
+		for token, quality := range idx.matchingTokens(queryToken) {
+			for _, posting := range idx.postings[token] {
+				if score := quality * posting.weight; score > tokenScores[posting.doc] {
+					tokenScores[posting.doc] = score
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = tokenScores
+			continue
+		}
+		for doc, score := range scores {
+			if tokenScore, ok := tokenScores[doc]; ok {
+				scores[doc] = score + tokenScore
+			} else {
+				delete(scores, doc)
+			}
+		}
+	}
+
+	// Whole-phrase matches on the name float to the top
+	phrase := strings.Join(queryTokens, " ")
+	for doc := range scores {
+		if name := strings.Join(tokenizeSearchText(idx.docName(doc)), " "); name == phrase {
+			scores[doc] *= 2
+		} else if strings.HasPrefix(name, phrase) {
+			scores[doc] *= 1.5
+		}
+	}
+
+	ranked := make(map[searchDocKind][]searchDoc)
+	for doc := range scores {
+		ranked[doc.kind] = append(ranked[doc.kind], doc)
+	}
+	for kind, docs := range ranked {
+		sort.Slice(docs, func(i, j int) bool {
+			if scores[docs[i]] != scores[docs[j]] {
+				return scores[docs[i]] > scores[docs[j]]
+			}
+			// Ties keep library order (songs are sorted by album and track)
+			return docs[i].index < docs[j].index
+		})
+		if len(docs) > limit {
+			ranked[kind] = docs[:limit]
+		}
+	}
+
+	for _, doc := range ranked[searchDocSong] {
+		results.Songs = append(results.Songs, idx.songs[doc.index])
+	}
+	for _, doc := range ranked[searchDocAlbum] {
+		results.Albums = append(results.Albums, idx.albums[doc.index])
+	}
+	for _, doc := range ranked[searchDocArtist] {
+		results.Artists = append(results.Artists, idx.artists[doc.index])
+	}
+	return results
+}
+
+// docName returns the primary name of a document, used for phrase boosts
+func (idx *SearchIndex) docName(doc searchDoc) string {
+	switch doc.kind {
+	case searchDocSong:
+		return idx.songs[doc.index].Title
+	case searchDocAlbum:
+		return idx.albums[doc.index].Name
+	default:
+		return idx.artists[doc.index].Name
+	}
+}
+
+// matchingTokens finds indexed tokens matching a query token, with the match quality
+func (idx *SearchIndex) matchingTokens(queryToken string) map[string]float64 {
+	matches := make(map[string]float64)
+
+	// Exact and prefix matches sit in one run of the sorted vocabulary
+	start := sort.SearchStrings(idx.tokens, queryToken)
+	for i := start; i < len(idx.tokens) && strings.HasPrefix(idx.tokens[i], queryToken); i++ {
+		if idx.tokens[i] == queryToken {
+			matches[idx.tokens[i]] = searchMatchExact
+		} else {
+			matches[idx.tokens[i]] = searchMatchPrefix
+		}
+	}
+
+	// Typo tolerance only for words long enough that one slip isn't a different word
+	maxDistance := 0
+	switch queryLength := len([]rune(queryToken)); {
+	case queryLength >= 8:
+		maxDistance = 2
+	case queryLength >= 4:
+		maxDistance = 1
+	}
+	if maxDistance == 0 {
+		return matches
+	}
+
+	for _, token := range idx.tokens {
+		if _, matched := matches[token]; matched {
+			continue
+		}
+		if withinEditDistance(queryToken, token, maxDistance) {
+			matches[token] = searchMatchFuzzy
+		}
+	}
+	return matches
+}
+
+// tokenizeSearchText folds text and splits it into words
+func tokenizeSearchText(text string) []string {
+	return strings.FieldsFunc(foldSearchText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// foldSearchText lower-cases text and strips diacritics ("Beyoncé" -> "beyonce")
+func foldSearchText(text string) string {
+	var builder strings.Builder
+	builder.Grow(len(text))
+	for _, r := range strings.ToLower(text) {
+		// Combining marks left over from decomposed input
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if folded, ok := searchFoldings[r]; ok {
+			builder.WriteString(folded)
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// searchFoldings maps lower-case Latin letters with diacritics to plain ASCII
+var searchFoldings = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g", 'ĥ': "h", 'ħ': "h",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'ĵ': "j", 'ķ': "k", 'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o", 'œ': "oe",
+	'ŕ': "r", 'ŗ': "r", 'ř': "r", 'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ș': "s", 'ß': "ss",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'ț': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ŵ': "w", 'ý': "y", 'ÿ': "y", 'ŷ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// withinEditDistance reports whether a and b are at most maxDistance edits apart
+// (insertions, deletions, substitutions and adjacent transpositions)
+func withinEditDistance(a, b string, maxDistance int) bool {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > maxDistance || -diff > maxDistance {
+		return false
+	}
+
+	// Optimal string alignment distance over three rolling rows
+	previous2 := make([]int, len(rb)+1)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			best := previous[j] + 1 // deletion
+			if insertion := current[j-1] + 1; insertion < best {
+				best = insertion
+			}
+			if substitution := previous[j-1] + cost; substitution < best {
+				best = substitution
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if transposition := previous2[j-2] + 1; transposition < best {
+					best = transposition
+				}
+			}
+			current[j] = best
+			if best < rowMin {
+				rowMin = best
+			}
+		}
+		// Every later cell builds on this row, so stop once it is out of reach
+		if rowMin > maxDistance {
+			return false
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return previous[len(rb)] <= maxDistance
+}
+
+// Search runs a query against the current library's search index
+func (ml *MusicLibrary) Search(query string, limit int) SearchResults {
+	ml.mutex.RLock()
+	index := ml.searchIndex
+	ml.mutex.RUnlock()
+	return index.Search(query, limit)
+}
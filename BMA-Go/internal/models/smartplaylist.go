@@ -0,0 +1,516 @@
+package models
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxSmartRuleDepth bounds how deeply all/any groups nest, so a hostile rule tree
+// can't exhaust the stack
+const maxSmartRuleDepth = 8
+
+// smartRefreshInterval is how often smart playlists are re-evaluated while nothing
+// changes, so rules like "added in the last 30 days" let old songs go
+const smartRefreshInterval = time.Hour
+
+// ErrSmartRule wraps every problem found while compiling smart playlist rules
+var ErrSmartRule = errors.New("invalid smart playlist rule")
+
+// SmartSpec picks a smart playlist's songs: every listed song matching Rules, in
+// Sort order, at most Limit of them. Specs are replaced, never changed in place.
+type SmartSpec struct {
+	Rules SmartRule `json:"rules"`
+	Sort  string    `json:"sort,omitempty"`  // field to order by, "-" prefix for descending, or "random"
+	Limit int       `json:"limit,omitempty"` // most songs to keep, 0 for no limit
+}
+
+// SmartRule is a node in a rule tree: either an all/any group of rules, or a
+// condition comparing a song field with a value, such as
+// {"field": "genre", "op": "is", "value": "Jazz"}. An empty rule matches every song.
+type SmartRule struct {
+	All   []SmartRule     `json:"all,omitempty"`
+	Any   []SmartRule     `json:"any,omitempty"`
+	Field string          `json:"field,omitempty"`
+	Op    string          `json:"op,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// PlayStats is what the play history knows about a song
+type PlayStats struct {
+	PlayCount  int
+	LastPlayed time.Time // zero if never played
+}
+
+// smartMatcher reports whether a song matches a compiled rule
+type smartMatcher func(song *Song, stats PlayStats) bool
+
+// smartFieldKind says which operators and values a field takes
+type smartFieldKind int
+
+const (
+	smartText smartFieldKind = iota
+	smartNumber
+	smartDate
+	smartBool
+)
+
+// smartField reads one song property for rules and sorting
+type smartField struct {
+	kind   smartFieldKind
+	text   func(song *Song) string
+	number func(song *Song, stats PlayStats) float64
+	date   func(song *Song, stats PlayStats) time.Time
+	flag   func(song *Song) bool
+}
+
+// smartFields lists every field rules and sort specs can use
+var smartFields = map[string]smartField{
+	"title":       {kind: smartText, text: func(s *Song) string { return s.Title }},
+	"artist":      {kind: smartText, text: func(s *Song) string { return s.Artist }},
+	"album":       {kind: smartText, text: func(s *Song) string { return s.Album }},
+	"albumArtist": {kind: smartText, text: func(s *Song) string { return s.AlbumArtist }},
+	"genre":       {kind: smartText, text: func(s *Song) string { return s.Genre }},
+	"composer":    {kind: smartText, text: func(s *Song) string { return s.Composer }},
+	"format":      {kind: smartText, text: func(s *Song) string { return s.Format }},
+	"path":        {kind: smartText, text: func(s *Song) string { return s.Path }},
+	"year":        {kind: smartNumber, number: func(s *Song, _ PlayStats) float64 { return float64(s.Year) }},
+	"trackNumber": {kind: smartNumber, number: func(s *Song, _ PlayStats) float64 { return float64(s.TrackNumber) }},
+	"discNumber":  {kind: smartNumber, number: func(s *Song, _ PlayStats) float64 { return float64(s.DiscNumber) }},
+	"duration":    {kind: smartNumber, number: func(s *Song, _ PlayStats) float64 { return s.Duration.Seconds() }},
+	"bitrate":     {kind: smartNumber, number: func(s *Song, _ PlayStats) float64 { return float64(s.Bitrate) }},
+	"sampleRate":  {kind: smartNumber, number: func(s *Song, _ PlayStats) float64 { return float64(s.SampleRate) }},
+	"playCount":   {kind: smartNumber, number: func(_ *Song, p PlayStats) float64 { return float64(p.PlayCount) }},
+	"addedAt":     {kind: smartDate, date: func(s *Song, _ PlayStats) time.Time { return s.AddedAt }},
+	"modifiedAt":  {kind: smartDate, date: func(s *Song, _ PlayStats) time.Time { return s.ModTime }},
+	"lastPlayed":  {kind: smartDate, date: func(_ *Song, p PlayStats) time.Time { return p.LastPlayed }},
+	"compilation": {kind: smartBool, flag: func(s *Song) bool { return s.Compilation }},
+}
+
+// Validate checks that a spec compiles, without evaluating it
+func (spec SmartSpec) Validate() error {
+	if spec.Limit < 0 {
+		return fmt.Errorf("%w: limit can't be negative", ErrSmartRule)
+	}
+	if _, err := compileSmartSort(spec.Sort); err != nil {
+		return err
+	}
+	_, err := spec.Rules.compile(time.Now(), 0)
+	return err
+}
+
+// compile turns a rule tree into a matcher, resolving relative dates against now
+func (r SmartRule) compile(now time.Time, depth int) (smartMatcher, error) {
+	if depth > maxSmartRuleDepth {
+		return nil, fmt.Errorf("%w: rules nest deeper than %d levels", ErrSmartRule, maxSmartRuleDepth)
+	}
+
+	parts := 0
+	for _, set := range []bool{r.All != nil, r.Any != nil, r.Field != ""} {
+		if set {
+			parts++
+		}
+	}
+	switch {
+	case parts > 1:
+		return nil, fmt.Errorf("%w: a rule has either all, any or a field", ErrSmartRule)
+	case parts == 0:
+		return func(*Song, PlayStats) bool { return true }, nil
+	case r.Field != "":
+		return r.compileCondition(now)
+	}
+
+	group := r.All
+	if r.Any != nil {
+		group = r.Any
+	}
+	matchers := make([]smartMatcher, len(group))
+	for i, rule := range group {
+		matcher, err := rule.compile(now, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = matcher
+	}
+
+	if r.Any != nil {
+		return func(song *Song, stats PlayStats) bool {
+			for _, matcher := range matchers {
+				if matcher(song, stats) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	return func(song *Song, stats PlayStats) bool {
+		for _, matcher := range matchers {
+			if !matcher(song, stats) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// compileCondition compiles a single field comparison
+func (r SmartRule) compileCondition(now time.Time) (smartMatcher, error) {
+	field, ok := smartFields[r.Field]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown field %q", ErrSmartRule, r.Field)
+	}
+	invalid := func(expected string) error {
+		return fmt.Errorf("%w: %s %s expects %s, got %s", ErrSmartRule, r.Field, r.Op, expected, r.Value)
+	}
+
+	switch field.kind {
+	case smartText:
+		var value string
+		if json.Unmarshal(r.Value, &value) != nil {
+			return nil, invalid("a string")
+		}
+		value = foldSearchText(value)
+		compare, err := textComparison(r.Op, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s doesn't support %q", ErrSmartRule, r.Field, r.Op)
+		}
+		return func(song *Song, _ PlayStats) bool {
+			return compare(foldSearchText(field.text(song)))
+		}, nil
+
+	case smartNumber:
+		var value float64
+		if json.Unmarshal(r.Value, &value) != nil {
+			return nil, invalid("a number")
+		}
+		compare, err := numberComparison(r.Op, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s doesn't support %q", ErrSmartRule, r.Field, r.Op)
+		}
+		return func(song *Song, stats PlayStats) bool {
+			return compare(field.number(song, stats))
+		}, nil
+
+	case smartDate:
+		var value string
+		if json.Unmarshal(r.Value, &value) != nil {
+			return nil, invalid("a period or a date")
+		}
+		compare, err := dateComparison(r.Op, value, now)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %s: %v", ErrSmartRule, r.Field, r.Op, err)
+		}
+		return func(song *Song, stats PlayStats) bool {
+			return compare(field.date(song, stats))
+		}, nil
+
+	default:
+		var value bool
+		if json.Unmarshal(r.Value, &value) != nil {
+			return nil, invalid("true or false")
+		}
+		switch r.Op {
+		case "is":
+		case "isNot":
+			value = !value
+		default:
+			return nil, fmt.Errorf("%w: %s doesn't support %q", ErrSmartRule, r.Field, r.Op)
+		}
+		return func(song *Song, _ PlayStats) bool {
+			return field.flag(song) == value
+		}, nil
+	}
+}
+
+// textComparison compares folded text with a folded value
+func textComparison(op, value string) (func(string) bool, error) {
+	switch op {
+	case "is":
+		return func(text string) bool { return text == value }, nil
+	case "isNot":
+		return func(text string) bool { return text != value }, nil
+	case "contains":
+		return func(text string) bool { return strings.Contains(text, value) }, nil
+	case "notContains":
+		return func(text string) bool { return !strings.Contains(text, value) }, nil
+	case "startsWith":
+		return func(text string) bool { return strings.HasPrefix(text, value) }, nil
+	case "endsWith":
+		return func(text string) bool { return strings.HasSuffix(text, value) }, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
+
+// numberComparison compares a number with a value
+func numberComparison(op string, value float64) (func(float64) bool, error) {
+	switch op {
+	case "is":
+		return func(number float64) bool { return number == value }, nil
+	case "isNot":
+		return func(number float64) bool { return number != value }, nil
+	case "gt":
+		return func(number float64) bool { return number > value }, nil
+	case "gte":
+		return func(number float64) bool { return number >= value }, nil
+	case "lt":
+		return func(number float64) bool { return number < value }, nil
+	case "lte":
+		return func(number float64) bool { return number <= value }, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
+
+// dateComparison compares a time with a period back from now ("30d", "6m") or a
+// date ("2020-01-31"). A zero time, such as a song that was never played, is never
+// in the last period and never before or after a date.
+func dateComparison(op, value string, now time.Time) (func(time.Time) bool, error) {
+	switch op {
+	case "inTheLast", "notInTheLast":
+		cutoff, err := periodCutoff(value, now)
+		if err != nil {
+			return nil, err
+		}
+		if op == "inTheLast" {
+			return func(t time.Time) bool { return !t.IsZero() && !t.Before(cutoff) }, nil
+		}
+		return func(t time.Time) bool { return t.IsZero() || t.Before(cutoff) }, nil
+
+	case "before", "after":
+		date, err := parseSmartDate(value)
+		if err != nil {
+			return nil, err
+		}
+		if op == "before" {
+			return func(t time.Time) bool { return !t.IsZero() && t.Before(date) }, nil
+		}
+		return func(t time.Time) bool { return !t.IsZero() && t.After(date) }, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
+
+// periodCutoff returns the time a period such as "12h", "30d", "2w", "6m" or "1y"
+// reaches back to from now
+func periodCutoff(period string, now time.Time) (time.Time, error) {
+	period = strings.TrimSpace(period)
+	if len(period) < 2 {
+		return time.Time{}, fmt.Errorf("invalid period %q", period)
+	}
+	count, err := strconv.Atoi(period[:len(period)-1])
+	if err != nil || count < 0 {
+		return time.Time{}, fmt.Errorf("invalid period %q", period)
+	}
+
+	switch period[len(period)-1] {
+	case 'h':
+		return now.Add(-time.Duration(count) * time.Hour), nil
+	case 'd':
+		return now.AddDate(0, 0, -count), nil
+	case 'w':
+		return now.AddDate(0, 0, -7*count), nil
+	case 'm':
+		return now.AddDate(0, -count, 0), nil
+	case 'y':
+		return now.AddDate(-count, 0, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid period %q, expected a unit of h, d, w, m or y", period)
+}
+
+// parseSmartDate accepts a date ("2020-01-31", local midnight) or an RFC 3339 time
+func parseSmartDate(text string) (time.Time, error) {
+	if date, err := time.ParseInLocation("2006-01-02", text, time.Local); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", text)
+	}
+	return date, nil
+}
+
+// smartSortKey orders two songs for a sort spec; it reports whether a goes first
+type smartSortKey func(playlistID uuid.UUID, a, b *Song, statsA, statsB PlayStats) bool
+
+// compileSmartSort turns a sort spec into an ordering, or nil for library order
+func compileSmartSort(spec string) (smartSortKey, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if spec == "random" {
+		// Shuffled by a hash of the playlist and song, so the order holds still while
+		// songs come and go instead of reshuffling on every library change
+		return func(playlistID uuid.UUID, a, b *Song, _, _ PlayStats) bool {
+			return shuffleKey(playlistID, a.ID) < shuffleKey(playlistID, b.ID)
+		}, nil
+	}
+
+	descending := strings.HasPrefix(spec, "-")
+	name := strings.TrimPrefix(spec, "-")
+	field, ok := smartFields[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort field %q", ErrSmartRule, name)
+	}
+
+	var less func(a, b *Song, statsA, statsB PlayStats) bool
+	switch field.kind {
+	case smartText:
+		less = func(a, b *Song, _, _ PlayStats) bool {
+			return foldSearchText(field.text(a)) < foldSearchText(field.text(b))
+		}
+	case smartNumber:
+		less = func(a, b *Song, statsA, statsB PlayStats) bool {
+			return field.number(a, statsA) < field.number(b, statsB)
+		}
+	case smartDate:
+		less = func(a, b *Song, statsA, statsB PlayStats) bool {
+			return field.date(a, statsA).Before(field.date(b, statsB))
+		}
+	default:
+		less = func(a, b *Song, _, _ PlayStats) bool {
+			return !field.flag(a) && field.flag(b)
+		}
+	}
+
+	if descending {
+		return func(_ uuid.UUID, a, b *Song, statsA, statsB PlayStats) bool {
+			return less(b, a, statsB, statsA)
+		}, nil
+	}
+	return func(_ uuid.UUID, a, b *Song, statsA, statsB PlayStats) bool {
+		return less(a, b, statsA, statsB)
+	}, nil
+}
+
+// shuffleKey is a song's place in a playlist's random order
+func shuffleKey(playlistID, songID uuid.UUID) string {
+	hash := sha1.Sum(append(playlistID[:], songID[:]...))
+	return string(hash[:])
+}
+
+// SetPlayStatsSource sets where smart playlists look up play counts and last-played
+// times. The library starts out with its own play history.
+func (ml *MusicLibrary) SetPlayStatsSource(source func(songID uuid.UUID) PlayStats) {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	ml.playStats = source
+}
+
+// evaluateSmart returns the IDs of the listed songs a spec picks, in order
+func (ml *MusicLibrary) evaluateSmart(playlistID uuid.UUID, spec SmartSpec) ([]uuid.UUID, error) {
+	matcher, err := spec.Rules.compile(time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
+	sortKey, err := compileSmartSort(spec.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	ml.mutex.RLock()
+	songs := make([]*Song, len(ml.Songs))
+	copy(songs, ml.Songs)
+	source := ml.playStats
+	ml.mutex.RUnlock()
+
+	// Songs and their stats stay paired through the sort
+	type candidate struct {
+		song  *Song
+		stats PlayStats
+	}
+	var matched []candidate
+	for _, song := range songs {
+		var stats PlayStats
+		if source != nil {
+			stats = source(song.ID)
+		}
+		if matcher(song, stats) {
+			matched = append(matched, candidate{song, stats})
+		}
+	}
+
+	if sortKey != nil {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return sortKey(playlistID, matched[i].song, matched[j].song, matched[i].stats, matched[j].stats)
+		})
+	}
+	if spec.Limit > 0 && len(matched) > spec.Limit {
+		matched = matched[:spec.Limit]
+	}
+
+	songIDs := make([]uuid.UUID, len(matched))
+	for i, candidate := range matched {
+		songIDs[i] = candidate.song.ID
+	}
+	return songIDs, nil
+}
+
+// CreateSmartPlaylist adds a smart playlist and fills it from the library
+func (ml *MusicLibrary) CreateSmartPlaylist(name string, spec SmartSpec) (Playlist, error) {
+	if err := spec.Validate(); err != nil {
+		return Playlist{}, err
+	}
+	id := uuid.New()
+	songIDs, err := ml.evaluateSmart(id, spec)
+	if err != nil {
+		return Playlist{}, err
+	}
+	return ml.playlists.createSmart(id, name, &spec, songIDs)
+}
+
+// UpdateSmartPlaylist renames a smart playlist and/or replaces its spec, refilling
+// it when the spec changes; nil leaves a field as is
+func (ml *MusicLibrary) UpdateSmartPlaylist(id string, name *string, spec *SmartSpec) (Playlist, error) {
+	var songIDs []uuid.UUID
+	if spec != nil {
+		if err := spec.Validate(); err != nil {
+			return Playlist{}, err
+		}
+		playlistID, err := uuid.Parse(id)
+		if err != nil {
+			return Playlist{}, ErrPlaylistNotFound
+		}
+		if songIDs, err = ml.evaluateSmart(playlistID, *spec); err != nil {
+			return Playlist{}, err
+		}
+	}
+	return ml.playlists.updateSmart(id, name, spec, songIDs)
+}
+
+// RefreshSmartPlaylists re-evaluates every smart playlist, for when the library or
+// the play history changes. Only playlists whose songs changed are saved and notified.
+func (ml *MusicLibrary) RefreshSmartPlaylists() {
+	ml.smartMutex.Lock()
+	defer ml.smartMutex.Unlock()
+	ml.lastSmartRefresh = time.Now()
+
+	results := make(map[string]smartResult)
+	for _, playlist := range ml.playlists.List() {
+		if playlist.Smart == nil {
+			continue
+		}
+		songIDs, err := ml.evaluateSmart(playlist.ID, *playlist.Smart)
+		if err != nil {
+			log.Printf("⚠️ [PLAYLISTS] Failed to evaluate smart playlist %q: %v", playlist.Name, err)
+			continue
+		}
+		results[playlist.ID.String()] = smartResult{spec: playlist.Smart, songIDs: songIDs}
+	}
+	if len(results) > 0 {
+		ml.playlists.setSmartSongs(results)
+	}
+}
+
+// smartPlaylistsStale reports whether smart playlists are due for a refresh
+// because time has passed, not because anything changed
+func (ml *MusicLibrary) smartPlaylistsStale() bool {
+	ml.smartMutex.Lock()
+	defer ml.smartMutex.Unlock()
+	return time.Since(ml.lastSmartRefresh) >= smartRefreshInterval
+}
@@ -3,9 +3,12 @@ package server
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/gorilla/mux"
 )
 
 // AuthContextKey is used for storing auth data in request context
@@ -15,6 +18,7 @@ const (
 	TokenContextKey AuthContextKey = "token"
 	UserAgentContextKey AuthContextKey = "userAgent"
 	ClientIPContextKey AuthContextKey = "clientIP"
+	DeviceContextKey AuthContextKey = "device"
 )
 
 // AuthMiddleware provides Bearer token authentication for protected endpoints
@@ -55,13 +59,6 @@ func (am *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		
-		// Validate token
-		if !am.serverManager.IsValidToken(token) {
-			log.Printf("❌ [AUTH] Invalid or expired token: %s...", truncateToken(token))
-			writeAuthError(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
-		}
-		
 		// Extract client information
 		clientIP := extractClientIP(r)
 		userAgent := r.Header.Get("User-Agent")
@@ -69,21 +66,63 @@ func (am *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 			userAgent = "unknown"
 		}
 		
-		log.Printf("✅ [AUTH] Valid token: %s... from %s", truncateToken(token), clientIP)
+		// Resolve the token to its device (claims unclaimed pairing codes for older clients)
+		credential, ok := am.serverManager.AuthenticateToken(token, userAgent)
+		if !ok {
+			log.Printf("❌ [AUTH] Invalid or expired token: %s", truncateToken(token))
+			writeAuthError(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+		
+		log.Printf("✅ [AUTH] Valid token: %s from %s (%s)", truncateToken(token), clientIP, credential.DeviceName)
 		
 		// Track device connection
-		am.serverManager.TrackDeviceConnection(token, clientIP, userAgent)
+		am.serverManager.TrackDeviceConnection(credential, clientIP, userAgent)
 		
 		// Add auth data to request context
 		ctx := context.WithValue(r.Context(), TokenContextKey, token)
 		ctx = context.WithValue(ctx, ClientIPContextKey, clientIP)
 		ctx = context.WithValue(ctx, UserAgentContextKey, userAgent)
+		ctx = context.WithValue(ctx, DeviceContextKey, credential)
 		
 		// Call next handler with enriched context
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// RequireAuthOrSignature is RequireAuth for HLS playlists and segments. Players fetch
+// those URLs themselves and can't always add the Authorization header, so a URL
+// signed for the song (see hls.go) is accepted in its place.
+func (am *AuthMiddleware) RequireAuthOrSignature(next http.HandlerFunc) http.HandlerFunc {
+	requireAuth := am.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || r.URL.Query().Get("sig") == "" {
+			requireAuth(w, r)
+			return
+		}
+		
+		credential, err := am.serverManager.hlsSigner.verify(mux.Vars(r)["songId"], r.URL.Query(), am.serverManager.credentials)
+		if err != nil {
+			log.Printf("❌ [AUTH] Rejected signed URL from %s: %v", extractClientIP(r), err)
+			writeAuthError(w, "Invalid or expired signature", http.StatusUnauthorized)
+			return
+		}
+		
+		clientIP := extractClientIP(r)
+		userAgent := r.Header.Get("User-Agent")
+		if userAgent == "" {
+			userAgent = "unknown"
+		}
+		am.serverManager.TrackDeviceConnection(credential, clientIP, userAgent)
+		
+		// No TokenContextKey: the signature stands in for the token, which it doesn't reveal
+		ctx := context.WithValue(r.Context(), ClientIPContextKey, clientIP)
+		ctx = context.WithValue(ctx, UserAgentContextKey, userAgent)
+		ctx = context.WithValue(ctx, DeviceContextKey, credential)
+		next(w, r.WithContext(ctx))
+	}
+}
+
 // TokenValidator provides token validation functionality
 type TokenValidator struct {
 	serverManager *ServerManager
@@ -118,6 +157,57 @@ func (tv *TokenValidator) GetTokenInfo(token string) map[string]interface{} {
 	return info
 }
 
+// RequireLoopback restricts an endpoint to requests from this machine. Granting
+// admin rights is one: no paired device can give them to itself or another.
+func (am *AuthMiddleware) RequireLoopback(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackRequest(r) {
+			log.Printf("❌ [AUTH] Rejected %s %s from %s: only allowed from this machine", r.Method, r.URL.Path, r.RemoteAddr)
+			writeAuthError(w, "Only allowed from the server itself", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RequireAuthUnlessLoopback is RequireAuth, except that requests from this machine
+// need no token
+func (am *AuthMiddleware) RequireAuthUnlessLoopback(next http.HandlerFunc) http.HandlerFunc {
+	requireAuth := am.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isLoopbackRequest(r) {
+			next(w, r)
+			return
+		}
+		requireAuth(w, r)
+	}
+}
+
+// RequireAuthOrPathToken is RequireAuth for DELETE /pair/{token}. The Android client
+// sends that request without an Authorization header, so presenting the token in the
+// path is accepted in its place. A pending pairing code is passed straight through:
+// authenticating with it would claim it and pair a device just to revoke it.
+func (am *AuthMiddleware) RequireAuthOrPathToken(next http.HandlerFunc) http.HandlerFunc {
+	requireAuth := am.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := mux.Vars(r)["token"]
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || (bearer != "" && bearer != token) {
+			requireAuth(w, r)
+			return
+		}
+
+		if am.serverManager.credentials.HasPairingCode(token) {
+			next(w, r.WithContext(context.WithValue(r.Context(), TokenContextKey, token)))
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+token)
+		requireAuth(w, r)
+	}
+}
+
 // Helper functions
 
 // extractClientIP gets the real client IP, considering proxy headers
@@ -144,6 +234,16 @@ func extractClientIP(r *http.Request) string {
 	return r.RemoteAddr
 }
 
+// isLoopbackRequest reports whether a request comes from this machine
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // truncateToken safely truncates a token for logging
 func truncateToken(token string) string {
 	if len(token) <= 8 {
@@ -32,14 +32,23 @@ type ServerManager struct {
 	// Music library
 	musicLibrary *models.MusicLibrary
 	
+	// Server-sent events for /events (see events.go)
+	events *EventHub
+	
+	// Converts streams for ?format= and ?maxBitrate= (see transcode.go)
+	transcoding *transcoding
+	
+	// Signs HLS URLs for players that can't send the Authorization header (see hls.go)
+	hlsSigner *urlSigner
+	
 	// Device tracking
 	connectedDevices []models.ConnectedDevice
 	devicesMutex     sync.RWMutex
 	
-	// Token management  
-	pairingTokens    map[string]time.Time // token -> expiration
-	tokensMutex      sync.RWMutex
-	currentPairingToken string
+	// Pairing codes and per-device credentials, persisted hashed (see pairing.go)
+	credentials         *models.CredentialStore
+	tokensMutex         sync.RWMutex
+	currentPairingToken string // pairing code currently shown in the QR code
 	
 	// QR code caching for fast loading
 	cachedQRBytes    []byte
@@ -60,7 +69,9 @@ func NewServerManager() *ServerManager {
 	
 	sm := &ServerManager{
 		Port:            8008,
-		pairingTokens:   make(map[string]time.Time),
+		credentials:     models.LoadCredentialStore(),
+		events:          NewEventHub(),
+		hlsSigner:       newURLSigner(),
 		ctx:             ctx,
 		cancelFunc:      cancel,
 	}
@@ -77,9 +88,15 @@ func NewServerManager() *ServerManager {
 // SetMusicLibrary connects a music library to the server manager
 func (sm *ServerManager) SetMusicLibrary(library *models.MusicLibrary) {
 	sm.musicLibrary = library
+	sm.events.watchLibrary(library)
 	log.Println("🎵 MusicLibrary connected to ServerManager")
 }
 
+// SetTranscoding sets up stream transcoding with the configured ffmpeg and cache size
+func (sm *ServerManager) SetTranscoding(ffmpegPath string, cacheMB int) {
+	sm.transcoding = newTranscoding(ffmpegPath, cacheMB)
+}
+
 // StartServer starts the HTTP server on port 8008
 func (sm *ServerManager) StartServer() error {
 	if sm.IsRunning {
@@ -98,9 +115,12 @@ func (sm *ServerManager) StartServer() error {
 	
 	// Create HTTP server
 	addr := fmt.Sprintf("0.0.0.0:%d", sm.Port)
+	// WriteTimeout only bounds regular API responses - /stream replaces it with a
+	// rolling per-chunk deadline (see stream.go) so long tracks aren't cut off
 	sm.server = &http.Server{
 		Addr:    addr,
 		Handler: sm.router,
+		ReadHeaderTimeout: 10 * time.Second,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -137,6 +157,9 @@ func (sm *ServerManager) StopServer() error {
 	
 	log.Println("🛑 Stopping BMA server...")
 	
+	// End event streams first, Shutdown would otherwise wait for them to time out
+	sm.events.Shutdown()
+	
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -153,7 +176,7 @@ func (sm *ServerManager) StopServer() error {
 	sm.ClearQRCache() // Clear QR cache when server stops
 	sm.ServerURL = ""
 	sm.clearConnectedDevices()
-	sm.revokeAllTokens()
+	sm.revokePairingCodes() // paired devices keep their credentials across restarts
 	
 	log.Println("✅ Server stopped successfully")
 	return nil
@@ -233,17 +256,16 @@ func (sm *ServerManager) getLocalIPAddress() string {
 
 // Device tracking methods
 
-// TrackDeviceConnection tracks a successful device connection
-func (sm *ServerManager) TrackDeviceConnection(token, ipAddress, userAgent string) {
+// TrackDeviceConnection records activity from a paired device
+func (sm *ServerManager) TrackDeviceConnection(credential models.DeviceCredential, ipAddress, userAgent string) {
 	sm.devicesMutex.Lock()
 	defer sm.devicesMutex.Unlock()
 	
-	deviceName := sm.parseDeviceName(userAgent)
-	
 	// Check if device already exists (update last seen)
 	for i, device := range sm.connectedDevices {
-		if device.Token == token {
+		if device.DeviceID == credential.DeviceID {
 			sm.connectedDevices[i].LastSeenAt = time.Now()
+			sm.connectedDevices[i].IPAddress = ipAddress
 			log.Printf("📱 Updated device activity: %s", sm.connectedDevices[i].DeviceName)
 			return
 		}
@@ -252,8 +274,9 @@ func (sm *ServerManager) TrackDeviceConnection(token, ipAddress, userAgent strin
 	// Add new device
 	device := models.ConnectedDevice{
 		ID:          uuid.New(),
-		Token:       token,
-		DeviceName:  deviceName,
+		DeviceID:    credential.DeviceID,
+		Token:       credential.Token,
+		DeviceName:  credential.DeviceName,
 		IPAddress:   ipAddress,
 		UserAgent:   userAgent,
 		ConnectedAt: time.Now(),
@@ -267,24 +290,34 @@ func (sm *ServerManager) TrackDeviceConnection(token, ipAddress, userAgent strin
 	sm.cleanupInactiveDevices()
 }
 
-// DisconnectDevice removes a device by token
+// DisconnectDevice removes the device using token and revokes its credential.
+// Other paired devices keep their own credentials and stay connected.
 func (sm *ServerManager) DisconnectDevice(token string) bool {
+	removed := sm.removeConnectedDevices(func(device models.ConnectedDevice) bool {
+		return device.Token == token
+	})
+	
+	sm.revokePairingToken(token)
+	return removed > 0
+}
+
+// removeConnectedDevices drops every connected device matching the predicate
+func (sm *ServerManager) removeConnectedDevices(match func(models.ConnectedDevice) bool) int {
 	sm.devicesMutex.Lock()
 	defer sm.devicesMutex.Unlock()
 	
-	for i, device := range sm.connectedDevices {
-		if device.Token == token {
-			// Remove device
-			sm.connectedDevices = append(sm.connectedDevices[:i], sm.connectedDevices[i+1:]...)
+	remaining := []models.ConnectedDevice{}
+	for _, device := range sm.connectedDevices {
+		if match(device) {
 			log.Printf("📱 Device disconnected: %s (%s)", device.DeviceName, device.IPAddress)
-			
-			// Revoke token
-			sm.revokePairingToken(token)
-			return true
+			continue
 		}
+		remaining = append(remaining, device)
 	}
 	
-	return false
+	removed := len(sm.connectedDevices) - len(remaining)
+	sm.connectedDevices = remaining
+	return removed
 }
 
 // GetConnectedDevices returns a copy of connected devices
@@ -335,6 +368,7 @@ func (sm *ServerManager) startDeviceMonitor() {
 			case <-ticker.C:
 				if sm.IsRunning {
 					sm.cleanupInactiveDevices()
+					sm.credentials.PruneExpired()
 				}
 			case <-sm.ctx.Done():
 				return
@@ -385,129 +419,6 @@ func containsAtIndex(s, substr string) bool {
 	return false
 }
 
-// Token management methods
-
-// GeneratePairingToken creates a new pairing token with expiration
-func (sm *ServerManager) GeneratePairingToken(expiresInMinutes int) string {
-	sm.tokensMutex.Lock()
-	defer sm.tokensMutex.Unlock()
-	
-	// If we already have a valid current token and connected devices, reuse it
-	if sm.currentPairingToken != "" {
-		if expiration, exists := sm.pairingTokens[sm.currentPairingToken]; exists && time.Now().Before(expiration) {
-			// Check if we have connected devices using this token
-			sm.devicesMutex.RLock()
-			hasConnectedDevices := len(sm.connectedDevices) > 0
-			sm.devicesMutex.RUnlock()
-			
-			if hasConnectedDevices {
-				log.Printf("🔄 Reusing existing token: %s... (devices already connected)", sm.currentPairingToken[:8])
-				return sm.currentPairingToken
-			}
-		}
-	}
-	
-	token := uuid.New().String()
-	expiration := time.Now().Add(time.Duration(expiresInMinutes) * time.Minute)
-	
-	sm.pairingTokens[token] = expiration
-	sm.currentPairingToken = token
-	
-	// Clean up expired tokens
-	sm.cleanupExpiredTokensUnsafe()
-	
-	// Clear QR cache when new token is generated (prevents stale token issues)
-	go sm.ClearQRCache()
-	
-	log.Printf("🔑 Generated NEW pairing token: %s... (expires in %d minutes, now have %d tokens)", token[:8], expiresInMinutes, len(sm.pairingTokens))
-	return token
-}
-
-// IsValidToken checks if a token is valid and not expired
-func (sm *ServerManager) IsValidToken(token string) bool {
-	sm.tokensMutex.RLock()
-	defer sm.tokensMutex.RUnlock()
-	
-	expiration, exists := sm.pairingTokens[token]
-	if !exists {
-		log.Printf("🔍 [DEBUG] Token %s... not found in pairingTokens map (has %d tokens)", token[:8], len(sm.pairingTokens))
-		// Debug: Show what tokens ARE in the map
-		log.Printf("🔍 [DEBUG] Available tokens in map:")
-		for storedToken := range sm.pairingTokens {
-			log.Printf("🔍 [DEBUG]   - %s...", storedToken[:8])
-		}
-		return false
-	}
-	
-	// Check if token is expired
-	if time.Now().After(expiration) {
-		// Remove expired token (but need to upgrade to write lock)
-		sm.tokensMutex.RUnlock()
-		sm.tokensMutex.Lock()
-		delete(sm.pairingTokens, token)
-		if sm.currentPairingToken == token {
-			sm.currentPairingToken = ""
-		}
-		sm.tokensMutex.Unlock()
-		sm.tokensMutex.RLock()
-		return false
-	}
-	
-	return true
-}
-
-// revokePairingToken removes a specific token
-func (sm *ServerManager) revokePairingToken(token string) {
-	sm.tokensMutex.Lock()
-	defer sm.tokensMutex.Unlock()
-	
-	delete(sm.pairingTokens, token)
-	if sm.currentPairingToken == token {
-		sm.currentPairingToken = ""
-		// Clear QR cache when current token is revoked to prevent stale QR codes
-		go sm.ClearQRCache()
-	}
-	log.Printf("🔒 Revoked pairing token: %s...", token[:8])
-}
-
-// revokeAllTokens removes all tokens
-func (sm *ServerManager) revokeAllTokens() {
-	sm.tokensMutex.Lock()
-	defer sm.tokensMutex.Unlock()
-	
-	sm.pairingTokens = make(map[string]time.Time)
-	sm.currentPairingToken = ""
-	log.Println("🔒 All pairing tokens revoked")
-	
-	// Clear QR cache when all tokens are revoked to prevent stale QR codes
-	go sm.ClearQRCache()
-}
-
-// cleanupExpiredTokensUnsafe removes expired tokens (assumes write lock held)
-func (sm *ServerManager) cleanupExpiredTokensUnsafe() {
-	now := time.Now()
-	for token, expiration := range sm.pairingTokens {
-		if now.After(expiration) {
-			delete(sm.pairingTokens, token)
-			if sm.currentPairingToken == token {
-				sm.currentPairingToken = ""
-			}
-		}
-	}
-}
-
-// GetCurrentPairingToken returns the current pairing token
-func (sm *ServerManager) GetCurrentPairingToken() string {
-	sm.tokensMutex.RLock()
-	defer sm.tokensMutex.RUnlock()
-	return sm.currentPairingToken
-}
-
-// RevokePairingToken removes a specific token (public method for UI)
-func (sm *ServerManager) RevokePairingToken(token string) {
-	sm.revokePairingToken(token)
-}
-
 // Router setup
 
 // setupRouter initializes the HTTP router with all endpoints
@@ -589,6 +500,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // QR Code Generation Methods
 
 // GenerateQRCode creates a QR code for device pairing with caching for speed
@@ -670,8 +586,8 @@ func (sm *ServerManager) GetPairingDataAsJSON() (string, error) {
 	
 	sm.tokensMutex.RLock()
 	if sm.currentPairingToken != "" {
-		if expiration, exists := sm.pairingTokens[sm.currentPairingToken]; exists && time.Now().Before(expiration) {
-			// Use existing valid token
+		if expiration, ok := sm.credentials.PairingCodeExpiry(sm.currentPairingToken); ok {
+			// Use existing valid code
 			token = sm.currentPairingToken
 			expiresAt = expiration
 			log.Printf("🔄 Using existing token for QR: %s...", token[:8])
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"bma-go/internal/models"
+	"github.com/google/uuid"
+)
+
+// Pairing works in two steps. The QR code (or POST /pair) hands out a short-lived,
+// one-time pairing code. A device exchanges it at POST /pair/claim for its own
+// long-lived credential, so every phone has a separate token that can be revoked
+// on its own. Older clients send the code straight back as a bearer token; the
+// first such request claims the code implicitly and it becomes their credential.
+//
+// Codes and credentials live in a models.CredentialStore, which persists them
+// (hashed) so paired phones survive a server restart.
+
+// deviceCredentialLifetime is how long a claimed device credential stays valid
+const deviceCredentialLifetime = 365 * 24 * time.Hour
+
+// errInvalidPairingCode is returned when a code is unknown, expired or already claimed
+var errInvalidPairingCode = errors.New("invalid or expired pairing code")
+
+// GeneratePairingToken creates a new one-time pairing code with expiration
+func (sm *ServerManager) GeneratePairingToken(expiresInMinutes int) string {
+	sm.tokensMutex.Lock()
+	defer sm.tokensMutex.Unlock()
+
+	code := uuid.New().String()
+	expiration := time.Now().Add(time.Duration(expiresInMinutes) * time.Minute)
+
+	// Also prunes expired codes and credentials
+	sm.credentials.AddPairingCode(code, expiration)
+	sm.currentPairingToken = code
+
+	// Clear QR cache when new code is generated (prevents stale code issues)
+	go sm.ClearQRCache()
+
+	log.Printf("🔑 Generated NEW pairing code: %s... (expires in %d minutes)", code[:8], expiresInMinutes)
+	return code
+}
+
+// ClaimPairingCode exchanges a one-time pairing code for a new device credential
+func (sm *ServerManager) ClaimPairingCode(code, deviceName string) (models.DeviceCredential, error) {
+	return sm.claimPairingCode(code, uuid.New().String(), deviceName)
+}
+
+// claimPairingCode consumes a pairing code and issues a credential with the given token
+func (sm *ServerManager) claimPairingCode(code, token, deviceName string) (models.DeviceCredential, error) {
+	deviceName = strings.TrimSpace(deviceName)
+	if deviceName == "" {
+		deviceName = "Unknown Device"
+	}
+
+	now := time.Now()
+	credential, ok := sm.credentials.ClaimPairingCode(code, token, models.DeviceCredential{
+		DeviceID:   uuid.New(),
+		DeviceName: deviceName,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(deviceCredentialLifetime),
+		LastUsedAt: now,
+	})
+	if !ok {
+		return models.DeviceCredential{}, errInvalidPairingCode
+	}
+
+	// The QR code shows a spent code now, so the next one needs a fresh code
+	sm.tokensMutex.Lock()
+	if sm.currentPairingToken == code {
+		sm.currentPairingToken = ""
+		go sm.ClearQRCache()
+	}
+	sm.tokensMutex.Unlock()
+
+	log.Printf("🔐 Pairing code %s claimed by %s (device %s)", truncateToken(code), deviceName, credential.DeviceID)
+	return credential, nil
+}
+
+// AuthenticateToken resolves a bearer token to the device it belongs to. An unclaimed
+// pairing code is claimed on the spot for clients that skip /pair/claim.
+func (sm *ServerManager) AuthenticateToken(token, userAgent string) (models.DeviceCredential, bool) {
+	if credential, ok := sm.credentials.LookupDevice(token); ok {
+		return credential, true
+	}
+
+	credential, err := sm.claimPairingCode(token, token, sm.parseDeviceName(userAgent))
+	if err != nil {
+		return models.DeviceCredential{}, false
+	}
+	return credential, true
+}
+
+// IsValidToken checks if a token is a live device credential or an unclaimed pairing code
+func (sm *ServerManager) IsValidToken(token string) bool {
+	if _, ok := sm.credentials.LookupDevice(token); ok {
+		return true
+	}
+	return sm.credentials.HasPairingCode(token)
+}
+
+// revokePairingToken removes a pairing code or a device credential, returning the
+// device the credential belonged to
+func (sm *ServerManager) revokePairingToken(token string) (models.DeviceCredential, bool) {
+	credential, wasDevice := sm.credentials.RevokeToken(token)
+	if wasDevice {
+		log.Printf("🔒 Revoked credential for %s (device %s)", credential.DeviceName, credential.DeviceID)
+		sm.events.Kick(func(subscriber *eventSubscriber) bool {
+			return subscriber.token == token
+		}, "token-revoked", map[string]interface{}{"deviceId": credential.DeviceID.String()})
+	}
+
+	sm.tokensMutex.Lock()
+	defer sm.tokensMutex.Unlock()
+
+	if sm.currentPairingToken == token {
+		sm.currentPairingToken = ""
+		// Clear QR cache when current code is revoked to prevent stale QR codes
+		go sm.ClearQRCache()
+	}
+	log.Printf("🔒 Revoked pairing token: %s", truncateToken(token))
+	return credential, wasDevice
+}
+
+// RevokeDevice revokes every credential held by a device and disconnects it
+func (sm *ServerManager) RevokeDevice(deviceID uuid.UUID) bool {
+	revoked := sm.credentials.RevokeDevice(deviceID)
+	for _, credential := range revoked {
+		log.Printf("🔒 Revoked credential for %s (device %s)", credential.DeviceName, deviceID)
+	}
+	sm.events.Kick(func(subscriber *eventSubscriber) bool {
+		return subscriber.deviceID == deviceID
+	}, "token-revoked", map[string]interface{}{"deviceId": deviceID.String()})
+
+	sm.removeConnectedDevices(func(device models.ConnectedDevice) bool {
+		return device.DeviceID == deviceID
+	})
+	return len(revoked) > 0
+}
+
+// revokePairingCodes invalidates every pending pairing code but keeps paired devices,
+// so stopping the server doesn't force phones to pair again
+func (sm *ServerManager) revokePairingCodes() {
+	sm.credentials.RevokePairingCodes()
+
+	sm.tokensMutex.Lock()
+	defer sm.tokensMutex.Unlock()
+
+	sm.currentPairingToken = ""
+	log.Println("🔒 All pending pairing codes revoked")
+
+	// Clear QR cache so a stopped-and-restarted server never shows a dead code
+	go sm.ClearQRCache()
+}
+
+// revokeAllTokens removes all pairing codes and device credentials
+func (sm *ServerManager) revokeAllTokens() {
+	sm.credentials.RevokeAll()
+	sm.events.Kick(func(*eventSubscriber) bool { return true }, "token-revoked", map[string]interface{}{})
+
+	sm.tokensMutex.Lock()
+	defer sm.tokensMutex.Unlock()
+
+	sm.currentPairingToken = ""
+	log.Println("🔒 All pairing codes and device credentials revoked")
+
+	// Clear QR cache when all tokens are revoked to prevent stale QR codes
+	go sm.ClearQRCache()
+}
+
+// GetCurrentPairingToken returns the pairing code currently shown in the QR code
+func (sm *ServerManager) GetCurrentPairingToken() string {
+	sm.tokensMutex.RLock()
+	defer sm.tokensMutex.RUnlock()
+	return sm.currentPairingToken
+}
+
+// RevokePairingToken removes a specific code or credential and disconnects the device
+// that held it (public method for UI and DELETE /pair/{token})
+func (sm *ServerManager) RevokePairingToken(token string) {
+	credential, wasDevice := sm.revokePairingToken(token)
+	sm.removeConnectedDevices(func(device models.ConnectedDevice) bool {
+		return device.Token == token || (wasDevice && device.DeviceID == credential.DeviceID)
+	})
+}
+
+// RevokeAllDevices unpairs every device (public method for UI)
+func (sm *ServerManager) RevokeAllDevices() {
+	sm.revokeAllTokens()
+	sm.clearConnectedDevices()
+}
+
+// GetPairedDevices returns the devices holding a credential, without their tokens
+func (sm *ServerManager) GetPairedDevices() []models.DeviceCredential {
+	return sm.credentials.PairedDevices()
+}
+
+// SetDeviceAdmin grants or withdraws a paired device's right to revoke other devices
+func (sm *ServerManager) SetDeviceAdmin(deviceID uuid.UUID, admin bool) bool {
+	if !sm.credentials.SetAdmin(deviceID, admin) {
+		return false
+	}
+	log.Printf("🛡️ Admin rights for device %s set to %t", deviceID, admin)
+	return true
+}
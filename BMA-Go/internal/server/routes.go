@@ -1,15 +1,19 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"time"
 
 	"bma-go/internal/models"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -25,13 +29,46 @@ func (sm *ServerManager) setupRoutes() {
 	sm.router.HandleFunc("/health", sm.handleHealth).Methods("GET")
 	sm.router.HandleFunc("/info", sm.handleInfo).Methods("GET")
 	sm.router.HandleFunc("/pair", sm.handlePair).Methods("POST")
+	sm.router.HandleFunc("/pair/claim", sm.handleClaimPairing).Methods("POST")
 	
 	// Authenticated endpoints (require Bearer token)
 	sm.router.HandleFunc("/disconnect", authMiddleware.RequireAuth(sm.handleDisconnect)).Methods("POST")
+	sm.router.HandleFunc("/pair/{token}", authMiddleware.RequireAuthOrPathToken(sm.handleRevokePairing)).Methods("DELETE")
+	sm.router.HandleFunc("/devices", authMiddleware.RequireAuthUnlessLoopback(sm.handlePairedDevices)).Methods("GET")
+	sm.router.HandleFunc("/devices/{deviceId}/admin", authMiddleware.RequireLoopback(sm.handleSetDeviceAdmin)).Methods("PUT")
 	sm.router.HandleFunc("/heartbeat", authMiddleware.RequireAuth(sm.handleHeartbeat)).Methods("POST")
+	sm.router.HandleFunc("/events", authMiddleware.RequireAuth(sm.handleEvents)).Methods("GET")
 	sm.router.HandleFunc("/songs", authMiddleware.RequireAuth(sm.handleSongs)).Methods("GET")
-	sm.router.HandleFunc("/stream/{songId}", authMiddleware.RequireAuth(sm.handleStream)).Methods("GET")
+	sm.router.HandleFunc("/library/changes", authMiddleware.RequireAuth(sm.handleLibraryChanges)).Methods("GET")
+	sm.router.HandleFunc("/library/duplicates", authMiddleware.RequireAuth(sm.handleDuplicates)).Methods("GET")
+	sm.router.HandleFunc("/library/scan", authMiddleware.RequireAuth(sm.handleScanStatus)).Methods("GET")
+	sm.router.HandleFunc("/library/roots", authMiddleware.RequireAuth(sm.handleLibraryRoots)).Methods("GET")
+	sm.router.HandleFunc("/albums", authMiddleware.RequireAuth(sm.handleAlbums)).Methods("GET")
+	sm.router.HandleFunc("/albums/{albumId}", authMiddleware.RequireAuth(sm.handleAlbum)).Methods("GET")
+	sm.router.HandleFunc("/artists", authMiddleware.RequireAuth(sm.handleArtists)).Methods("GET")
+	sm.router.HandleFunc("/artists/{artistId}", authMiddleware.RequireAuth(sm.handleArtist)).Methods("GET")
+	sm.router.HandleFunc("/folders", authMiddleware.RequireAuth(sm.handleFolders)).Methods("GET")
+	sm.router.HandleFunc("/search", authMiddleware.RequireAuth(sm.handleSearch)).Methods("GET")
+	sm.router.HandleFunc("/playlists", authMiddleware.RequireAuth(sm.handlePlaylists)).Methods("GET")
+	sm.router.HandleFunc("/playlists", authMiddleware.RequireAuth(sm.handleCreatePlaylist)).Methods("POST")
+	sm.router.HandleFunc("/playlists/{playlistId}", authMiddleware.RequireAuth(sm.handlePlaylist)).Methods("GET")
+	sm.router.HandleFunc("/playlists/{playlistId}", authMiddleware.RequireAuth(sm.handleUpdatePlaylist)).Methods("PUT")
+	sm.router.HandleFunc("/playlists/{playlistId}", authMiddleware.RequireAuth(sm.handleDeletePlaylist)).Methods("DELETE")
+	sm.router.HandleFunc("/playlists/{playlistId}/tracks", authMiddleware.RequireAuth(sm.handleAddPlaylistTracks)).Methods("POST")
+	sm.router.HandleFunc("/playlists/{playlistId}/tracks/move", authMiddleware.RequireAuth(sm.handleMovePlaylistTrack)).Methods("POST")
+	sm.router.HandleFunc("/playlists/{playlistId}/tracks/{position:[0-9]+}", authMiddleware.RequireAuth(sm.handleRemovePlaylistTrack)).Methods("DELETE")
+	sm.router.HandleFunc("/playlists/{playlistId}/export", authMiddleware.RequireAuth(sm.handleExportPlaylist)).Methods("GET")
+	sm.router.HandleFunc("/scrobble", authMiddleware.RequireAuth(sm.handleScrobble)).Methods("POST")
+	sm.router.HandleFunc("/now-playing", authMiddleware.RequireAuth(sm.handleNowPlaying)).Methods("GET")
+	sm.router.HandleFunc("/history", authMiddleware.RequireAuth(sm.handleHistory)).Methods("GET")
+	sm.router.HandleFunc("/stats/{kind:top-songs|top-albums|top-artists}", authMiddleware.RequireAuth(sm.handleTopStats)).Methods("GET")
+	sm.router.HandleFunc("/stream/{songId}", authMiddleware.RequireAuth(sm.handleStream)).Methods("GET", "HEAD")
+	sm.router.HandleFunc("/hls/{songId}/url", authMiddleware.RequireAuth(sm.handleHLSURL)).Methods("GET")
+	sm.router.HandleFunc("/hls/{songId}/index.m3u8", authMiddleware.RequireAuthOrSignature(sm.handleHLSMaster)).Methods("GET")
+	sm.router.HandleFunc("/hls/{songId}/{variant}/index.m3u8", authMiddleware.RequireAuthOrSignature(sm.handleHLSMedia)).Methods("GET")
+	sm.router.HandleFunc("/hls/{songId}/{variant}/{segment:[0-9]+}.ts", authMiddleware.RequireAuthOrSignature(sm.handleHLSSegment)).Methods("GET")
 	sm.router.HandleFunc("/artwork/{songId}", authMiddleware.RequireAuth(sm.handleArtwork)).Methods("GET")
+	sm.router.HandleFunc("/artwork/album/{albumId}", authMiddleware.RequireAuth(sm.handleAlbumArtwork)).Methods("GET")
 	
 	log.Println("✅ All API routes configured")
 }
@@ -96,7 +133,7 @@ func (sm *ServerManager) handleInfo(w http.ResponseWriter, r *http.Request) {
 	log.Printf("✅ Server info sent successfully (albums: %d, songs: %d)", albumCount, songCount)
 }
 
-// handlePair creates a new pairing token for device authentication
+// handlePair creates a new one-time pairing code for device authentication
 func (sm *ServerManager) handlePair(w http.ResponseWriter, r *http.Request) {
 	log.Println("📱 Pairing request received")
 	
@@ -123,6 +160,50 @@ func (sm *ServerManager) handlePair(w http.ResponseWriter, r *http.Request) {
 	log.Printf("✅ Pairing token generated: %s... (expires in 60 minutes)", token[:8])
 }
 
+// handleClaimPairing exchanges a one-time pairing code for a device credential
+func (sm *ServerManager) handleClaimPairing(w http.ResponseWriter, r *http.Request) {
+	log.Println("📱 Pairing claim received")
+	
+	var request struct {
+		Code       string `json:"code"`
+		DeviceName string `json:"deviceName"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&request); err != nil || request.Code == "" {
+		log.Printf("❌ Invalid pairing claim body: %v", err)
+		http.Error(w, "Expected JSON body with a pairing code", http.StatusBadRequest)
+		return
+	}
+	
+	deviceName := request.DeviceName
+	if deviceName == "" {
+		deviceName = sm.parseDeviceName(r.Header.Get("User-Agent"))
+	}
+	
+	credential, err := sm.ClaimPairingCode(request.Code, deviceName)
+	if err != nil {
+		log.Printf("❌ Pairing claim rejected: %v", err)
+		writeAuthError(w, "Invalid or expired pairing code", http.StatusUnauthorized)
+		return
+	}
+	
+	response := map[string]interface{}{
+		"deviceId":   credential.DeviceID.String(),
+		"deviceName": credential.DeviceName,
+		"token":      credential.Token,
+		"createdAt":  credential.CreatedAt,
+		"expiresAt":  credential.ExpiresAt,
+		"serverUrl":  sm.GetServerURL(),
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("❌ Failed to encode pairing claim response: %v", err)
+		return
+	}
+	
+	log.Printf("✅ Device paired: %s (%s)", credential.DeviceName, credential.DeviceID)
+}
+
 // Authenticated endpoints
 
 // handleDisconnect removes a device from connected devices list
@@ -163,6 +244,127 @@ func (sm *ServerManager) handleDisconnect(w http.ResponseWriter, r *http.Request
 	log.Println("✅ Disconnect response sent successfully")
 }
 
+// handleRevokePairing revokes a pairing code or device credential. A device may only
+// revoke its own token unless its credential has admin rights. Admins never see other
+// devices' tokens, so they may name a paired device by its ID instead.
+func (sm *ServerManager) handleRevokePairing(w http.ResponseWriter, r *http.Request) {
+	target := mux.Vars(r)["token"]
+	token, _ := r.Context().Value(TokenContextKey).(string)
+	credential, authenticated := r.Context().Value(DeviceContextKey).(models.DeviceCredential)
+
+	requester := credential.DeviceName
+	if !authenticated {
+		requester = "the holder of a pending pairing code"
+	}
+
+	switch {
+	case target == token:
+		log.Printf("🔒 Revoke request for token %s from %s", truncateToken(target), requester)
+		sm.RevokePairingToken(target)
+
+	case !credential.Admin:
+		log.Printf("❌ [AUTH] %s tried to revoke another device's token", requester)
+		writeAuthError(w, "Devices may only revoke their own token", http.StatusForbidden)
+		return
+
+	case sm.IsValidToken(target):
+		log.Printf("🔒 Revoke request for token %s from admin %s", truncateToken(target), requester)
+		sm.RevokePairingToken(target)
+
+	default:
+		deviceID, err := uuid.Parse(target)
+		if err != nil || !sm.RevokeDevice(deviceID) {
+			http.Error(w, "Token or device not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("🔒 Admin %s revoked device %s", requester, deviceID)
+	}
+
+	response := map[string]string{
+		"status":  "revoked",
+		"message": "Pairing token revoked",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("❌ Failed to encode revoke response: %v", err)
+		return
+	}
+}
+
+// requireAdmin answers 403 unless the requesting device has admin rights
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	credential, _ := r.Context().Value(DeviceContextKey).(models.DeviceCredential)
+	if !credential.Admin {
+		log.Printf("❌ [AUTH] %s tried to manage paired devices without admin rights", credential.DeviceName)
+		writeAuthError(w, "Admin rights required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handlePairedDevices lists every paired device, oldest first, for admins and for
+// requests from this machine
+func (sm *ServerManager) handlePairedDevices(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackRequest(r) && !requireAdmin(w, r) {
+		return
+	}
+
+	connected := make(map[uuid.UUID]bool)
+	for _, device := range sm.GetConnectedDevices() {
+		connected[device.DeviceID] = true
+	}
+
+	paired := sm.GetPairedDevices()
+	sort.Slice(paired, func(i, j int) bool { return paired[i].CreatedAt.Before(paired[j].CreatedAt) })
+
+	devices := make([]map[string]interface{}, 0, len(paired))
+	for _, device := range paired {
+		devices = append(devices, map[string]interface{}{
+			"deviceId":   device.DeviceID.String(),
+			"deviceName": device.DeviceName,
+			"admin":      device.Admin,
+			"connected":  connected[device.DeviceID],
+			"createdAt":  device.CreatedAt.Format(time.RFC3339),
+			"lastUsedAt": device.LastUsedAt.Format(time.RFC3339),
+		})
+	}
+	if err := writeJSONResponse(w, devices); err != nil {
+		log.Printf("❌ Failed to encode paired devices: %v", err)
+	}
+}
+
+// handleSetDeviceAdmin grants or withdraws admin rights with {"admin": true|false}.
+// Only requests from this machine get here, so pairing never grants them.
+func (sm *ServerManager) handleSetDeviceAdmin(w http.ResponseWriter, r *http.Request) {
+	deviceID, err := uuid.Parse(mux.Vars(r)["deviceId"])
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Admin *bool `json:"admin"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&request); err != nil || request.Admin == nil {
+		http.Error(w, `Expected {"admin": true|false}`, http.StatusBadRequest)
+		return
+	}
+
+	if !sm.SetDeviceAdmin(deviceID, *request.Admin) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	response := map[string]interface{}{
+		"deviceId": deviceID.String(),
+		"admin":    *request.Admin,
+	}
+	if err := writeJSONResponse(w, response); err != nil {
+		log.Printf("❌ Failed to encode admin response: %v", err)
+	}
+}
+
 // handleHeartbeat processes device heartbeat pings for connection monitoring
 func (sm *ServerManager) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 	// Auth middleware already called TrackDeviceConnection(), so device activity is updated
@@ -180,7 +382,7 @@ func (sm *ServerManager) handleHeartbeat(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// handleSongs returns the list of all songs with album organization
+// handleSongs returns the songs in library order, optionally paged and projected (see paging.go)
 func (sm *ServerManager) handleSongs(w http.ResponseWriter, r *http.Request) {
 	// Extract token for logging
 	if token, ok := r.Context().Value(TokenContextKey).(string); ok {
@@ -196,51 +398,94 @@ func (sm *ServerManager) handleSongs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Parse projection and paging before touching the library
+	fields, err := parseFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	libraryVersion := sm.musicLibrary.GetLibraryVersion()
+	page, status, err := parsePage(r, libraryVersion)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	
 	// Get songs from the music library
 	librarySongs := sm.musicLibrary.GetSongs()
-	log.Printf("📊 Retrieved %d songs from music library", len(librarySongs))
+	start, end := 0, len(librarySongs)
+	if page.Paged {
+		start, end = page.bounds(len(librarySongs))
+	}
 	
 	// Convert songs to JSON-compatible format
-	songs := make([]map[string]interface{}, len(librarySongs))
-	for i, song := range librarySongs {
-		songs[i] = map[string]interface{}{
-			"id":              song.ID.String(),
-			"filename":        song.Filename,
-			"title":           song.Title,
-			"artist":          song.Artist,
-			"album":           song.Album,
-			"trackNumber":     song.TrackNumber,
-			"parentDirectory": song.ParentDirectory,
-			"hasArtwork":      song.HasArtwork(),
-			"sortOrder":       i, // Explicit sort order for Android to maintain
-		}
+	songs := make([]map[string]interface{}, 0, end-start)
+	for i := start; i < end; i++ {
+		song := songPayload(librarySongs[i])
+		song["sortOrder"] = i // Explicit sort order for Android to maintain
+		songs = append(songs, projectFields(song, fields))
 	}
 	
-	// Debug: Log the exact order being sent to Android
-	log.Printf("📊 [DEBUG] Sending songs to Android in this order:")
-	for i, song := range librarySongs {
-		if i < 10 { // Show first 10 songs
-			log.Printf("📊 [DEBUG]   %d: %s - %s (Track: %d, Album: %s)", 
-				i+1, song.Artist, song.Title, song.TrackNumber, song.Album)
+	log.Printf("📊 Returning songs %d-%d of %d to client", start, end, len(librarySongs))
+	
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(librarySongs)))
+	w.Header().Set("X-Library-Version", strconv.FormatInt(libraryVersion, 10))
+	
+	// Unpaged requests keep the plain array older clients expect
+	var response interface{} = songs
+	if page.Paged {
+		envelope := map[string]interface{}{
+			"songs":          songs,
+			"total":          len(librarySongs),
+			"offset":         start,
+			"limit":          page.Limit,
+			"libraryVersion": libraryVersion,
 		}
-	}
-	if len(librarySongs) > 10 {
-		log.Printf("📊 [DEBUG]   ... and %d more songs", len(librarySongs)-10)
+		if end < len(librarySongs) {
+			envelope["nextCursor"] = encodeCursor(libraryVersion, end)
+		}
+		response = envelope
 	}
 	
-	log.Printf("📊 Returning %d songs to client", len(songs))
-	
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(songs); err != nil {
+	if err := writeJSONResponse(w, response); err != nil {
 		log.Printf("❌ Failed to encode songs data: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	
 	log.Println("✅ Songs list sent successfully")
 }
 
-// handleStream serves MP3 file content for a given song ID
+// handleLibraryChanges returns the songs added, updated and removed since ?since=<libraryVersion>
+func (sm *ServerManager) handleLibraryChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		http.Error(w, "Expected ?since=<libraryVersion>", http.StatusBadRequest)
+		return
+	}
+	
+	fields, err := parseFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	var delta models.LibraryDelta
+	if sm.musicLibrary != nil {
+		delta = sm.musicLibrary.ChangesSince(since)
+	} else {
+		delta = models.LibraryDelta{Since: since, FullSync: since != 0}
+	}
+	
+	log.Printf("🔄 Library changes since %d: +%d ~%d -%d (full sync: %v)", since, len(delta.Added), len(delta.Updated), len(delta.Removed), delta.FullSync)
+	
+	if err := writeJSONResponse(w, libraryDeltaPayload(delta, fields)); err != nil {
+		log.Printf("❌ Failed to encode library changes: %v", err)
+	}
+}
+
+// handleStream serves audio file content for a given song ID, honouring byte ranges.
+// ?format=mp3|opus and ?maxBitrate= (kbps) ask for a transcoded stream.
 func (sm *ServerManager) handleStream(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	songID := vars["songId"]
@@ -250,6 +495,13 @@ func (sm *ServerManager) handleStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	query := r.URL.Query()
+	transcodeOptions, err := models.ParseTranscodeOptions(query.Get("format"), query.Get("maxBitrate"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
 	log.Printf("🎵 Stream requested for song ID: %s", songID)
 	
 	// Check if music library is available
@@ -272,15 +524,33 @@ func (sm *ServerManager) handleStream(w http.ResponseWriter, r *http.Request) {
 	
 	// Check if file exists
 	if _, err := os.Stat(song.Path); os.IsNotExist(err) {
-		log.Printf("❌ MP3 file not found at path: %s", song.Path)
+		log.Printf("❌ Audio file not found at path: %s", song.Path)
 		http.Error(w, "Music file not found", http.StatusNotFound)
 		return
 	}
 	
-	// Stream the MP3 file
-	if err := writeFileResponse(w, song.Path, "audio/mpeg"); err != nil {
-		log.Printf("❌ Failed to stream MP3 file: %v", err)
-		http.Error(w, "Failed to stream file", http.StatusInternalServerError)
+	// Convert the song when the client asked for another format or a lower bitrate
+	if transcodeOptions != nil {
+		served, err := sm.transcoding.serve(w, r, song, *transcodeOptions)
+		if err != nil {
+			log.Printf("❌ Failed to transcode %s: %v", song.Title, err)
+		}
+		if served {
+			return
+		}
+	}
+	
+	// Songs scanned before format detection existed have no MIME type; they were all MP3
+	contentType := song.MimeType
+	if contentType == "" {
+		contentType = models.FormatMP3.MimeType
+	}
+	
+	// Stream the file (supports Range requests for seeking and resuming)
+	if err := serveAudioFile(w, r, song.Path, contentType); err != nil {
+		// serveAudioFile has already answered: with 404 or 500 if the file
+		// couldn't be opened, otherwise the headers were sent before the error
+		log.Printf("❌ Failed to stream %s file: %v", song.Format, err)
 		return
 	}
 	
@@ -314,36 +584,87 @@ func (sm *ServerManager) handleArtwork(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// Check if song has artwork
-	artworkData := song.GetArtwork()
-	if len(artworkData) == 0 {
+	if !serveArtwork(w, r, song) {
 		log.Printf("❌ No artwork found for song: %s - %s", song.Artist, song.Title)
-		http.Error(w, "Artwork not found", http.StatusNotFound)
 		return
 	}
 	
-	log.Printf("🎨 Serving artwork for: %s - %s (%d bytes)", song.Artist, song.Title, len(artworkData))
+	log.Printf("✅ Successfully served artwork for: %s", song.Title)
+}
+
+// handleAlbumArtwork serves the cover of an album: a cover image from its folder if
+// there is one, otherwise the first embedded picture
+func (sm *ServerManager) handleAlbumArtwork(w http.ResponseWriter, r *http.Request) {
+	albumID := mux.Vars(r)["albumId"]
 	
-	// Determine content type (most MP3 artwork is JPEG, but could be PNG)
-	contentType := "image/jpeg"
-	if len(artworkData) >= 8 {
-		// Check for PNG signature
-		if artworkData[0] == 0x89 && artworkData[1] == 0x50 && artworkData[2] == 0x4E && artworkData[3] == 0x47 {
-			contentType = "image/png"
-		}
+	var album *models.Album
+	if sm.musicLibrary != nil {
+		album = sm.musicLibrary.GetAlbumByID(albumID)
+	}
+	if album == nil {
+		log.Printf("❌ Album not found: %s", albumID)
+		http.Error(w, "Album not found", http.StatusNotFound)
+		return
 	}
 	
-	// Set headers and serve artwork
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(artworkData)))
-	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
-	
-	if _, err := w.Write(artworkData); err != nil {
-		log.Printf("❌ Failed to serve artwork: %v", err)
+	if !serveArtwork(w, r, album) {
+		log.Printf("❌ No artwork found for album: %s", album.Name)
 		return
 	}
+	log.Printf("✅ Successfully served artwork for album: %s", album.Name)
+}
+
+// artworkSource is a song or album whose picture can be served
+type artworkSource interface {
+	ArtworkID() string
+	GetArtwork() []byte
+	GetArtworkVariant(size int) ([]byte, error)
+}
+
+// serveArtwork writes a picture, resized when ?size= asks for it. It reports false
+// after answering 404 or 400 itself.
+func serveArtwork(w http.ResponseWriter, r *http.Request, source artworkSource) bool {
+	artworkID := source.ArtworkID()
+	if artworkID == "" {
+		http.Error(w, "Artwork not found", http.StatusNotFound)
+		return false
+	}
 	
-	log.Printf("✅ Successfully served artwork for: %s", song.Title)
+	// ?size= picks a resized JPEG variant; without it the original picture is served
+	var artworkData []byte
+	etag := artworkID
+	if value := r.URL.Query().Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || !models.IsArtworkSize(size) {
+			http.Error(w, "Invalid size, use one of 64, 256 or 600", http.StatusBadRequest)
+			return false
+		}
+		
+		artworkData, err = source.GetArtworkVariant(size)
+		if err != nil {
+			// Formats the image package can't decode are still served at full size
+			log.Printf("⚠️ Could not resize artwork %s: %v", artworkID, err)
+		} else {
+			etag = fmt.Sprintf("%s-%d", artworkID, size)
+		}
+	}
+	if artworkData == nil {
+		artworkData = source.GetArtwork()
+	}
+	if len(artworkData) == 0 {
+		http.Error(w, "Artwork not found", http.StatusNotFound)
+		return false
+	}
+	
+	log.Printf("🎨 Serving artwork %s (%d bytes)", etag, len(artworkData))
+	
+	// Cached pictures are named by content hash, so it doubles as a strong ETag and
+	// ServeContent answers If-None-Match with 304
+	w.Header().Set("Content-Type", http.DetectContentType(artworkData))
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(artworkData))
+	return true
 }
 
 // Helper functions
@@ -353,26 +674,3 @@ func writeJSONResponse(w http.ResponseWriter, data interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(data)
 }
-
-// writeFileResponse streams a file as HTTP response
-func writeFileResponse(w http.ResponseWriter, filePath, contentType string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	
-	// Get file info for content length
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return err
-	}
-	
-	// Set headers
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
-	
-	// Stream file content
-	_, err = io.Copy(w, file)
-	return err
-} 
\ No newline at end of file
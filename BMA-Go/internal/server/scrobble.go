@@ -0,0 +1,314 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bma-go/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxScrobbleBodySize bounds /scrobble bodies; 1 MB holds several thousand events
+	maxScrobbleBodySize = 1 << 20
+	// maxScrobbleEvents caps one batch, so a phone that was offline for weeks
+	// sends its backlog in a few requests
+	maxScrobbleEvents = 1000
+
+	defaultStatsLimit   = 20
+	maxStatsLimit       = 500
+	defaultHistoryLimit = 50
+)
+
+// scrobbleEvent is one entry of a /scrobble batch
+type scrobbleEvent struct {
+	Type       string `json:"type"` // "played" (default) or "nowPlaying"
+	SongID     string `json:"songId"`
+	PlayedAt   string `json:"playedAt"`   // played: when playback started, RFC 3339
+	DurationMs int64  `json:"durationMs"` // played: how long was listened to
+	PositionMs int64  `json:"positionMs"` // nowPlaying: how far into the song playback is
+}
+
+// scrobbleRejection explains why one event of a batch wasn't recorded
+type scrobbleRejection struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// handleScrobble records {"events": [...]}: songs played, possibly long ago by a
+// phone that was offline, and the song playing right now. Events are accepted or
+// rejected one by one; resending a batch only reports the repeats as duplicates.
+func (sm *ServerManager) handleScrobble(w http.ResponseWriter, r *http.Request) {
+	if sm.musicLibrary == nil {
+		http.Error(w, "Music library not available", http.StatusServiceUnavailable)
+		return
+	}
+	credential, _ := r.Context().Value(DeviceContextKey).(models.DeviceCredential)
+
+	var request struct {
+		Events []scrobbleEvent `json:"events"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxScrobbleBodySize)).Decode(&request); err != nil {
+		log.Printf("❌ [HISTORY] Invalid scrobble body: %v", err)
+		http.Error(w, "Expected a JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(request.Events) == 0 || len(request.Events) > maxScrobbleEvents {
+		http.Error(w, "Expected between 1 and 1000 events", http.StatusBadRequest)
+		return
+	}
+
+	rejected := []scrobbleRejection{}
+	reject := func(index int, reason string) {
+		rejected = append(rejected, scrobbleRejection{Index: index, Error: reason})
+	}
+
+	var reports []models.PlayReport
+	var reportIndexes []int
+	nowPlaying := 0
+	for i, event := range request.Events {
+		songID, err := uuid.Parse(event.SongID)
+		if err != nil {
+			reject(i, "invalid songId")
+			continue
+		}
+
+		switch event.Type {
+		case "", "played":
+			playedAt, err := time.Parse(time.RFC3339, event.PlayedAt)
+			if err != nil {
+				reject(i, "invalid playedAt, expected RFC 3339")
+				continue
+			}
+			reports = append(reports, models.PlayReport{
+				SongID:   songID,
+				PlayedAt: playedAt,
+				Duration: time.Duration(event.DurationMs) * time.Millisecond,
+			})
+			reportIndexes = append(reportIndexes, i)
+
+		case "nowPlaying":
+			position := time.Duration(event.PositionMs) * time.Millisecond
+			if err := sm.musicLibrary.RecordNowPlaying(credential, songID, position); err != nil {
+				reject(i, err.Error())
+				continue
+			}
+			nowPlaying++
+
+		default:
+			reject(i, "unknown event type")
+		}
+	}
+
+	accepted, duplicates := 0, 0
+	for i, err := range sm.musicLibrary.RecordPlays(credential, reports) {
+		switch err {
+		case nil:
+			accepted++
+		case models.ErrPlayDuplicate:
+			duplicates++
+		default:
+			reject(reportIndexes[i], err.Error())
+		}
+	}
+
+	log.Printf("🎧 [HISTORY] %s scrobbled %d plays (%d duplicates, %d rejected)", credential.DeviceName, accepted, duplicates, len(rejected))
+	response := map[string]interface{}{
+		"accepted":   accepted,
+		"duplicates": duplicates,
+		"nowPlaying": nowPlaying,
+		"rejected":   rejected,
+	}
+	if err := writeJSONResponse(w, response); err != nil {
+		log.Printf("❌ Failed to encode scrobble response: %v", err)
+	}
+}
+
+// playFilter reads ?range= and ?device= ("me" or a device ID), answering the
+// request itself when either is invalid
+func playFilter(w http.ResponseWriter, r *http.Request) (models.PlayFilter, bool) {
+	var filter models.PlayFilter
+	since, err := models.ParseStatsRange(r.URL.Query().Get("range"))
+	if err != nil {
+		http.Error(w, "Invalid range, expected week, month, year, all or a period such as 30d", http.StatusBadRequest)
+		return filter, false
+	}
+	filter.Since = since
+
+	switch device := r.URL.Query().Get("device"); device {
+	case "":
+	case "me":
+		credential, _ := r.Context().Value(DeviceContextKey).(models.DeviceCredential)
+		filter.DeviceID = credential.DeviceID
+	default:
+		if filter.DeviceID, err = uuid.Parse(device); err != nil {
+			http.Error(w, "Invalid device", http.StatusBadRequest)
+			return filter, false
+		}
+	}
+	return filter, true
+}
+
+// queryLimit reads ?limit=, capped at maxLimit
+func queryLimit(w http.ResponseWriter, r *http.Request, defaultLimit, maxLimit int) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultLimit, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return 0, false
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit, true
+}
+
+// playPayload converts a recorded play
+func playPayload(play models.Play) map[string]interface{} {
+	payload := map[string]interface{}{
+		"songId":     play.SongID.String(),
+		"deviceId":   play.DeviceID.String(),
+		"deviceName": play.DeviceName,
+		"playedAt":   play.PlayedAt.Format(time.RFC3339),
+		"durationMs": play.Duration.Milliseconds(),
+		"title":      play.Title,
+		"artist":     play.Artist,
+		"artistId":   play.ArtistID.String(),
+		"album":      play.Album,
+	}
+	if play.AlbumID != uuid.Nil {
+		payload["albumId"] = play.AlbumID.String()
+	}
+	return payload
+}
+
+// handleHistory lists recent plays, newest first: ?range=, ?device= and ?limit=
+func (sm *ServerManager) handleHistory(w http.ResponseWriter, r *http.Request) {
+	filter, ok := playFilter(w, r)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(w, r, defaultHistoryLimit, maxStatsLimit)
+	if !ok {
+		return
+	}
+
+	plays := []map[string]interface{}{}
+	if sm.musicLibrary != nil {
+		for _, play := range sm.musicLibrary.History().Plays(filter, limit) {
+			plays = append(plays, playPayload(play))
+		}
+	}
+	if err := writeJSONResponse(w, plays); err != nil {
+		log.Printf("❌ Failed to encode play history: %v", err)
+	}
+}
+
+// handleTopStats answers /stats/top-songs, /stats/top-albums and /stats/top-artists:
+// the most played first, over ?range= (default all time), for ?device= or everyone
+func (sm *ServerManager) handleTopStats(w http.ResponseWriter, r *http.Request) {
+	if sm.musicLibrary == nil {
+		http.Error(w, "Music library not available", http.StatusServiceUnavailable)
+		return
+	}
+	filter, ok := playFilter(w, r)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(w, r, defaultStatsLimit, maxStatsLimit)
+	if !ok {
+		return
+	}
+
+	history := sm.musicLibrary.History()
+	kind := mux.Vars(r)["kind"]
+	var top []models.TopEntry
+	switch kind {
+	case "top-songs":
+		top = history.TopSongs(filter, limit)
+	case "top-albums":
+		top = history.TopAlbums(filter, limit)
+	default:
+		top = history.TopArtists(filter, limit)
+	}
+
+	// Songs still in the library come with their details, for artwork and playback
+	var songs []*models.Song
+	if kind == "top-songs" {
+		ids := make([]uuid.UUID, len(top))
+		for i, entry := range top {
+			ids[i] = entry.ID
+		}
+		songs = sm.musicLibrary.GetSongsByIDs(ids)
+	}
+
+	items := make([]map[string]interface{}, len(top))
+	for i, entry := range top {
+		items[i] = map[string]interface{}{
+			"id":         entry.ID.String(),
+			"name":       entry.Name,
+			"playCount":  entry.PlayCount,
+			"listenedMs": entry.ListenTime.Milliseconds(),
+			"lastPlayed": entry.LastPlayed.Format(time.RFC3339),
+		}
+		if kind != "top-artists" {
+			items[i]["artist"] = entry.Artist
+		}
+		if songs != nil && songs[i] != nil {
+			items[i]["song"] = songPayload(songs[i])
+		}
+	}
+
+	rangeName := r.URL.Query().Get("range")
+	if rangeName == "" {
+		rangeName = "all"
+	}
+	summary := history.Summary(filter)
+	response := map[string]interface{}{
+		"range":      rangeName,
+		"totalPlays": summary.PlayCount,
+		"listenedMs": summary.ListenTime.Milliseconds(),
+		"items":      items,
+	}
+	if !filter.Since.IsZero() {
+		response["since"] = filter.Since.Format(time.RFC3339)
+	}
+	if err := writeJSONResponse(w, response); err != nil {
+		log.Printf("❌ Failed to encode %s: %v", kind, err)
+	}
+}
+
+// nowPlayingPayload converts what a device is playing
+func nowPlayingPayload(entry models.NowPlaying, song *models.Song) map[string]interface{} {
+	payload := map[string]interface{}{
+		"deviceId":   entry.DeviceID.String(),
+		"deviceName": entry.DeviceName,
+		"songId":     entry.SongID.String(),
+		"startedAt":  entry.StartedAt.Format(time.RFC3339),
+	}
+	if song != nil {
+		payload["song"] = songPayload(song)
+	}
+	return payload
+}
+
+// handleNowPlaying lists what each device is playing right now
+func (sm *ServerManager) handleNowPlaying(w http.ResponseWriter, r *http.Request) {
+	playing := []map[string]interface{}{}
+	if sm.musicLibrary != nil {
+		for _, entry := range sm.musicLibrary.History().NowPlaying() {
+			playing = append(playing, nowPlayingPayload(entry, sm.musicLibrary.GetSongByID(entry.SongID.String())))
+		}
+	}
+	if err := writeJSONResponse(w, playing); err != nil {
+		log.Printf("❌ Failed to encode now playing: %v", err)
+	}
+}
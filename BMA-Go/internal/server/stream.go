@@ -0,0 +1,259 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Streaming timeout policy. The server-wide WriteTimeout is far too short for a
+// full track over a slow Tailscale link, so streaming responses replace it with a
+// rolling deadline that is pushed forward every time a chunk is written. A client
+// that stops reading for streamChunkTimeout gets cut off; one that keeps reading
+// can take as long as it needs.
+const (
+	streamChunkSize    = 64 * 1024
+	streamChunkTimeout = 60 * time.Second
+)
+
+// errInvalidRange is returned for Range headers that can't be parsed or satisfied
+var errInvalidRange = errors.New("invalid range")
+
+// errMultipleRanges is returned when a client asks for more than one byte range
+var errMultipleRanges = errors.New("multiple ranges not supported")
+
+// byteRange is a single, resolved byte range within a file
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// contentRange formats the range for the Content-Range header
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+// serveAudioFile streams a file with full HTTP range and conditional request support.
+// It handles Range (single range only), If-Range, If-None-Match and If-Modified-Since,
+// and sets Accept-Ranges, ETag and Last-Modified so clients can seek and resume.
+// A file that can't be opened is answered with 404 (missing) or 500 before the
+// error is returned; later errors happen after the headers have been sent.
+func serveAudioFile(w http.ResponseWriter, r *http.Request, filePath, contentType string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "Audio file not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to open audio file", http.StatusInternalServerError)
+		}
+		return err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		http.Error(w, "Failed to open audio file", http.StatusInternalServerError)
+		return err
+	}
+
+	size := fileInfo.Size()
+	modTime := fileInfo.ModTime().UTC().Truncate(time.Second)
+	etag := fileETag(size, fileInfo.ModTime())
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", modTime.Format(http.TimeFormat))
+	header.Set("Cache-Control", "private, max-age=86400")
+
+	// Conditional GET: let the client reuse what it already has
+	if notModified(r, etag, modTime) {
+		header.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	// Resolve the requested range (If-Range falls back to the full file when stale)
+	status := http.StatusOK
+	sendRange := byteRange{start: 0, length: size}
+
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && ifRangeMatches(r, etag, modTime) {
+		parsed, err := parseRange(rangeHeader, size)
+		if err != nil {
+			log.Printf("⚠️ [STREAM] Rejecting range %q for %s: %v", rangeHeader, filePath, err)
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			header.Del("Content-Type")
+			http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return nil
+		}
+
+		sendRange = parsed
+		status = http.StatusPartialContent
+		header.Set("Content-Range", sendRange.contentRange(size))
+		log.Printf("🎵 [STREAM] Serving range %s", sendRange.contentRange(size))
+	}
+
+	header.Set("Content-Length", strconv.FormatInt(sendRange.length, 10))
+	w.WriteHeader(status)
+
+	if r.Method == http.MethodHead || sendRange.length == 0 {
+		return nil
+	}
+
+	if _, err := file.Seek(sendRange.start, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = copyWithDeadline(w, io.LimitReader(file, sendRange.length))
+	return err
+}
+
+// copyWithDeadline copies src to w in chunks, extending the write deadline before
+// each chunk so long streams aren't killed by the server-wide WriteTimeout
+func copyWithDeadline(w http.ResponseWriter, src io.Reader) (int64, error) {
+	controller := http.NewResponseController(w)
+	buf := make([]byte, streamChunkSize)
+	var written int64
+
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			// Not every ResponseWriter supports deadlines; streaming still works without them
+			_ = controller.SetWriteDeadline(time.Now().Add(streamChunkTimeout))
+
+			wn, writeErr := w.Write(buf[:n])
+			written += int64(wn)
+			if writeErr != nil {
+				return written, writeErr
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
+
+// fileETag builds a strong validator from the file size and modification time
+func fileETag(size int64, modTime time.Time) string {
+	return fmt.Sprintf("\"%x-%x\"", modTime.UnixNano(), size)
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since for a GET/HEAD request
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 9110 13.2.2)
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagListMatches(inm, etag)
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !modTime.After(t)
+		}
+	}
+
+	return false
+}
+
+// ifRangeMatches reports whether a Range header should be honoured given If-Range
+func ifRangeMatches(r *http.Request, etag string, modTime time.Time) bool {
+	ifRange := strings.TrimSpace(r.Header.Get("If-Range"))
+	if ifRange == "" {
+		return true
+	}
+
+	// Entity tag form: must be a strong match
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		return ifRange == etag
+	}
+
+	// HTTP-date form: must match the last modification time exactly
+	if t, err := http.ParseTime(ifRange); err == nil {
+		return t.Equal(modTime)
+	}
+
+	return false
+}
+
+// etagListMatches checks an If-None-Match header value against an ETag (weak comparison)
+func etagListMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	target := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == target {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange parses a single-range "bytes=" header against a file of the given size.
+// Multi-range requests are rejected rather than answered with multipart/byteranges,
+// which no audio player we care about actually uses.
+func parseRange(header string, size int64) (byteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return byteRange{}, errInvalidRange
+	}
+
+	spec := strings.TrimSpace(strings.TrimPrefix(header, prefix))
+	if strings.Contains(spec, ",") {
+		return byteRange{}, errMultipleRanges
+	}
+
+	startStr, endStr, found := strings.Cut(spec, "-")
+	if !found {
+		return byteRange{}, errInvalidRange
+	}
+	startStr = strings.TrimSpace(startStr)
+	endStr = strings.TrimSpace(endStr)
+
+	// Suffix range: "bytes=-500" means the last 500 bytes
+	if startStr == "" {
+		suffix, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffix <= 0 || size == 0 {
+			return byteRange{}, errInvalidRange
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return byteRange{start: size - suffix, length: suffix}, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return byteRange{}, errInvalidRange
+	}
+
+	// Open-ended range: "bytes=1000-"
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, errInvalidRange
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return byteRange{start: start, length: end - start + 1}, nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"bma-go/internal/models"
+)
+
+// transcoding converts streams for ?format= and ?maxBitrate= and caches the results
+type transcoding struct {
+	transcoder models.Transcoder
+	cache      *models.TranscodeCache
+}
+
+// newTranscoding sets up the ffmpeg (or passthrough) transcoder and its disk cache
+func newTranscoding(ffmpegPath string, cacheMB int) *transcoding {
+	return &transcoding{
+		transcoder: models.NewTranscoder(ffmpegPath),
+		cache:      models.DefaultTranscodeCache(cacheMB),
+	}
+}
+
+// converts reports whether streams can actually be converted, which HLS relies on
+func (t *transcoding) converts() bool {
+	return t != nil && t.transcoder.Converts()
+}
+
+// serve answers a stream request with a converted song. It reports false, having
+// written nothing, when the original file should be served instead: the song
+// already satisfies the options, or no transcoder that converts is available.
+func (t *transcoding) serve(w http.ResponseWriter, r *http.Request, song *models.Song, options models.TranscodeOptions) (bool, error) {
+	if !options.NeedsTranscode(song) {
+		return false, nil
+	}
+	if !t.converts() {
+		log.Printf("⚠️ [TRANSCODE] No transcoder available, sending the original %s file", song.Format)
+		return false, nil
+	}
+
+	format, bitrate := options.Output()
+
+	// A finished transcode is a plain file, so it can be served with ranges
+	if path, ok := t.cache.Lookup(song, options); ok {
+		log.Printf("🎚️ [TRANSCODE] Serving cached %s %dk: %s", format.Name, bitrate, song.Title)
+		return true, serveAudioFile(w, r, path, format.MimeType)
+	}
+
+	// The length isn't known until the transcode finishes, so seeking is only
+	// possible once it is cached
+	header := w.Header()
+	header.Set("Content-Type", format.MimeType)
+	header.Set("Accept-Ranges", "none")
+	header.Set("Cache-Control", "private, max-age=86400")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return true, nil
+	}
+
+	log.Printf("🎚️ [TRANSCODE] Transcoding %s to %s %dk with %s: %s", song.Format, format.Name, bitrate, t.transcoder.Name(), song.Title)
+	started := time.Now()
+
+	// The request context ends when the client disconnects, which kills the transcode
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	output := &streamWriter{w: w, controller: http.NewResponseController(w)}
+	var dst io.Writer = output
+	entry, err := t.cache.Create(song, options)
+	if err != nil {
+		log.Printf("⚠️ [TRANSCODE] Not caching this transcode: %v", err)
+	} else {
+		dst = io.MultiWriter(output, entry)
+	}
+
+	err = t.transcoder.Transcode(ctx, song, options, dst)
+	if err != nil {
+		if entry != nil {
+			entry.Abort()
+		}
+		if r.Context().Err() != nil {
+			log.Printf("🛑 [TRANSCODE] Client disconnected, transcode cancelled after %d bytes: %s", output.written, song.Title)
+			return true, nil
+		}
+		if !output.started {
+			// Nothing was sent yet, so the client can still get a proper error
+			header.Del("Accept-Ranges")
+			header.Del("Cache-Control")
+			http.Error(w, "Transcoding failed", http.StatusInternalServerError)
+		}
+		return true, err
+	}
+
+	if entry != nil {
+		if err := entry.Commit(); err != nil {
+			log.Printf("⚠️ [TRANSCODE] Failed to cache transcode: %v", err)
+		}
+	}
+	log.Printf("✅ [TRANSCODE] Transcoded %d bytes in %v: %s", output.written, time.Since(started).Round(time.Millisecond), song.Title)
+	return true, nil
+}
+
+// streamWriter writes a response of unknown length. Headers go out with the first
+// chunk, every chunk is flushed, and the write deadline is extended before each one
+// like copyWithDeadline does for files.
+type streamWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	started    bool
+	written    int64
+}
+
+// Write sends a chunk to the client
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if !sw.started {
+		sw.started = true
+		sw.w.WriteHeader(http.StatusOK)
+	}
+
+	// Not every ResponseWriter supports deadlines; streaming still works without them
+	_ = sw.controller.SetWriteDeadline(time.Now().Add(streamChunkTimeout))
+
+	n, err := sw.w.Write(p)
+	sw.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+
+	// Encoders write in small pieces; send each one rather than waiting for the
+	// response buffer to fill, so playback can start right away
+	_ = sw.controller.Flush()
+	return n, nil
+}
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"log"
+	"strings"
 	
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -43,9 +44,23 @@ func (ui *MainUI) initialize() {
 	
 	// Create a MusicLibrary instance
 	ui.musicLibrary = models.NewMusicLibrary()
+	if ui.config != nil {
+		ui.musicLibrary.SetArtworkFilenames(ui.config.ArtworkFilenames)
+		if err := ui.musicLibrary.SetLibraryRules(ui.config.LibraryRules); err != nil {
+			log.Printf("❌ Invalid libraryRules in config, using the defaults: %v", err)
+		}
+		if err := ui.musicLibrary.SetDuplicateHandling(ui.config.DuplicatePolicy, ui.config.FingerprintDuplicates); err != nil {
+			log.Printf("❌ Invalid duplicatePolicy in config, keeping the first copy: %v", err)
+		}
+	}
 	
 	// Connect the MusicLibrary to the ServerManager
 	ui.serverManager.SetMusicLibrary(ui.musicLibrary)
+	if ui.config != nil {
+		ui.serverManager.SetTranscoding(ui.config.FFmpegPath, ui.config.TranscodeCacheMB)
+	} else {
+		ui.serverManager.SetTranscoding("", 0)
+	}
 	
 	// Create UI components connected to the real server manager and music library
 	ui.serverStatus = NewServerStatusBar(ui.serverManager)
@@ -58,6 +73,8 @@ func (ui *MainUI) initialize() {
 
 	// Set the parent window for dialogs
 	ui.songList.SetParentWindow(ui.window)
+	ui.deviceStatus.SetParentWindow(ui.window)
+	ui.songList.SetConfig(ui.config)
 
 	// Create animation coordinator
 	qrSection := ui.serverStatus.GetQRSection()
@@ -111,16 +128,16 @@ func (ui *MainUI) setupLibraryStatusConnection() {
 
 // LoadMusicLibrary loads the music library from the configured folder
 func (ui *MainUI) LoadMusicLibrary() {
-	// Check if music folder is configured in the passed config
-	if ui.config.MusicFolder == "" {
+	// Check if music folders are configured in the passed config
+	if len(ui.config.MusicFolders) == 0 {
 		log.Println("⚠️ No music folder configured")
 		return
 	}
 	
-	log.Printf("🎵 Loading music library from: %s", ui.config.MusicFolder)
+	log.Printf("🎵 Loading music library from: %s", strings.Join(ui.config.MusicFolderPaths(), ", "))
 	
-	// Use SelectFolder which sets the path and scans the library
-	go ui.musicLibrary.SelectFolder(ui.config.MusicFolder)
+	// SetRoots scans every enabled folder, then watches them
+	go ui.musicLibrary.SetRoots(ui.config.MusicFolders)
 	
 	// Automatically start the server after music library loading
 	go ui.AutoStartServer()
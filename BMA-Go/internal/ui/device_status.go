@@ -2,19 +2,24 @@ package ui
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"bma-go/internal/models"
 	"bma-go/internal/server"
 )
 
 // DeviceStatusView shows connected device information
 type DeviceStatusView struct {
 	serverManager *server.ServerManager
+	window        fyne.Window
 	deviceLabel   *widget.Label
 	libraryLabel  *widget.Label
 	content       *fyne.Container
@@ -38,9 +43,13 @@ func (view *DeviceStatusView) initialize() {
 	view.libraryLabel = widget.NewLabel("No library")
 	view.libraryLabel.TextStyle = fyne.TextStyle{Bold: true}
 	
+	pairedButton := widget.NewButtonWithIcon("Paired Devices", theme.AccountIcon(), view.showPairedDevices)
+	pairedButton.Importance = widget.LowImportance
+
 	// Create horizontal layout with device status on left, library stats on right
 	statusContent := container.NewHBox(
 		view.deviceLabel,
+		pairedButton,
 		layout.NewSpacer(),
 		view.libraryLabel,
 	)
@@ -88,4 +97,75 @@ func (view *DeviceStatusView) UpdateLibraryStats(albumCount, songCount int) {
 // GetContent returns the UI content for display
 func (view *DeviceStatusView) GetContent() fyne.CanvasObject {
 	return view.content
-} 
\ No newline at end of file
+} 
+
+// SetParentWindow sets the window dialogs are shown over
+func (view *DeviceStatusView) SetParentWindow(window fyne.Window) {
+	view.window = window
+}
+
+// showPairedDevices lists every paired device with its admin rights. Admin devices
+// may revoke other devices through DELETE /pair/{token}; pairing never makes a
+// device an admin, only this dialog or a request from this machine does.
+func (view *DeviceStatusView) showPairedDevices() {
+	if view.window == nil {
+		return
+	}
+
+	var devices []models.DeviceCredential
+	var list *widget.List
+	reload := func() {
+		devices = view.serverManager.GetPairedDevices()
+		sort.Slice(devices, func(i, j int) bool { return devices[i].CreatedAt.Before(devices[j].CreatedAt) })
+		list.Refresh()
+	}
+
+	list = widget.NewList(
+		func() int { return len(devices) },
+		func() fyne.CanvasObject {
+			return container.NewHBox(
+				widget.NewLabel("Device name — paired 00 Jan 2006"),
+				layout.NewSpacer(),
+				widget.NewCheck("Admin", nil),
+				widget.NewButtonWithIcon("Revoke", theme.DeleteIcon(), nil),
+			)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(devices) {
+				return
+			}
+			device := devices[id]
+			row := obj.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(fmt.Sprintf("%s — paired %s", device.DeviceName, device.CreatedAt.Local().Format("2 Jan 2006")))
+
+			admin := row.Objects[2].(*widget.Check)
+			admin.OnChanged = nil
+			admin.SetChecked(device.Admin)
+			admin.OnChanged = func(checked bool) {
+				view.serverManager.SetDeviceAdmin(device.DeviceID, checked)
+				reload()
+			}
+
+			row.Objects[3].(*widget.Button).OnTapped = func() {
+				dialog.ShowConfirm("Revoke Device", fmt.Sprintf("Unpair %q? It will need to scan the QR code again.", device.DeviceName), func(ok bool) {
+					if ok {
+						view.serverManager.RevokeDevice(device.DeviceID)
+						reload()
+						view.updateDeviceStatus()
+					}
+				}, view.window)
+			}
+		},
+	)
+	reload()
+
+	empty := widget.NewLabel("No devices are paired yet")
+	content := fyne.CanvasObject(list)
+	if len(devices) == 0 {
+		content = empty
+	}
+
+	d := dialog.NewCustom("Paired Devices", "Close", content, view.window)
+	d.Resize(fyne.NewSize(560, 360))
+	d.Show()
+}
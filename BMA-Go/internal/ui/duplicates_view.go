@@ -0,0 +1,142 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"bma-go/internal/models"
+)
+
+// DuplicatesView lists the groups of duplicate files the last scan found, with the
+// copy each group keeps, and lets the duplicate policy be changed
+type DuplicatesView struct {
+	musicLibrary *models.MusicLibrary
+	config       *models.Config
+	window       fyne.Window
+
+	policySelect     *widget.Select
+	fingerprintCheck *widget.Check
+	summaryLabel     *widget.Label
+	groupList        *widget.Accordion
+}
+
+// ShowDuplicatesDialog opens the duplicates view over the main window
+func ShowDuplicatesDialog(musicLibrary *models.MusicLibrary, config *models.Config, window fyne.Window) {
+	view := &DuplicatesView{
+		musicLibrary: musicLibrary,
+		config:       config,
+		window:       window,
+	}
+	content := view.initialize()
+
+	d := dialog.NewCustom("Duplicates", "Close", content, window)
+	d.Resize(fyne.NewSize(720, 560))
+	d.Show()
+}
+
+// initialize builds the settings row and the group list
+func (v *DuplicatesView) initialize() fyne.CanvasObject {
+	report := v.musicLibrary.GetDuplicates()
+
+	policies := make([]string, len(models.DuplicatePolicies))
+	for i, policy := range models.DuplicatePolicies {
+		policies[i] = string(policy)
+	}
+	v.policySelect = widget.NewSelect(policies, nil)
+	v.policySelect.SetSelected(string(report.Policy))
+
+	v.fingerprintCheck = widget.NewCheck("Match identical audio (reads every file once)", nil)
+	v.fingerprintCheck.SetChecked(report.Fingerprinting)
+
+	// Set the callbacks after the initial values so opening the view changes nothing
+	v.policySelect.OnChanged = func(string) { v.applySettings() }
+	v.fingerprintCheck.OnChanged = func(bool) { v.applySettings() }
+
+	v.summaryLabel = widget.NewLabel("")
+	v.summaryLabel.Wrapping = fyne.TextWrapWord
+
+	v.groupList = widget.NewAccordion()
+	v.showReport(report)
+
+	settings := container.NewBorder(nil, nil, widget.NewLabel("Keep"), nil, v.policySelect)
+	return container.NewBorder(
+		container.NewVBox(settings, v.fingerprintCheck, v.summaryLabel),
+		nil, nil, nil,
+		container.NewVScroll(v.groupList),
+	)
+}
+
+// showReport fills the list with one collapsible item per duplicate group
+func (v *DuplicatesView) showReport(report models.DuplicateReport) {
+	v.groupList.Items = nil
+	hidden := 0
+	for _, group := range report.Groups {
+		kept := group.Kept
+		title := fmt.Sprintf("%s — %s (%d copies)", kept.Artist, kept.Title, len(group.Songs))
+		if group.SameAudio {
+			title += " · same audio"
+		}
+
+		rows := container.NewVBox()
+		for _, song := range group.Songs {
+			marker := "✅"
+			if song != kept && report.Policy != models.DuplicatesKeepAll {
+				marker = "🚫"
+				hidden++
+			}
+			rows.Add(widget.NewLabel(fmt.Sprintf("%s %s\n     %s", marker, song.Path, describeCopy(song))))
+		}
+		v.groupList.Append(widget.NewAccordionItem(title, rows))
+	}
+	v.groupList.Refresh()
+
+	switch {
+	case len(report.Groups) == 0:
+		v.summaryLabel.SetText("No duplicates found.")
+	case report.Policy == models.DuplicatesKeepAll:
+		v.summaryLabel.SetText(fmt.Sprintf("%d songs have more than one copy. Every copy is listed.", len(report.Groups)))
+	default:
+		v.summaryLabel.SetText(fmt.Sprintf("%d songs have more than one copy. %d copies are hidden (✅ listed, 🚫 hidden).", len(report.Groups), hidden))
+	}
+}
+
+// describeCopy summarizes what tells copies apart: format, bitrate and age
+func describeCopy(song *models.Song) string {
+	details := []string{strings.ToUpper(song.Format)}
+	if song.Bitrate > 0 {
+		details = append(details, fmt.Sprintf("%d kbps", song.Bitrate))
+	}
+	if song.IsLossless() {
+		details = append(details, "lossless")
+	}
+	if !song.ModTime.IsZero() {
+		details = append(details, "modified "+song.ModTime.Format("2006-01-02"))
+	}
+	return strings.Join(details, " · ")
+}
+
+// applySettings saves the chosen policy and regroups the library with it
+func (v *DuplicatesView) applySettings() {
+	policy := v.policySelect.Selected
+	fingerprint := v.fingerprintCheck.Checked
+
+	if v.config != nil {
+		if err := v.config.SetDuplicateHandling(policy, fingerprint); err != nil {
+			log.Printf("❌ Failed to save duplicate policy: %v", err)
+		}
+	}
+
+	v.summaryLabel.SetText("Applying...")
+	go func() {
+		if err := v.musicLibrary.SetDuplicateHandling(policy, fingerprint); err != nil {
+			log.Printf("❌ Failed to apply duplicate policy: %v", err)
+		}
+		v.showReport(v.musicLibrary.GetDuplicates())
+	}()
+}
@@ -0,0 +1,228 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"bma-go/internal/models"
+)
+
+// LibraryRulesDialog edits how albums are grouped and what is inferred from paths.
+// Rules are previewed against the current library and can only be applied once
+// the preview matches what is in the form.
+type LibraryRulesDialog struct {
+	musicLibrary *models.MusicLibrary
+	config       *models.Config
+	window       fyne.Window
+	dialog       *dialog.CustomDialog
+
+	templatesEntry  *widget.Entry
+	skipEntry       *widget.Entry
+	minSizeEntry    *widget.Entry
+	precedenceEntry *widget.Entry
+	summaryLabel    *widget.Label
+	albumList       *widget.List
+	applyButton     *widget.Button
+
+	previewRows []string             // one line per album the previewed rules produce
+	previewed   *models.LibraryRules // rules the preview was made with; nil until previewed
+	edits       int                  // bumped on every edit, so a slow preview of old rules is dropped
+}
+
+// ShowLibraryRulesDialog opens the rules editor over the main window
+func ShowLibraryRulesDialog(musicLibrary *models.MusicLibrary, config *models.Config, window fyne.Window) {
+	d := &LibraryRulesDialog{
+		musicLibrary: musicLibrary,
+		config:       config,
+		window:       window,
+	}
+	d.initialize()
+	d.dialog.Show()
+}
+
+// initialize builds the form, the preview list and the dialog around them
+func (d *LibraryRulesDialog) initialize() {
+	defaults := models.DefaultLibraryRules()
+	var current models.LibraryRules
+	if d.config != nil && d.config.LibraryRules != nil {
+		current = *d.config.LibraryRules
+	}
+
+	d.templatesEntry = widget.NewMultiLineEntry()
+	d.templatesEntry.SetPlaceHolder("{artist}/{year} - {album}/{track} {title}")
+	d.templatesEntry.SetText(strings.Join(current.PathTemplates, "\n"))
+	d.templatesEntry.SetMinRowsVisible(3)
+
+	d.skipEntry = widget.NewEntry()
+	d.skipEntry.SetPlaceHolder(strings.Join(defaults.SkipFolders, ", "))
+	d.skipEntry.SetText(strings.Join(current.SkipFolders, ", "))
+
+	d.minSizeEntry = widget.NewEntry()
+	d.minSizeEntry.SetPlaceHolder(strconv.Itoa(defaults.MinAlbumSize))
+	if current.MinAlbumSize > 0 {
+		d.minSizeEntry.SetText(strconv.Itoa(current.MinAlbumSize))
+	}
+
+	d.precedenceEntry = widget.NewEntry()
+	d.precedenceEntry.SetPlaceHolder(strings.Join(defaults.Precedence, ", "))
+	d.precedenceEntry.SetText(strings.Join(current.Precedence, ", "))
+
+	// Any edit invalidates the preview
+	for _, entry := range []*widget.Entry{d.templatesEntry, d.skipEntry, d.minSizeEntry, d.precedenceEntry} {
+		entry.OnChanged = func(string) { d.invalidatePreview() }
+	}
+
+	form := widget.NewForm(
+		&widget.FormItem{Text: "Path templates", Widget: d.templatesEntry, HintText: "One per line, below the music folder, without extension"},
+		&widget.FormItem{Text: "Skip folders", Widget: d.skipEntry, HintText: "Never used as album or artist names"},
+		&widget.FormItem{Text: "Minimum album size", Widget: d.minSizeEntry, HintText: "Smaller groups are listed under their folder"},
+		&widget.FormItem{Text: "Precedence", Widget: d.precedenceEntry, HintText: "Sources to use, highest priority first: tags, path, filename, folders"},
+	)
+
+	d.summaryLabel = widget.NewLabel("Preview the rules to see how your library would be grouped.")
+	d.summaryLabel.Wrapping = fyne.TextWrapWord
+
+	d.albumList = widget.NewList(
+		func() int { return len(d.previewRows) },
+		func() fyne.CanvasObject { return widget.NewLabel("Album — Artist (00 tracks)") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id < len(d.previewRows) {
+				obj.(*widget.Label).SetText(d.previewRows[id])
+			}
+		},
+	)
+
+	previewButton := widget.NewButtonWithIcon("Preview", theme.SearchIcon(), d.preview)
+
+	content := container.NewBorder(
+		container.NewVBox(form, previewButton, d.summaryLabel),
+		nil, nil, nil,
+		d.albumList,
+	)
+
+	cancelButton := widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), func() {
+		d.dialog.Hide()
+	})
+	d.applyButton = widget.NewButtonWithIcon("Apply", theme.ConfirmIcon(), d.apply)
+	d.applyButton.Importance = widget.HighImportance
+	d.applyButton.Disable()
+
+	d.dialog = dialog.NewCustomWithoutButtons("Library Rules", content, d.window)
+	d.dialog.SetButtons([]fyne.CanvasObject{cancelButton, d.applyButton})
+	d.dialog.Resize(fyne.NewSize(640, 600))
+}
+
+// readForm turns the form into rules; empty fields keep their defaults
+func (d *LibraryRulesDialog) readForm() (*models.LibraryRules, error) {
+	rules := &models.LibraryRules{
+		PathTemplates: splitRulesList(d.templatesEntry.Text, "\n"),
+		SkipFolders:   splitRulesList(d.skipEntry.Text, ","),
+		Precedence:    splitRulesList(d.precedenceEntry.Text, ","),
+	}
+	if text := strings.TrimSpace(d.minSizeEntry.Text); text != "" {
+		size, err := strconv.Atoi(text)
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("minimum album size must be a whole number of at least 1")
+		}
+		rules.MinAlbumSize = size
+	}
+	if _, err := rules.Compile(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// splitRulesList splits a form field into trimmed, non-empty items
+func splitRulesList(text, separator string) []string {
+	var items []string
+	for _, item := range strings.Split(text, separator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// invalidatePreview disables Apply until the edited rules are previewed again
+func (d *LibraryRulesDialog) invalidatePreview() {
+	d.edits++
+	if d.previewed == nil {
+		return
+	}
+	d.previewed = nil
+	d.applyButton.Disable()
+	d.summaryLabel.SetText("Rules changed. Preview again before applying.")
+}
+
+// preview shows the albums the rules in the form would produce
+func (d *LibraryRulesDialog) preview() {
+	rules, err := d.readForm()
+	if err != nil {
+		d.summaryLabel.SetText(fmt.Sprintf("❌ %v", err))
+		return
+	}
+
+	d.summaryLabel.SetText("Working out the new grouping...")
+	edits := d.edits
+	go func() {
+		preview, err := d.musicLibrary.PreviewLibraryRules(rules)
+		if edits != d.edits {
+			return
+		}
+		if err != nil {
+			d.summaryLabel.SetText(fmt.Sprintf("❌ %v", err))
+			return
+		}
+
+		added := make(map[*models.Album]bool, len(preview.AddedAlbums))
+		for _, album := range preview.AddedAlbums {
+			added[album] = true
+		}
+		rows := make([]string, len(preview.Albums))
+		for i, album := range preview.Albums {
+			marker := ""
+			if added[album] {
+				marker = "🆕 "
+			}
+			rows[i] = fmt.Sprintf("%s%s — %s (%d tracks)", marker, album.Name, album.Artist, album.TrackCount())
+		}
+
+		d.previewRows = rows
+		d.previewed = rules
+		d.summaryLabel.SetText(fmt.Sprintf(
+			"%d albums (%d new, %d no longer grouped), %d songs on no album, %d songs with changed details.",
+			len(preview.Albums), len(preview.AddedAlbums), len(preview.RemovedAlbums),
+			preview.StandaloneSongs, preview.ChangedSongs,
+		))
+		d.albumList.Refresh()
+		d.applyButton.Enable()
+	}()
+}
+
+// apply saves the previewed rules and regroups the library with them
+func (d *LibraryRulesDialog) apply() {
+	rules := d.previewed
+	if rules == nil {
+		return
+	}
+	d.dialog.Hide()
+
+	if d.config != nil {
+		if err := d.config.SetLibraryRules(rules); err != nil {
+			log.Printf("❌ Failed to save library rules: %v", err)
+		}
+	}
+	go func() {
+		if err := d.musicLibrary.SetLibraryRules(rules); err != nil {
+			log.Printf("❌ Failed to apply library rules: %v", err)
+		}
+	}()
+}
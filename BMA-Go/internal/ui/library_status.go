@@ -7,7 +7,6 @@ import (
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
-	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	
 	"bma-go/internal/models"
@@ -49,11 +48,12 @@ func (lsb *LibraryStatusBar) initialize() {
 	lsb.scanProgress = widget.NewProgressBar()
 	lsb.scanProgress.Hide()
 
-	// Main status content - simple layout
-	statusContent := container.NewHBox(
+	// Main status content - simple layout; the progress bar fills the middle while scanning
+	statusContent := container.NewBorder(
+		nil, nil,
 		lsb.libraryLabel,
-		layout.NewSpacer(),
 		lsb.devicesLabel,
+		lsb.scanProgress,
 	)
 	
 	// Simple padded container
@@ -125,6 +125,17 @@ func (lsb *LibraryStatusBar) setupCallbacks() {
 		}
 	})
 	
+	// Progress arrives from the scan workers at most a few times a second
+	lsb.musicLibrary.SetScanProgressCallback(func(progress models.ScanProgress) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("🔥 [CRASH] Panic in scan progress callback: %v", r)
+			}
+		}()
+		
+		lsb.UpdateScanProgress(progress.Fraction())
+	})
+	
 	// Set up library change callback - this will be called after scanning completes
 	lsb.musicLibrary.SetLibraryChangedCallback(func() {
 		log.Println("📊 [DEBUG] LibraryStatusBar: library changed callback")
@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"bma-go/internal/models"
+)
+
+// MusicFoldersDialog manages the folders the library is built from. Folders can be
+// added, removed and turned off; the library is rescanned once the list is applied.
+type MusicFoldersDialog struct {
+	musicLibrary *models.MusicLibrary
+	config       *models.Config
+	window       fyne.Window
+	dialog       *dialog.CustomDialog
+
+	roots       []models.LibraryRoot         // edited copy of the configured folders
+	statuses    map[string]models.RootStatus // state of each folder when the dialog opened, by path
+	folderList  *widget.List
+	applyButton *widget.Button
+}
+
+// ShowMusicFoldersDialog opens the music folder list over the main window
+func ShowMusicFoldersDialog(musicLibrary *models.MusicLibrary, config *models.Config, window fyne.Window) {
+	d := &MusicFoldersDialog{
+		musicLibrary: musicLibrary,
+		config:       config,
+		window:       window,
+		statuses:     make(map[string]models.RootStatus),
+	}
+	d.initialize()
+	d.dialog.Show()
+}
+
+// initialize builds the folder list and the dialog around it
+func (d *MusicFoldersDialog) initialize() {
+	if d.config != nil {
+		d.roots = append([]models.LibraryRoot(nil), d.config.MusicFolders...)
+	}
+	for _, status := range d.musicLibrary.GetRoots() {
+		d.statuses[status.Path] = status
+	}
+
+	d.folderList = widget.NewList(
+		func() int { return len(d.roots) },
+		func() fyne.CanvasObject {
+			return container.NewHBox(
+				widget.NewCheck("", nil),
+				widget.NewLabel("/path/to/music"),
+				layout.NewSpacer(),
+				widget.NewLabel("Online • 0000 songs"),
+				widget.NewButtonWithIcon("", theme.DeleteIcon(), nil),
+			)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(d.roots) {
+				return
+			}
+			root := d.roots[id]
+			row := obj.(*fyne.Container)
+
+			enabled := row.Objects[0].(*widget.Check)
+			enabled.OnChanged = nil
+			enabled.SetChecked(!root.Disabled)
+			enabled.OnChanged = func(checked bool) {
+				d.roots[id].Disabled = !checked
+				d.folderList.RefreshItem(id)
+				d.applyButton.Enable()
+			}
+
+			row.Objects[1].(*widget.Label).SetText(root.Path)
+			row.Objects[3].(*widget.Label).SetText(d.describeFolder(root))
+			row.Objects[4].(*widget.Button).OnTapped = func() {
+				d.roots = append(d.roots[:id], d.roots[id+1:]...)
+				d.folderList.Refresh()
+				d.applyButton.Enable()
+			}
+		},
+	)
+
+	addButton := widget.NewButtonWithIcon("Add Folder", theme.FolderOpenIcon(), d.addFolder)
+	hint := widget.NewLabel("Unticked folders stay in the list but aren't scanned. Folders on drives that are unplugged show as offline until they're back.")
+	hint.Wrapping = fyne.TextWrapWord
+
+	content := container.NewBorder(
+		container.NewVBox(hint, container.NewHBox(addButton)),
+		nil, nil, nil,
+		d.folderList,
+	)
+
+	cancelButton := widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), func() {
+		d.dialog.Hide()
+	})
+	d.applyButton = widget.NewButtonWithIcon("Apply", theme.ConfirmIcon(), d.apply)
+	d.applyButton.Importance = widget.HighImportance
+	d.applyButton.Disable()
+
+	d.dialog = dialog.NewCustomWithoutButtons("Music Folders", content, d.window)
+	d.dialog.SetButtons([]fyne.CanvasObject{cancelButton, d.applyButton})
+	d.dialog.Resize(fyne.NewSize(720, 440))
+}
+
+// describeFolder summarizes a folder's state for its row
+func (d *MusicFoldersDialog) describeFolder(root models.LibraryRoot) string {
+	if root.Disabled {
+		return "Off"
+	}
+	status, scanned := d.statuses[root.Path]
+	switch {
+	case !scanned || status.Disabled:
+		return "Not scanned yet"
+	case !status.Online:
+		return "🔌 Offline"
+	default:
+		return fmt.Sprintf("Online • %d songs", status.SongCount)
+	}
+}
+
+// addFolder asks for a folder and adds it to the list
+func (d *MusicFoldersDialog) addFolder() {
+	dialog.ShowFolderOpen(func(folder fyne.ListableURI, err error) {
+		if err != nil {
+			log.Printf("❌ [LIBRARY] Error selecting folder: %v", err)
+			return
+		}
+		if folder == nil {
+			return // user cancelled
+		}
+
+		d.roots = models.CleanLibraryRoots(append(d.roots, models.LibraryRoot{Path: folder.Path()}))
+		d.folderList.Refresh()
+		d.applyButton.Enable()
+	}, d.window)
+}
+
+// apply saves the folder list and rescans the library with it
+func (d *MusicFoldersDialog) apply() {
+	roots := models.CleanLibraryRoots(d.roots)
+	d.dialog.Hide()
+
+	if d.config != nil {
+		if err := d.config.SetMusicFolders(roots); err != nil {
+			log.Printf("❌ Failed to save music folders: %v", err)
+		}
+	}
+	go d.musicLibrary.SetRoots(roots)
+}
@@ -0,0 +1,403 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+
+	"bma-go/internal/models"
+)
+
+// maxPlaylistSearchResults caps the song list of the Add Songs dialog
+const maxPlaylistSearchResults = 50
+
+// PlaylistsView shows the server's playlists next to the library: the playlists on
+// the left, the selected one's tracks on the right. Playlists imported from files
+// in the music folders are shown but can't be edited.
+type PlaylistsView struct {
+	musicLibrary *models.MusicLibrary
+	window       fyne.Window
+	content      fyne.CanvasObject
+
+	playlists []models.Playlist // snapshot of the store, in list order
+	selected  *models.Playlist  // playlist whose tracks are shown
+	tracks    []*models.Song    // its songs, nil where a song is missing
+
+	playlistList *widget.List
+	trackList    *widget.List
+	titleLabel   *widget.Label
+	summaryLabel *widget.Label
+	addButton    *widget.Button
+	renameButton *widget.Button
+	exportButton *widget.Button
+	deleteButton *widget.Button
+}
+
+// NewPlaylistsView creates the playlists view and keeps it in sync with the store
+func NewPlaylistsView(musicLibrary *models.MusicLibrary) *PlaylistsView {
+	v := &PlaylistsView{musicLibrary: musicLibrary}
+	v.initialize()
+
+	musicLibrary.Playlists().SetChangedCallback(func(string) { v.reload() })
+	// Songs that come and go change which tracks are missing
+	musicLibrary.SetLibraryChangedCallback(v.reload)
+
+	v.reload()
+	return v
+}
+
+// GetContent returns the view's content
+func (v *PlaylistsView) GetContent() fyne.CanvasObject {
+	return v.content
+}
+
+// SetParentWindow sets the window dialogs are shown over
+func (v *PlaylistsView) SetParentWindow(window fyne.Window) {
+	v.window = window
+}
+
+// initialize builds the playlist list, the track list and their buttons
+func (v *PlaylistsView) initialize() {
+	v.playlistList = widget.NewList(
+		func() int { return len(v.playlists) },
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Playlist name (000)")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(v.playlists) {
+				return
+			}
+			playlist := v.playlists[id]
+			name := fmt.Sprintf("%s (%d)", playlist.Name, len(playlist.SongIDs))
+			if playlist.ReadOnly() {
+				name = "📄 " + name
+			} else if playlist.Smart != nil {
+				name = "✨ " + name
+			}
+			obj.(*widget.Label).SetText(name)
+		},
+	)
+	v.playlistList.OnSelected = func(id widget.ListItemID) {
+		if id < len(v.playlists) {
+			v.showPlaylist(v.playlists[id].ID.String())
+		}
+	}
+
+	v.trackList = widget.NewList(
+		func() int { return len(v.tracks) },
+		func() fyne.CanvasObject {
+			return container.NewHBox(
+				widget.NewLabel("00. Artist — Title"),
+				layout.NewSpacer(),
+				widget.NewLabel("00:00"),
+				widget.NewButtonWithIcon("", theme.MoveUpIcon(), nil),
+				widget.NewButtonWithIcon("", theme.MoveDownIcon(), nil),
+				widget.NewButtonWithIcon("", theme.DeleteIcon(), nil),
+			)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(v.tracks) || v.selected == nil {
+				return
+			}
+			row := obj.(*fyne.Container)
+			song := v.tracks[id]
+
+			if song == nil {
+				row.Objects[0].(*widget.Label).SetText(fmt.Sprintf("%d. ⚠️ Missing song (offline folder or deleted file)", id+1))
+				row.Objects[2].(*widget.Label).SetText("")
+			} else {
+				row.Objects[0].(*widget.Label).SetText(fmt.Sprintf("%d. %s — %s", id+1, song.Artist, song.Title))
+				row.Objects[2].(*widget.Label).SetText(formatTrackDuration(song))
+			}
+
+			playlistID := v.selected.ID.String()
+			readOnly := v.selected.ReadOnly() || v.selected.Smart != nil
+			up := row.Objects[3].(*widget.Button)
+			down := row.Objects[4].(*widget.Button)
+			remove := row.Objects[5].(*widget.Button)
+			up.OnTapped = func() { v.edit(v.musicLibrary.Playlists().MoveTrack(playlistID, id, id-1)) }
+			down.OnTapped = func() { v.edit(v.musicLibrary.Playlists().MoveTrack(playlistID, id, id+1)) }
+			remove.OnTapped = func() { v.edit(v.musicLibrary.Playlists().RemoveTrack(playlistID, id)) }
+			setEnabled(up, !readOnly && id > 0)
+			setEnabled(down, !readOnly && id < len(v.tracks)-1)
+			setEnabled(remove, !readOnly)
+		},
+	)
+
+	newButton := widget.NewButtonWithIcon("New Playlist", theme.ContentAddIcon(), v.createPlaylist)
+	newButton.Importance = widget.HighImportance
+
+	v.titleLabel = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	v.summaryLabel = widget.NewLabel("")
+	v.summaryLabel.Wrapping = fyne.TextWrapWord
+	v.addButton = widget.NewButtonWithIcon("Add Songs", theme.ContentAddIcon(), v.addSongs)
+	v.renameButton = widget.NewButtonWithIcon("Rename", theme.DocumentCreateIcon(), v.renamePlaylist)
+	v.exportButton = widget.NewButtonWithIcon("Export M3U8", theme.DocumentSaveIcon(), v.exportPlaylist)
+	v.deleteButton = widget.NewButtonWithIcon("Delete", theme.DeleteIcon(), v.deletePlaylist)
+
+	left := container.NewBorder(container.NewPadded(newButton), nil, nil, nil, v.playlistList)
+	right := container.NewBorder(
+		container.NewVBox(
+			v.titleLabel,
+			v.summaryLabel,
+			container.NewHBox(v.addButton, v.renameButton, v.exportButton, v.deleteButton),
+		),
+		nil, nil, nil,
+		v.trackList,
+	)
+
+	split := container.NewHSplit(left, right)
+	split.Offset = 0.3
+	v.content = split
+}
+
+// reload refreshes the playlists from the store, keeping the selection
+func (v *PlaylistsView) reload() {
+	v.playlists = v.musicLibrary.Playlists().List()
+	v.playlistList.Refresh()
+
+	selectedID := ""
+	if v.selected != nil {
+		selectedID = v.selected.ID.String()
+	}
+	v.showPlaylist(selectedID)
+
+	// A rename can move the selected playlist to another row
+	if v.selected != nil {
+		v.selectPlaylist(selectedID)
+	}
+}
+
+// showPlaylist shows a playlist's tracks, or an empty state when id is unknown
+func (v *PlaylistsView) showPlaylist(id string) {
+	playlist, ok := v.musicLibrary.Playlists().Get(id)
+	if !ok {
+		v.selected = nil
+		v.tracks = nil
+		v.titleLabel.SetText("No playlist selected")
+		v.summaryLabel.SetText(fmt.Sprintf("%d playlists. Phones and this app share them; .m3u, .m3u8 and .pls files in the music folders are imported too.", len(v.playlists)))
+		for _, button := range []*widget.Button{v.addButton, v.renameButton, v.exportButton, v.deleteButton} {
+			button.Disable()
+		}
+		v.trackList.Refresh()
+		return
+	}
+
+	v.selected = &playlist
+	v.tracks = v.musicLibrary.GetSongsByIDs(playlist.SongIDs)
+	v.titleLabel.SetText(playlist.Name)
+
+	missing := 0
+	for _, song := range v.tracks {
+		if song == nil {
+			missing++
+		}
+	}
+	summary := fmt.Sprintf("%d songs", len(v.tracks))
+	if missing > 0 {
+		summary += fmt.Sprintf(", %d missing", missing)
+	}
+	if playlist.ReadOnly() {
+		summary += fmt.Sprintf(" • Imported from %s, edit the file to change it", playlist.SourcePath)
+	}
+	if playlist.Smart != nil {
+		rules, _ := json.Marshal(playlist.Smart.Rules)
+		summary += fmt.Sprintf(" • Smart playlist, kept up to date from its rules: %s", rules)
+		if playlist.Smart.Sort != "" {
+			summary += fmt.Sprintf(", sorted by %s", playlist.Smart.Sort)
+		}
+		if playlist.Smart.Limit > 0 {
+			summary += fmt.Sprintf(", at most %d songs", playlist.Smart.Limit)
+		}
+	}
+	v.summaryLabel.SetText(summary)
+
+	setEnabled(v.addButton, !playlist.ReadOnly() && playlist.Smart == nil)
+	setEnabled(v.renameButton, !playlist.ReadOnly())
+	setEnabled(v.deleteButton, !playlist.ReadOnly())
+	v.exportButton.Enable()
+	v.trackList.Refresh()
+}
+
+// edit reports a failed store edit; successful ones reload through the callback
+func (v *PlaylistsView) edit(_ models.Playlist, err error) {
+	if err == nil {
+		return
+	}
+	log.Printf("❌ [PLAYLISTS] %v", err)
+	if v.window != nil {
+		dialog.ShowError(err, v.window)
+	}
+}
+
+// createPlaylist asks for a name and creates an empty playlist
+func (v *PlaylistsView) createPlaylist() {
+	v.askName("New Playlist", "Create", "", func(name string) {
+		playlist, err := v.musicLibrary.Playlists().Create(name, nil)
+		v.edit(playlist, err)
+		if err == nil {
+			v.selectPlaylist(playlist.ID.String())
+		}
+	})
+}
+
+// renamePlaylist asks for a new name for the selected playlist
+func (v *PlaylistsView) renamePlaylist() {
+	if v.selected == nil {
+		return
+	}
+	id := v.selected.ID.String()
+	v.askName("Rename Playlist", "Rename", v.selected.Name, func(name string) {
+		v.edit(v.musicLibrary.Playlists().Update(id, &name, nil))
+	})
+}
+
+// askName shows a one-field form for a playlist name
+func (v *PlaylistsView) askName(title, confirm, current string, onConfirm func(string)) {
+	if v.window == nil {
+		log.Println("❌ No parent window set for playlist dialog")
+		return
+	}
+	entry := widget.NewEntry()
+	entry.SetText(current)
+	entry.Validator = func(text string) error {
+		if text == "" {
+			return models.ErrPlaylistNameEmpty
+		}
+		return nil
+	}
+	dialog.ShowForm(title, confirm, "Cancel", []*widget.FormItem{widget.NewFormItem("Name", entry)}, func(ok bool) {
+		if ok {
+			onConfirm(entry.Text)
+		}
+	}, v.window)
+}
+
+// selectPlaylist selects a playlist in the list by ID
+func (v *PlaylistsView) selectPlaylist(id string) {
+	for i, playlist := range v.playlists {
+		if playlist.ID.String() == id {
+			v.playlistList.Select(i)
+			return
+		}
+	}
+}
+
+// deletePlaylist deletes the selected playlist after confirmation
+func (v *PlaylistsView) deletePlaylist() {
+	if v.selected == nil || v.window == nil {
+		return
+	}
+	id, name := v.selected.ID.String(), v.selected.Name
+	dialog.ShowConfirm("Delete Playlist", fmt.Sprintf("Delete %q from every device?", name), func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := v.musicLibrary.Playlists().Delete(id); err != nil {
+			v.edit(models.Playlist{}, err)
+			return
+		}
+		v.playlistList.UnselectAll()
+	}, v.window)
+}
+
+// exportPlaylist saves the selected playlist as an M3U8 file
+func (v *PlaylistsView) exportPlaylist() {
+	if v.selected == nil || v.window == nil {
+		return
+	}
+	playlist := *v.selected
+	songs := v.tracks
+
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			v.edit(playlist, err)
+			return
+		}
+		if writer == nil {
+			return // user cancelled
+		}
+		defer writer.Close()
+
+		if err := models.WritePlaylistM3U8(writer, playlist, songs); err != nil {
+			v.edit(playlist, err)
+			return
+		}
+		log.Printf("📜 [PLAYLISTS] Exported %q to %s", playlist.Name, writer.URI().Path())
+	}, v.window)
+	save.SetFileName(models.PlaylistFileName(playlist.Name))
+	save.Show()
+}
+
+// addSongs opens a search over the library; picking a song appends it to the
+// selected playlist
+func (v *PlaylistsView) addSongs() {
+	if v.selected == nil || v.window == nil {
+		return
+	}
+	id := v.selected.ID.String()
+
+	var results []*models.Song
+	status := widget.NewLabel("Search by title, artist or album, then pick songs to add.")
+	resultList := widget.NewList(
+		func() int { return len(results) },
+		func() fyne.CanvasObject { return widget.NewLabel("Artist — Title (Album)") },
+		func(i widget.ListItemID, obj fyne.CanvasObject) {
+			if i < len(results) {
+				song := results[i]
+				obj.(*widget.Label).SetText(fmt.Sprintf("%s — %s (%s)", song.Artist, song.Title, song.Album))
+			}
+		},
+	)
+	resultList.OnSelected = func(i widget.ListItemID) {
+		resultList.UnselectAll()
+		if i >= len(results) {
+			return
+		}
+		song := results[i]
+		playlist, err := v.musicLibrary.Playlists().AddTracks(id, []uuid.UUID{song.ID}, -1)
+		v.edit(playlist, err)
+		if err == nil {
+			status.SetText(fmt.Sprintf("Added %s — %s (%d songs)", song.Artist, song.Title, len(playlist.SongIDs)))
+		}
+	}
+
+	search := widget.NewEntry()
+	search.SetPlaceHolder("Search the library")
+	search.OnChanged = func(query string) {
+		results = v.musicLibrary.Search(query, maxPlaylistSearchResults).Songs
+		resultList.Refresh()
+	}
+
+	content := container.NewBorder(container.NewVBox(search, status), nil, nil, nil, resultList)
+	d := dialog.NewCustom("Add Songs to "+v.selected.Name, "Done", content, v.window)
+	d.Resize(fyne.NewSize(640, 480))
+	d.Show()
+	v.window.Canvas().Focus(search)
+}
+
+// formatTrackDuration formats a song's length as m:ss
+func formatTrackDuration(song *models.Song) string {
+	if song.Duration <= 0 {
+		return ""
+	}
+	seconds := int(song.Duration.Seconds())
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// setEnabled enables or disables a button
+func setEnabled(button *widget.Button, enabled bool) {
+	if enabled {
+		button.Enable()
+	} else {
+		button.Disable()
+	}
+}
@@ -44,7 +44,7 @@ func (s *WelcomeStep) GetContent() fyne.CanvasObject {
 		
 		// Feature list without icons - cleaner look
 		features := widget.NewLabelWithStyle(
-			"• Install Tailscale for remote access\n• Download the Android app\n• Select your music folder\n• Automatic server startup & pairing",
+			"• Install Tailscale for remote access\n• Download the Android app\n• Select your music folders\n• Automatic server startup & pairing",
 			fyne.TextAlignLeading,
 			fyne.TextStyle{},
 		)
@@ -549,10 +549,11 @@ func (s *PairingStep) GetNextAction() func() { return nil }
 type MusicLibraryStep struct {
 	content       fyne.CanvasObject
 	config        *models.Config
-	folderPath    string
+	folderPaths   []string
 	pathCard      *customTheme.ModernCard
 	pathLabel     *widget.Label
 	selectButton  *customTheme.ModernButton
+	clearButton   *widget.Button
 	window        fyne.Window
 	onStateChange func() // Callback when folder selection changes
 }
@@ -568,7 +569,7 @@ func (s *MusicLibraryStep) GetContent() fyne.CanvasObject {
 		title := widget.NewLabelWithStyle("Select Music Library", fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
 		
 		description := widget.NewLabelWithStyle(
-			"Choose the folder containing your music files.\nThe app will scan for MP3 files in this folder and subfolders.",
+			"Choose the folders containing your music files, such as an internal disk, a USB drive or a NAS mount.\nThe app will scan for MP3, FLAC, M4A, OGG, Opus and WAV files in these folders and subfolders.",
 			fyne.TextAlignCenter,
 			fyne.TextStyle{},
 		)
@@ -577,12 +578,18 @@ func (s *MusicLibraryStep) GetContent() fyne.CanvasObject {
 		s.pathLabel = widget.NewLabelWithStyle("No folder selected", fyne.TextAlignCenter, fyne.TextStyle{Italic: true})
 		s.pathCard = customTheme.NewModernCard("Selected Folder", "", s.pathLabel)
 		
-		// Clean select button
-		s.selectButton = customTheme.NewModernButton("Select Music Folder", func() {
+		// Clean select button; each pick adds another folder
+		s.selectButton = customTheme.NewModernButton("Add Music Folder", func() {
 			s.showFolderDialog()
 		})
 		s.selectButton.SetImportance(widget.HighImportance)
 		
+		s.clearButton = widget.NewButton("Clear", func() {
+			s.folderPaths = nil
+			s.saveFolders()
+		})
+		s.clearButton.Hide()
+		
 		// Main card
 		libraryCard := customTheme.NewModernCard(
 			"",
@@ -592,7 +599,7 @@ func (s *MusicLibraryStep) GetContent() fyne.CanvasObject {
 				description,
 				widget.NewSeparator(),
 				s.pathCard,
-				container.NewCenter(s.selectButton),
+				container.NewCenter(container.NewHBox(s.selectButton, s.clearButton)),
 			),
 		)
 		
@@ -611,27 +618,55 @@ func (s *MusicLibraryStep) showFolderDialog() {
 			return
 		}
 		
-		s.folderPath = folder.Path()
-		
-		// Update the existing label instead of creating a new one
-		s.pathLabel.SetText(s.folderPath)
-		s.pathLabel.TextStyle = fyne.TextStyle{} // Remove italic style
-		s.pathLabel.Refresh()
-		
-		// Update the card title
-		s.pathCard.Title = "Music Folder Selected"
-		s.pathCard.Refresh()
-		
-		// Save to config
-		s.config.SetMusicFolder(s.folderPath)
-		
-		// Notify wizard that state has changed
-		if s.onStateChange != nil {
-			s.onStateChange()
+		for _, path := range s.folderPaths {
+			if path == folder.Path() {
+				return
+			}
 		}
+		s.folderPaths = append(s.folderPaths, folder.Path())
+		s.saveFolders()
 	}, s.window)
 }
 
+// saveFolders saves the chosen folders and shows them in the card
+func (s *MusicLibraryStep) saveFolders() {
+	roots := make([]models.LibraryRoot, len(s.folderPaths))
+	for i, path := range s.folderPaths {
+		roots[i] = models.LibraryRoot{Path: path}
+	}
+	if err := s.config.SetMusicFolders(roots); err != nil {
+		log.Printf("❌ Failed to save music folders: %v", err)
+	}
+	
+	s.showFolders()
+	
+	// Notify wizard that state has changed
+	if s.onStateChange != nil {
+		s.onStateChange()
+	}
+}
+
+// showFolders updates the existing label and card instead of creating new ones
+func (s *MusicLibraryStep) showFolders() {
+	if s.pathLabel == nil || s.pathCard == nil {
+		return
+	}
+	
+	if len(s.folderPaths) == 0 {
+		s.pathLabel.SetText("No folder selected")
+		s.pathLabel.TextStyle = fyne.TextStyle{Italic: true}
+		s.pathCard.Title = "Selected Folder"
+		s.clearButton.Hide()
+	} else {
+		s.pathLabel.SetText(strings.Join(s.folderPaths, "\n"))
+		s.pathLabel.TextStyle = fyne.TextStyle{} // Remove italic style
+		s.pathCard.Title = "Music Folders Selected"
+		s.clearButton.Show()
+	}
+	s.pathLabel.Refresh()
+	s.pathCard.Refresh()
+}
+
 func (s *MusicLibraryStep) SetWindow(window fyne.Window) {
 	s.window = window
 }
@@ -643,22 +678,17 @@ func (s *MusicLibraryStep) SetStateChangeCallback(callback func()) {
 
 func (s *MusicLibraryStep) GetTitle() string { return "Music Library" }
 func (s *MusicLibraryStep) OnEnter() {
-	// Check if music folder is already configured
-	if s.config != nil && s.config.MusicFolder != "" {
-		s.folderPath = s.config.MusicFolder
-		if s.pathLabel != nil {
-			s.pathLabel.SetText(s.folderPath)
-			s.pathLabel.TextStyle = fyne.TextStyle{} // Remove italic style
-			s.pathLabel.Refresh()
-		}
-		if s.pathCard != nil {
-			s.pathCard.Title = "Music Folder Selected"
-			s.pathCard.Refresh()
+	// Check if music folders are already configured
+	if s.config != nil && len(s.config.MusicFolders) > 0 {
+		s.folderPaths = nil
+		for _, root := range s.config.MusicFolders {
+			s.folderPaths = append(s.folderPaths, root.Path)
 		}
+		s.showFolders()
 	}
 }
 func (s *MusicLibraryStep) OnExit()          {}
-func (s *MusicLibraryStep) CanContinue() bool { return s.folderPath != "" }
+func (s *MusicLibraryStep) CanContinue() bool { return len(s.folderPaths) > 0 }
 func (s *MusicLibraryStep) GetNextAction() func() { return nil }
 
 // SetupCompleteStep - Step 6: Setup completion
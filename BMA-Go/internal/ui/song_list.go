@@ -17,20 +17,28 @@ import (
 	customTheme "bma-go/internal/ui/theme"
 )
 
+// listArtworkSize is the artwork variant decoded for list rows
+const listArtworkSize = 256
+
 // SongListView displays the music library with album folder organization
 type SongListView struct {
 	musicLibrary    *models.MusicLibrary
 	content         *fyne.Container
 	folderButton    *customTheme.ModernButton
+	rulesButton     *customTheme.ModernButton
+	dupesButton     *customTheme.ModernButton
 	songList        *widget.List
 	noMusicCard     *customTheme.ModernCard
 	parentWindow    fyne.Window
+	config          *models.Config   // Saved when music folders, library rules or the duplicate policy change
 	centerStack     *fyne.Container  // Stack layout for switching between views
+	playlistsView   *PlaylistsView   // Playlists tab next to the library
+	statsView       *StatsView       // Listening Stats tab built from scrobbled plays
 	
 	// Animation state
 	isAnimating     bool
 	
-	// Artwork cache
+	// Decoded artwork, keyed by artwork ID so a new cover image replaces the old one
 	artworkCache    map[string]*canvas.Image
 	artworkMutex    sync.RWMutex
 	placeholderImg  *canvas.Image
@@ -73,14 +81,17 @@ func (slv *SongListView) createPlaceholderImage() {
 
 // getDisplayItemArtwork retrieves or creates artwork for a display item (album or folder)
 func (slv *SongListView) getDisplayItemArtwork(item models.DisplayItem) *canvas.Image {
-	// Use item ID as cache key
-	itemID := item.GetID()
+	// Items sharing a cover (or an album whose cover changed) are keyed by the picture itself
+	artworkID := item.ArtworkID()
+	if artworkID == "" {
+		return slv.placeholderImg
+	}
 	
-	log.Printf("🎨 [ARTWORK] Getting artwork for item: %s (ID: %s, folder: %t)", item.GetName(), itemID, item.IsFolder())
+	log.Printf("🎨 [ARTWORK] Getting artwork for item: %s (ID: %s, folder: %t)", item.GetName(), item.GetID(), item.IsFolder())
 	
 	// Check cache first
 	slv.artworkMutex.RLock()
-	if cachedImg, exists := slv.artworkCache[itemID]; exists {
+	if cachedImg, exists := slv.artworkCache[artworkID]; exists {
 		slv.artworkMutex.RUnlock()
 		// Check if cached image is placeholder or real artwork
 		if cachedImg == slv.placeholderImg {
@@ -94,8 +105,11 @@ func (slv *SongListView) getDisplayItemArtwork(item models.DisplayItem) *canvas.
 	
 	log.Printf("🎨 [ARTWORK] Cache miss for item: %s, checking %d songs for artwork", item.GetName(), len(item.GetSongs()))
 	
-	// Try to get artwork from item
-	artworkData := item.GetArtwork()
+	// A thumbnail is plenty for the list and keeps full-size covers out of memory
+	artworkData, err := item.GetArtworkVariant(listArtworkSize)
+	if err != nil {
+		artworkData = item.GetArtwork()
+	}
 	if len(artworkData) == 0 {
 		log.Printf("🎨 [ARTWORK] No artwork data found for item: %s, using placeholder", item.GetName())
 		return slv.placeholderImg
@@ -119,7 +133,7 @@ func (slv *SongListView) getDisplayItemArtwork(item models.DisplayItem) *canvas.
 	
 	// Cache the image
 	slv.artworkMutex.Lock()
-	slv.artworkCache[itemID] = canvasImg
+	slv.artworkCache[artworkID] = canvasImg
 	slv.artworkMutex.Unlock()
 	
 	log.Printf("🎨 [ARTWORK] Cached artwork for item: %s", item.GetName())
@@ -138,16 +152,32 @@ func (slv *SongListView) getAlbumArtwork(album *models.Album) *canvas.Image {
 func (slv *SongListView) initialize() {
 	// Clean folder selection button - no icon
 	slv.folderButton = customTheme.NewModernButton(
-		"Select Music Folder",
+		"Music Folders",
 		func() {
 			slv.onSelectFolder()
 		},
 	)
 	slv.folderButton.SetImportance(widget.HighImportance)
+	
+	// Album grouping and inference rules, previewed before they're applied
+	slv.rulesButton = customTheme.NewModernButton(
+		"Library Rules",
+		func() {
+			slv.onEditRules()
+		},
+	)
+
+	// Duplicate groups found by the last scan, and the policy that picks which copy stays
+	slv.dupesButton = customTheme.NewModernButton(
+		"Duplicates",
+		func() {
+			slv.onShowDuplicates()
+		},
+	)
 
 	// No music selected message in a clean card
 	noMusicLabel := widget.NewLabelWithStyle(
-		"No music folder selected.\nClick 'Select Music Folder' to choose your music directory.",
+		"No music folder selected.\nClick 'Music Folders' to add your music directories.",
 		fyne.TextAlignCenter,
 		fyne.TextStyle{},
 	)
@@ -194,7 +224,7 @@ func (slv *SongListView) initialize() {
 	)
 
 	// Header with button - remove extra padding
-	headerContent := container.NewPadded(slv.folderButton)
+	headerContent := container.NewPadded(container.NewBorder(nil, nil, nil, container.NewHBox(slv.dupesButton, slv.rulesButton), slv.folderButton))
 
 	// IMPORTANT: Set up library listener BEFORE creating content
 	// This ensures callbacks are registered before any potential library loading
@@ -207,13 +237,22 @@ func (slv *SongListView) initialize() {
 	// Initially show the appropriate content
 	slv.updateCenterStack()
 
+	// Playlists are shared with every paired device, so they sit beside the library
+	slv.playlistsView = NewPlaylistsView(slv.musicLibrary)
+	slv.statsView = NewStatsView(slv.musicLibrary)
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Library", slv.centerStack),
+		container.NewTabItem("Playlists", slv.playlistsView.GetContent()),
+		container.NewTabItem("Listening Stats", slv.statsView.GetContent()),
+	)
+
 	// Main content area - use Border layout to give list maximum vertical space
 	slv.content = container.NewBorder(
-		headerContent,    // top - header gets only the space it needs
-		nil,             // bottom
-		nil,             // left  
-		nil,             // right
-		slv.centerStack, // center - list gets all remaining space
+		headerContent, // top - header gets only the space it needs
+		nil,           // bottom
+		nil,           // left  
+		nil,           // right
+		tabs,          // center - the tabs get all remaining space
 	)
 	
 	// Do an initial refresh in case music is already loaded
@@ -299,9 +338,33 @@ func (slv *SongListView) GetContent() fyne.CanvasObject {
 // SetParentWindow sets the parent window for dialogs
 func (slv *SongListView) SetParentWindow(window fyne.Window) {
 	slv.parentWindow = window
+	slv.playlistsView.SetParentWindow(window)
+}
+
+// SetConfig sets the config music folder, library rule and duplicate policy changes are saved to
+func (slv *SongListView) SetConfig(config *models.Config) {
+	slv.config = config
+}
+
+// onEditRules opens the library rules editor
+func (slv *SongListView) onEditRules() {
+	if slv.parentWindow == nil {
+		log.Println("❌ No parent window set for library rules dialog")
+		return
+	}
+	ShowLibraryRulesDialog(slv.musicLibrary, slv.config, slv.parentWindow)
+}
+
+// onShowDuplicates opens the duplicates view
+func (slv *SongListView) onShowDuplicates() {
+	if slv.parentWindow == nil {
+		log.Println("❌ No parent window set for duplicates view")
+		return
+	}
+	ShowDuplicatesDialog(slv.musicLibrary, slv.config, slv.parentWindow)
 }
 
-// onSelectFolder handles folder selection
+// onSelectFolder opens the music folder list
 func (slv *SongListView) onSelectFolder() {
 	if slv.parentWindow == nil {
 		// Update the no music card with error
@@ -311,8 +374,7 @@ func (slv *SongListView) onSelectFolder() {
 		return
 	}
 	
-	// Open the folder selection dialog using the MusicLibrary
-	slv.musicLibrary.ShowFolderSelectionDialog(slv.parentWindow)
+	ShowMusicFoldersDialog(slv.musicLibrary, slv.config, slv.parentWindow)
 }
 
 // LoadMusicLibrary loads and displays the music library
@@ -0,0 +1,207 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+
+	"bma-go/internal/models"
+)
+
+const (
+	// statsTopLimit is how many songs, albums and artists each top list shows
+	statsTopLimit = 25
+	// statsRecentLimit is how many plays the recently played list shows
+	statsRecentLimit = 50
+	allDevicesOption = "All devices"
+)
+
+// statsRanges maps the range options to ParseStatsRange values, in display order
+var statsRanges = []struct{ label, value string }{
+	{"Last week", "week"},
+	{"Last month", "month"},
+	{"Last year", "year"},
+	{"All time", "all"},
+}
+
+// StatsView shows listening stats scrobbled by the paired devices: what was
+// played most over a range, for one device or all of them, and the latest plays.
+type StatsView struct {
+	musicLibrary *models.MusicLibrary
+	content      fyne.CanvasObject
+
+	rangeValue string
+	deviceID   uuid.UUID
+	devices    []models.PlayDevice
+
+	topSongs   []models.TopEntry
+	topAlbums  []models.TopEntry
+	topArtists []models.TopEntry
+	recent     []models.Play
+
+	rangeSelect  *widget.Select
+	deviceSelect *widget.Select
+	summaryLabel *widget.Label
+	songList     *widget.List
+	albumList    *widget.List
+	artistList   *widget.List
+	recentList   *widget.List
+}
+
+// NewStatsView creates the stats view and refreshes it whenever plays are recorded
+func NewStatsView(musicLibrary *models.MusicLibrary) *StatsView {
+	v := &StatsView{musicLibrary: musicLibrary, rangeValue: "month"}
+	v.initialize()
+
+	musicLibrary.History().SetPlaysAddedCallback(func(int) { v.reload() })
+
+	v.reload()
+	return v
+}
+
+// GetContent returns the view's content
+func (v *StatsView) GetContent() fyne.CanvasObject {
+	return v.content
+}
+
+// initialize builds the filters, the summary and the four lists
+func (v *StatsView) initialize() {
+	rangeLabels := make([]string, len(statsRanges))
+	for i, r := range statsRanges {
+		rangeLabels[i] = r.label
+	}
+	v.rangeSelect = widget.NewSelect(rangeLabels, func(label string) {
+		for _, r := range statsRanges {
+			if r.label == label && r.value != v.rangeValue {
+				v.rangeValue = r.value
+				v.reload()
+			}
+		}
+	})
+	v.rangeSelect.SetSelected("Last month")
+
+	v.deviceSelect = widget.NewSelect([]string{allDevicesOption}, func(label string) {
+		deviceID := uuid.Nil
+		for _, device := range v.devices {
+			if deviceOptionLabel(device) == label {
+				deviceID = device.ID
+			}
+		}
+		if deviceID != v.deviceID {
+			v.deviceID = deviceID
+			v.reload()
+		}
+	})
+	v.deviceSelect.SetSelected(allDevicesOption)
+
+	v.summaryLabel = widget.NewLabel("")
+
+	v.songList = newTopList(&v.topSongs, true)
+	v.albumList = newTopList(&v.topAlbums, true)
+	v.artistList = newTopList(&v.topArtists, false)
+	v.recentList = widget.NewList(
+		func() int { return len(v.recent) },
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Artist — Title · Device · 00 Jan 15:04")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(v.recent) {
+				return
+			}
+			play := v.recent[id]
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s — %s · %s · %s",
+				play.Artist, play.Title, play.DeviceName, play.PlayedAt.Local().Format("2 Jan 15:04")))
+		},
+	)
+
+	filters := container.NewHBox(
+		widget.NewLabel("Range:"), v.rangeSelect,
+		widget.NewLabel("Device:"), v.deviceSelect,
+	)
+	lists := container.NewGridWithColumns(2,
+		titledList("Top Songs", v.songList),
+		titledList("Top Albums", v.albumList),
+		titledList("Top Artists", v.artistList),
+		titledList("Recently Played", v.recentList),
+	)
+	v.content = container.NewBorder(container.NewVBox(filters, v.summaryLabel), nil, nil, nil, lists)
+}
+
+// reload recomputes the stats for the current range and device
+func (v *StatsView) reload() {
+	history := v.musicLibrary.History()
+	since, _ := models.ParseStatsRange(v.rangeValue)
+	filter := models.PlayFilter{Since: since, DeviceID: v.deviceID}
+
+	// Devices show up as they scrobble for the first time
+	v.devices = history.Devices()
+	options := []string{allDevicesOption}
+	for _, device := range v.devices {
+		options = append(options, deviceOptionLabel(device))
+	}
+	v.deviceSelect.Options = options
+	v.deviceSelect.Refresh()
+
+	v.topSongs = history.TopSongs(filter, statsTopLimit)
+	v.topAlbums = history.TopAlbums(filter, statsTopLimit)
+	v.topArtists = history.TopArtists(filter, statsTopLimit)
+	v.recent = history.Plays(filter, statsRecentLimit)
+
+	summary := history.Summary(filter)
+	if summary.PlayCount == 0 {
+		v.summaryLabel.SetText("No plays yet — paired devices report what they play to the server")
+	} else {
+		v.summaryLabel.SetText(fmt.Sprintf("%d plays · %s listened · %d different songs",
+			summary.PlayCount, formatListenTime(summary.ListenTime), summary.SongCount))
+	}
+
+	v.songList.Refresh()
+	v.albumList.Refresh()
+	v.artistList.Refresh()
+	v.recentList.Refresh()
+}
+
+// newTopList creates a ranked list over entries, which reload replaces
+func newTopList(entries *[]models.TopEntry, withArtist bool) *widget.List {
+	return widget.NewList(
+		func() int { return len(*entries) },
+		func() fyne.CanvasObject {
+			return widget.NewLabel("00. Artist — Title (000 plays)")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(*entries) {
+				return
+			}
+			entry := (*entries)[id]
+			name := entry.Name
+			if withArtist && entry.Artist != "" {
+				name = entry.Artist + " — " + name
+			}
+			obj.(*widget.Label).SetText(fmt.Sprintf("%d. %s (%d plays)", id+1, name, entry.PlayCount))
+		},
+	)
+}
+
+// titledList puts a bold title above a list
+func titledList(title string, list *widget.List) fyne.CanvasObject {
+	header := widget.NewLabelWithStyle(title, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	return container.NewBorder(header, nil, nil, nil, list)
+}
+
+// deviceOptionLabel names a device in the device filter; the ID suffix tells
+// apart phones that share a name
+func deviceOptionLabel(device models.PlayDevice) string {
+	return fmt.Sprintf("%s (%s)", device.Name, device.ID.String()[:8])
+}
+
+// formatListenTime formats a listening time as hours and minutes
+func formatListenTime(d time.Duration) string {
+	if d < time.Hour {
+		return fmt.Sprintf("%d min", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%d h %d min", int(d.Hours()), int(d.Minutes())%60)
+}
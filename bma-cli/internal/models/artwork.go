@@ -0,0 +1,282 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ArtworkSizes are the thumbnail sizes /artwork serves, as the longest side in pixels
+var ArtworkSizes = []int{64, 256, 600}
+
+// artworkJPEGQuality is used for every resized variant
+const artworkJPEGQuality = 85
+
+// errNoArtwork is returned for songs without an embedded picture
+var errNoArtwork = errors.New("no artwork")
+
+// ArtworkCache stores embedded pictures on disk, named by the SHA-256 of their
+// bytes. A picture shared by every track of an album is stored once, and songs
+// only keep the hash. Resized JPEG variants sit next to the original and are
+// generated on first request.
+//
+//	artwork/ab/ab12...ef        original bytes, as found in the tags
+//	artwork/ab/ab12...ef-256    JPEG scaled to fit 256x256
+type ArtworkCache struct {
+	dir   string
+	mutex sync.Mutex // serializes writes, which share temp file names
+}
+
+var (
+	defaultArtworkCache     *ArtworkCache
+	defaultArtworkCacheOnce sync.Once
+)
+
+// DefaultArtworkCache returns the cache under the data directory
+func DefaultArtworkCache() *ArtworkCache {
+	defaultArtworkCacheOnce.Do(func() {
+		dataDir, err := GetDataDir()
+		if err != nil {
+			log.Printf("⚠️ [ARTWORK] Cannot resolve data directory, artwork will be read from files: %v", err)
+			defaultArtworkCache = &ArtworkCache{}
+			return
+		}
+		defaultArtworkCache = OpenArtworkCache(filepath.Join(dataDir, "artwork"))
+	})
+	return defaultArtworkCache
+}
+
+// OpenArtworkCache returns a cache rooted at dir; directories are created on first write
+func OpenArtworkCache(dir string) *ArtworkCache {
+	return &ArtworkCache{dir: dir}
+}
+
+// ArtworkHash returns the content hash a picture is stored under
+func ArtworkHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// IsArtworkSize reports whether size is one of ArtworkSizes
+func IsArtworkSize(size int) bool {
+	for _, allowed := range ArtworkSizes {
+		if size == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns where a picture (size 0) or one of its variants is stored
+func (c *ArtworkCache) path(hash string, size int) (string, error) {
+	if c.dir == "" {
+		return "", fmt.Errorf("artwork cache unavailable")
+	}
+	if len(hash) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid artwork hash %q", hash)
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", fmt.Errorf("invalid artwork hash %q", hash)
+	}
+
+	name := hash
+	if size > 0 {
+		name = hash + "-" + strconv.Itoa(size)
+	}
+	return filepath.Join(c.dir, hash[:2], name), nil
+}
+
+// Store saves a picture unless it is already cached and returns its hash
+func (c *ArtworkCache) Store(data []byte) (string, error) {
+	hash := ArtworkHash(data)
+	return hash, c.write(hash, 0, data)
+}
+
+// write stores a file under the cache unless it already exists. Content is
+// addressed by hash, so an existing file never needs replacing.
+func (c *ArtworkCache) write(hash string, size int, data []byte) error {
+	path, err := c.path(hash, size)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create artwork directory: %w", err)
+	}
+	if err := WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write artwork: %w", err)
+	}
+	return nil
+}
+
+// Load returns the original bytes of a cached picture
+func (c *ArtworkCache) Load(hash string) ([]byte, error) {
+	path, err := c.path(hash, 0)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// Variant returns a picture scaled to fit size x size as JPEG, creating it on first
+// use. Pictures already that small are re-encoded but never enlarged.
+func (c *ArtworkCache) Variant(hash string, size int) ([]byte, error) {
+	if !IsArtworkSize(size) {
+		return nil, fmt.Errorf("unsupported artwork size %d", size)
+	}
+
+	path, err := c.path(hash, size)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	}
+
+	original, err := c.Load(hash)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode artwork: %w", err)
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, resizeToFit(img, size), &jpeg.Options{Quality: artworkJPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode artwork: %w", err)
+	}
+
+	if err := c.write(hash, size, encoded.Bytes()); err != nil {
+		log.Printf("⚠️ [ARTWORK] %v", err)
+	}
+	log.Printf("🎨 [ARTWORK] Created %dpx variant of %s (%d -> %d bytes)", size, hash[:12], len(original), encoded.Len())
+	return encoded.Bytes(), nil
+}
+
+// Prune deletes cached pictures and variants whose hash isn't referenced any more
+func (c *ArtworkCache) Prune(referenced map[string]bool) int {
+	if c.dir == "" {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	shards, err := os.ReadDir(c.dir)
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		shardPath := filepath.Join(c.dir, shard.Name())
+		entries, err := os.ReadDir(shardPath)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			hash, _, _ := strings.Cut(entry.Name(), "-")
+			if referenced[hash] {
+				continue
+			}
+			if err := os.Remove(filepath.Join(shardPath, entry.Name())); err == nil {
+				removed++
+			}
+		}
+	}
+
+	if removed > 0 {
+		log.Printf("🎨 [ARTWORK] Pruned %d unused cache files", removed)
+	}
+	return removed
+}
+
+// resizeToFit scales an image down so its longest side is at most size, averaging
+// every source pixel that falls into a destination pixel. Transparent areas are
+// flattened onto white since JPEG has no alpha.
+func resizeToFit(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := srcWidth, srcHeight
+	if srcWidth > size || srcHeight > size {
+		if srcWidth >= srcHeight {
+			dstWidth = size
+			dstHeight = srcHeight * size / srcWidth
+		} else {
+			dstHeight = size
+			dstWidth = srcWidth * size / srcHeight
+		}
+		if dstWidth < 1 {
+			dstWidth = 1
+		}
+		if dstHeight < 1 {
+			dstHeight = 1
+		}
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Over)
+	if dstWidth == srcWidth && dstHeight == srcHeight {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := y * srcHeight / dstHeight
+		y1 := (y + 1) * srcHeight / dstHeight
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dstWidth; x++ {
+			x0 := x * srcWidth / dstWidth
+			x1 := (x + 1) * srcWidth / dstWidth
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, count uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					b += uint64(row[i+2])
+					count++
+				}
+			}
+
+			offset := y*dst.Stride + x*4
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = 0xff
+		}
+	}
+	return dst
+}
@@ -0,0 +1,126 @@
+package models
+
+import "github.com/google/uuid"
+
+// maxChangeLogEntries bounds how many library versions back /library/changes can
+// answer; older clients are told to do a full sync instead
+const maxChangeLogEntries = 256
+
+// changeLogEntry records which songs one library version changed
+type changeLogEntry struct {
+	Previous int64 // version the change was applied to
+	Version  int64 // version it produced
+	Added    []uuid.UUID
+	Updated  []uuid.UUID
+	Removed  []uuid.UUID
+}
+
+// LibraryDelta describes how the library changed since a version a client has seen
+type LibraryDelta struct {
+	Since    int64
+	Version  int64
+	FullSync bool // the changelog doesn't reach back to Since; refetch the whole library
+	Added    []*Song
+	Updated  []*Song
+	Removed  []uuid.UUID
+}
+
+// recordChangesUnsafe appends a changelog entry (assumes versionMutex held)
+func (ml *MusicLibrary) recordChangesUnsafe(previous, version int64, changes LibraryChanges) {
+	entry := changeLogEntry{Previous: previous, Version: version}
+	for _, song := range changes.Added {
+		entry.Added = append(entry.Added, song.ID)
+	}
+	for _, song := range changes.Updated {
+		entry.Updated = append(entry.Updated, song.ID)
+	}
+	for _, song := range changes.Removed {
+		entry.Removed = append(entry.Removed, song.ID)
+	}
+
+	ml.changeLog = append(ml.changeLog, entry)
+	if len(ml.changeLog) > maxChangeLogEntries {
+		ml.changeLog = append([]changeLogEntry(nil), ml.changeLog[len(ml.changeLog)-maxChangeLogEntries:]...)
+	}
+}
+
+// isLoggedVersionUnsafe reports whether the changelog can answer from version. Only
+// versions this process produced qualify: LibraryVersion isn't persisted, so after a
+// restart the log starts over at 0, and a version from before lies somewhere inside
+// its range without the deletions made meanwhile (assumes versionMutex held).
+func (ml *MusicLibrary) isLoggedVersionUnsafe(version int64) bool {
+	if len(ml.changeLog) == 0 {
+		return false
+	}
+	if version == ml.changeLog[0].Previous {
+		return true
+	}
+	for _, entry := range ml.changeLog {
+		if entry.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangesSince folds every change after the given version into one delta: a song
+// added and then removed again is left out, one removed and re-added is "updated".
+func (ml *MusicLibrary) ChangesSince(since int64) LibraryDelta {
+	ml.versionMutex.RLock()
+	delta := LibraryDelta{Since: since, Version: ml.LibraryVersion}
+
+	if since == ml.LibraryVersion {
+		ml.versionMutex.RUnlock()
+		return delta
+	}
+	if !ml.isLoggedVersionUnsafe(since) {
+		ml.versionMutex.RUnlock()
+		delta.FullSync = true
+		return delta
+	}
+
+	// Whether each touched song existed at `since`, judged by the first change to it
+	existedBefore := make(map[uuid.UUID]bool)
+	var touched []uuid.UUID
+	note := func(id uuid.UUID, existed bool) {
+		if _, seen := existedBefore[id]; !seen {
+			existedBefore[id] = existed
+			touched = append(touched, id)
+		}
+	}
+	for _, entry := range ml.changeLog {
+		if entry.Version <= since {
+			continue
+		}
+		for _, id := range entry.Added {
+			note(id, false)
+		}
+		for _, id := range entry.Updated {
+			note(id, true)
+		}
+		for _, id := range entry.Removed {
+			note(id, true)
+		}
+	}
+	ml.versionMutex.RUnlock()
+
+	ml.mutex.RLock()
+	current := make(map[uuid.UUID]*Song, len(ml.Songs))
+	for _, song := range ml.Songs {
+		current[song.ID] = song
+	}
+	ml.mutex.RUnlock()
+
+	for _, id := range touched {
+		song, existsNow := current[id]
+		switch {
+		case existsNow && existedBefore[id]:
+			delta.Updated = append(delta.Updated, song)
+		case existsNow:
+			delta.Added = append(delta.Added, song)
+		case existedBefore[id]:
+			delta.Removed = append(delta.Removed, id)
+		}
+	}
+	return delta
+}
@@ -4,28 +4,90 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Config represents the application configuration
 type Config struct {
 	SetupComplete bool   `json:"setupComplete"`
-	MusicFolder   string `json:"musicFolder,omitempty"`
+	MusicFolder   string `json:"musicFolder,omitempty"` // single folder from older configs, moved into MusicFolders on load
 	TailscaleIP   string `json:"tailscaleIP,omitempty"`
+	
+	// Browser origins allowed to call the API cross-origin (e.g. a web player).
+	// Empty by default: the mobile app doesn't use CORS at all.
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+	
+	// Cover image file names to look for next to the tracks, highest priority
+	// first. Empty means DefaultArtworkFilenames.
+	ArtworkFilenames []string `json:"artworkFilenames,omitempty"`
+	
+	// Folders the library is built from, each scanned and watched on its own
+	MusicFolders []LibraryRoot `json:"musicFolders,omitempty"`
+	
+	// How albums are grouped and what is inferred from paths when tags are
+	// missing. Nil means DefaultLibraryRules.
+	LibraryRules *LibraryRules `json:"libraryRules,omitempty"`
+	
+	// Which copy of a duplicated song is listed: first, bitrate, lossless, newest
+	// or keep-all. Empty means first.
+	DuplicatePolicy string `json:"duplicatePolicy,omitempty"`
+	
+	// Also treat files with identical audio data as duplicates, whatever their
+	// tags say. The first scan with this on reads every file once.
+	FingerprintDuplicates bool `json:"fingerprintDuplicates,omitempty"`
+	
+	// ffmpeg used to convert streams for ?format= and ?maxBitrate=. Empty looks
+	// for ffmpeg on the PATH; without one, original files are streamed.
+	FFmpegPath string `json:"ffmpegPath,omitempty"`
+	
+	// Disk space for finished transcodes, in MB. Zero means
+	// DefaultTranscodeCacheMB, a negative value turns the cache off.
+	TranscodeCacheMB int `json:"transcodeCacheMB,omitempty"`
 }
 
-// GetConfigPath returns the path to the config file
-func GetConfigPath() (string, error) {
+// IsOriginAllowed reports whether a browser origin is listed in AllowedOrigins
+func (c *Config) IsOriginAllowed(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDataDir returns the directory holding config and other persistent state
+func GetDataDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
 	
-	configDir := filepath.Join(homeDir, ".bma-cli")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	dataDir := filepath.Join(homeDir, ".bma-cli")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return "", err
+	}
+	
+	return dataDir, nil
+}
+
+// GetConfigPath returns the path to the config file
+func GetConfigPath() (string, error) {
+	dataDir, err := GetDataDir()
+	if err != nil {
 		return "", err
 	}
 	
-	return filepath.Join(configDir, "config.json"), nil
+	return filepath.Join(dataDir, "config.json"), nil
+}
+
+// WriteFileAtomic writes data to a temporary file and renames it into place, so a
+// crash mid-write never leaves a truncated state file behind
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
 }
 
 // LoadConfig loads the configuration from file or returns default config
@@ -52,6 +114,14 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 	
+	// Older configs had a single music folder
+	if config.MusicFolder != "" {
+		if len(config.MusicFolders) == 0 {
+			config.MusicFolders = []LibraryRoot{{Path: config.MusicFolder}}
+		}
+		config.MusicFolder = ""
+	}
+	
 	return &config, nil
 }
 
@@ -76,12 +146,36 @@ func (c *Config) MarkSetupComplete() error {
 	return c.SaveConfig()
 }
 
-// SetMusicFolder sets the music folder path and saves the config
-func (c *Config) SetMusicFolder(folderPath string) error {
-	c.MusicFolder = folderPath
+// SetLibraryRules stores the library rules and saves the config
+func (c *Config) SetLibraryRules(rules *LibraryRules) error {
+	c.LibraryRules = rules
 	return c.SaveConfig()
 }
 
+// SetDuplicateHandling stores the duplicate policy and fingerprint setting and saves the config
+func (c *Config) SetDuplicateHandling(policy string, fingerprint bool) error {
+	c.DuplicatePolicy = policy
+	c.FingerprintDuplicates = fingerprint
+	return c.SaveConfig()
+}
+
+// SetMusicFolders sets the library roots and saves the config
+func (c *Config) SetMusicFolders(roots []LibraryRoot) error {
+	c.MusicFolders = CleanLibraryRoots(roots)
+	return c.SaveConfig()
+}
+
+// MusicFolderPaths returns the paths of the enabled music folders
+func (c *Config) MusicFolderPaths() []string {
+	var paths []string
+	for _, root := range c.MusicFolders {
+		if !root.Disabled {
+			paths = append(paths, root.Path)
+		}
+	}
+	return paths
+}
+
 // SetTailscaleIP sets the Tailscale IP and saves the config
 func (c *Config) SetTailscaleIP(ip string) error {
 	c.TailscaleIP = ip
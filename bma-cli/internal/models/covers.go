@@ -0,0 +1,127 @@
+package models
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultArtworkFilenames is the order cover images next to the tracks are looked
+// for in, unless the config lists its own (artworkFilenames). Matching ignores case.
+var DefaultArtworkFilenames = []string{
+	"cover.jpg", "cover.jpeg", "cover.png",
+	"folder.jpg", "folder.jpeg", "folder.png",
+	"front.jpg", "front.jpeg", "front.png",
+	"album.jpg", "album.jpeg", "album.png",
+	"albumart.jpg",
+}
+
+// isImageFile reports whether a file could be a cover image, judging by extension
+func isImageFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// SetArtworkFilenames sets the cover image names to look for, in priority order.
+// It applies from the next scan; an empty list restores DefaultArtworkFilenames.
+func (ml *MusicLibrary) SetArtworkFilenames(names []string) {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	ml.artworkFilenames = append([]string(nil), names...)
+}
+
+// findFolderCover returns the highest priority cover image in dir and its artwork
+// cache hash. entries may be nil, in which case the directory is read.
+func (ml *MusicLibrary) findFolderCover(dir string, entries []os.DirEntry) (string, string) {
+	if entries == nil {
+		var err error
+		if entries, err = os.ReadDir(dir); err != nil {
+			return "", ""
+		}
+	}
+
+	images := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() && isImageFile(entry.Name()) {
+			images[strings.ToLower(entry.Name())] = entry.Name()
+		}
+	}
+	if len(images) == 0 {
+		return "", ""
+	}
+
+	ml.mutex.RLock()
+	names := ml.artworkFilenames
+	ml.mutex.RUnlock()
+	if len(names) == 0 {
+		names = DefaultArtworkFilenames
+	}
+
+	for _, name := range names {
+		actual, ok := images[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		coverPath := filepath.Join(dir, actual)
+		hash, err := ml.coverHash(coverPath)
+		if err != nil {
+			log.Printf("⚠️ [ARTWORK] Skipping cover %s: %v", coverPath, err)
+			continue
+		}
+		return coverPath, hash
+	}
+	return "", ""
+}
+
+// coverHash returns the artwork cache hash of a cover image, caching the image the
+// first time it is seen and whenever it changes
+func (ml *MusicLibrary) coverHash(coverPath string) (string, error) {
+	info, err := os.Stat(coverPath)
+	if err != nil {
+		return "", err
+	}
+	if hash, ok := ml.index.coverHash(coverPath, info); ok {
+		return hash, nil
+	}
+
+	data, err := os.ReadFile(coverPath)
+	if err != nil {
+		return "", err
+	}
+	hash, err := DefaultArtworkCache().Store(data)
+	if err != nil {
+		// Still usable: the song keeps the path and reads the file on demand
+		log.Printf("⚠️ [ARTWORK] Failed to cache cover %s: %v", coverPath, err)
+	}
+
+	ml.index.putCover(coverPath, info, hash)
+	log.Printf("🎨 [ARTWORK] Found folder cover: %s", coverPath)
+	return hash, nil
+}
+
+// applyFolderCovers points the songs in the given directories at their folder's
+// current cover image. Songs whose cover changed are replaced by copies, since
+// the published ones may be read concurrently.
+func (ml *MusicLibrary) applyFolderCovers(scanned map[string]*Song, dirs map[string]bool) {
+	type cover struct{ path, hash string }
+	covers := make(map[string]cover, len(dirs))
+	for dir := range dirs {
+		path, hash := ml.findFolderCover(dir, nil)
+		covers[dir] = cover{path, hash}
+	}
+
+	for songPath, song := range scanned {
+		current, ok := covers[song.ParentDirectory]
+		if !ok || (song.FolderArtworkPath == current.path && song.FolderArtworkHash == current.hash) {
+			continue
+		}
+		updated := *song
+		updated.FolderArtworkPath = current.path
+		updated.FolderArtworkHash = current.hash
+		scanned[songPath] = &updated
+	}
+}
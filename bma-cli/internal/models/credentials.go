@@ -0,0 +1,340 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CredentialStore persists pending pairing codes and paired devices, so a restart
+// doesn't force every phone to scan the QR code again. Only SHA-256 hashes of codes
+// and tokens are kept, in memory and on disk; a leaked store file can't be replayed.
+type CredentialStore struct {
+	mutex        sync.RWMutex
+	path         string
+	PairingCodes map[string]time.Time         `json:"pairingCodes"` // code hash -> expiration
+	Devices      map[string]*DeviceCredential `json:"devices"`      // token hash -> device (Token left empty)
+}
+
+// HashToken returns the hex SHA-256 of a code or token, the form it is stored in
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetCredentialStorePath returns the path to the paired devices file
+func GetCredentialStorePath() (string, error) {
+	dataDir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "devices.json"), nil
+}
+
+// LoadCredentialStore loads the store from disk, dropping expired entries. A missing
+// or unreadable file yields an empty store (devices simply pair again).
+func LoadCredentialStore() *CredentialStore {
+	store := &CredentialStore{
+		PairingCodes: make(map[string]time.Time),
+		Devices:      make(map[string]*DeviceCredential),
+	}
+
+	storePath, err := GetCredentialStorePath()
+	if err != nil {
+		log.Printf("⚠️ [CREDENTIALS] Cannot resolve store path: %v", err)
+		return store
+	}
+	store.path = storePath
+
+	data, err := os.ReadFile(storePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️ [CREDENTIALS] Failed to read paired devices: %v", err)
+		}
+		return store
+	}
+
+	var stored CredentialStore
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Printf("⚠️ [CREDENTIALS] Paired devices file is corrupt, starting fresh: %v", err)
+		return store
+	}
+
+	for hash, expiration := range stored.PairingCodes {
+		store.PairingCodes[hash] = expiration
+	}
+	for hash, device := range stored.Devices {
+		if device != nil {
+			device.Token = ""
+			store.Devices[hash] = device
+		}
+	}
+
+	if removed := store.pruneExpiredUnsafe(); removed > 0 {
+		if err := store.saveUnsafe(); err != nil {
+			log.Printf("⚠️ [CREDENTIALS] %v", err)
+		}
+	}
+
+	log.Printf("🔐 [CREDENTIALS] Loaded %d paired devices and %d pending pairing codes", len(store.Devices), len(store.PairingCodes))
+	return store
+}
+
+// saveUnsafe writes the store to disk (assumes lock held)
+func (s *CredentialStore) saveUnsafe() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode paired devices: %w", err)
+	}
+
+	// Owner-only: the hashes aren't replayable, but device names are still private
+	if err := WriteFileAtomic(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write paired devices: %w", err)
+	}
+	return nil
+}
+
+// save writes the store to disk, logging rather than failing the caller
+func (s *CredentialStore) save() {
+	if err := s.saveUnsafe(); err != nil {
+		log.Printf("⚠️ [CREDENTIALS] %v", err)
+	}
+}
+
+// pruneExpiredUnsafe removes expired codes and devices (assumes write lock held)
+func (s *CredentialStore) pruneExpiredUnsafe() int {
+	now := time.Now()
+	removed := 0
+
+	for hash, expiration := range s.PairingCodes {
+		if now.After(expiration) {
+			delete(s.PairingCodes, hash)
+			removed++
+		}
+	}
+
+	for hash, device := range s.Devices {
+		if device.IsExpired() {
+			delete(s.Devices, hash)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// PruneExpired removes expired codes and devices and saves if anything changed
+func (s *CredentialStore) PruneExpired() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pruneExpiredUnsafe() > 0 {
+		s.save()
+	}
+}
+
+// AddPairingCode records a new one-time pairing code
+func (s *CredentialStore) AddPairingCode(code string, expiresAt time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.PairingCodes[HashToken(code)] = expiresAt
+	s.pruneExpiredUnsafe()
+	s.save()
+}
+
+// HasPairingCode reports whether a code is pending and unexpired
+func (s *CredentialStore) HasPairingCode(code string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	expiration, exists := s.PairingCodes[HashToken(code)]
+	return exists && time.Now().Before(expiration)
+}
+
+// PairingCodeExpiry returns when a pending code expires
+func (s *CredentialStore) PairingCodeExpiry(code string) (time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	expiration, exists := s.PairingCodes[HashToken(code)]
+	if !exists || time.Now().After(expiration) {
+		return time.Time{}, false
+	}
+	return expiration, true
+}
+
+// ClaimPairingCode consumes a pending code and pairs a device under token. It fails
+// if the code is unknown, expired or was already claimed.
+func (s *CredentialStore) ClaimPairingCode(code, token string, device DeviceCredential) (DeviceCredential, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	codeHash := HashToken(code)
+	expiration, exists := s.PairingCodes[codeHash]
+	if !exists {
+		return DeviceCredential{}, false
+	}
+
+	// One-time use, whether or not it's still valid
+	delete(s.PairingCodes, codeHash)
+	if time.Now().After(expiration) {
+		s.save()
+		return DeviceCredential{}, false
+	}
+
+	stored := device
+	stored.Token = ""
+	s.Devices[HashToken(token)] = &stored
+	s.save()
+
+	device.Token = token
+	return device, true
+}
+
+// SetAdmin grants or withdraws admin rights for every credential of a device,
+// reporting whether the device is paired
+func (s *CredentialStore) SetAdmin(deviceID uuid.UUID, admin bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	found := false
+	for _, device := range s.Devices {
+		if device.DeviceID == deviceID {
+			device.Admin = admin
+			found = true
+		}
+	}
+
+	if found {
+		s.save()
+	}
+	return found
+}
+
+// LookupDevice returns the device a token belongs to, if it is still valid
+func (s *CredentialStore) LookupDevice(token string) (DeviceCredential, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tokenHash := HashToken(token)
+	device, exists := s.Devices[tokenHash]
+	if !exists {
+		return DeviceCredential{}, false
+	}
+
+	if device.IsExpired() {
+		delete(s.Devices, tokenHash)
+		s.save()
+		log.Printf("🔐 [CREDENTIALS] Credential for %s expired", device.DeviceName)
+		return DeviceCredential{}, false
+	}
+
+	// Kept in memory only; written out with the next change to the store
+	device.LastUsedAt = time.Now()
+
+	found := *device
+	found.Token = token
+	return found, true
+}
+
+// MatchDevice returns a valid credential of the device whose token hash satisfies
+// match. Signed URLs name the device and prove the credential without carrying it.
+func (s *CredentialStore) MatchDevice(deviceID uuid.UUID, match func(tokenHash string) bool) (DeviceCredential, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for hash, device := range s.Devices {
+		if device.DeviceID == deviceID && !device.IsExpired() && match(hash) {
+			return *device, true
+		}
+	}
+	return DeviceCredential{}, false
+}
+
+// RevokeToken removes a pairing code or device credential, returning the device
+// it belonged to (if it was a credential)
+func (s *CredentialStore) RevokeToken(token string) (DeviceCredential, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	hash := HashToken(token)
+	_, wasCode := s.PairingCodes[hash]
+	delete(s.PairingCodes, hash)
+
+	device, wasDevice := s.Devices[hash]
+	delete(s.Devices, hash)
+
+	if wasCode || wasDevice {
+		s.save()
+	}
+	if !wasDevice {
+		return DeviceCredential{}, false
+	}
+	return *device, true
+}
+
+// RevokeDevice removes every credential held by a device
+func (s *CredentialStore) RevokeDevice(deviceID uuid.UUID) []DeviceCredential {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var revoked []DeviceCredential
+	for hash, device := range s.Devices {
+		if device.DeviceID == deviceID {
+			revoked = append(revoked, *device)
+			delete(s.Devices, hash)
+		}
+	}
+
+	if len(revoked) > 0 {
+		s.save()
+	}
+	return revoked
+}
+
+// RevokePairingCodes removes every pending pairing code, leaving paired devices alone
+func (s *CredentialStore) RevokePairingCodes() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.PairingCodes) == 0 {
+		return
+	}
+	s.PairingCodes = make(map[string]time.Time)
+	s.save()
+}
+
+// RevokeAll removes every pending code and paired device
+func (s *CredentialStore) RevokeAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.PairingCodes = make(map[string]time.Time)
+	s.Devices = make(map[string]*DeviceCredential)
+	s.save()
+}
+
+// PairedDevices returns a copy of every paired device (tokens are never available)
+func (s *CredentialStore) PairedDevices() []DeviceCredential {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	devices := make([]DeviceCredential, 0, len(s.Devices))
+	for _, device := range s.Devices {
+		devices = append(devices, *device)
+	}
+	return devices
+}
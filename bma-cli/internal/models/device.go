@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ConnectedDevice represents a device connected to the BMA CLI server
+type ConnectedDevice struct {
+	ID          uuid.UUID `json:"id"`
+	DeviceID    uuid.UUID `json:"deviceId"` // matches the DeviceCredential this connection uses
+	Token       string    `json:"token"`
+	DeviceName  string    `json:"deviceName,omitempty"`
+	IPAddress   string    `json:"ipAddress"`
+	UserAgent   string    `json:"userAgent,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
+}
+
+// DeviceCredential is the long-lived credential a device receives in exchange for a
+// one-time pairing code. Each paired device has its own, so it can be revoked alone.
+type DeviceCredential struct {
+	DeviceID   uuid.UUID `json:"deviceId"`
+	DeviceName string    `json:"deviceName"`
+	Token      string    `json:"token,omitempty"` // only set on copies handed to the holder
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastUsedAt time.Time `json:"lastUsedAt,omitempty"`
+	Admin      bool      `json:"admin,omitempty"` // may revoke other devices
+}
+
+// IsExpired reports whether the credential is past its expiry time
+func (c *DeviceCredential) IsExpired() bool {
+	return !c.ExpiresAt.IsZero() && time.Now().After(c.ExpiresAt)
+}
@@ -0,0 +1,461 @@
+package models
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxPlayClockSkew is how far in the future a play may claim to be, for phones
+	// whose clocks run a little fast
+	maxPlayClockSkew = 5 * time.Minute
+	// nowPlayingGrace keeps a now-playing entry around a little past the song's end
+	nowPlayingGrace = 2 * time.Minute
+	// nowPlayingFallback is how long a now-playing entry lasts for a song of unknown length
+	nowPlayingFallback = 10 * time.Minute
+)
+
+// Errors returned for plays that can't be recorded
+var (
+	ErrPlayUnknownSong = errors.New("song is not in the library")
+	ErrPlayTime        = errors.New("playedAt is missing or in the future")
+	ErrPlayDuplicate   = errors.New("play was already recorded")
+)
+
+// Play is one listen reported by a device. Title, artist and album are copied
+// from the library when the play is recorded, so it still counts under a name
+// after the song is gone.
+type Play struct {
+	SongID     uuid.UUID     `json:"songId"`
+	DeviceID   uuid.UUID     `json:"deviceId"`
+	DeviceName string        `json:"deviceName,omitempty"`
+	PlayedAt   time.Time     `json:"playedAt"`
+	Duration   time.Duration `json:"duration,omitempty"` // how long was listened to
+	Title      string        `json:"title,omitempty"`
+	Artist     string        `json:"artist,omitempty"` // the artist the song is filed under
+	ArtistID   uuid.UUID     `json:"artistId"`
+	Album      string        `json:"album,omitempty"`
+	AlbumID    uuid.UUID     `json:"albumId"` // uuid.Nil for songs that aren't on an album
+}
+
+// key identifies a play for deduplication. Offline batches are often resent
+// whole, so the same device reporting the same song at the same second is a repeat.
+func (p *Play) key() string {
+	return fmt.Sprintf("%s/%s/%d", p.DeviceID, p.SongID, p.PlayedAt.Unix())
+}
+
+// NowPlaying is the song a device says it is playing right now
+type NowPlaying struct {
+	DeviceID   uuid.UUID
+	DeviceName string
+	SongID     uuid.UUID
+	StartedAt  time.Time
+	ExpiresAt  time.Time // when the song should have ended, plus some grace
+}
+
+// PlayFilter selects plays by time and device
+type PlayFilter struct {
+	Since    time.Time // zero for all time
+	DeviceID uuid.UUID // uuid.Nil for every device
+}
+
+// matches reports whether a play passes the filter
+func (f PlayFilter) matches(play *Play) bool {
+	return !play.PlayedAt.Before(f.Since) && (f.DeviceID == uuid.Nil || play.DeviceID == f.DeviceID)
+}
+
+// PlayHistory keeps every play reported by the paired devices, so listening stats
+// survive switching phones. Plays are appended to a JSON Lines file as they come.
+type PlayHistory struct {
+	mutex      sync.RWMutex
+	path       string
+	plays      []*Play // sorted by PlayedAt
+	seen       map[string]bool
+	bySong     map[uuid.UUID]PlayStats
+	nowPlaying map[uuid.UUID]NowPlaying // by device
+
+	onPlaysAdded []func(count int)
+	onNowPlaying []func(NowPlaying)
+}
+
+// GetPlayHistoryPath returns the path to the play history file
+func GetPlayHistoryPath() (string, error) {
+	dataDir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "history.jsonl"), nil
+}
+
+// LoadPlayHistory reads the play history from disk. Lines that can't be parsed,
+// such as one cut short by a crash, are skipped.
+func LoadPlayHistory() *PlayHistory {
+	history := &PlayHistory{
+		seen:       make(map[string]bool),
+		bySong:     make(map[uuid.UUID]PlayStats),
+		nowPlaying: make(map[uuid.UUID]NowPlaying),
+	}
+
+	historyPath, err := GetPlayHistoryPath()
+	if err != nil {
+		log.Printf("⚠️ [HISTORY] Cannot resolve history path: %v", err)
+		return history
+	}
+	history.path = historyPath
+
+	file, err := os.Open(historyPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️ [HISTORY] Failed to read play history: %v", err)
+		}
+		return history
+	}
+	defer file.Close()
+
+	skipped := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var play Play
+		if err := json.Unmarshal(scanner.Bytes(), &play); err != nil || play.SongID == uuid.Nil {
+			skipped++
+			continue
+		}
+		history.addUnsafe(&play)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("⚠️ [HISTORY] Failed to read play history: %v", err)
+	}
+	if skipped > 0 {
+		log.Printf("⚠️ [HISTORY] Skipped %d unreadable lines", skipped)
+	}
+
+	log.Printf("🎧 [HISTORY] Loaded %d plays", len(history.plays))
+	return history
+}
+
+// addUnsafe adds a play to memory, keeping plays in time order (assumes lock held).
+// It reports false for a play that was already recorded.
+func (h *PlayHistory) addUnsafe(play *Play) bool {
+	key := play.key()
+	if h.seen[key] {
+		return false
+	}
+	h.seen[key] = true
+
+	// Live plays arrive in order; only offline batches need the search
+	at := len(h.plays)
+	if at > 0 && play.PlayedAt.Before(h.plays[at-1].PlayedAt) {
+		at = sort.Search(len(h.plays), func(i int) bool { return h.plays[i].PlayedAt.After(play.PlayedAt) })
+	}
+	h.plays = append(h.plays, nil)
+	copy(h.plays[at+1:], h.plays[at:])
+	h.plays[at] = play
+
+	stats := h.bySong[play.SongID]
+	stats.PlayCount++
+	if play.PlayedAt.After(stats.LastPlayed) {
+		stats.LastPlayed = play.PlayedAt
+	}
+	h.bySong[play.SongID] = stats
+	return true
+}
+
+// appendUnsafe writes plays to the end of the history file (assumes lock held)
+func (h *PlayHistory) appendUnsafe(plays []*Play) error {
+	if h.path == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open play history: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	for _, play := range plays {
+		line, err := json.Marshal(play)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to encode play: %w", err)
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write play history: %w", err)
+	}
+	return file.Close()
+}
+
+// SetPlaysAddedCallback adds a callback run with the number of new plays after
+// plays are recorded
+func (h *PlayHistory) SetPlaysAddedCallback(callback func(count int)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.onPlaysAdded = append(h.onPlaysAdded, callback)
+}
+
+// SetNowPlayingCallback adds a callback run when a device starts playing a song
+func (h *PlayHistory) SetNowPlayingCallback(callback func(NowPlaying)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.onNowPlaying = append(h.onNowPlaying, callback)
+}
+
+// add records new plays, dropping repeats, and reports which were new. The file
+// is written before the callbacks run.
+func (h *PlayHistory) add(plays []*Play) []bool {
+	added := make([]bool, len(plays))
+	var fresh []*Play
+
+	h.mutex.Lock()
+	for i, play := range plays {
+		if h.addUnsafe(play) {
+			added[i] = true
+			fresh = append(fresh, play)
+
+			// The device has moved past the song it said it was playing
+			if current, ok := h.nowPlaying[play.DeviceID]; ok && current.SongID == play.SongID {
+				delete(h.nowPlaying, play.DeviceID)
+			}
+		}
+	}
+	if len(fresh) > 0 {
+		if err := h.appendUnsafe(fresh); err != nil {
+			log.Printf("⚠️ [HISTORY] %v", err)
+		}
+	}
+	callbacks := make([]func(int), len(h.onPlaysAdded))
+	copy(callbacks, h.onPlaysAdded)
+	h.mutex.Unlock()
+
+	if len(fresh) > 0 {
+		log.Printf("🎧 [HISTORY] Recorded %d plays", len(fresh))
+		for _, callback := range callbacks {
+			if callback != nil {
+				callback(len(fresh))
+			}
+		}
+	}
+	return added
+}
+
+// setNowPlaying records what a device is playing and notifies the callbacks
+func (h *PlayHistory) setNowPlaying(entry NowPlaying) {
+	h.mutex.Lock()
+	h.nowPlaying[entry.DeviceID] = entry
+	callbacks := make([]func(NowPlaying), len(h.onNowPlaying))
+	copy(callbacks, h.onNowPlaying)
+	h.mutex.Unlock()
+
+	for _, callback := range callbacks {
+		if callback != nil {
+			callback(entry)
+		}
+	}
+}
+
+// NowPlaying returns what each device is playing, leaving out songs that should
+// have ended by now, most recent first
+func (h *PlayHistory) NowPlaying() []NowPlaying {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	now := time.Now()
+	var entries []NowPlaying
+	for _, entry := range h.nowPlaying {
+		if now.Before(entry.ExpiresAt) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].StartedAt.After(entries[j].StartedAt) })
+	return entries
+}
+
+// Stats returns how often and when a song was last played, on any device
+func (h *PlayHistory) Stats(songID uuid.UUID) PlayStats {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.bySong[songID]
+}
+
+// Plays returns the plays matching a filter, most recent first, at most limit of
+// them (0 for all)
+func (h *PlayHistory) Plays(filter PlayFilter, limit int) []Play {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	var plays []Play
+	for i := len(h.plays) - 1; i >= 0; i-- {
+		play := h.plays[i]
+		if play.PlayedAt.Before(filter.Since) {
+			break
+		}
+		if filter.matches(play) {
+			plays = append(plays, *play)
+			if limit > 0 && len(plays) == limit {
+				break
+			}
+		}
+	}
+	return plays
+}
+
+// PlayDevice is a device that has reported plays
+type PlayDevice struct {
+	ID   uuid.UUID
+	Name string // as of its latest play
+}
+
+// Devices returns every device in the history, by name
+func (h *PlayHistory) Devices() []PlayDevice {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	names := make(map[uuid.UUID]string)
+	for _, play := range h.plays {
+		names[play.DeviceID] = play.DeviceName
+	}
+	devices := make([]PlayDevice, 0, len(names))
+	for id, name := range names {
+		devices = append(devices, PlayDevice{ID: id, Name: name})
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Name != devices[j].Name {
+			return devices[i].Name < devices[j].Name
+		}
+		return devices[i].ID.String() < devices[j].ID.String()
+	})
+	return devices
+}
+
+// ParseStatsRange turns a stats range ("week", "month", "year", "all" or a period
+// such as "30d" or "6m") into the time it starts at; zero means all time
+func ParseStatsRange(value string) (time.Time, error) {
+	switch value {
+	case "", "all":
+		return time.Time{}, nil
+	case "week":
+		value = "1w"
+	case "month":
+		value = "1m"
+	case "year":
+		value = "1y"
+	}
+	return periodCutoff(value, time.Now())
+}
+
+// TopEntry is a song, album or artist with how much it was played
+type TopEntry struct {
+	ID         uuid.UUID
+	Name       string
+	Artist     string // songs and albums only
+	PlayCount  int
+	ListenTime time.Duration
+	LastPlayed time.Time
+}
+
+// TopSongs returns the most played songs matching a filter
+func (h *PlayHistory) TopSongs(filter PlayFilter, limit int) []TopEntry {
+	return h.top(filter, limit, func(play *Play) (uuid.UUID, string, string) {
+		return play.SongID, play.Title, play.Artist
+	})
+}
+
+// TopAlbums returns the most played albums matching a filter. Songs that weren't
+// on an album when they were played don't count.
+func (h *PlayHistory) TopAlbums(filter PlayFilter, limit int) []TopEntry {
+	return h.top(filter, limit, func(play *Play) (uuid.UUID, string, string) {
+		return play.AlbumID, play.Album, play.Artist
+	})
+}
+
+// TopArtists returns the most played artists matching a filter
+func (h *PlayHistory) TopArtists(filter PlayFilter, limit int) []TopEntry {
+	return h.top(filter, limit, func(play *Play) (uuid.UUID, string, string) {
+		return play.ArtistID, play.Artist, ""
+	})
+}
+
+// top counts plays by the ID keyOf picks, naming each entry after its latest play,
+// and returns the most played first
+func (h *PlayHistory) top(filter PlayFilter, limit int, keyOf func(*Play) (id uuid.UUID, name, artist string)) []TopEntry {
+	h.mutex.RLock()
+	byID := make(map[uuid.UUID]*TopEntry)
+	var entries []*TopEntry
+	for i := len(h.plays) - 1; i >= 0; i-- {
+		play := h.plays[i]
+		if play.PlayedAt.Before(filter.Since) {
+			break
+		}
+		if !filter.matches(play) {
+			continue
+		}
+		id, name, artist := keyOf(play)
+		if id == uuid.Nil {
+			continue
+		}
+		entry, exists := byID[id]
+		if !exists {
+			entry = &TopEntry{ID: id, Name: name, Artist: artist, LastPlayed: play.PlayedAt}
+			byID[id] = entry
+			entries = append(entries, entry)
+		}
+		entry.PlayCount++
+		entry.ListenTime += play.Duration
+	}
+	h.mutex.RUnlock()
+
+	// Ties go to whatever was played most recently, which is the order found
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].PlayCount > entries[j].PlayCount
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	top := make([]TopEntry, len(entries))
+	for i, entry := range entries {
+		top[i] = *entry
+	}
+	return top
+}
+
+// PlaySummary totals the plays matching a filter
+type PlaySummary struct {
+	PlayCount  int
+	ListenTime time.Duration
+	SongCount  int // different songs played
+}
+
+// Summary totals the plays matching a filter
+func (h *PlayHistory) Summary(filter PlayFilter) PlaySummary {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	var summary PlaySummary
+	songs := make(map[uuid.UUID]bool)
+	for i := len(h.plays) - 1; i >= 0; i-- {
+		play := h.plays[i]
+		if play.PlayedAt.Before(filter.Since) {
+			break
+		}
+		if filter.matches(play) {
+			summary.PlayCount++
+			summary.ListenTime += play.Duration
+			songs[play.SongID] = true
+		}
+	}
+	summary.SongCount = len(songs)
+	return summary
+}
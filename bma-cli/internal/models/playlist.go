@@ -0,0 +1,501 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxPlaylistNameLength keeps names short enough for every client's list rows
+const maxPlaylistNameLength = 200
+
+// Errors returned by PlaylistStore edits, so callers can pick a status code
+var (
+	ErrPlaylistNotFound  = errors.New("playlist not found")
+	ErrPlaylistReadOnly  = errors.New("playlist is imported from a file in the music folder and can't be edited")
+	ErrPlaylistPosition  = errors.New("track position out of range")
+	ErrPlaylistNameEmpty = errors.New("playlist name is empty")
+	ErrPlaylistSmart     = errors.New("smart playlist songs are picked by its rules and can't be edited by hand")
+	ErrPlaylistNotSmart  = errors.New("playlist isn't a smart playlist")
+)
+
+// Playlist is an ordered list of songs, keyed on their stable IDs so it survives
+// rescans, moved files and songs that are temporarily offline
+type Playlist struct {
+	ID        uuid.UUID   `json:"id"`
+	Name      string      `json:"name"`
+	SongIDs   []uuid.UUID `json:"songIds"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+
+	// File in a music folder the playlist was imported from. Imported playlists
+	// follow their file on every scan and can't be edited through the store.
+	SourcePath string `json:"sourcePath,omitempty"`
+
+	// Rules that pick a smart playlist's songs; SongIDs then hold their last result
+	Smart *SmartSpec `json:"smart,omitempty"`
+}
+
+// ReadOnly reports whether the playlist mirrors a file and can't be edited
+func (p *Playlist) ReadOnly() bool {
+	return p.SourcePath != ""
+}
+
+// clone returns a copy that doesn't share the song list
+func (p *Playlist) clone() Playlist {
+	copied := *p
+	copied.SongIDs = append([]uuid.UUID(nil), p.SongIDs...)
+	return copied
+}
+
+// PlaylistStore persists the server's playlists, so every device sees the same ones
+type PlaylistStore struct {
+	mutex     sync.RWMutex
+	path      string
+	Playlists map[string]*Playlist `json:"playlists"` // keyed by ID
+	onChanged []func(id string)
+}
+
+// GetPlaylistStorePath returns the path to the playlists file
+func GetPlaylistStorePath() (string, error) {
+	dataDir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "playlists.json"), nil
+}
+
+// LoadPlaylistStore loads the playlists from disk. A missing file yields an empty
+// store; a corrupt one is moved aside rather than overwritten by the next save.
+func LoadPlaylistStore() *PlaylistStore {
+	store := &PlaylistStore{Playlists: make(map[string]*Playlist)}
+
+	storePath, err := GetPlaylistStorePath()
+	if err != nil {
+		log.Printf("⚠️ [PLAYLISTS] Cannot resolve store path: %v", err)
+		return store
+	}
+	store.path = storePath
+
+	data, err := os.ReadFile(storePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️ [PLAYLISTS] Failed to read playlists: %v", err)
+		}
+		return store
+	}
+
+	var stored PlaylistStore
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Printf("⚠️ [PLAYLISTS] Playlists file is corrupt, keeping it as %s.corrupt: %v", storePath, err)
+		if err := os.Rename(storePath, storePath+".corrupt"); err != nil {
+			log.Printf("⚠️ [PLAYLISTS] %v", err)
+		}
+		return store
+	}
+
+	for _, playlist := range stored.Playlists {
+		if playlist != nil {
+			store.Playlists[playlist.ID.String()] = playlist
+		}
+	}
+
+	log.Printf("📜 [PLAYLISTS] Loaded %d playlists", len(store.Playlists))
+	return store
+}
+
+// saveUnsafe writes the store to disk (assumes lock held)
+func (s *PlaylistStore) saveUnsafe() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode playlists: %w", err)
+	}
+	if err := WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write playlists: %w", err)
+	}
+	return nil
+}
+
+// save writes the store to disk, logging rather than failing the caller
+func (s *PlaylistStore) save() {
+	if err := s.saveUnsafe(); err != nil {
+		log.Printf("⚠️ [PLAYLISTS] %v", err)
+	}
+}
+
+// SetChangedCallback adds a callback run with a playlist's ID after it is created,
+// edited or deleted
+func (s *PlaylistStore) SetChangedCallback(callback func(id string)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onChanged = append(s.onChanged, callback)
+}
+
+// notifyChanged calls every changed callback. Must be called without holding
+// s.mutex, since callbacks usually read the store.
+func (s *PlaylistStore) notifyChanged(ids ...string) {
+	s.mutex.RLock()
+	callbacks := make([]func(string), len(s.onChanged))
+	copy(callbacks, s.onChanged)
+	s.mutex.RUnlock()
+
+	for _, id := range ids {
+		for _, callback := range callbacks {
+			if callback != nil {
+				callback(id)
+			}
+		}
+	}
+}
+
+// List returns a copy of every playlist, sorted by name
+func (s *PlaylistStore) List() []Playlist {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	playlists := make([]Playlist, 0, len(s.Playlists))
+	for _, playlist := range s.Playlists {
+		playlists = append(playlists, playlist.clone())
+	}
+	sort.Slice(playlists, func(i, j int) bool {
+		name1, name2 := strings.ToLower(playlists[i].Name), strings.ToLower(playlists[j].Name)
+		if name1 != name2 {
+			return name1 < name2
+		}
+		return playlists[i].ID.String() < playlists[j].ID.String()
+	})
+	return playlists
+}
+
+// Get returns a copy of a playlist by ID
+func (s *PlaylistStore) Get(id string) (Playlist, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	playlist, exists := s.Playlists[id]
+	if !exists {
+		return Playlist{}, false
+	}
+	return playlist.clone(), true
+}
+
+// cleanPlaylistName trims a name and checks it isn't empty
+func cleanPlaylistName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrPlaylistNameEmpty
+	}
+	if len([]rune(name)) > maxPlaylistNameLength {
+		name = string([]rune(name)[:maxPlaylistNameLength])
+	}
+	return name, nil
+}
+
+// Create adds a playlist with the given songs
+func (s *PlaylistStore) Create(name string, songIDs []uuid.UUID) (Playlist, error) {
+	name, err := cleanPlaylistName(name)
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	now := time.Now()
+	playlist := &Playlist{
+		ID:        uuid.New(),
+		Name:      name,
+		SongIDs:   append([]uuid.UUID{}, songIDs...),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.mutex.Lock()
+	s.Playlists[playlist.ID.String()] = playlist
+	s.save()
+	created := playlist.clone()
+	s.mutex.Unlock()
+
+	log.Printf("📜 [PLAYLISTS] Created %q with %d songs", created.Name, len(created.SongIDs))
+	s.notifyChanged(created.ID.String())
+	return created, nil
+}
+
+// edit applies a change to an editable playlist, then saves and notifies
+func (s *PlaylistStore) edit(id string, change func(*Playlist) error) (Playlist, error) {
+	s.mutex.Lock()
+	playlist, exists := s.Playlists[id]
+	if !exists {
+		s.mutex.Unlock()
+		return Playlist{}, ErrPlaylistNotFound
+	}
+	if playlist.ReadOnly() {
+		s.mutex.Unlock()
+		return Playlist{}, ErrPlaylistReadOnly
+	}
+
+	// Work on a copy so a failed change leaves the playlist untouched
+	edited := playlist.clone()
+	if err := change(&edited); err != nil {
+		s.mutex.Unlock()
+		return Playlist{}, err
+	}
+	edited.UpdatedAt = time.Now()
+	*playlist = edited
+	s.save()
+	s.mutex.Unlock()
+
+	s.notifyChanged(id)
+	return edited.clone(), nil
+}
+
+// editTracks applies a change to the songs of a playlist that isn't smart
+func (s *PlaylistStore) editTracks(id string, change func(*Playlist) error) (Playlist, error) {
+	return s.edit(id, func(playlist *Playlist) error {
+		if playlist.Smart != nil {
+			return ErrPlaylistSmart
+		}
+		return change(playlist)
+	})
+}
+
+// Update renames a playlist and/or replaces its songs; nil leaves a field as is
+func (s *PlaylistStore) Update(id string, name *string, songIDs []uuid.UUID) (Playlist, error) {
+	return s.edit(id, func(playlist *Playlist) error {
+		if songIDs != nil && playlist.Smart != nil {
+			return ErrPlaylistSmart
+		}
+		if name != nil {
+			cleaned, err := cleanPlaylistName(*name)
+			if err != nil {
+				return err
+			}
+			playlist.Name = cleaned
+		}
+		if songIDs != nil {
+			playlist.SongIDs = append([]uuid.UUID{}, songIDs...)
+		}
+		return nil
+	})
+}
+
+// AddTracks inserts songs before position, or appends them when position is
+// negative or the playlist's length
+func (s *PlaylistStore) AddTracks(id string, songIDs []uuid.UUID, position int) (Playlist, error) {
+	return s.editTracks(id, func(playlist *Playlist) error {
+		if position < 0 {
+			position = len(playlist.SongIDs)
+		}
+		if position > len(playlist.SongIDs) {
+			return ErrPlaylistPosition
+		}
+
+		songs := make([]uuid.UUID, 0, len(playlist.SongIDs)+len(songIDs))
+		songs = append(songs, playlist.SongIDs[:position]...)
+		songs = append(songs, songIDs...)
+		songs = append(songs, playlist.SongIDs[position:]...)
+		playlist.SongIDs = songs
+		return nil
+	})
+}
+
+// RemoveTrack removes the song at position. Positions rather than song IDs are
+// used because a playlist may hold the same song more than once.
+func (s *PlaylistStore) RemoveTrack(id string, position int) (Playlist, error) {
+	return s.editTracks(id, func(playlist *Playlist) error {
+		if position < 0 || position >= len(playlist.SongIDs) {
+			return ErrPlaylistPosition
+		}
+		playlist.SongIDs = append(playlist.SongIDs[:position], playlist.SongIDs[position+1:]...)
+		return nil
+	})
+}
+
+// MoveTrack moves the song at from so it ends up at position to
+func (s *PlaylistStore) MoveTrack(id string, from, to int) (Playlist, error) {
+	return s.editTracks(id, func(playlist *Playlist) error {
+		count := len(playlist.SongIDs)
+		if from < 0 || from >= count || to < 0 || to >= count {
+			return ErrPlaylistPosition
+		}
+
+		moved := playlist.SongIDs[from]
+		if from < to {
+			copy(playlist.SongIDs[from:to], playlist.SongIDs[from+1:to+1])
+		} else {
+			copy(playlist.SongIDs[to+1:from+1], playlist.SongIDs[to:from])
+		}
+		playlist.SongIDs[to] = moved
+		return nil
+	})
+}
+
+// createSmart adds a smart playlist holding the songs its spec picked
+func (s *PlaylistStore) createSmart(id uuid.UUID, name string, spec *SmartSpec, songIDs []uuid.UUID) (Playlist, error) {
+	name, err := cleanPlaylistName(name)
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	now := time.Now()
+	playlist := &Playlist{
+		ID:        id,
+		Name:      name,
+		SongIDs:   songIDs,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Smart:     spec,
+	}
+
+	s.mutex.Lock()
+	s.Playlists[playlist.ID.String()] = playlist
+	s.save()
+	created := playlist.clone()
+	s.mutex.Unlock()
+
+	log.Printf("📜 [PLAYLISTS] Created smart playlist %q with %d songs", created.Name, len(created.SongIDs))
+	s.notifyChanged(created.ID.String())
+	return created, nil
+}
+
+// updateSmart renames a smart playlist and/or replaces its spec along with the
+// songs the new spec picked; nil leaves a field as is
+func (s *PlaylistStore) updateSmart(id string, name *string, spec *SmartSpec, songIDs []uuid.UUID) (Playlist, error) {
+	return s.edit(id, func(playlist *Playlist) error {
+		if playlist.Smart == nil {
+			return ErrPlaylistNotSmart
+		}
+		if name != nil {
+			cleaned, err := cleanPlaylistName(*name)
+			if err != nil {
+				return err
+			}
+			playlist.Name = cleaned
+		}
+		if spec != nil {
+			playlist.Smart = spec
+			playlist.SongIDs = songIDs
+		}
+		return nil
+	})
+}
+
+// smartResult is the outcome of evaluating a smart playlist's spec
+type smartResult struct {
+	spec    *SmartSpec
+	songIDs []uuid.UUID
+}
+
+// setSmartSongs stores re-evaluated smart playlists whose songs changed. Results
+// for a spec that was replaced in the meantime are dropped.
+func (s *PlaylistStore) setSmartSongs(results map[string]smartResult) {
+	var changed []string
+
+	s.mutex.Lock()
+	for id, result := range results {
+		playlist, exists := s.Playlists[id]
+		if !exists || playlist.Smart != result.spec || sameSongIDs(playlist.SongIDs, result.songIDs) {
+			continue
+		}
+		playlist.SongIDs = result.songIDs
+		playlist.UpdatedAt = time.Now()
+		changed = append(changed, id)
+	}
+	if len(changed) > 0 {
+		s.save()
+		log.Printf("📜 [PLAYLISTS] Refreshed %d smart playlists", len(changed))
+	}
+	s.mutex.Unlock()
+
+	s.notifyChanged(changed...)
+}
+
+// Delete removes an editable playlist
+func (s *PlaylistStore) Delete(id string) error {
+	s.mutex.Lock()
+	playlist, exists := s.Playlists[id]
+	if !exists {
+		s.mutex.Unlock()
+		return ErrPlaylistNotFound
+	}
+	if playlist.ReadOnly() {
+		s.mutex.Unlock()
+		return ErrPlaylistReadOnly
+	}
+	delete(s.Playlists, id)
+	s.save()
+	s.mutex.Unlock()
+
+	log.Printf("📜 [PLAYLISTS] Deleted %q", playlist.Name)
+	s.notifyChanged(id)
+	return nil
+}
+
+// syncImported brings the imported playlists up to date with the playlist files
+// just read. Imported playlists whose file wasn't read are dropped when stale
+// reports their file as gone; the rest are kept as they are.
+func (s *PlaylistStore) syncImported(found []*Playlist, stale func(sourcePath string) bool) {
+	var changed []string
+
+	s.mutex.Lock()
+	seen := make(map[string]bool, len(found))
+	for _, imported := range found {
+		id := imported.ID.String()
+		seen[id] = true
+
+		existing, exists := s.Playlists[id]
+		switch {
+		case !exists:
+			now := time.Now()
+			imported.CreatedAt, imported.UpdatedAt = now, now
+			s.Playlists[id] = imported
+			log.Printf("📜 [PLAYLISTS] Imported %q (%d songs) from %s", imported.Name, len(imported.SongIDs), imported.SourcePath)
+		case existing.Name != imported.Name || !sameSongIDs(existing.SongIDs, imported.SongIDs):
+			existing.Name = imported.Name
+			existing.SongIDs = imported.SongIDs
+			existing.UpdatedAt = time.Now()
+			log.Printf("📜 [PLAYLISTS] Updated %q from %s", imported.Name, imported.SourcePath)
+		default:
+			continue
+		}
+		changed = append(changed, id)
+	}
+
+	for id, playlist := range s.Playlists {
+		if playlist.ReadOnly() && !seen[id] && stale(playlist.SourcePath) {
+			delete(s.Playlists, id)
+			changed = append(changed, id)
+			log.Printf("📜 [PLAYLISTS] Removed %q, its file is gone: %s", playlist.Name, playlist.SourcePath)
+		}
+	}
+
+	if len(changed) > 0 {
+		s.save()
+	}
+	s.mutex.Unlock()
+
+	s.notifyChanged(changed...)
+}
+
+// sameSongIDs reports whether two song lists are identical, order included
+func sameSongIDs(a, b []uuid.UUID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
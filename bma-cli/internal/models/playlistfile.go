@@ -0,0 +1,280 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxPlaylistFileSize skips files too big to be a playlist someone wrote by hand
+// or exported from a player
+const maxPlaylistFileSize = 4 << 20
+
+// playlistExtensions are the playlist files imported from the music folders
+var playlistExtensions = map[string]bool{
+	".m3u":  true,
+	".m3u8": true,
+	".pls":  true,
+}
+
+// IsPlaylistFile reports whether a file name looks like an importable playlist
+func IsPlaylistFile(name string) bool {
+	return playlistExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// ParsePlaylistFile reads an M3U, M3U8 or PLS playlist and returns its name and the
+// absolute paths of its entries, in order. Relative entries are resolved against the
+// playlist's folder; URLs other than file:// ones are skipped.
+func ParsePlaylistFile(path string) (string, []string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if info.Size() > maxPlaylistFileSize {
+		return "", nil, fmt.Errorf("playlist is larger than %d bytes", maxPlaylistFileSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	// .m3u8 is UTF-8 by definition; plain .m3u and .pls files written by older
+	// players are usually Latin-1
+	text := string(data)
+	if !utf8.Valid(data) {
+		text = decodeLatin1(data)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var entries []string
+	if strings.EqualFold(filepath.Ext(path), ".pls") {
+		entries = parsePLS(text)
+	} else {
+		var title string
+		title, entries = parseM3U(text)
+		if title != "" {
+			name = title
+		}
+	}
+
+	dir := filepath.Dir(path)
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if resolved, ok := resolvePlaylistEntry(dir, entry); ok {
+			paths = append(paths, resolved)
+		}
+	}
+	return name, paths, nil
+}
+
+// parseM3U returns the #PLAYLIST: title, if any, and the entries of an M3U file
+func parseM3U(text string) (string, []string) {
+	var title string
+	var entries []string
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), maxPlaylistFileSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			title = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#"):
+			// #EXTM3U, #EXTINF and other directives carry nothing the library lacks
+		default:
+			entries = append(entries, line)
+		}
+	}
+	return title, entries
+}
+
+// parsePLS returns the FileN= entries of a PLS file, ordered by N
+func parsePLS(text string) []string {
+	files := make(map[int]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), maxPlaylistFileSize)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found || len(key) <= 4 || !strings.EqualFold(key[:4], "file") {
+			continue
+		}
+		if n, err := strconv.Atoi(key[4:]); err == nil {
+			files[n] = strings.TrimSpace(value)
+		}
+	}
+
+	numbers := make([]int, 0, len(files))
+	for n := range files {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	entries := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		if files[n] != "" {
+			entries = append(entries, files[n])
+		}
+	}
+	return entries
+}
+
+// resolvePlaylistEntry turns a playlist entry into an absolute, cleaned file path
+func resolvePlaylistEntry(dir, entry string) (string, bool) {
+	if strings.HasPrefix(strings.ToLower(entry), "file://") {
+		parsed, err := url.Parse(entry)
+		if err != nil || parsed.Path == "" {
+			return "", false
+		}
+		entry = parsed.Path
+	} else if strings.Contains(entry, "://") {
+		// Internet radio and other streams aren't library songs
+		return "", false
+	}
+
+	// Playlists written on Windows use backslashes
+	if filepath.Separator == '/' {
+		entry = strings.ReplaceAll(entry, "\\", "/")
+	}
+	entry = filepath.FromSlash(entry)
+	if !filepath.IsAbs(entry) {
+		entry = filepath.Join(dir, entry)
+	}
+	return filepath.Clean(entry), true
+}
+
+// decodeLatin1 converts ISO-8859-1 bytes to a string
+func decodeLatin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// WritePlaylistM3U8 writes a playlist as extended M3U with absolute paths, so it
+// can be opened by other players on this machine. Songs no longer in the library
+// are left out.
+func WritePlaylistM3U8(w io.Writer, playlist Playlist, songs []*Song) error {
+	buffered := bufio.NewWriter(w)
+	fmt.Fprintf(buffered, "#EXTM3U\n#PLAYLIST:%s\n", singleLine(playlist.Name))
+	for _, song := range songs {
+		if song == nil {
+			continue
+		}
+		seconds := -1
+		if song.Duration > 0 {
+			seconds = int(song.Duration.Seconds() + 0.5)
+		}
+		fmt.Fprintf(buffered, "#EXTINF:%d,%s - %s\n", seconds, singleLine(song.Artist), singleLine(song.Title))
+		fmt.Fprintf(buffered, "%s\n", song.Path)
+	}
+	return buffered.Flush()
+}
+
+// PlaylistFileName turns a playlist name into a safe .m3u8 file name
+func PlaylistFileName(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if safe == "" {
+		safe = "playlist"
+	}
+	return safe + ".m3u8"
+}
+
+// singleLine keeps a tag value from breaking the line-based M3U format
+func singleLine(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// playlistSongID returns the ID of the song at path: the scanned song's when there
+// is one, its indexed ID when it's in an offline folder, and otherwise the ID the
+// file will get once it appears
+func (ml *MusicLibrary) playlistSongID(path string) uuid.UUID {
+	ml.mutex.RLock()
+	song := ml.allSongs[path]
+	ml.mutex.RUnlock()
+	if song != nil {
+		return song.ID
+	}
+	if entry := ml.index.Lookup(path); entry != nil {
+		return entry.ID
+	}
+	return StableSongID(path)
+}
+
+// readPlaylistFile imports a playlist file as a read-only playlist
+func (ml *MusicLibrary) readPlaylistFile(path string) (*Playlist, error) {
+	name, paths, err := ParsePlaylistFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	songIDs := make([]uuid.UUID, len(paths))
+	for i, songPath := range paths {
+		songIDs[i] = ml.playlistSongID(songPath)
+	}
+	return &Playlist{
+		ID:         StablePlaylistID(path),
+		Name:       name,
+		SongIDs:    songIDs,
+		SourcePath: path,
+	}, nil
+}
+
+// importPlaylists reads playlist files into the store as read-only playlists, and
+// drops imported playlists whose file stale reports as gone. Run it after the songs
+// are committed, so entries resolve to their current IDs.
+func (ml *MusicLibrary) importPlaylists(paths []string, stale func(sourcePath string) bool) {
+	found := make([]*Playlist, 0, len(paths))
+	for _, path := range paths {
+		playlist, err := ml.readPlaylistFile(path)
+		if err != nil {
+			log.Printf("⚠️ [PLAYLISTS] Failed to import %s: %v", path, err)
+			continue
+		}
+		found = append(found, playlist)
+	}
+	ml.playlists.syncImported(found, stale)
+}
+
+// Playlists returns the library's playlist store
+func (ml *MusicLibrary) Playlists() *PlaylistStore {
+	return ml.playlists
+}
+
+// GetSongsByIDs returns the listed song for each ID, in order, with nil for IDs
+// that aren't in the library
+func (ml *MusicLibrary) GetSongsByIDs(ids []uuid.UUID) []*Song {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+
+	byID := make(map[uuid.UUID]*Song, len(ml.Songs))
+	for _, song := range ml.Songs {
+		byID[song.ID] = song
+	}
+
+	songs := make([]*Song, len(ids))
+	for i, id := range ids {
+		songs[i] = byID[id]
+	}
+	return songs
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PlayReport is a play as a device reports it
+type PlayReport struct {
+	SongID   uuid.UUID
+	PlayedAt time.Time
+	Duration time.Duration // how long was listened to; the song's length when zero
+}
+
+// History returns the library's play history
+func (ml *MusicLibrary) History() *PlayHistory {
+	return ml.history
+}
+
+// playForUnsafe builds the play a report describes, copying the names it is
+// counted under from the library (assumes lock held)
+func (ml *MusicLibrary) playForUnsafe(song *Song, albums map[uuid.UUID]*Album, device DeviceCredential, report PlayReport) *Play {
+	play := &Play{
+		SongID:     song.ID,
+		DeviceID:   device.DeviceID,
+		DeviceName: device.DeviceName,
+		PlayedAt:   report.PlayedAt.UTC(),
+		Duration:   report.Duration,
+		Title:      song.Title,
+		Artist:     artistName(song),
+		ArtistID:   StableArtistID(artistName(song)),
+	}
+	if play.Duration <= 0 {
+		play.Duration = song.Duration
+	}
+	if album := albums[song.ID]; album != nil {
+		play.Album = album.Name
+		play.AlbumID = album.ID
+	}
+	return play
+}
+
+// RecordPlays adds plays a device reported, possibly long after the fact when it
+// was offline. It returns an error per report: nil when recorded, or why not.
+// Smart playlists are refreshed in the background once plays are in.
+func (ml *MusicLibrary) RecordPlays(device DeviceCredential, reports []PlayReport) []error {
+	errs := make([]error, len(reports))
+	now := time.Now()
+
+	ml.mutex.RLock()
+	songs := make(map[uuid.UUID]*Song, len(ml.Songs))
+	for _, song := range ml.Songs {
+		songs[song.ID] = song
+	}
+	albums := make(map[uuid.UUID]*Album)
+	for _, album := range ml.Albums {
+		for _, song := range album.Songs {
+			albums[song.ID] = album
+		}
+	}
+
+	var plays []*Play
+	var indexes []int
+	for i, report := range reports {
+		song := songs[report.SongID]
+		switch {
+		case song == nil:
+			errs[i] = ErrPlayUnknownSong
+		case report.PlayedAt.IsZero() || report.PlayedAt.After(now.Add(maxPlayClockSkew)):
+			errs[i] = ErrPlayTime
+		default:
+			if report.PlayedAt.After(now) {
+				report.PlayedAt = now
+			}
+			plays = append(plays, ml.playForUnsafe(song, albums, device, report))
+			indexes = append(indexes, i)
+		}
+	}
+	ml.mutex.RUnlock()
+
+	recorded := false
+	for i, added := range ml.history.add(plays) {
+		if added {
+			recorded = true
+		} else {
+			errs[indexes[i]] = ErrPlayDuplicate
+		}
+	}
+	if recorded {
+		go ml.RefreshSmartPlaylists()
+	}
+	return errs
+}
+
+// RecordNowPlaying notes that a device started playing a song, position into it
+func (ml *MusicLibrary) RecordNowPlaying(device DeviceCredential, songID uuid.UUID, position time.Duration) error {
+	song := ml.GetSongByID(songID.String())
+	if song == nil {
+		return ErrPlayUnknownSong
+	}
+
+	now := time.Now()
+	startedAt := now.Add(-position)
+	expiresAt := now.Add(nowPlayingFallback)
+	if song.Duration > 0 {
+		expiresAt = startedAt.Add(song.Duration + nowPlayingGrace)
+	}
+	ml.history.setNowPlaying(NowPlaying{
+		DeviceID:   device.DeviceID,
+		DeviceName: device.DeviceName,
+		SongID:     song.ID,
+		StartedAt:  startedAt,
+		ExpiresAt:  expiresAt,
+	})
+	return nil
+}
@@ -1,12 +1,12 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -25,22 +25,62 @@ type Song struct {
 	Duration        time.Duration `json:"duration,omitempty"`
 	ParentDirectory string        `json:"parentDirectory"`
 	TrackNumber     int           `json:"trackNumber,omitempty"`
-	ArtworkData     []byte        `json:"-"` // Exclude from JSON, store artwork bytes
+	TrackTotal      int           `json:"trackTotal,omitempty"`
+	DiscNumber      int           `json:"discNumber,omitempty"`
+	DiscTotal       int           `json:"discTotal,omitempty"`
+	AlbumArtist     string        `json:"albumArtist,omitempty"`
+	Year            int           `json:"year,omitempty"`
+	Genre           string        `json:"genre,omitempty"`
+	Composer        string        `json:"composer,omitempty"`
+	Compilation     bool          `json:"compilation,omitempty"` // various-artists album
+	Bitrate         int           `json:"bitrate,omitempty"`    // average, in kbps
+	SampleRate      int           `json:"sampleRate,omitempty"` // in Hz
+	Channels        int           `json:"channels,omitempty"`
+	Format          string        `json:"format,omitempty"`     // short format name from the registry ("mp3", "flac", ...)
+	MimeType        string        `json:"mimeType,omitempty"`   // Content-Type used when streaming
+	Root            string        `json:"root,omitempty"`       // library root (music folder) the file was found under
+	ArtworkHash     string        `json:"-"` // embedded picture in the artwork cache; the bytes stay on disk
+	AudioHash       string        `json:"-"` // AudioFingerprint, only computed when duplicates are matched by audio
+	ModTime         time.Time     `json:"-"` // file modification time, for the "newest" duplicate policy
+	AddedAt         time.Time     `json:"-"` // when the file first appeared in the library, for smart playlists
+	
+	// Cover image next to the file (cover.jpg, folder.png, ...), found during the scan
+	FolderArtworkPath string `json:"-"`
+	FolderArtworkHash string `json:"-"`
+	
+	tags  songTags      // what the file's tags said, before LibraryRules filled the gaps
+	rules *LibraryRules // rules the fields above were resolved with
 }
 
-// NewSongFromFile creates a Song from an MP3 file path with full metadata extraction
-func NewSongFromFile(filePath string) (*Song, error) {
-	log.Printf("🎵 [DEBUG] Creating song from file: %s", filePath)
-	
-	// Generate unique ID
-	id := uuid.New()
+// defaultRules resolves songs created outside a library
+var defaultRules = DefaultLibraryRules()
+
+// NewSongFromFile creates a Song from an audio file path with full metadata extraction.
+// root is the music folder the file lives under, since path templates match the path
+// below it; without one, templates only see the file name.
+func NewSongFromFile(filePath, root string) (*Song, error) {
+	song, err := readSongFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	song.Root = root
+	if root == "" {
+		root = filepath.Dir(filePath)
+	}
+	song.applyRules(relativePath(filePath, root), defaultRules)
+	return song, nil
+}
+
+// readSongFile reads a file's tags and audio properties. Title, artist, album and
+// numbering stay unset until applyRules resolves them.
+func readSongFile(filePath string) (*Song, error) {
+	// Derive a stable ID from the path so it survives restarts and rescans
+	id := StableSongID(filePath)
 	
 	// Extract basic file info
 	filename := filepath.Base(filePath)
 	parentDir := filepath.Dir(filePath)
 	
-	log.Printf("🎵 [DEBUG] File info - name: %s, dir: %s", filename, parentDir)
-	
 	// Initialize song with basic info
 	song := &Song{
 		ID:              id,
@@ -49,186 +89,190 @@ func NewSongFromFile(filePath string) (*Song, error) {
 		ParentDirectory: parentDir,
 	}
 	
-	// Extract metadata from MP3 file
-	log.Printf("🎵 [DEBUG] Attempting MP3 metadata extraction")
-	if err := song.extractMP3Metadata(); err != nil {
-		log.Printf("⚠️ [DEBUG] MP3 metadata extraction failed: %v, falling back to filename", err)
-		// If MP3 metadata extraction fails, fall back to filename parsing
-		song.extractMetadataFromFilename()
-	} else {
-		log.Printf("🎵 [DEBUG] MP3 metadata extraction successful")
+	// Work out the format from the file contents, not just the extension
+	format := DetectFormat(filePath)
+	if format == nil {
+		return nil, fmt.Errorf("unsupported audio format: %s", filename)
 	}
+	song.Format = format.Name
+	song.MimeType = format.MimeType
 	
-	// Apply folder-based inference if metadata is missing
-	log.Printf("🎵 [DEBUG] Applying folder inference")
-	song.applyFolderInference()
+	// Extract metadata from tags (ID3, FLAC/Vorbis comments, MP4 atoms)
+	// Untagged files (e.g. WAV) rely on the other sources in the library rules
+	if err := song.extractTagMetadata(); err != nil && !errors.Is(err, tag.ErrNoTagsFound) {
+		log.Printf("⚠️ [SCAN] Could not read tags of %s: %v", filePath, err)
+	}
 	
-	log.Printf("🎵 [DEBUG] Song created successfully: %s by %s", song.Title, song.Artist)
+	// Read duration and stream properties from the audio data itself
+	if info, err := ReadAudioInfo(filePath, format); err != nil {
+		log.Printf("⚠️ [SCAN] Could not read audio properties of %s: %v", filePath, err)
+	} else {
+		song.applyAudioInfo(info)
+	}
 	
 	return song, nil
 }
 
-// extractMP3Metadata extracts metadata from MP3 ID3 tags using github.com/dhowden/tag
-func (s *Song) extractMP3Metadata() error {
-	log.Printf("🎵 [DEBUG] Opening file for metadata: %s", s.Path)
-	
+// extractTagMetadata extracts metadata from the file's tags using github.com/dhowden/tag,
+// which understands ID3 (MP3), FLAC/Ogg Vorbis comments and MP4 atoms
+func (s *Song) extractTagMetadata() error {
 	file, err := os.Open(s.Path)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 	
-	log.Printf("🎵 [DEBUG] Reading tags from file")
-	
 	metadata, err := tag.ReadFrom(file)
 	if err != nil {
 		return fmt.Errorf("failed to read tags: %w", err)
 	}
 	
-	log.Printf("🎵 [DEBUG] Processing metadata tags")
-	
-	// Extract basic metadata
+	// Extract basic metadata; applyRules decides whether it wins over the path
 	if title := metadata.Title(); title != "" {
-		s.Title = title
-		log.Printf("🎵 [DEBUG] Found title: %s", title)
-	} else {
-		// Fallback to filename without extension
-		s.Title = strings.TrimSuffix(s.Filename, filepath.Ext(s.Filename))
-		log.Printf("🎵 [DEBUG] No title found, using filename: %s", s.Title)
+		s.tags.Title = title
 	}
 	
 	if artist := metadata.Artist(); artist != "" {
-		s.Artist = artist
-		log.Printf("🎵 [DEBUG] Found artist: %s", artist)
+		s.tags.Artist = artist
 	}
 	
 	if album := metadata.Album(); album != "" {
-		s.Album = album
-		log.Printf("🎵 [DEBUG] Found album: %s", album)
+		s.tags.Album = album
 	}
 	
-	// Extract track number
-	if track, _ := metadata.Track(); track != 0 {
-		s.TrackNumber = track
-		log.Printf("🎵 [DEBUG] Found track number: %d", track)
+	// Extract track and disc numbers ("3 of 12", "disc 2 of 2")
+	if track, total := metadata.Track(); track != 0 {
+		s.tags.TrackNumber = track
+		s.TrackTotal = total
+	}
+	if disc, total := metadata.Disc(); disc != 0 {
+		s.tags.DiscNumber = disc
+		s.DiscTotal = total
 	}
 	
-	// Duration extraction is not available in this tag library
-	// We'll leave duration as 0 for now
-	
-	// Extract artwork
-	if picture := metadata.Picture(); picture != nil {
-		s.ArtworkData = picture.Data
-		log.Printf("🎵 [DEBUG] Found artwork: %d bytes", len(picture.Data))
+	s.tags.AlbumArtist = strings.TrimSpace(metadata.AlbumArtist())
+	s.tags.Year = metadata.Year()
+	s.tags.Genre = strings.TrimSpace(metadata.Genre())
+	s.Composer = strings.TrimSpace(metadata.Composer())
+	if metadata.Format() == tag.VORBIS {
+		// The Vorbis reader falls back to the performer or artist when there is no composer
+		composer, _ := metadata.Raw()["composer"].(string)
+		s.Composer = strings.TrimSpace(composer)
 	}
+	s.Compilation = isCompilation(metadata.Raw())
+	
+	// Duration isn't available from tags; NewSongFromFile reads it from the audio headers
 	
-	log.Printf("🎵 [DEBUG] Metadata extraction completed")
+	// Extract artwork into the on-disk cache; the song only keeps its hash
+	if picture := metadata.Picture(); picture != nil && len(picture.Data) > 0 {
+		hash, err := DefaultArtworkCache().Store(picture.Data)
+		if err != nil {
+			// GetArtwork falls back to reading the tags again
+			log.Printf("⚠️ [ARTWORK] Failed to cache artwork for %s: %v", s.Filename, err)
+		}
+		s.ArtworkHash = hash
+	}
+
 	return nil
 }
 
-// extractMetadataFromFilename falls back to parsing filename patterns
-func (s *Song) extractMetadataFromFilename() {
-	title := strings.TrimSuffix(s.Filename, ".mp3")
-	s.Title = title
-	
-	// Pattern 1: "Artist - Song Title"
-	if strings.Contains(title, " - ") {
-		parts := strings.SplitN(title, " - ", 2)
-		if len(parts) == 2 {
-			artist := strings.TrimSpace(parts[0])
-			songTitle := strings.TrimSpace(parts[1])
-			if artist != "" {
-				s.Artist = artist
-				s.Title = songTitle
+// isCompilation reads the compilation flag, which every tag format stores under
+// its own key (ID3 TCMP, MP4 cpil, Vorbis COMPILATION)
+func isCompilation(raw map[string]interface{}) bool {
+	for _, key := range []string{"TCMP", "TCP", "cpil", "compilation"} {
+		switch value := raw[key].(type) {
+		case string:
+			value = strings.TrimSpace(value)
+			if value == "1" || strings.EqualFold(value, "true") {
+				return true
+			}
+		case int:
+			if value != 0 {
+				return true
+			}
+		case bool:
+			if value {
+				return true
 			}
 		}
-		return
 	}
-	
-	// Pattern 2: "01. Song Title" or "Track Number Song Title"
-	trackPattern := regexp.MustCompile(`^(\d+)\.?\s*(.+)$`)
-	if matches := trackPattern.FindStringSubmatch(title); len(matches) == 3 {
-		if trackNum, err := strconv.Atoi(matches[1]); err == nil {
-			s.TrackNumber = trackNum
-			s.Title = strings.TrimSpace(matches[2])
+	return false
+}
+
+// applyAudioInfo copies stream properties parsed from the audio headers onto the song
+func (s *Song) applyAudioInfo(info AudioInfo) {
+	s.Duration = info.Duration.Round(time.Millisecond)
+	s.Bitrate = info.Bitrate
+	s.SampleRate = info.SampleRate
+	s.Channels = info.Channels
+}
+
+// applyRules sets title, artist, album and numbering from the rules' metadata
+// sources in order of precedence. relPath is the file's path below the music folder.
+func (s *Song) applyRules(relPath string, rules *LibraryRules) {
+	var resolved songTags
+	for _, source := range rules.Precedence {
+		switch source {
+		case SourceTags:
+			resolved.fillFrom(s.tags)
+		case SourcePath:
+			resolved.fillFrom(rules.pathTags(relPath))
+		case SourceFilename:
+			resolved.fillFrom(filenameTags(s.Filename))
+		case SourceFolders:
+			resolved.fillFrom(rules.folderTags(s.ParentDirectory))
 		}
-		return
 	}
-	
-	// Pattern 3: "Artist_Album_Track" (underscore separated)
-	underscoreParts := strings.Split(title, "_")
-	if len(underscoreParts) >= 3 {
-		s.Artist = strings.TrimSpace(underscoreParts[0])
-		s.Album = strings.TrimSpace(underscoreParts[1])
-		s.Title = strings.TrimSpace(underscoreParts[2])
-		return
+	if resolved.Title == "" {
+		// Fallback to filename without extension
+		resolved.Title = strings.TrimSuffix(s.Filename, filepath.Ext(s.Filename))
 	}
+	
+	s.Title = resolved.Title
+	s.Artist = resolved.Artist
+	s.Album = resolved.Album
+	s.AlbumArtist = resolved.AlbumArtist
+	s.Genre = resolved.Genre
+	s.TrackNumber = resolved.TrackNumber
+	s.DiscNumber = resolved.DiscNumber
+	s.Year = resolved.Year
+	s.rules = rules
 }
 
-// applyFolderInference infers album and artist from folder structure
-func (s *Song) applyFolderInference() {
-	// Infer album from parent directory if not set
-	if s.Album == "" {
-		s.Album = s.InferredAlbum()
-	}
-	
-	// Infer artist from folder structure if not set
-	if s.Artist == "" {
-		s.Artist = s.InferredArtist()
+// libraryRules returns the rules the song was resolved with
+func (s *Song) libraryRules() *LibraryRules {
+	if s.rules != nil {
+		return s.rules
 	}
+	return defaultRules
 }
 
-// InferredAlbum tries to infer album from folder structure
+// InferredAlbum tries to infer album from folder structure, unless the library
+// rules leave folders out
 func (s *Song) InferredAlbum() string {
 	if s.Album != "" {
 		return s.Album
 	}
 	
-	// Try to infer album from parent directory name
-	folderName := filepath.Base(s.ParentDirectory)
-	
-	// Skip common non-album folder names
-	skipFolders := []string{"Music", "iTunes", "Songs", "MP3", "Audio", "Downloads"}
-	for _, skip := range skipFolders {
-		if strings.EqualFold(folderName, skip) {
-			return ""
-		}
-	}
-	
-	if folderName != "" && folderName != "." {
-		return folderName
+	rules := s.libraryRules()
+	if !rules.uses(SourceFolders) {
+		return ""
 	}
-	
-	return ""
+	return rules.folderTags(s.ParentDirectory).Album
 }
 
-// InferredArtist tries to infer artist from folder structure  
+// InferredArtist tries to infer artist from folder structure, unless the library
+// rules leave folders out
 func (s *Song) InferredArtist() string {
 	if s.Artist != "" {
 		return s.Artist
 	}
 	
-	// Try to infer artist from parent directory structure
-	pathComponents := strings.Split(s.ParentDirectory, string(filepath.Separator))
-	
-	// Look for Artist/Album structure (parent's parent directory)
-	if len(pathComponents) >= 2 {
-		potentialArtist := pathComponents[len(pathComponents)-2]
-		
-		// Skip common non-artist folder names
-		skipFolders := []string{"Music", "iTunes", "Songs", "MP3", "Audio", "Downloads"}
-		for _, skip := range skipFolders {
-			if strings.EqualFold(potentialArtist, skip) {
-				return ""
-			}
-		}
-		
-		if potentialArtist != "" && potentialArtist != "." {
-			return potentialArtist
-		}
+	rules := s.libraryRules()
+	if !rules.uses(SourceFolders) {
+		return ""
 	}
-	
-	return ""
+	return rules.folderTags(s.ParentDirectory).Artist
 }
 
 // DisplayTitle returns a cleaned up title for display (removes track numbers)
@@ -244,21 +288,134 @@ func (s *Song) DisplayTitle() string {
 	return cleanTitle
 }
 
+// ArtworkID returns the artwork cache hash of the picture shown for this song: the
+// embedded one, or else the cover image in its folder
+func (s *Song) ArtworkID() string {
+	if s.ArtworkHash != "" {
+		return s.ArtworkHash
+	}
+	return s.FolderArtworkHash
+}
+
 // GetArtwork returns the album artwork bytes if available
 func (s *Song) GetArtwork() []byte {
-	return s.ArtworkData
+	return s.loadArtwork(s.ArtworkID())
+}
+
+// GetArtworkVariant returns the artwork scaled to fit size x size (one of
+// ArtworkSizes) as JPEG
+func (s *Song) GetArtworkVariant(size int) ([]byte, error) {
+	return s.artworkVariant(s.ArtworkID(), size)
 }
 
-// HasArtwork returns true if the song has embedded artwork
+// HasArtwork returns true if the song has embedded artwork or a folder cover
 func (s *Song) HasArtwork() bool {
-	return len(s.ArtworkData) > 0
+	return s.ArtworkID() != ""
+}
+
+// loadArtwork returns one of the song's pictures (embedded or folder cover) from the
+// artwork cache, re-reading it from its source if the cache no longer has it
+func (s *Song) loadArtwork(hash string) []byte {
+	if hash == "" {
+		return nil
+	}
+
+	cache := DefaultArtworkCache()
+	if data, err := cache.Load(hash); err == nil {
+		return data
+	}
+
+	// The cache was cleared or couldn't be written; go back to the source file
+	var data []byte
+	if hash == s.ArtworkHash {
+		data = s.loadEmbeddedArtwork()
+	} else if hash == s.FolderArtworkHash {
+		var err error
+		if data, err = os.ReadFile(s.FolderArtworkPath); err != nil {
+			log.Printf("⚠️ [ARTWORK] Failed to read %s: %v", s.FolderArtworkPath, err)
+		}
+	}
+	if data != nil {
+		if _, err := cache.Store(data); err != nil {
+			log.Printf("⚠️ [ARTWORK] Failed to cache artwork for %s: %v", s.Filename, err)
+		}
+	}
+	return data
+}
+
+// artworkVariant returns a resized copy of one of the song's pictures
+func (s *Song) artworkVariant(hash string, size int) ([]byte, error) {
+	if hash == "" {
+		return nil, errNoArtwork
+	}
+
+	cache := DefaultArtworkCache()
+	data, err := cache.Variant(hash, size)
+	if errors.Is(err, os.ErrNotExist) && s.loadArtwork(hash) != nil {
+		// loadArtwork put the original back into the cache
+		data, err = cache.Variant(hash, size)
+	}
+	return data, err
+}
+
+// loadEmbeddedArtwork reads the picture straight from the file's tags, for when
+// the artwork cache no longer has it
+func (s *Song) loadEmbeddedArtwork() []byte {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		log.Printf("⚠️ [ARTWORK] Failed to open %s: %v", s.Path, err)
+		return nil
+	}
+	defer file.Close()
+	
+	metadata, err := tag.ReadFrom(file)
+	if err != nil {
+		log.Printf("⚠️ [ARTWORK] Failed to read tags from %s: %v", s.Path, err)
+		return nil
+	}
+	
+	if picture := metadata.Picture(); picture != nil {
+		return picture.Data
+	}
+	return nil
+}
+
+// sameMetadata reports whether two songs look identical to clients
+func (s *Song) sameMetadata(other *Song) bool {
+	return s.ID == other.ID &&
+		s.Path == other.Path &&
+		s.Title == other.Title &&
+		s.Artist == other.Artist &&
+		s.Album == other.Album &&
+		s.TrackNumber == other.TrackNumber &&
+		s.TrackTotal == other.TrackTotal &&
+		s.DiscNumber == other.DiscNumber &&
+		s.DiscTotal == other.DiscTotal &&
+		s.AlbumArtist == other.AlbumArtist &&
+		s.Year == other.Year &&
+		s.Genre == other.Genre &&
+		s.Composer == other.Composer &&
+		s.Compilation == other.Compilation &&
+		s.Format == other.Format &&
+		s.Duration == other.Duration &&
+		s.Bitrate == other.Bitrate &&
+		s.ArtworkHash == other.ArtworkHash &&
+		s.FolderArtworkHash == other.FolderArtworkHash
+}
+
+// SortingDisc returns the disc number used for sorting; untagged songs count as disc 1
+func (s *Song) SortingDisc() int {
+	if s.DiscNumber > 0 {
+		return s.DiscNumber
+	}
+	return 1
 }
 
 // SortingTitle returns a title suitable for sorting (with proper numeric handling)
 func (s *Song) SortingTitle() string {
-	// Enhanced sorting: numbered track priority (01, 02, 10)
+	// Enhanced sorting: disc, then numbered track priority (01, 02, 10)
 	if s.TrackNumber > 0 {
-		return fmt.Sprintf("%03d_%s", s.TrackNumber, s.DisplayTitle())
+		return fmt.Sprintf("%02d_%03d_%s", s.SortingDisc(), s.TrackNumber, s.DisplayTitle())
 	}
 	return s.DisplayTitle()
 }
\ No newline at end of file
@@ -0,0 +1,421 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTranscodeCacheMB is the disk space transcoded files may use when the
+// config doesn't say otherwise
+const DefaultTranscodeCacheMB = 1024
+
+// Transcoded bitrates are kept within what both encoders handle well, in kbps
+const (
+	minTranscodeBitrate = 32
+	maxTranscodeBitrate = 320
+)
+
+// staleTranscodeAge is how old a partly written transcode must be before the cache
+// treats it as left behind by a crash
+const staleTranscodeAge = time.Hour
+
+// TranscodeFormats are the formats clients can ask for with ?format=
+var TranscodeFormats = map[string]*AudioFormat{
+	"mp3":  FormatMP3,
+	"opus": FormatOpus,
+}
+
+// defaultTranscodeBitrates are used when a client asks for a format but no bitrate
+var defaultTranscodeBitrates = map[*AudioFormat]int{
+	FormatMP3:    192,
+	FormatOpus:   128,
+	FormatMPEGTS: 128,
+}
+
+// TranscodeOptions is what a client asked a stream to be converted to
+type TranscodeOptions struct {
+	Format     *AudioFormat // nil keeps the song's format unless the bitrate forces a conversion
+	MaxBitrate int          // in kbps, 0 for no limit
+	CopyAudio  bool         // repackage the original audio into Format without re-encoding it
+
+	// Part of the song to convert, for HLS segments. A zero Length converts it all.
+	Offset time.Duration
+	Length time.Duration
+}
+
+// ParseTranscodeOptions reads the ?format= and ?maxBitrate= values of a stream
+// request. It returns nil when neither is set.
+func ParseTranscodeOptions(format, maxBitrate string) (*TranscodeOptions, error) {
+	if format == "" && maxBitrate == "" {
+		return nil, nil
+	}
+
+	options := &TranscodeOptions{}
+	if format != "" {
+		options.Format = TranscodeFormats[strings.ToLower(format)]
+		if options.Format == nil {
+			return nil, fmt.Errorf("unsupported format %q, use mp3 or opus", format)
+		}
+	}
+	if maxBitrate != "" {
+		bitrate, err := strconv.Atoi(maxBitrate)
+		if err != nil || bitrate <= 0 {
+			return nil, fmt.Errorf("invalid maxBitrate %q, use kbps such as 128", maxBitrate)
+		}
+		if bitrate < minTranscodeBitrate {
+			bitrate = minTranscodeBitrate
+		}
+		options.MaxBitrate = min(bitrate, maxTranscodeBitrate)
+	}
+	return options, nil
+}
+
+// NeedsTranscode reports whether song has to be converted to satisfy the options.
+// Songs already in the asked format and within the bitrate are sent as they are.
+func (o TranscodeOptions) NeedsTranscode(song *Song) bool {
+	if o.Format != nil && o.Format.Name != song.Format {
+		return true
+	}
+	if o.MaxBitrate > 0 {
+		// Lossless files and ones whose bitrate is unknown could be any size
+		if format := FormatByName(song.Format); format != nil && format.Lossless {
+			return true
+		}
+		return song.Bitrate == 0 || song.Bitrate > o.MaxBitrate
+	}
+	return false
+}
+
+// Output returns the format and bitrate a conversion produces: MP3 unless another
+// format was asked for, at the maximum bitrate or the format's default.
+func (o TranscodeOptions) Output() (*AudioFormat, int) {
+	format := o.Format
+	if format == nil {
+		format = FormatMP3
+	}
+	bitrate := defaultTranscodeBitrates[format]
+	if o.MaxBitrate > 0 {
+		bitrate = o.MaxBitrate
+	}
+	return format, bitrate
+}
+
+// Transcoder converts songs to another format or bitrate while they're streamed
+type Transcoder interface {
+	// Name identifies the backend in logs
+	Name() string
+
+	// Converts reports whether Transcode actually changes the audio. When it
+	// doesn't, the original file should be served instead, with range support.
+	Converts() bool
+
+	// Transcode writes song, converted as the options ask, to w. It stops and
+	// returns ctx.Err() once ctx is cancelled.
+	Transcode(ctx context.Context, song *Song, options TranscodeOptions, w io.Writer) error
+}
+
+// NewTranscoder returns an ffmpeg transcoder, or a passthrough one when ffmpeg
+// can't be found. An empty ffmpegPath looks for ffmpeg on the PATH.
+func NewTranscoder(ffmpegPath string) Transcoder {
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+	}
+	path, err := exec.LookPath(ffmpegPath)
+	if err != nil {
+		log.Printf("⚠️ [TRANSCODE] ffmpeg not found (%v), streams will be sent in their original format", err)
+		return PassthroughTranscoder{}
+	}
+	log.Printf("🎚️ [TRANSCODE] Transcoding with %s", path)
+	return &FFmpegTranscoder{Path: path}
+}
+
+// FFmpegTranscoder converts audio by running a local ffmpeg
+type FFmpegTranscoder struct {
+	Path string
+}
+
+// Name identifies the backend in logs
+func (t *FFmpegTranscoder) Name() string {
+	return "ffmpeg"
+}
+
+// Converts reports true: ffmpeg re-encodes every stream it is given
+func (t *FFmpegTranscoder) Converts() bool {
+	return true
+}
+
+// Transcode pipes ffmpeg's output to w. The process is killed when ctx is
+// cancelled, and also exits on its own once w stops accepting data.
+func (t *FFmpegTranscoder) Transcode(ctx context.Context, song *Song, options TranscodeOptions, w io.Writer) error {
+	format, bitrate := options.Output()
+
+	args := []string{"-nostdin", "-hide_banner", "-loglevel", "error"}
+	var trim []string
+	if options.Length > 0 {
+		trim = []string{"-ss", ffmpegSeconds(options.Offset), "-t", ffmpegSeconds(options.Length)}
+	}
+
+	// Seeking before -i is fast and, when the audio is re-encoded, exact: ffmpeg
+	// decodes from the previous packet and drops what comes before the offset.
+	// Copied audio can only be cut between packets, and an input seek may start a
+	// packet early, so neighbouring segments would overlap. Trimming on the output
+	// side instead gives each packet to exactly one segment.
+	if !options.CopyAudio {
+		args = append(args, trim...)
+	}
+	args = append(args, "-i", song.Path, "-map", "0:a:0", "-vn")
+	if options.CopyAudio {
+		args = append(args, trim...)
+	}
+
+	codec := func(encoder string) []string {
+		if options.CopyAudio {
+			return []string{"-c:a", "copy"}
+		}
+		return []string{"-c:a", encoder, "-b:a", fmt.Sprintf("%dk", bitrate)}
+	}
+	switch format {
+	case FormatMPEGTS:
+		// Segments are stamped with their place in the song so players can join them up
+		args = append(args, codec("aac")...)
+		args = append(args, "-output_ts_offset", ffmpegSeconds(options.Offset), "-f", "mpegts")
+	case FormatOpus:
+		args = append(args, codec("libopus")...)
+		args = append(args, "-f", "ogg")
+	default:
+		args = append(args, codec("libmp3lame")...)
+		args = append(args, "-f", "mp3")
+	}
+	args = append(args, "pipe:1")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.Path, args...)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("ffmpeg failed: %w: %s", err, message)
+		}
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return nil
+}
+
+// ffmpegSeconds formats a duration the way ffmpeg's -ss and -t options take it
+func ffmpegSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// PassthroughTranscoder is used when ffmpeg is missing: it leaves audio untouched
+type PassthroughTranscoder struct{}
+
+// Name identifies the backend in logs
+func (PassthroughTranscoder) Name() string {
+	return "passthrough"
+}
+
+// Converts reports false, so callers serve the original file instead
+func (PassthroughTranscoder) Converts() bool {
+	return false
+}
+
+// Transcode copies the original file to w
+func (PassthroughTranscoder) Transcode(ctx context.Context, song *Song, options TranscodeOptions, w io.Writer) error {
+	file, err := os.Open(song.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(w, file); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// TranscodeCache keeps finished transcodes on disk so a song played twice is only
+// converted once. Files are named by a hash of the song file, its size and
+// modification time, and the output format and bitrate, so an edited file is
+// never served stale. Once the cache outgrows its size cap, the least recently
+// served files are removed.
+type TranscodeCache struct {
+	dir      string
+	maxBytes int64
+	mutex    sync.Mutex // serializes trimming
+}
+
+// OpenTranscodeCache returns a cache rooted at dir holding at most maxMB megabytes.
+// Zero means DefaultTranscodeCacheMB, a negative size turns the cache off.
+func OpenTranscodeCache(dir string, maxMB int) *TranscodeCache {
+	if maxMB == 0 {
+		maxMB = DefaultTranscodeCacheMB
+	}
+	if maxMB < 0 || dir == "" {
+		return &TranscodeCache{}
+	}
+	return &TranscodeCache{dir: dir, maxBytes: int64(maxMB) * 1024 * 1024}
+}
+
+// DefaultTranscodeCache returns a cache under the data directory
+func DefaultTranscodeCache(maxMB int) *TranscodeCache {
+	dataDir, err := GetDataDir()
+	if err != nil {
+		log.Printf("⚠️ [TRANSCODE] Cannot resolve data directory, transcodes won't be cached: %v", err)
+		return &TranscodeCache{}
+	}
+	return OpenTranscodeCache(filepath.Join(dataDir, "transcodes"), maxMB)
+}
+
+// transcodeCacheVersion is part of every cache key. Raising it abandons transcodes
+// made with older ffmpeg arguments; the size cap evicts them over time.
+// 2: copied HLS segments are trimmed on the output side
+const transcodeCacheVersion = 2
+
+// path returns where the transcode of song for options is stored
+func (c *TranscodeCache) path(song *Song, options TranscodeOptions) (string, error) {
+	if c.dir == "" {
+		return "", fmt.Errorf("transcode cache disabled")
+	}
+	info, err := os.Stat(song.Path)
+	if err != nil {
+		return "", err
+	}
+
+	format, bitrate := options.Output()
+	key := fmt.Sprintf("%d\x00%s\x00%d\x00%d\x00%s\x00%d\x00%v\x00%d\x00%d", transcodeCacheVersion, song.Path, info.Size(), info.ModTime().UnixNano(),
+		format.Name, bitrate, options.CopyAudio, options.Offset, options.Length)
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+format.Extensions[0]), nil
+}
+
+// Lookup returns the cached transcode of song for options, if there is one, and
+// marks it as recently used
+func (c *TranscodeCache) Lookup(song *Song, options TranscodeOptions) (string, bool) {
+	path, err := c.path(song, options)
+	if err != nil {
+		return "", false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return path, true
+}
+
+// Create starts a cache entry for the transcode of song for options. The entry is
+// only added by Commit, once the whole transcode was written.
+func (c *TranscodeCache) Create(song *Song, options TranscodeOptions) (*TranscodeEntry, error) {
+	path, err := c.path(song, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create transcode directory: %w", err)
+	}
+	file, err := os.CreateTemp(c.dir, "*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &TranscodeEntry{cache: c, file: file, path: path}, nil
+}
+
+// trim removes the least recently used transcodes until the cache fits its cap,
+// along with partial files left behind by crashes
+func (c *TranscodeCache) trim() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	type cachedFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cachedFile
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		path := filepath.Join(c.dir, entry.Name())
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			if time.Since(info.ModTime()) > staleTranscodeAge {
+				os.Remove(path)
+			}
+			continue
+		}
+		files = append(files, cachedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	removed := 0
+	for _, file := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(file.path); err != nil {
+			continue
+		}
+		total -= file.size
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("🧹 [TRANSCODE] Removed %d cached transcodes to stay under %d MB", removed, c.maxBytes/(1024*1024))
+	}
+}
+
+// TranscodeEntry is a transcode being written to the cache
+type TranscodeEntry struct {
+	cache *TranscodeCache
+	file  *os.File
+	path  string
+}
+
+// Write appends transcoded audio to the entry
+func (e *TranscodeEntry) Write(p []byte) (int, error) {
+	return e.file.Write(p)
+}
+
+// Commit adds the finished transcode to the cache, then trims the cache
+func (e *TranscodeEntry) Commit() error {
+	if err := e.file.Close(); err != nil {
+		os.Remove(e.file.Name())
+		return err
+	}
+	if err := os.Rename(e.file.Name(), e.path); err != nil {
+		os.Remove(e.file.Name())
+		return err
+	}
+	e.cache.trim()
+	return nil
+}
+
+// Abort throws away a transcode that didn't finish
+func (e *TranscodeEntry) Abort() {
+	e.file.Close()
+	os.Remove(e.file.Name())
+}
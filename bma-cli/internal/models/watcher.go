@@ -0,0 +1,326 @@
+package models
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watcherDebounce is how long the watcher waits for file system activity to settle
+// before applying a batch. Copying an album in fires hundreds of events at once.
+const watcherDebounce = 1500 * time.Millisecond
+
+// StartWatching initializes and starts a file system watcher for every enabled,
+// online library root, for automatic library updates. Each root gets its own
+// watcher, so a drive that disappears only takes its own watches with it.
+func (ml *MusicLibrary) StartWatching() error {
+	roots := ml.enabledRoots()
+
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+
+	// Don't start if already watching
+	if ml.isWatching {
+		log.Println("👀 [WATCHER] Already watching folders")
+		return nil
+	}
+
+	// Don't start if no folder selected
+	if len(roots) == 0 {
+		log.Println("👀 [WATCHER] No folders enabled, cannot start watching")
+		return nil
+	}
+
+	ml.watchers = make(map[string]*fsnotify.Watcher, len(roots))
+	var firstErr error
+	for _, root := range roots {
+		if ml.offlineRoots[root] {
+			continue
+		}
+
+		// Create new watcher; the folders already watched keep theirs, so StopWatching
+		// still has to find them
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Printf("❌ [WATCHER] Failed to create watcher for %s: %v", root, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		// fsnotify isn't recursive, so every directory in the tree needs its own watch
+		if err := addWatchesRecursive(watcher, root); err != nil {
+			log.Printf("❌ [WATCHER] Failed to watch folder %s: %v", root, err)
+			watcher.Close()
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		ml.watchers[root] = watcher
+		log.Printf("👀 [WATCHER] Started watching folder: %s", root)
+
+		// Start the event processing goroutine
+		go ml.watchEvents(watcher, root)
+	}
+	ml.isWatching = true
+
+	return firstErr
+}
+
+// StopWatching stops every file system watcher and cleans up resources
+func (ml *MusicLibrary) StopWatching() {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+
+	if !ml.isWatching {
+		return
+	}
+
+	log.Println("👀 [WATCHER] Stopping file system watchers")
+
+	// Close the watchers (this also ends their watchEvents goroutines)
+	for _, watcher := range ml.watchers {
+		watcher.Close()
+	}
+	ml.watchers = nil
+	ml.isWatching = false
+
+	log.Println("👀 [WATCHER] File system watchers stopped")
+}
+
+// addWatchesRecursive adds a watch for dir and every directory beneath it
+func addWatchesRecursive(watcher *fsnotify.Watcher, dir string) error {
+	watched := 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			log.Printf("⚠️ [WATCHER] Skipping unreadable path %s: %v", path, err)
+			return nil
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if err := watcher.Add(path); err != nil {
+			if path == dir {
+				return err
+			}
+			log.Printf("⚠️ [WATCHER] Failed to watch %s: %v", path, err)
+			return nil
+		}
+		watched++
+		return nil
+	})
+
+	if err == nil {
+		log.Printf("👀 [WATCHER] Watching %d directories under %s", watched, dir)
+	}
+	return err
+}
+
+// watchEvents collects file system events below a root and applies them in
+// debounced batches
+func (ml *MusicLibrary) watchEvents(watcher *fsnotify.Watcher, root string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("🔥 [WATCHER] Panic in event processing: %v", r)
+		}
+	}()
+
+	pending := make(map[string]fsnotify.Op)
+	debounce := time.NewTimer(watcherDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				log.Println("👀 [WATCHER] Events channel closed")
+				return
+			}
+
+			if !isRelevantEvent(event) {
+				continue
+			}
+
+			log.Printf("👀 [WATCHER] Event: %s %s", event.Op.String(), event.Name)
+
+			// New directories need watches right away, or files copied into them are missed
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addWatchesRecursive(watcher, event.Name); err != nil {
+						log.Printf("⚠️ [WATCHER] Failed to watch new directory %s: %v", event.Name, err)
+					}
+				}
+			}
+
+			pending[event.Name] |= event.Op
+			debounce.Reset(watcherDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				log.Println("👀 [WATCHER] Errors channel closed")
+				return
+			}
+			log.Printf("❌ [WATCHER] File system error: %v", err)
+
+		case <-debounce.C:
+			if len(pending) == 0 {
+				continue
+			}
+			batch := pending
+			pending = make(map[string]fsnotify.Op)
+			ml.applyFileSystemChanges(batch, root)
+		}
+	}
+}
+
+// isRelevantEvent filters out events that can't affect the library
+func isRelevantEvent(event fsnotify.Event) bool {
+	// Permission changes never affect tags or contents
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+
+	// Cover images next to the tracks can change an album's artwork, and playlist
+	// files are imported
+	if isAudioFile(filepath.Base(event.Name)) || isImageFile(filepath.Base(event.Name)) || IsPlaylistFile(filepath.Base(event.Name)) {
+		return true
+	}
+
+	// Removed or renamed paths can't be inspected any more - they may have been directories
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		return true
+	}
+
+	info, err := os.Stat(event.Name)
+	return err == nil && info.IsDir()
+}
+
+// applyFileSystemChanges applies a batch of changed paths below a root to the
+// library as a diff, instead of rescanning the whole folder
+func (ml *MusicLibrary) applyFileSystemChanges(batch map[string]fsnotify.Op, root string) {
+	// An unmounted drive looks like every file was deleted. Reload instead, which
+	// marks the root offline and keeps its index entries for when it's back.
+	if !ml.isRootOnline(root) {
+		log.Printf("🔌 [WATCHER] Music folder went offline: %s", root)
+		go ml.reloadRoots()
+		return
+	}
+
+	ml.scanMutex.Lock()
+	defer ml.scanMutex.Unlock()
+
+	ml.mutex.RLock()
+	scanned := make(map[string]*Song, len(ml.allSongs))
+	for path, song := range ml.allSongs {
+		scanned[path] = song
+	}
+	ml.mutex.RUnlock()
+
+	paths := make([]string, 0, len(batch))
+	for path := range batch {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	log.Printf("👀 [WATCHER] Applying %d changed paths", len(paths))
+
+	// Additions and updates first, so moved files can claim their old IDs
+	// before the old paths are dropped from the index
+	var gone, playlistFiles []string
+	coverDirs := make(map[string]bool) // folders whose cover image may have changed
+	for _, path := range paths {
+		if !isWithinRoot(path, root) {
+			continue
+		}
+
+		if isAudioFile(filepath.Base(path)) || isImageFile(filepath.Base(path)) {
+			coverDirs[filepath.Dir(path)] = true
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			gone = append(gone, path)
+			continue
+		}
+
+		if info.IsDir() {
+			found, playlists, err := ml.scanDirectory(path)
+			if err != nil {
+				log.Printf("⚠️ [WATCHER] Failed to scan directory %s: %v", path, err)
+			}
+			for _, song := range found {
+				scanned[song.Path] = song
+			}
+			playlistFiles = append(playlistFiles, playlists...)
+			continue
+		}
+
+		if IsPlaylistFile(info.Name()) {
+			playlistFiles = append(playlistFiles, path)
+			continue
+		}
+
+		if !isAudioFile(info.Name()) {
+			continue
+		}
+
+		song, err := ml.songForFile(path)
+		if err != nil {
+			log.Printf("⚠️ [WATCHER] Failed to read %s: %v", path, err)
+			continue
+		}
+		scanned[path] = song
+	}
+
+	// Removals: a removed directory takes every song beneath it
+	for _, path := range gone {
+		for songPath := range scanned {
+			if isWithinRoot(songPath, path) {
+				delete(scanned, songPath)
+				ml.index.Remove(songPath)
+			}
+		}
+	}
+
+	// Single files read above don't know their folder's cover yet, and added,
+	// replaced or deleted cover images change it for the whole folder
+	ml.applyFolderCovers(scanned, coverDirs)
+
+	if err := ml.index.Save(); err != nil {
+		log.Printf("⚠️ [INDEX] %v", err)
+	}
+
+	changes := ml.commitSongs(scanned)
+
+	// Playlists are read once the songs they list are in, and go with their file
+	ml.importPlaylists(playlistFiles, func(sourcePath string) bool {
+		for _, path := range gone {
+			if isWithinRoot(sourcePath, path) {
+				return true
+			}
+		}
+		return false
+	})
+
+	if changes.IsEmpty() {
+		log.Println("👀 [WATCHER] No visible library changes")
+		return
+	}
+
+	log.Printf("👀 [WATCHER] Library updated incrementally (%s)", changes.Summary())
+	ml.notifyLibraryChanged()
+}
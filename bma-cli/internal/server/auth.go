@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// AuthContextKey is used for storing auth data in request context
+type AuthContextKey string
+
+const (
+	TokenContextKey     AuthContextKey = "token"
+	UserAgentContextKey AuthContextKey = "userAgent"
+	ClientIPContextKey  AuthContextKey = "clientIP"
+	DeviceContextKey    AuthContextKey = "device"
+)
+
+// AuthMiddleware provides Bearer token authentication for protected endpoints
+type AuthMiddleware struct {
+	musicServer *MusicServer
+}
+
+// NewAuthMiddleware creates a new authentication middleware
+func NewAuthMiddleware(ms *MusicServer) *AuthMiddleware {
+	return &AuthMiddleware{
+		musicServer: ms,
+	}
+}
+
+// RequireAuth returns a middleware function that enforces Bearer token authentication
+func (am *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Extract Authorization header
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Println("❌ [AUTH] Missing authorization header")
+			writeAuthError(w, "Missing authorization token", http.StatusUnauthorized)
+			return
+		}
+
+		// Validate Bearer token format
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			log.Println("❌ [AUTH] Invalid authorization header format")
+			writeAuthError(w, "Invalid authorization format", http.StatusUnauthorized)
+			return
+		}
+
+		// Extract token
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if len(token) == 0 {
+			log.Println("❌ [AUTH] Empty token")
+			writeAuthError(w, "Empty authorization token", http.StatusUnauthorized)
+			return
+		}
+
+		// Extract client information
+		clientIP := extractClientIP(r)
+		userAgent := r.Header.Get("User-Agent")
+		if userAgent == "" {
+			userAgent = "unknown"
+		}
+
+		// Resolve the token to its device (claims unclaimed pairing codes for older clients)
+		credential, ok := am.musicServer.AuthenticateToken(token, userAgent)
+		if !ok {
+			log.Printf("❌ [AUTH] Invalid or expired token: %s", truncateToken(token))
+			writeAuthError(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		log.Printf("✅ [AUTH] Valid token: %s from %s (%s)", truncateToken(token), clientIP, credential.DeviceName)
+
+		// Track device connection
+		am.musicServer.TrackDeviceConnection(credential, clientIP, userAgent)
+
+		// Add auth data to request context
+		ctx := context.WithValue(r.Context(), TokenContextKey, token)
+		ctx = context.WithValue(ctx, ClientIPContextKey, clientIP)
+		ctx = context.WithValue(ctx, UserAgentContextKey, userAgent)
+		ctx = context.WithValue(ctx, DeviceContextKey, credential)
+
+		// Call next handler with enriched context
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// RequirePairingAccess guards the endpoints that hand out pairing codes. The CLI
+// has no screen of its own, so codes are only issued to the machine itself or to
+// whoever holds the pairing key printed in the terminal at startup.
+func (am *AuthMiddleware) RequirePairingAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isLoopbackRequest(r) {
+			next(w, r)
+			return
+		}
+
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			key = r.Header.Get("X-Pairing-Key")
+		}
+		if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(am.musicServer.pairingKey)) != 1 {
+			log.Printf("❌ [AUTH] Pairing request without a valid pairing key from %s", r.RemoteAddr)
+			writeAuthError(w, "A valid pairing key is required", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// RequireLoopback restricts an endpoint to requests from this machine. Granting
+// admin rights is one: no paired device can give them to itself or another.
+func (am *AuthMiddleware) RequireLoopback(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackRequest(r) {
+			log.Printf("❌ [AUTH] Rejected %s %s from %s: only allowed from this machine", r.Method, r.URL.Path, r.RemoteAddr)
+			writeAuthError(w, "Only allowed from the server itself", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RequireAuthUnlessLoopback is RequireAuth, except that requests from this machine
+// need no token
+func (am *AuthMiddleware) RequireAuthUnlessLoopback(next http.HandlerFunc) http.HandlerFunc {
+	requireAuth := am.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isLoopbackRequest(r) {
+			next(w, r)
+			return
+		}
+		requireAuth(w, r)
+	}
+}
+
+// RequireAuthOrPathToken is RequireAuth for DELETE /pair/{token}. The Android client
+// sends that request without an Authorization header, so presenting the token in the
+// path is accepted in its place. A pending pairing code is passed straight through:
+// authenticating with it would claim it and pair a device just to revoke it.
+func (am *AuthMiddleware) RequireAuthOrPathToken(next http.HandlerFunc) http.HandlerFunc {
+	requireAuth := am.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := mux.Vars(r)["token"]
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || (bearer != "" && bearer != token) {
+			requireAuth(w, r)
+			return
+		}
+
+		if am.musicServer.credentials.HasPairingCode(token) {
+			next(w, r.WithContext(context.WithValue(r.Context(), TokenContextKey, token)))
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+token)
+		requireAuth(w, r)
+	}
+}
+
+// RequireAuthOrSignature is RequireAuth for HLS playlists and segments. Players fetch
+// those URLs themselves and can't always add the Authorization header, so a URL
+// signed for the song (see hls.go) is accepted in its place.
+func (am *AuthMiddleware) RequireAuthOrSignature(next http.HandlerFunc) http.HandlerFunc {
+	requireAuth := am.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || r.URL.Query().Get("sig") == "" {
+			requireAuth(w, r)
+			return
+		}
+
+		credential, err := am.musicServer.hlsSigner.verify(mux.Vars(r)["songId"], r.URL.Query(), am.musicServer.credentials)
+		if err != nil {
+			log.Printf("❌ [AUTH] Rejected signed URL from %s: %v", extractClientIP(r), err)
+			writeAuthError(w, "Invalid or expired signature", http.StatusUnauthorized)
+			return
+		}
+
+		clientIP := extractClientIP(r)
+		userAgent := r.Header.Get("User-Agent")
+		if userAgent == "" {
+			userAgent = "unknown"
+		}
+		am.musicServer.TrackDeviceConnection(credential, clientIP, userAgent)
+
+		// No TokenContextKey: the signature stands in for the token, which it doesn't reveal
+		ctx := context.WithValue(r.Context(), ClientIPContextKey, clientIP)
+		ctx = context.WithValue(ctx, UserAgentContextKey, userAgent)
+		ctx = context.WithValue(ctx, DeviceContextKey, credential)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// Helper functions
+
+// extractClientIP gets the real client IP, considering proxy headers
+func extractClientIP(r *http.Request) string {
+	// Check X-Forwarded-For header (most common proxy header)
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		// X-Forwarded-For can contain multiple IPs, take the first one
+		ips := strings.Split(forwarded, ",")
+		return strings.TrimSpace(ips[0])
+	}
+
+	// Check X-Real-IP header (Nginx)
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+
+	// Fall back to RemoteAddr
+	return r.RemoteAddr
+}
+
+// isLoopbackRequest reports whether the TCP peer is this machine. Proxy headers are
+// ignored on purpose - they are trivially spoofed.
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// truncateToken safely truncates a token for logging
+func truncateToken(token string) string {
+	if len(token) <= 8 {
+		return strings.Repeat("*", len(token))
+	}
+	return token[:8] + "..."
+}
+
+// writeAuthError writes a standardized authentication error response
+func writeAuthError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(statusCode)
+
+	response := map[string]interface{}{
+		"error":   "authentication_failed",
+		"message": message,
+		"status":  statusCode,
+	}
+
+	// Don't log error if we can't write JSON response
+	_ = json.NewEncoder(w).Encode(response)
+}
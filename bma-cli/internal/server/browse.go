@@ -0,0 +1,391 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"bma-cli/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// Library browsing endpoints. The grouping lives on the server so clients no longer
+// re-derive albums from the flat /songs list; bma-cli serves the same JSON schema.
+
+// Result limit per group (songs, albums, artists) for /search
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// songPayload converts a song to the JSON shape shared by every endpoint that lists songs
+func songPayload(song *models.Song) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              song.ID.String(),
+		"filename":        song.Filename,
+		"title":           song.Title,
+		"artist":          song.Artist,
+		"album":           song.Album,
+		"trackNumber":     song.TrackNumber,
+		"trackTotal":      song.TrackTotal,
+		"discNumber":      song.DiscNumber,
+		"discTotal":       song.DiscTotal,
+		"albumArtist":     song.AlbumArtist,
+		"year":            song.Year,
+		"genre":           song.Genre,
+		"composer":        song.Composer,
+		"compilation":     song.Compilation,
+		"parentDirectory": song.ParentDirectory,
+		"durationMs":      song.Duration.Milliseconds(),
+		"bitrate":         song.Bitrate,
+		"sampleRate":      song.SampleRate,
+		"channels":        song.Channels,
+		"format":          song.Format,
+		"mimeType":        song.MimeType,
+		"hasArtwork":      song.HasArtwork(),
+		"rootId":          rootID(song.Root),
+	}
+}
+
+// rootID identifies the library root a song came from, or "" if it has none
+func rootID(root string) string {
+	if root == "" {
+		return ""
+	}
+	return models.StableFolderID(root).String()
+}
+
+// songsPayload converts a list of songs, keeping their order
+func songsPayload(songs []*models.Song) []map[string]interface{} {
+	payload := make([]map[string]interface{}, len(songs))
+	for i, song := range songs {
+		payload[i] = songPayload(song)
+	}
+	return payload
+}
+
+// albumPayload converts an album, with its track list when includeSongs is set
+func albumPayload(album *models.Album, includeSongs bool) map[string]interface{} {
+	payload := map[string]interface{}{
+		"id":          album.ID.String(),
+		"name":        album.Name,
+		"artist":      album.Artist,
+		"year":        album.Year,
+		"genre":       album.Genre,
+		"discCount":   album.DiscCount,
+		"compilation": album.Compilation,
+		"trackCount":  album.TrackCount(),
+		"durationMs":  album.TotalDuration().Milliseconds(),
+		"hasArtwork":  album.HasArtwork(),
+	}
+	if includeSongs {
+		payload["songs"] = songsPayload(album.Songs)
+	}
+	return payload
+}
+
+// artistPayload converts an artist, with their songs when includeSongs is set
+func artistPayload(artist *models.Artist, includeSongs bool) map[string]interface{} {
+	albums := make([]map[string]interface{}, len(artist.Albums))
+	for i, album := range artist.Albums {
+		albums[i] = albumPayload(album, false)
+	}
+
+	payload := map[string]interface{}{
+		"id":         artist.ID.String(),
+		"name":       artist.Name,
+		"albumCount": len(artist.Albums),
+		"songCount":  len(artist.Songs),
+		"albums":     albums,
+	}
+	if includeSongs {
+		payload["songs"] = songsPayload(artist.Songs)
+	}
+	return payload
+}
+
+// folderPayload converts a folder of standalone songs
+func folderPayload(folder *models.Folder) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         folder.ID.String(),
+		"name":       folder.Name,
+		"path":       folder.Path,
+		"songCount":  len(folder.Songs),
+		"durationMs": folder.TotalDuration().Milliseconds(),
+		"songs":      songsPayload(folder.Songs),
+	}
+}
+
+// duplicateGroupPayload converts a group of duplicate files; "listed" marks the
+// copies the library shows (all of them under the keep-all policy)
+func duplicateGroupPayload(group models.DuplicateGroup, policy models.DuplicatePolicy) map[string]interface{} {
+	songs := make([]map[string]interface{}, len(group.Songs))
+	for i, song := range group.Songs {
+		payload := songPayload(song)
+		payload["lossless"] = song.IsLossless()
+		payload["listed"] = song == group.Kept || policy == models.DuplicatesKeepAll
+		songs[i] = payload
+	}
+
+	return map[string]interface{}{
+		"keptId":    group.Kept.ID.String(),
+		"sameTags":  group.SameTags,
+		"sameAudio": group.SameAudio,
+		"songs":     songs,
+	}
+}
+
+// scanProgressPayload converts scan progress, shared by /library/scan and
+// scan-progress events
+func scanProgressPayload(progress models.ScanProgress) map[string]interface{} {
+	return map[string]interface{}{
+		"seen":      progress.Seen,
+		"processed": progress.Processed,
+		"failed":    progress.Failed,
+		"listed":    progress.Listed,
+		"fraction":  progress.Fraction(),
+	}
+}
+
+// libraryDeltaPayload converts a library delta, shared by /library/changes and
+// library-changed events
+func libraryDeltaPayload(delta models.LibraryDelta, fields map[string]bool) map[string]interface{} {
+	added := make([]map[string]interface{}, len(delta.Added))
+	for i, song := range delta.Added {
+		added[i] = projectFields(songPayload(song), fields)
+	}
+	updated := make([]map[string]interface{}, len(delta.Updated))
+	for i, song := range delta.Updated {
+		updated[i] = projectFields(songPayload(song), fields)
+	}
+	removed := make([]string, len(delta.Removed))
+	for i, id := range delta.Removed {
+		removed[i] = id.String()
+	}
+
+	return map[string]interface{}{
+		"since":          delta.Since,
+		"libraryVersion": delta.Version,
+		"fullSync":       delta.FullSync,
+		"added":          added,
+		"updated":        updated,
+		"removed":        removed,
+	}
+}
+
+// handleAlbums returns every album with its track list
+func (ms *MusicServer) handleAlbums(w http.ResponseWriter, r *http.Request) {
+	log.Println("📀 Albums list requested")
+
+	albums := []map[string]interface{}{}
+	if ms.musicLibrary != nil {
+		for _, album := range ms.musicLibrary.GetAlbums() {
+			albums = append(albums, albumPayload(album, true))
+		}
+	}
+
+	log.Printf("📊 Returning %d albums to client", len(albums))
+	if err := writeJSONResponse(w, albums); err != nil {
+		log.Printf("❌ Failed to encode albums data: %v", err)
+	}
+}
+
+// handleAlbum returns a single album with its track list
+func (ms *MusicServer) handleAlbum(w http.ResponseWriter, r *http.Request) {
+	albumID := mux.Vars(r)["albumId"]
+
+	var album *models.Album
+	if ms.musicLibrary != nil {
+		album = ms.musicLibrary.GetAlbumByID(albumID)
+	}
+	if album == nil {
+		log.Printf("❌ Album not found: %s", albumID)
+		http.Error(w, "Album not found", http.StatusNotFound)
+		return
+	}
+
+	if err := writeJSONResponse(w, albumPayload(album, true)); err != nil {
+		log.Printf("❌ Failed to encode album data: %v", err)
+	}
+}
+
+// handleArtists returns every artist with a summary of their albums
+func (ms *MusicServer) handleArtists(w http.ResponseWriter, r *http.Request) {
+	log.Println("🎤 Artists list requested")
+
+	artists := []map[string]interface{}{}
+	if ms.musicLibrary != nil {
+		for _, artist := range ms.musicLibrary.GetArtists() {
+			artists = append(artists, artistPayload(artist, false))
+		}
+	}
+
+	log.Printf("📊 Returning %d artists to client", len(artists))
+	if err := writeJSONResponse(w, artists); err != nil {
+		log.Printf("❌ Failed to encode artists data: %v", err)
+	}
+}
+
+// handleArtist returns a single artist with their albums and songs
+func (ms *MusicServer) handleArtist(w http.ResponseWriter, r *http.Request) {
+	artistID := mux.Vars(r)["artistId"]
+
+	var artist *models.Artist
+	if ms.musicLibrary != nil {
+		artist = ms.musicLibrary.GetArtistByID(artistID)
+	}
+	if artist == nil {
+		log.Printf("❌ Artist not found: %s", artistID)
+		http.Error(w, "Artist not found", http.StatusNotFound)
+		return
+	}
+
+	if err := writeJSONResponse(w, artistPayload(artist, true)); err != nil {
+		log.Printf("❌ Failed to encode artist data: %v", err)
+	}
+}
+
+// handleFolders returns the songs that aren't on any album, grouped by folder
+func (ms *MusicServer) handleFolders(w http.ResponseWriter, r *http.Request) {
+	log.Println("📁 Folders list requested")
+
+	folders := []map[string]interface{}{}
+	if ms.musicLibrary != nil {
+		for _, folder := range ms.musicLibrary.GetFolders() {
+			folders = append(folders, folderPayload(folder))
+		}
+	}
+
+	log.Printf("📊 Returning %d folders to client", len(folders))
+	if err := writeJSONResponse(w, folders); err != nil {
+		log.Printf("❌ Failed to encode folders data: %v", err)
+	}
+}
+
+// handleDuplicates reports every group of duplicate files and which copy is listed
+func (ms *MusicServer) handleDuplicates(w http.ResponseWriter, r *http.Request) {
+	var report models.DuplicateReport
+	if ms.musicLibrary != nil {
+		report = ms.musicLibrary.GetDuplicates()
+	}
+
+	groups := make([]map[string]interface{}, len(report.Groups))
+	hidden := 0
+	for i, group := range report.Groups {
+		groups[i] = duplicateGroupPayload(group, report.Policy)
+		if report.Policy != models.DuplicatesKeepAll {
+			hidden += len(group.Songs) - 1
+		}
+	}
+
+	log.Printf("🚫 Duplicates requested: %d groups, %d copies hidden", len(groups), hidden)
+
+	response := map[string]interface{}{
+		"policy":         report.Policy,
+		"fingerprinting": report.Fingerprinting,
+		"groupCount":     len(groups),
+		"hiddenCount":    hidden,
+		"groups":         groups,
+	}
+	if err := writeJSONResponse(w, response); err != nil {
+		log.Printf("❌ Failed to encode duplicates report: %v", err)
+	}
+}
+
+// handleScanStatus reports the running library scan, or the last one
+func (ms *MusicServer) handleScanStatus(w http.ResponseWriter, r *http.Request) {
+	var status models.ScanStatus
+	if ms.musicLibrary != nil {
+		status = ms.musicLibrary.GetScanStatus()
+	}
+
+	response := scanProgressPayload(status.Progress)
+	response["scanning"] = status.Scanning
+	response["roots"] = status.Roots
+	response["cancelled"] = status.Cancelled
+	if !status.StartedAt.IsZero() {
+		response["startedAt"] = status.StartedAt.Format(time.RFC3339)
+	}
+	if !status.FinishedAt.IsZero() {
+		response["finishedAt"] = status.FinishedAt.Format(time.RFC3339)
+	}
+	if status.Error != "" {
+		response["error"] = status.Error
+	}
+
+	if err := writeJSONResponse(w, response); err != nil {
+		log.Printf("❌ Failed to encode scan status: %v", err)
+	}
+}
+
+// handleLibraryRoots lists the music folders with their online state and song counts
+func (ms *MusicServer) handleLibraryRoots(w http.ResponseWriter, r *http.Request) {
+	roots := []map[string]interface{}{}
+	if ms.musicLibrary != nil {
+		for _, root := range ms.musicLibrary.GetRoots() {
+			roots = append(roots, map[string]interface{}{
+				"id":        root.ID,
+				"path":      root.Path,
+				"name":      filepath.Base(root.Path),
+				"enabled":   !root.Disabled,
+				"online":    root.Online,
+				"songCount": root.SongCount,
+			})
+		}
+	}
+
+	if err := writeJSONResponse(w, roots); err != nil {
+		log.Printf("❌ Failed to encode library roots: %v", err)
+	}
+}
+
+// handleSearch runs a library search and returns ranked songs, albums and artists
+func (ms *MusicServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+	}
+
+	var results models.SearchResults
+	if ms.musicLibrary != nil {
+		results = ms.musicLibrary.Search(query, limit)
+	}
+
+	albums := make([]map[string]interface{}, len(results.Albums))
+	for i, album := range results.Albums {
+		albums[i] = albumPayload(album, false)
+	}
+	artists := make([]map[string]interface{}, len(results.Artists))
+	for i, artist := range results.Artists {
+		artists[i] = artistPayload(artist, false)
+	}
+
+	log.Printf("🔎 Search %q: %d songs, %d albums, %d artists", query, len(results.Songs), len(albums), len(artists))
+
+	response := map[string]interface{}{
+		"query":   query,
+		"songs":   songsPayload(results.Songs),
+		"albums":  albums,
+		"artists": artists,
+	}
+	if err := writeJSONResponse(w, response); err != nil {
+		log.Printf("❌ Failed to encode search results: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"bma-cli/internal/models"
+	"github.com/google/uuid"
+)
+
+// deviceInactiveTimeout is how long a device can go without a request (heartbeats
+// included) before it stops counting as connected
+const deviceInactiveTimeout = 2 * time.Minute
+
+// TrackDeviceConnection records activity from a paired device
+func (ms *MusicServer) TrackDeviceConnection(credential models.DeviceCredential, ipAddress, userAgent string) {
+	ms.devicesMutex.Lock()
+	defer ms.devicesMutex.Unlock()
+
+	// Check if device already exists (update last seen)
+	for i, device := range ms.connectedDevices {
+		if device.DeviceID == credential.DeviceID {
+			ms.connectedDevices[i].LastSeenAt = time.Now()
+			ms.connectedDevices[i].IPAddress = ipAddress
+			return
+		}
+	}
+
+	// Add new device
+	device := models.ConnectedDevice{
+		ID:          uuid.New(),
+		DeviceID:    credential.DeviceID,
+		Token:       credential.Token,
+		DeviceName:  credential.DeviceName,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		ConnectedAt: time.Now(),
+		LastSeenAt:  time.Now(),
+	}
+
+	ms.connectedDevices = append(ms.connectedDevices, device)
+	log.Printf("📱 New device connected: %s (%s)", device.DeviceName, device.IPAddress)
+}
+
+// DisconnectDevice removes the device using token and revokes its credential.
+// Other paired devices keep their own credentials and stay connected.
+func (ms *MusicServer) DisconnectDevice(token string) bool {
+	removed := ms.removeConnectedDevices(func(device models.ConnectedDevice) bool {
+		return device.Token == token
+	})
+
+	ms.revokePairingToken(token)
+	return removed > 0
+}
+
+// removeConnectedDevices drops every connected device matching the predicate
+func (ms *MusicServer) removeConnectedDevices(match func(models.ConnectedDevice) bool) int {
+	ms.devicesMutex.Lock()
+	defer ms.devicesMutex.Unlock()
+
+	remaining := []models.ConnectedDevice{}
+	for _, device := range ms.connectedDevices {
+		if match(device) {
+			log.Printf("📱 Device disconnected: %s (%s)", device.DeviceName, device.IPAddress)
+			continue
+		}
+		remaining = append(remaining, device)
+	}
+
+	removed := len(ms.connectedDevices) - len(remaining)
+	ms.connectedDevices = remaining
+	return removed
+}
+
+// GetConnectedDevices returns a copy of connected devices
+func (ms *MusicServer) GetConnectedDevices() []models.ConnectedDevice {
+	ms.devicesMutex.RLock()
+	defer ms.devicesMutex.RUnlock()
+
+	devices := make([]models.ConnectedDevice, len(ms.connectedDevices))
+	copy(devices, ms.connectedDevices)
+	return devices
+}
+
+// cleanupInactiveDevices removes devices that haven't been seen recently
+func (ms *MusicServer) cleanupInactiveDevices() {
+	cutoff := time.Now().Add(-deviceInactiveTimeout)
+
+	removed := ms.removeConnectedDevices(func(device models.ConnectedDevice) bool {
+		return device.LastSeenAt.Before(cutoff)
+	})
+	if removed > 0 {
+		log.Printf("📱 Cleaned up %d inactive devices", removed)
+	}
+}
+
+// startDeviceMonitor starts background monitoring for device connections
+func (ms *MusicServer) startDeviceMonitor() {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ms.cleanupInactiveDevices()
+				ms.credentials.PruneExpired()
+			case <-ms.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// parseDeviceName extracts device info from user agent
+func parseDeviceName(userAgent string) string {
+	switch {
+	case userAgent == "":
+		return "Unknown Device"
+	case strings.Contains(userAgent, "Android"):
+		return "Android Device"
+	case strings.Contains(userAgent, "iPhone"):
+		return "iPhone"
+	case strings.Contains(userAgent, "iPad"):
+		return "iPad"
+	case strings.Contains(userAgent, "Mac"):
+		return "Mac"
+	case strings.Contains(userAgent, "BMA"):
+		return "BMA App"
+	default:
+		return "Unknown Device"
+	}
+}
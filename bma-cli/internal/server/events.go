@@ -0,0 +1,308 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"bma-cli/internal/models"
+	"github.com/google/uuid"
+)
+
+// Server-sent events. GET /events keeps a text/event-stream open for each device
+// and pushes:
+//
+//	hello            on connect, with the current libraryVersion
+//	library-changed  songs added, updated and removed (same shape as /library/changes)
+//	scan-started, scan-progress, scan-finished
+//	playlist-changed a playlist was created, edited or deleted ("deleted": true)
+//	now-playing      a device started playing a song (same shape as /now-playing)
+//	plays-recorded   plays were scrobbled; top lists and history have changed
+//	token-revoked    this device's credential was revoked; the stream ends after it
+//	server-shutdown  the server is stopping; the stream ends after it
+//
+// A client that misses events (reconnect, slow reader) catches up with
+// /library/changes?since=<the libraryVersion it last saw>.
+
+const (
+	// eventBufferSize is how many events may queue for one stream before it is dropped
+	eventBufferSize = 64
+	// eventKeepAliveInterval keeps proxies and NAT from closing an idle stream
+	eventKeepAliveInterval = 25 * time.Second
+	// eventWriteTimeout bounds a single write to a stalled client
+	eventWriteTimeout = 10 * time.Second
+	// maxEventDeltaSongs keeps library-changed events small; bigger changes only
+	// say fullSync and clients refetch
+	maxEventDeltaSongs = 500
+)
+
+// serverEvent is one message on the event stream
+type serverEvent struct {
+	ID   uint64
+	Type string
+	Data interface{}
+}
+
+// eventSubscriber is one open /events stream
+type eventSubscriber struct {
+	token     string
+	deviceID  uuid.UUID
+	events    chan serverEvent
+	done      chan struct{} // closed when the server ends the stream
+	closeOnce sync.Once
+}
+
+// close ends the stream; events already queued are still delivered
+func (s *eventSubscriber) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// EventHub fans server events out to every open /events stream
+type EventHub struct {
+	mutex       sync.Mutex
+	subscribers map[*eventSubscriber]bool
+	nextID      uint64
+
+	// Library version the last library-changed event brought clients up to
+	libraryMutex   sync.Mutex
+	libraryVersion int64
+}
+
+// NewEventHub creates an event hub with no subscribers
+func NewEventHub() *EventHub {
+	return &EventHub{
+		subscribers: make(map[*eventSubscriber]bool),
+	}
+}
+
+// subscribe opens a stream for a device
+func (h *EventHub) subscribe(token string, credential models.DeviceCredential) *eventSubscriber {
+	subscriber := &eventSubscriber{
+		token:    token,
+		deviceID: credential.DeviceID,
+		events:   make(chan serverEvent, eventBufferSize),
+		done:     make(chan struct{}),
+	}
+
+	h.mutex.Lock()
+	h.subscribers[subscriber] = true
+	count := len(h.subscribers)
+	h.mutex.Unlock()
+
+	log.Printf("📡 [EVENTS] %s subscribed (%d open streams)", credential.DeviceName, count)
+	return subscriber
+}
+
+// unsubscribe forgets a stream once its handler returns
+func (h *EventHub) unsubscribe(subscriber *eventSubscriber) {
+	h.mutex.Lock()
+	delete(h.subscribers, subscriber)
+	h.mutex.Unlock()
+	subscriber.close()
+}
+
+// Publish sends an event to every open stream. A stream whose queue is full is
+// dropped rather than blocking the publisher; the client reconnects and catches up.
+func (h *EventHub) Publish(eventType string, data interface{}) {
+	h.publish(func(*eventSubscriber) bool { return true }, eventType, data, false)
+}
+
+// Kick sends a final event to the matching streams and closes them
+func (h *EventHub) Kick(match func(*eventSubscriber) bool, eventType string, data interface{}) int {
+	return h.publish(match, eventType, data, true)
+}
+
+// publish delivers an event to matching streams, closing them afterwards if asked
+func (h *EventHub) publish(match func(*eventSubscriber) bool, eventType string, data interface{}, closeAfter bool) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.nextID++
+	event := serverEvent{ID: h.nextID, Type: eventType, Data: data}
+
+	delivered := 0
+	for subscriber := range h.subscribers {
+		if !match(subscriber) {
+			continue
+		}
+
+		drop := closeAfter
+		select {
+		case subscriber.events <- event:
+			delivered++
+		default:
+			log.Printf("⚠️ [EVENTS] Dropping stream that fell %d events behind", eventBufferSize)
+			drop = true
+		}
+
+		if drop {
+			delete(h.subscribers, subscriber)
+			subscriber.close()
+		}
+	}
+	return delivered
+}
+
+// Shutdown tells every client the server is stopping and ends all streams
+func (h *EventHub) Shutdown() {
+	h.Kick(func(*eventSubscriber) bool { return true }, "server-shutdown", map[string]interface{}{
+		"serverTime": time.Now().Format(time.RFC3339),
+	})
+}
+
+// watchLibrary turns library callbacks into events
+func (h *EventHub) watchLibrary(library *models.MusicLibrary) {
+	h.libraryMutex.Lock()
+	h.libraryVersion = library.GetLibraryVersion()
+	h.libraryMutex.Unlock()
+
+	library.SetScanningChangedCallback(func(isScanning bool) {
+		eventType := "scan-finished"
+		if isScanning {
+			eventType = "scan-started"
+		}
+		h.Publish(eventType, map[string]interface{}{
+			"libraryVersion": library.GetLibraryVersion(),
+			"songCount":      library.GetSongCount(),
+		})
+	})
+
+	library.SetScanProgressCallback(func(progress models.ScanProgress) {
+		h.Publish("scan-progress", scanProgressPayload(progress))
+	})
+
+	library.SetLibraryChangedCallback(func() {
+		h.publishLibraryChanged(library)
+	})
+
+	library.History().SetNowPlayingCallback(func(entry models.NowPlaying) {
+		h.Publish("now-playing", nowPlayingPayload(entry, library.GetSongByID(entry.SongID.String())))
+	})
+
+	library.History().SetPlaysAddedCallback(func(count int) {
+		h.Publish("plays-recorded", map[string]interface{}{"count": count})
+	})
+
+	library.Playlists().SetChangedCallback(func(id string) {
+		_, exists := library.Playlists().Get(id)
+		h.Publish("playlist-changed", map[string]interface{}{
+			"playlistId": id,
+			"deleted":    !exists,
+		})
+	})
+}
+
+// publishLibraryChanged sends what changed since the previous library-changed event
+func (h *EventHub) publishLibraryChanged(library *models.MusicLibrary) {
+	h.libraryMutex.Lock()
+	defer h.libraryMutex.Unlock()
+
+	delta := library.ChangesSince(h.libraryVersion)
+	if !delta.FullSync && len(delta.Added)+len(delta.Updated)+len(delta.Removed) == 0 {
+		return
+	}
+	h.libraryVersion = delta.Version
+
+	if len(delta.Added)+len(delta.Updated) > maxEventDeltaSongs {
+		delta = models.LibraryDelta{Since: delta.Since, Version: delta.Version, FullSync: true}
+	}
+	h.Publish("library-changed", libraryDeltaPayload(delta, nil))
+}
+
+// handleEvents streams server events to an authenticated device
+func (ms *MusicServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	token, _ := r.Context().Value(TokenContextKey).(string)
+	credential, _ := r.Context().Value(DeviceContextKey).(models.DeviceCredential)
+	clientIP, _ := r.Context().Value(ClientIPContextKey).(string)
+	userAgent, _ := r.Context().Value(UserAgentContextKey).(string)
+
+	// The server-wide read/write timeouts would end the stream after 30 seconds;
+	// each write below sets its own deadline instead
+	controller := http.NewResponseController(w)
+	_ = controller.SetReadDeadline(time.Time{})
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // don't let reverse proxies buffer the stream
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		log.Printf("❌ [EVENTS] Streaming not supported: %v", err)
+		return
+	}
+
+	subscriber := ms.events.subscribe(token, credential)
+	defer ms.events.unsubscribe(subscriber)
+
+	var libraryVersion int64
+	if ms.musicLibrary != nil {
+		libraryVersion = ms.musicLibrary.GetLibraryVersion()
+	}
+	hello := serverEvent{Type: "hello", Data: map[string]interface{}{
+		"deviceId":       credential.DeviceID.String(),
+		"libraryVersion": libraryVersion,
+	}}
+	if err := writeServerEvent(w, controller, hello); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-subscriber.events:
+			if err := writeServerEvent(w, controller, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			// An open stream counts as activity, so the device stays listed as connected
+			ms.TrackDeviceConnection(credential, clientIP, userAgent)
+			_ = controller.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		case <-subscriber.done:
+			// Deliver the final event (token-revoked, server-shutdown) before closing
+			for {
+				select {
+				case event := <-subscriber.events:
+					if err := writeServerEvent(w, controller, event); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeServerEvent writes one event in text/event-stream format and flushes it
+func writeServerEvent(w http.ResponseWriter, controller *http.ResponseController, event serverEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		log.Printf("❌ [EVENTS] Failed to encode %s event: %v", event.Type, err)
+		return nil
+	}
+
+	_ = controller.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	return controller.Flush()
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bma-cli/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// hlsURLLifetime is how long a signed HLS URL stays valid, long enough for a
+// paused song to be resumed later in the day
+const hlsURLLifetime = 12 * time.Hour
+
+// hlsPlaylistType is the Content-Type of HLS playlists
+const hlsPlaylistType = "application/vnd.apple.mpegurl"
+
+// errInvalidSignature is returned for signed URLs that are malformed, expired or
+// signed for another song or a revoked credential
+var errInvalidSignature = errors.New("invalid or expired signature")
+
+// urlSigner signs HLS URLs so players that can't send an Authorization header can
+// still fetch playlists and segments. A signature covers one song and one device
+// credential, so revoking the credential also invalidates its URLs. The key only
+// lives in memory: a restart invalidates every signed URL.
+type urlSigner struct {
+	key []byte
+}
+
+// urlSignerKeySize is the HMAC key length: a full SHA-256 output, as RFC 2104 advises
+const urlSignerKeySize = 32
+
+// newURLSigner creates a signer with a random key. Like uuid.New, it panics if the
+// system's random source fails, since nothing could be signed safely anyway.
+func newURLSigner() *urlSigner {
+	key := make([]byte, urlSignerKeySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("cannot create HLS signing key: %v", err))
+	}
+	return &urlSigner{key: key}
+}
+
+// signature returns the MAC for a song, credential and expiry time
+func (s *urlSigner) signature(songID, tokenHash string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%s\n%d", songID, tokenHash, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sign returns the query parameters that authorize a device credential to fetch
+// the HLS URLs of a song
+func (s *urlSigner) sign(songID string, credential models.DeviceCredential) (url.Values, time.Time) {
+	expiresAt := time.Now().Add(hlsURLLifetime).Truncate(time.Second)
+	expires := expiresAt.Unix()
+
+	query := url.Values{}
+	query.Set("device", credential.DeviceID.String())
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("sig", s.signature(songID, models.HashToken(credential.Token), expires))
+	return query, expiresAt
+}
+
+// verify checks the signed query parameters of a request for a song and returns
+// the credential they were signed for
+func (s *urlSigner) verify(songID string, query url.Values, credentials *models.CredentialStore) (models.DeviceCredential, error) {
+	deviceID, err := uuid.Parse(query.Get("device"))
+	if err != nil {
+		return models.DeviceCredential{}, errInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return models.DeviceCredential{}, errInvalidSignature
+	}
+
+	sig := []byte(query.Get("sig"))
+	credential, ok := credentials.MatchDevice(deviceID, func(tokenHash string) bool {
+		return hmac.Equal(sig, []byte(s.signature(songID, tokenHash, expires)))
+	})
+	if !ok {
+		return models.DeviceCredential{}, errInvalidSignature
+	}
+	return credential, nil
+}
+
+// hlsQuery returns the signed query to append to the URLs a playlist lists. A
+// request that was itself signed passes its signature on; one authorized by a
+// bearer token gets a fresh one.
+func (ms *MusicServer) hlsQuery(r *http.Request, songID string) string {
+	if token, ok := r.Context().Value(TokenContextKey).(string); ok {
+		credential, _ := r.Context().Value(DeviceContextKey).(models.DeviceCredential)
+		credential.Token = token
+		query, _ := ms.hlsSigner.sign(songID, credential)
+		return query.Encode()
+	}
+
+	signed := url.Values{}
+	for _, key := range []string{"device", "expires", "sig"} {
+		signed.Set(key, r.URL.Query().Get(key))
+	}
+	return signed.Encode()
+}
+
+// hlsSong resolves the song of an HLS request, answering the request itself when
+// the song can't be streamed as HLS
+func (ms *MusicServer) hlsSong(w http.ResponseWriter, r *http.Request) *models.Song {
+	songID := mux.Vars(r)["songId"]
+
+	var song *models.Song
+	if ms.musicLibrary != nil {
+		song = ms.musicLibrary.GetSongByID(songID)
+	}
+	if song == nil {
+		log.Printf("❌ [HLS] Song not found: %s", songID)
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return nil
+	}
+	if !ms.transcoding.converts() {
+		log.Println("❌ [HLS] HLS needs ffmpeg, which isn't available")
+		http.Error(w, "HLS is not available on this server, use /stream", http.StatusServiceUnavailable)
+		return nil
+	}
+	if models.HLSSegmentCount(song) == 0 {
+		log.Printf("❌ [HLS] Length of %s is unknown, can't split it into segments", song.Title)
+		http.Error(w, "Song length unknown, use /stream", http.StatusUnprocessableEntity)
+		return nil
+	}
+	return song
+}
+
+// handleHLSURL returns a signed URL for a song's master playlist, for players that
+// can't send the Authorization header
+func (ms *MusicServer) handleHLSURL(w http.ResponseWriter, r *http.Request) {
+	song := ms.hlsSong(w, r)
+	if song == nil {
+		return
+	}
+
+	credential, _ := r.Context().Value(DeviceContextKey).(models.DeviceCredential)
+	credential.Token, _ = r.Context().Value(TokenContextKey).(string)
+	query, expiresAt := ms.hlsSigner.sign(song.ID.String(), credential)
+
+	response := map[string]interface{}{
+		"url":       fmt.Sprintf("/hls/%s/index.m3u8?%s", song.ID, query.Encode()),
+		"expiresAt": expiresAt.Format(time.RFC3339),
+	}
+	if err := writeJSONResponse(w, response); err != nil {
+		log.Printf("❌ Failed to encode HLS URL: %v", err)
+	}
+}
+
+// handleHLSMaster serves a song's master playlist, one entry per variant
+func (ms *MusicServer) handleHLSMaster(w http.ResponseWriter, r *http.Request) {
+	song := ms.hlsSong(w, r)
+	if song == nil {
+		return
+	}
+
+	log.Printf("📺 [HLS] Master playlist for: %s - %s", song.Artist, song.Title)
+	writeHLSPlaylist(w, hlsMasterPlaylist(song, ms.hlsQuery(r, song.ID.String())))
+}
+
+// handleHLSMedia serves the segment list of one variant of a song
+func (ms *MusicServer) handleHLSMedia(w http.ResponseWriter, r *http.Request) {
+	song := ms.hlsSong(w, r)
+	if song == nil {
+		return
+	}
+	variant, ok := models.HLSVariantByName(song, mux.Vars(r)["variant"])
+	if !ok {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("📺 [HLS] %s playlist for: %s - %s", variant.Name, song.Artist, song.Title)
+	writeHLSPlaylist(w, hlsMediaPlaylist(song, ms.hlsQuery(r, song.ID.String())))
+}
+
+// handleHLSSegment serves one segment of a variant, transcoding it on first request
+func (ms *MusicServer) handleHLSSegment(w http.ResponseWriter, r *http.Request) {
+	song := ms.hlsSong(w, r)
+	if song == nil {
+		return
+	}
+	variant, ok := models.HLSVariantByName(song, mux.Vars(r)["variant"])
+	if !ok {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return
+	}
+	index, err := strconv.Atoi(mux.Vars(r)["segment"])
+	if err != nil || index < 0 || index >= models.HLSSegmentCount(song) {
+		http.Error(w, "Segment not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := ms.transcoding.serve(w, r, song, variant.SegmentOptions(song, index)); err != nil {
+		log.Printf("❌ [HLS] Failed to produce segment %d of %s (%s): %v", index, song.Title, variant.Name, err)
+	}
+}
+
+// hlsMasterPlaylist lists the variants of a song. BANDWIDTH includes roughly 10%
+// for the MPEG-TS overhead.
+func hlsMasterPlaylist(song *models.Song, query string) string {
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, variant := range models.HLSVariants(song) {
+		fmt.Fprintf(&playlist, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"%s\"\n", variant.Bitrate*1100, variant.Codecs)
+		fmt.Fprintf(&playlist, "%s/index.m3u8?%s\n", variant.Name, query)
+	}
+	return playlist.String()
+}
+
+// hlsMediaPlaylist lists the segments of a song. Every variant is split the same
+// way, so players can switch between them at any segment.
+func hlsMediaPlaylist(song *models.Song, query string) string {
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&playlist, "#EXT-X-TARGETDURATION:%d\n", int(models.HLSSegmentDuration.Seconds()))
+	playlist.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for i := 0; i < models.HLSSegmentCount(song); i++ {
+		fmt.Fprintf(&playlist, "#EXTINF:%.3f,\n", models.HLSSegmentLength(song, i).Seconds())
+		fmt.Fprintf(&playlist, "%d.ts?%s\n", i, query)
+	}
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+	return playlist.String()
+}
+
+// writeHLSPlaylist sends a playlist. They're built from the library in
+// microseconds, so unlike segments they aren't kept on disk.
+func writeHLSPlaylist(w http.ResponseWriter, playlist string) {
+	w.Header().Set("Content-Type", hlsPlaylistType)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if _, err := w.Write([]byte(playlist)); err != nil {
+		log.Printf("❌ [HLS] Failed to write playlist: %v", err)
+	}
+}
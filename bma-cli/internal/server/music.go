@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -12,7 +13,10 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"bma-cli/internal/models"
@@ -27,16 +31,53 @@ type MusicServer struct {
 	musicLibrary *models.MusicLibrary
 	server       *http.Server
 	router       *mux.Router
+	
+	// Pairing codes and per-device credentials, persisted hashed (see pairing.go)
+	credentials         *models.CredentialStore
+	tokensMutex         sync.RWMutex
+	currentPairingToken string // pairing code currently shown on the /qr page
+	pairingKey          string // required to issue pairing codes from other machines
+	
+	// Server-sent events for /events (see events.go)
+	events *EventHub
+	
+	// Converts streams for ?format= and ?maxBitrate= (see transcode.go)
+	transcoding *transcoding
+	
+	// Signs HLS URLs for players that can't send the Authorization header (see hls.go)
+	hlsSigner *urlSigner
+	
+	// Device tracking (see devices.go)
+	connectedDevices []models.ConnectedDevice
+	devicesMutex     sync.RWMutex
+	
+	// Shutdown context
+	ctx        context.Context
+	cancelFunc context.CancelFunc
 }
 
 // NewMusicServer creates a new music server
 func NewMusicServer(config *models.Config, musicLibrary *models.MusicLibrary) *MusicServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	
 	ms := &MusicServer{
 		config:       config,
 		musicLibrary: musicLibrary,
+		credentials:  models.LoadCredentialStore(),
+		pairingKey:   strings.ReplaceAll(uuid.New().String(), "-", ""),
+		events:       NewEventHub(),
+		transcoding:  newTranscoding(config.FFmpegPath, config.TranscodeCacheMB),
+		hlsSigner:    newURLSigner(),
+		ctx:          ctx,
+		cancelFunc:   cancel,
+	}
+	
+	if musicLibrary != nil {
+		ms.events.watchLibrary(musicLibrary)
 	}
 	
 	ms.setupRoutes()
+	ms.startDeviceMonitor()
 	return ms
 }
 
@@ -44,30 +85,73 @@ func NewMusicServer(config *models.Config, musicLibrary *models.MusicLibrary) *M
 func (ms *MusicServer) setupRoutes() {
 	ms.router = mux.NewRouter()
 	
-	// Add CORS middleware for mobile app access
-	ms.router.Use(ms.corsMiddleware)
 	ms.router.Use(ms.requestLoggingMiddleware)
 	
-	// Public endpoints (no authentication required for now)
+	authMiddleware := NewAuthMiddleware(ms)
+	
+	// Public endpoints (no authentication required)
 	ms.router.HandleFunc("/health", ms.handleHealth).Methods("GET")
 	ms.router.HandleFunc("/info", ms.handleInfo).Methods("GET")
-	ms.router.HandleFunc("/songs", ms.handleSongs).Methods("GET")
-	ms.router.HandleFunc("/albums", ms.handleAlbums).Methods("GET")
-	ms.router.HandleFunc("/stream/{songId}", ms.handleStream).Methods("GET")
-	ms.router.HandleFunc("/artwork/{songId}", ms.handleArtwork).Methods("GET")
+	ms.router.HandleFunc("/pair/claim", ms.handleClaimPairing).Methods("POST")
 	
-	// Pairing endpoints
-	ms.router.HandleFunc("/pair", ms.handlePair).Methods("POST")
-	ms.router.HandleFunc("/qr", ms.handleQRPage).Methods("GET")
+	// Pairing code issuance (loopback or pairing key only)
+	ms.router.HandleFunc("/pair", authMiddleware.RequirePairingAccess(ms.handlePair)).Methods("POST")
+	ms.router.HandleFunc("/qr", authMiddleware.RequirePairingAccess(ms.handleQRPage)).Methods("GET")
+	
+	// Authenticated endpoints (require Bearer token)
+	ms.router.HandleFunc("/disconnect", authMiddleware.RequireAuth(ms.handleDisconnect)).Methods("POST")
+	ms.router.HandleFunc("/pair/{token}", authMiddleware.RequireAuthOrPathToken(ms.handleRevokePairing)).Methods("DELETE")
+	ms.router.HandleFunc("/devices", authMiddleware.RequireAuthUnlessLoopback(ms.handlePairedDevices)).Methods("GET")
+	ms.router.HandleFunc("/devices/{deviceId}/admin", authMiddleware.RequireLoopback(ms.handleSetDeviceAdmin)).Methods("PUT")
+	ms.router.HandleFunc("/heartbeat", authMiddleware.RequireAuth(ms.handleHeartbeat)).Methods("POST")
+	ms.router.HandleFunc("/events", authMiddleware.RequireAuth(ms.handleEvents)).Methods("GET")
+	ms.router.HandleFunc("/songs", authMiddleware.RequireAuth(ms.handleSongs)).Methods("GET")
+	ms.router.HandleFunc("/library/changes", authMiddleware.RequireAuth(ms.handleLibraryChanges)).Methods("GET")
+	ms.router.HandleFunc("/library/duplicates", authMiddleware.RequireAuth(ms.handleDuplicates)).Methods("GET")
+	ms.router.HandleFunc("/library/scan", authMiddleware.RequireAuth(ms.handleScanStatus)).Methods("GET")
+	ms.router.HandleFunc("/library/roots", authMiddleware.RequireAuth(ms.handleLibraryRoots)).Methods("GET")
+	ms.router.HandleFunc("/albums", authMiddleware.RequireAuth(ms.handleAlbums)).Methods("GET")
+	ms.router.HandleFunc("/albums/{albumId}", authMiddleware.RequireAuth(ms.handleAlbum)).Methods("GET")
+	ms.router.HandleFunc("/artists", authMiddleware.RequireAuth(ms.handleArtists)).Methods("GET")
+	ms.router.HandleFunc("/artists/{artistId}", authMiddleware.RequireAuth(ms.handleArtist)).Methods("GET")
+	ms.router.HandleFunc("/folders", authMiddleware.RequireAuth(ms.handleFolders)).Methods("GET")
+	ms.router.HandleFunc("/search", authMiddleware.RequireAuth(ms.handleSearch)).Methods("GET")
+	ms.router.HandleFunc("/playlists", authMiddleware.RequireAuth(ms.handlePlaylists)).Methods("GET")
+	ms.router.HandleFunc("/playlists", authMiddleware.RequireAuth(ms.handleCreatePlaylist)).Methods("POST")
+	ms.router.HandleFunc("/playlists/{playlistId}", authMiddleware.RequireAuth(ms.handlePlaylist)).Methods("GET")
+	ms.router.HandleFunc("/playlists/{playlistId}", authMiddleware.RequireAuth(ms.handleUpdatePlaylist)).Methods("PUT")
+	ms.router.HandleFunc("/playlists/{playlistId}", authMiddleware.RequireAuth(ms.handleDeletePlaylist)).Methods("DELETE")
+	ms.router.HandleFunc("/playlists/{playlistId}/tracks", authMiddleware.RequireAuth(ms.handleAddPlaylistTracks)).Methods("POST")
+	ms.router.HandleFunc("/playlists/{playlistId}/tracks/move", authMiddleware.RequireAuth(ms.handleMovePlaylistTrack)).Methods("POST")
+	ms.router.HandleFunc("/playlists/{playlistId}/tracks/{position:[0-9]+}", authMiddleware.RequireAuth(ms.handleRemovePlaylistTrack)).Methods("DELETE")
+	ms.router.HandleFunc("/playlists/{playlistId}/export", authMiddleware.RequireAuth(ms.handleExportPlaylist)).Methods("GET")
+	ms.router.HandleFunc("/scrobble", authMiddleware.RequireAuth(ms.handleScrobble)).Methods("POST")
+	ms.router.HandleFunc("/now-playing", authMiddleware.RequireAuth(ms.handleNowPlaying)).Methods("GET")
+	ms.router.HandleFunc("/history", authMiddleware.RequireAuth(ms.handleHistory)).Methods("GET")
+	ms.router.HandleFunc("/stats/{kind:top-songs|top-albums|top-artists}", authMiddleware.RequireAuth(ms.handleTopStats)).Methods("GET")
+	ms.router.HandleFunc("/stream/{songId}", authMiddleware.RequireAuth(ms.handleStream)).Methods("GET", "HEAD")
+	ms.router.HandleFunc("/hls/{songId}/url", authMiddleware.RequireAuth(ms.handleHLSURL)).Methods("GET")
+	ms.router.HandleFunc("/hls/{songId}/index.m3u8", authMiddleware.RequireAuthOrSignature(ms.handleHLSMaster)).Methods("GET")
+	ms.router.HandleFunc("/hls/{songId}/{variant}/index.m3u8", authMiddleware.RequireAuthOrSignature(ms.handleHLSMedia)).Methods("GET")
+	ms.router.HandleFunc("/hls/{songId}/{variant}/{segment:[0-9]+}.ts", authMiddleware.RequireAuthOrSignature(ms.handleHLSSegment)).Methods("GET")
+	ms.router.HandleFunc("/artwork/{songId}", authMiddleware.RequireAuth(ms.handleArtwork)).Methods("GET")
+	ms.router.HandleFunc("/artwork/album/{albumId}", authMiddleware.RequireAuth(ms.handleAlbumArtwork)).Methods("GET")
 	
 	log.Println("✅ Music server routes configured")
 }
 
 // Start starts the music server
 func (ms *MusicServer) Start() error {
+	// WriteTimeout only bounds regular API responses - /stream replaces it with a
+	// rolling per-chunk deadline (see stream.go) so long tracks aren't cut off
 	ms.server = &http.Server{
-		Addr:    ":8080",
-		Handler: ms.router,
+		Addr:              ":8080",
+		// CORS wraps the router so preflights are answered before method matching
+		Handler:           ms.corsMiddleware(ms.router),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
 	}
 	
 	log.Println("🚀 Music server starting on :8080")
@@ -80,22 +164,49 @@ func (ms *MusicServer) Shutdown() error {
 		return nil
 	}
 	
+	// End event streams first, Shutdown would otherwise wait for them to time out
+	ms.events.Shutdown()
+	
+	// Stop background monitoring; paired devices keep their credentials across restarts
+	ms.cancelFunc()
+	ms.revokePairingCodes()
+	
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	
 	return ms.server.Shutdown(ctx)
 }
 
-// corsMiddleware adds CORS headers for mobile app access
+// PairingPageURL returns the /qr link, including the pairing key, for the terminal banner
+func (ms *MusicServer) PairingPageURL() string {
+	return fmt.Sprintf("%s/qr?key=%s", ms.getPreferredURL(), ms.pairingKey)
+}
+
+// corsMiddleware adds CORS headers for browser origins listed in the config. The
+// mobile app isn't a browser and never sends an Origin, so it is unaffected.
 func (ms *MusicServer) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && ms.config.IsOriginAllowed(origin)
+		
+		if origin != "" {
+			w.Header().Add("Vary", "Origin")
+		}
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Range")
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Range, Content-Length, ETag")
+		}
 		
 		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		if r.Method == "OPTIONS" && origin != "" {
+			if !allowed {
+				log.Printf("❌ [CORS] Rejected preflight from origin %s", origin)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		
@@ -144,6 +255,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // handleHealth returns server health status
 func (ms *MusicServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	log.Printf("🔍 Health check requested from %s", r.RemoteAddr)
@@ -170,6 +286,13 @@ func (ms *MusicServer) handleInfo(w http.ResponseWriter, r *http.Request) {
 		log.Printf("📊 Music library stats: %d albums, %d songs, version: %d", albumCount, songCount, libraryVersion)
 	}
 	
+	// musicPath predates multiple music folders and holds the first one
+	musicPaths := ms.config.MusicFolderPaths()
+	musicPath := ""
+	if len(musicPaths) > 0 {
+		musicPath = musicPaths[0]
+	}
+	
 	response := map[string]interface{}{
 		"server":      "BMA CLI Music Server",
 		"version":     "1.0",
@@ -180,7 +303,8 @@ func (ms *MusicServer) handleInfo(w http.ResponseWriter, r *http.Request) {
 			"albumCount":     albumCount,
 			"songCount":      songCount,
 			"hasLibrary":     ms.musicLibrary != nil,
-			"musicPath":      ms.config.MusicFolder,
+			"musicPath":      musicPath,
+			"musicPaths":     musicPaths,
 			"libraryVersion": libraryVersion,
 		},
 	}
@@ -195,7 +319,7 @@ func (ms *MusicServer) handleInfo(w http.ResponseWriter, r *http.Request) {
 	log.Printf("✅ Server info sent successfully (albums: %d, songs: %d)", albumCount, songCount)
 }
 
-// handleSongs returns the list of all songs
+// handleSongs returns the songs in library order, optionally paged and projected (see paging.go)
 func (ms *MusicServer) handleSongs(w http.ResponseWriter, r *http.Request) {
 	log.Println("🎵 Songs list requested")
 	
@@ -208,92 +332,94 @@ func (ms *MusicServer) handleSongs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Parse projection and paging before touching the library
+	fields, err := parseFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	libraryVersion := ms.musicLibrary.GetLibraryVersion()
+	page, status, err := parsePage(r, libraryVersion)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	
 	// Get songs from the music library
 	librarySongs := ms.musicLibrary.GetSongs()
-	log.Printf("📊 Retrieved %d songs from music library", len(librarySongs))
+	start, end := 0, len(librarySongs)
+	if page.Paged {
+		start, end = page.bounds(len(librarySongs))
+	}
 	
 	// Convert songs to JSON-compatible format
-	songs := make([]map[string]interface{}, len(librarySongs))
-	for i, song := range librarySongs {
-		songs[i] = map[string]interface{}{
-			"id":              song.ID.String(),
-			"filename":        song.Filename,
-			"title":           song.Title,
-			"artist":          song.Artist,
-			"album":           song.Album,
-			"trackNumber":     song.TrackNumber,
-			"parentDirectory": song.ParentDirectory,
-			"hasArtwork":      song.HasArtwork(),
-			"sortOrder":       i, // Explicit sort order
-		}
+	songs := make([]map[string]interface{}, 0, end-start)
+	for i := start; i < end; i++ {
+		song := songPayload(librarySongs[i])
+		song["sortOrder"] = i // Explicit sort order
+		songs = append(songs, projectFields(song, fields))
 	}
 	
-	log.Printf("📊 Returning %d songs to client", len(songs))
+	log.Printf("📊 Returning songs %d-%d of %d to client", start, end, len(librarySongs))
 	
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(songs); err != nil {
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(librarySongs)))
+	w.Header().Set("X-Library-Version", strconv.FormatInt(libraryVersion, 10))
+	
+	// Unpaged requests keep the plain array older clients expect
+	var response interface{} = songs
+	if page.Paged {
+		envelope := map[string]interface{}{
+			"songs":          songs,
+			"total":          len(librarySongs),
+			"offset":         start,
+			"limit":          page.Limit,
+			"libraryVersion": libraryVersion,
+		}
+		if end < len(librarySongs) {
+			envelope["nextCursor"] = encodeCursor(libraryVersion, end)
+		}
+		response = envelope
+	}
+	
+	if err := writeJSONResponse(w, response); err != nil {
 		log.Printf("❌ Failed to encode songs data: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	
 	log.Println("✅ Songs list sent successfully")
 }
 
-// handleAlbums returns the list of all albums
-func (ms *MusicServer) handleAlbums(w http.ResponseWriter, r *http.Request) {
-	log.Println("📀 Albums list requested")
-	
-	// Check if music library is available
-	if ms.musicLibrary == nil {
-		log.Println("❌ No music library available")
-		albums := []map[string]interface{}{}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(albums)
-		return
-	}
-	
-	// Get albums from the music library
-	libraryAlbums := ms.musicLibrary.GetAlbums()
-	log.Printf("📊 Retrieved %d albums from music library", len(libraryAlbums))
-	
-	// Convert albums to JSON-compatible format
-	albums := make([]map[string]interface{}, len(libraryAlbums))
-	for i, album := range libraryAlbums {
-		// Convert songs in album
-		songs := make([]map[string]interface{}, len(album.Songs))
-		for j, song := range album.Songs {
-			songs[j] = map[string]interface{}{
-				"id":          song.ID.String(),
-				"title":       song.Title,
-				"artist":      song.Artist,
-				"trackNumber": song.TrackNumber,
-				"hasArtwork":  song.HasArtwork(),
-			}
-		}
-		
-		albums[i] = map[string]interface{}{
-			"id":         album.ID.String(),
-			"name":       album.Name,
-			"artist":     album.Artist,
-			"trackCount": album.TrackCount(),
-			"songs":      songs,
-		}
+// handleLibraryChanges returns the songs added, updated and removed since ?since=<libraryVersion>
+func (ms *MusicServer) handleLibraryChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		http.Error(w, "Expected ?since=<libraryVersion>", http.StatusBadRequest)
+		return
 	}
 	
-	log.Printf("📊 Returning %d albums to client", len(albums))
-	
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(albums); err != nil {
-		log.Printf("❌ Failed to encode albums data: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	fields, err := parseFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	
-	log.Println("✅ Albums list sent successfully")
+	var delta models.LibraryDelta
+	if ms.musicLibrary != nil {
+		delta = ms.musicLibrary.ChangesSince(since)
+	} else {
+		delta = models.LibraryDelta{Since: since, FullSync: since != 0}
+	}
+	
+	log.Printf("🔄 Library changes since %d: +%d ~%d -%d (full sync: %v)", since, len(delta.Added), len(delta.Updated), len(delta.Removed), delta.FullSync)
+	
+	if err := writeJSONResponse(w, libraryDeltaPayload(delta, fields)); err != nil {
+		log.Printf("❌ Failed to encode library changes: %v", err)
+	}
 }
 
-// handleStream serves MP3 file content for a given song ID
+// handleStream serves audio file content for a given song ID, honouring byte ranges.
+// ?format=mp3|opus and ?maxBitrate= (kbps) ask for a transcoded stream.
 func (ms *MusicServer) handleStream(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	songID := vars["songId"]
@@ -303,6 +429,13 @@ func (ms *MusicServer) handleStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	query := r.URL.Query()
+	transcodeOptions, err := models.ParseTranscodeOptions(query.Get("format"), query.Get("maxBitrate"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
 	log.Printf("🎵 Stream requested for song ID: %s", songID)
 	
 	// Check if music library is available
@@ -325,15 +458,33 @@ func (ms *MusicServer) handleStream(w http.ResponseWriter, r *http.Request) {
 	
 	// Check if file exists
 	if _, err := os.Stat(song.Path); os.IsNotExist(err) {
-		log.Printf("❌ MP3 file not found at path: %s", song.Path)
+		log.Printf("❌ Audio file not found at path: %s", song.Path)
 		http.Error(w, "Music file not found", http.StatusNotFound)
 		return
 	}
 	
-	// Stream the MP3 file
-	if err := ms.writeFileResponse(w, song.Path, "audio/mpeg"); err != nil {
-		log.Printf("❌ Failed to stream MP3 file: %v", err)
-		http.Error(w, "Failed to stream file", http.StatusInternalServerError)
+	// Convert the song when the client asked for another format or a lower bitrate
+	if transcodeOptions != nil {
+		served, err := ms.transcoding.serve(w, r, song, *transcodeOptions)
+		if err != nil {
+			log.Printf("❌ Failed to transcode %s: %v", song.Title, err)
+		}
+		if served {
+			return
+		}
+	}
+	
+	// Songs scanned before format detection existed have no MIME type; they were all MP3
+	contentType := song.MimeType
+	if contentType == "" {
+		contentType = models.FormatMP3.MimeType
+	}
+	
+	// Stream the file (supports Range requests for seeking and resuming)
+	if err := serveAudioFile(w, r, song.Path, contentType); err != nil {
+		// serveAudioFile has already answered: with 404 or 500 if the file
+		// couldn't be opened, otherwise the headers were sent before the error
+		log.Printf("❌ Failed to stream %s file: %v", song.Format, err)
 		return
 	}
 	
@@ -367,60 +518,87 @@ func (ms *MusicServer) handleArtwork(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// Check if song has artwork
-	artworkData := song.GetArtwork()
-	if len(artworkData) == 0 {
+	if !serveArtwork(w, r, song) {
 		log.Printf("❌ No artwork found for song: %s - %s", song.Artist, song.Title)
-		http.Error(w, "Artwork not found", http.StatusNotFound)
 		return
 	}
 	
-	log.Printf("🎨 Serving artwork for: %s - %s (%d bytes)", song.Artist, song.Title, len(artworkData))
+	log.Printf("✅ Successfully served artwork for: %s", song.Title)
+}
+
+// handleAlbumArtwork serves the cover of an album: a cover image from its folder if
+// there is one, otherwise the first embedded picture
+func (ms *MusicServer) handleAlbumArtwork(w http.ResponseWriter, r *http.Request) {
+	albumID := mux.Vars(r)["albumId"]
 	
-	// Determine content type (most MP3 artwork is JPEG, but could be PNG)
-	contentType := "image/jpeg"
-	if len(artworkData) >= 8 {
-		// Check for PNG signature
-		if artworkData[0] == 0x89 && artworkData[1] == 0x50 && artworkData[2] == 0x4E && artworkData[3] == 0x47 {
-			contentType = "image/png"
-		}
+	var album *models.Album
+	if ms.musicLibrary != nil {
+		album = ms.musicLibrary.GetAlbumByID(albumID)
 	}
-	
-	// Set headers and serve artwork
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(artworkData)))
-	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
-	
-	if _, err := w.Write(artworkData); err != nil {
-		log.Printf("❌ Failed to serve artwork: %v", err)
+	if album == nil {
+		log.Printf("❌ Album not found: %s", albumID)
+		http.Error(w, "Album not found", http.StatusNotFound)
 		return
 	}
 	
-	log.Printf("✅ Successfully served artwork for: %s", song.Title)
+	if !serveArtwork(w, r, album) {
+		log.Printf("❌ No artwork found for album: %s", album.Name)
+		return
+	}
+	log.Printf("✅ Successfully served artwork for album: %s", album.Name)
 }
 
-// writeFileResponse streams a file as HTTP response
-func (ms *MusicServer) writeFileResponse(w http.ResponseWriter, filePath, contentType string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
+// artworkSource is a song or album whose picture can be served
+type artworkSource interface {
+	ArtworkID() string
+	GetArtwork() []byte
+	GetArtworkVariant(size int) ([]byte, error)
+}
+
+// serveArtwork writes a picture, resized when ?size= asks for it. It reports false
+// after answering 404 or 400 itself.
+func serveArtwork(w http.ResponseWriter, r *http.Request, source artworkSource) bool {
+	artworkID := source.ArtworkID()
+	if artworkID == "" {
+		http.Error(w, "Artwork not found", http.StatusNotFound)
+		return false
 	}
-	defer file.Close()
 	
-	// Get file info for content length
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return err
+	// ?size= picks a resized JPEG variant; without it the original picture is served
+	var artworkData []byte
+	etag := artworkID
+	if value := r.URL.Query().Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || !models.IsArtworkSize(size) {
+			http.Error(w, "Invalid size, use one of 64, 256 or 600", http.StatusBadRequest)
+			return false
+		}
+		
+		artworkData, err = source.GetArtworkVariant(size)
+		if err != nil {
+			// Formats the image package can't decode are still served at full size
+			log.Printf("⚠️ Could not resize artwork %s: %v", artworkID, err)
+		} else {
+			etag = fmt.Sprintf("%s-%d", artworkID, size)
+		}
+	}
+	if artworkData == nil {
+		artworkData = source.GetArtwork()
+	}
+	if len(artworkData) == 0 {
+		http.Error(w, "Artwork not found", http.StatusNotFound)
+		return false
 	}
 	
-	// Set headers
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
-	w.Header().Set("Accept-Ranges", "bytes")
+	log.Printf("🎨 Serving artwork %s (%d bytes)", etag, len(artworkData))
 	
-	// Stream file content
-	_, err = io.Copy(w, file)
-	return err
+	// Cached pictures are named by content hash, so it doubles as a strong ETag and
+	// ServeContent answers If-None-Match with 304
+	w.Header().Set("Content-Type", http.DetectContentType(artworkData))
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(artworkData))
+	return true
 }
 
 // handleQRPage serves the QR code pairing page
@@ -545,7 +723,7 @@ func (ms *MusicServer) handleQRPage(w http.ResponseWriter, r *http.Request) {
 		QRCode:       qrCodeBase64,
 		LocalURL:     ms.getLocalURL(),
 		TailscaleURL: ms.getTailscaleURL(),
-		MusicPath:    ms.config.MusicFolder,
+		MusicPath:    strings.Join(ms.config.MusicFolderPaths(), ", "),
 		SongCount:    ms.musicLibrary.GetSongCount(),
 		AlbumCount:   ms.musicLibrary.GetAlbumCount(),
 	}
@@ -563,15 +741,17 @@ func (ms *MusicServer) handleQRPage(w http.ResponseWriter, r *http.Request) {
 	log.Println("✅ QR code page served successfully")
 }
 
-// handlePair creates a new pairing token for device authentication
+// handlePair creates a new one-time pairing code for device authentication
 func (ms *MusicServer) handlePair(w http.ResponseWriter, r *http.Request) {
 	log.Println("📱 Pairing request received")
 	
+	code, expiresAt := ms.GeneratePairingToken(pairingCodeLifetime)
+	
 	// Generate simple pairing response matching mobile app expectations
 	response := map[string]interface{}{
 		"serverUrl": ms.getPreferredURL(),
-		"token":     uuid.New().String(),
-		"expiresAt": time.Now().Add(60 * time.Minute).Format(time.RFC3339),
+		"token":     code,
+		"expiresAt": expiresAt.Format(time.RFC3339),
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -584,13 +764,227 @@ func (ms *MusicServer) handlePair(w http.ResponseWriter, r *http.Request) {
 	log.Println("✅ Pairing response sent successfully")
 }
 
+// handleClaimPairing exchanges a one-time pairing code for a device credential
+func (ms *MusicServer) handleClaimPairing(w http.ResponseWriter, r *http.Request) {
+	log.Println("📱 Pairing claim received")
+	
+	var request struct {
+		Code       string `json:"code"`
+		DeviceName string `json:"deviceName"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&request); err != nil || request.Code == "" {
+		log.Printf("❌ Invalid pairing claim body: %v", err)
+		http.Error(w, "Expected JSON body with a pairing code", http.StatusBadRequest)
+		return
+	}
+	
+	deviceName := request.DeviceName
+	if deviceName == "" {
+		deviceName = parseDeviceName(r.Header.Get("User-Agent"))
+	}
+	
+	credential, err := ms.ClaimPairingCode(request.Code, deviceName)
+	if err != nil {
+		log.Printf("❌ Pairing claim rejected: %v", err)
+		writeAuthError(w, "Invalid or expired pairing code", http.StatusUnauthorized)
+		return
+	}
+	
+	response := map[string]interface{}{
+		"deviceId":   credential.DeviceID.String(),
+		"deviceName": credential.DeviceName,
+		"token":      credential.Token,
+		"createdAt":  credential.CreatedAt,
+		"expiresAt":  credential.ExpiresAt,
+		"serverUrl":  ms.getPreferredURL(),
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("❌ Failed to encode pairing claim response: %v", err)
+		return
+	}
+	
+	log.Printf("✅ Device paired: %s (%s)", credential.DeviceName, credential.DeviceID)
+}
+
+// handleDisconnect removes a device from connected devices list and revokes its credential
+func (ms *MusicServer) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	log.Println("📱 Disconnect request received")
+	
+	// Extract token from request context (set by auth middleware)
+	token, ok := r.Context().Value(TokenContextKey).(string)
+	if !ok {
+		log.Println("❌ No token found in disconnect request context")
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	
+	if ms.DisconnectDevice(token) {
+		log.Printf("📱 Device successfully disconnected")
+	} else {
+		log.Printf("⚠️ No device found with token for disconnect")
+	}
+	
+	response := map[string]string{
+		"status":  "disconnected",
+		"message": "Device successfully disconnected",
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("❌ Failed to encode disconnect response: %v", err)
+		return
+	}
+}
+
+// handleRevokePairing revokes a pairing code or device credential. A device may only
+// revoke its own token unless its credential has admin rights. Admins never see other
+// devices' tokens, so they may name a paired device by its ID instead.
+func (ms *MusicServer) handleRevokePairing(w http.ResponseWriter, r *http.Request) {
+	target := mux.Vars(r)["token"]
+	token, _ := r.Context().Value(TokenContextKey).(string)
+	credential, authenticated := r.Context().Value(DeviceContextKey).(models.DeviceCredential)
+
+	requester := credential.DeviceName
+	if !authenticated {
+		requester = "the holder of a pending pairing code"
+	}
+
+	switch {
+	case target == token:
+		log.Printf("🔒 Revoke request for token %s from %s", truncateToken(target), requester)
+		ms.RevokePairingToken(target)
+
+	case !credential.Admin:
+		log.Printf("❌ [AUTH] %s tried to revoke another device's token", requester)
+		writeAuthError(w, "Devices may only revoke their own token", http.StatusForbidden)
+		return
+
+	case ms.IsValidToken(target):
+		log.Printf("🔒 Revoke request for token %s from admin %s", truncateToken(target), requester)
+		ms.RevokePairingToken(target)
+
+	default:
+		deviceID, err := uuid.Parse(target)
+		if err != nil || !ms.RevokeDevice(deviceID) {
+			http.Error(w, "Token or device not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("🔒 Admin %s revoked device %s", requester, deviceID)
+	}
+
+	response := map[string]string{
+		"status":  "revoked",
+		"message": "Pairing token revoked",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("❌ Failed to encode revoke response: %v", err)
+		return
+	}
+}
+
+// requireAdmin answers 403 unless the requesting device has admin rights
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	credential, _ := r.Context().Value(DeviceContextKey).(models.DeviceCredential)
+	if !credential.Admin {
+		log.Printf("❌ [AUTH] %s tried to manage paired devices without admin rights", credential.DeviceName)
+		writeAuthError(w, "Admin rights required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handlePairedDevices lists every paired device, oldest first, for admins and for
+// requests from this machine
+func (ms *MusicServer) handlePairedDevices(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackRequest(r) && !requireAdmin(w, r) {
+		return
+	}
+
+	connected := make(map[uuid.UUID]bool)
+	for _, device := range ms.GetConnectedDevices() {
+		connected[device.DeviceID] = true
+	}
+
+	paired := ms.GetPairedDevices()
+	sort.Slice(paired, func(i, j int) bool { return paired[i].CreatedAt.Before(paired[j].CreatedAt) })
+
+	devices := make([]map[string]interface{}, 0, len(paired))
+	for _, device := range paired {
+		devices = append(devices, map[string]interface{}{
+			"deviceId":   device.DeviceID.String(),
+			"deviceName": device.DeviceName,
+			"admin":      device.Admin,
+			"connected":  connected[device.DeviceID],
+			"createdAt":  device.CreatedAt.Format(time.RFC3339),
+			"lastUsedAt": device.LastUsedAt.Format(time.RFC3339),
+		})
+	}
+	if err := writeJSONResponse(w, devices); err != nil {
+		log.Printf("❌ Failed to encode paired devices: %v", err)
+	}
+}
+
+// handleSetDeviceAdmin grants or withdraws admin rights with {"admin": true|false}.
+// Only requests from this machine get here, so pairing never grants them.
+func (ms *MusicServer) handleSetDeviceAdmin(w http.ResponseWriter, r *http.Request) {
+	deviceID, err := uuid.Parse(mux.Vars(r)["deviceId"])
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Admin *bool `json:"admin"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&request); err != nil || request.Admin == nil {
+		http.Error(w, `Expected {"admin": true|false}`, http.StatusBadRequest)
+		return
+	}
+
+	if !ms.SetDeviceAdmin(deviceID, *request.Admin) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	response := map[string]interface{}{
+		"deviceId": deviceID.String(),
+		"admin":    *request.Admin,
+	}
+	if err := writeJSONResponse(w, response); err != nil {
+		log.Printf("❌ Failed to encode admin response: %v", err)
+	}
+}
+
+// handleHeartbeat processes device heartbeat pings for connection monitoring
+func (ms *MusicServer) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	// Auth middleware already called TrackDeviceConnection(), so device activity is updated
+	
+	response := map[string]interface{}{
+		"status":     "alive",
+		"serverTime": time.Now().Format(time.RFC3339),
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("❌ Failed to encode heartbeat response: %v", err)
+		return
+	}
+}
+
 // generatePairingData creates the JSON data for QR code
 func (ms *MusicServer) generatePairingData() string {
+	// Reuse the current code until it is claimed, so reloading the page doesn't pile up codes
+	code, expiresAt := ms.currentPairingCode()
+	
 	// Match exact format expected by mobile app
 	pairingInfo := map[string]interface{}{
 		"serverUrl": ms.getPreferredURL(),
-		"token":     uuid.New().String(),
-		"expiresAt": time.Now().Add(60 * time.Minute).Format(time.RFC3339),
+		"token":     code,
+		"expiresAt": expiresAt.Format(time.RFC3339),
 	}
 	
 	data, _ := json.Marshal(pairingInfo)
@@ -641,4 +1035,10 @@ func (ms *MusicServer) getLocalIPAddress() string {
 	
 	localAddr := conn.LocalAddr().(*net.UDPAddr)
 	return localAddr.IP.String()
-}
\ No newline at end of file
+}
+
+// writeJSONResponse writes a JSON response with proper headers
+func writeJSONResponse(w http.ResponseWriter, data interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(data)
+}
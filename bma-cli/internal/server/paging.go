@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Paging and field selection for large song lists. Without any of these query
+// parameters /songs still returns the plain array older clients expect.
+
+// maxPageSize caps ?limit= so one request can't ask for the whole library again
+const maxPageSize = 1000
+
+// songFields lists every key ?fields= may select; "id" is always included
+var songFields = map[string]bool{
+	"id": true, "filename": true, "title": true, "artist": true, "album": true,
+	"trackNumber": true, "trackTotal": true, "discNumber": true, "discTotal": true,
+	"albumArtist": true, "year": true, "genre": true, "composer": true, "compilation": true,
+	"parentDirectory": true, "durationMs": true, "bitrate": true,
+	"sampleRate": true, "channels": true, "format": true, "mimeType": true,
+	"hasArtwork": true, "sortOrder": true, "rootId": true,
+}
+
+// pageRequest is a parsed ?limit=&offset= or ?cursor= request
+type pageRequest struct {
+	Paged  bool
+	Offset int
+	Limit  int
+}
+
+// parseFields reads ?fields=title,artist into a projection set (nil means every field)
+func parseFields(r *http.Request) (map[string]bool, error) {
+	value := r.URL.Query().Get("fields")
+	if value == "" {
+		return nil, nil
+	}
+
+	fields := map[string]bool{"id": true}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !songFields[field] {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		fields[field] = true
+	}
+	return fields, nil
+}
+
+// projectFields drops every key not selected by ?fields=
+func projectFields(payload map[string]interface{}, fields map[string]bool) map[string]interface{} {
+	if fields == nil {
+		return payload
+	}
+	for key := range payload {
+		if !fields[key] {
+			delete(payload, key)
+		}
+	}
+	return payload
+}
+
+// parsePage reads ?limit=, ?offset= and ?cursor=. A cursor is only valid for the
+// library version it was issued for, since songs shift position between versions.
+func parsePage(r *http.Request, libraryVersion int64) (pageRequest, int, error) {
+	query := r.URL.Query()
+	page := pageRequest{Limit: maxPageSize}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return page, http.StatusBadRequest, fmt.Errorf("invalid limit")
+		}
+		page.Paged = true
+		if limit < maxPageSize {
+			page.Limit = limit
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		version, offset, err := decodeCursor(cursor)
+		if err != nil {
+			return page, http.StatusBadRequest, err
+		}
+		if version != libraryVersion {
+			return page, http.StatusConflict, fmt.Errorf("library changed since this cursor was issued, start again from the first page")
+		}
+		page.Paged = true
+		page.Offset = offset
+	} else if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return page, http.StatusBadRequest, fmt.Errorf("invalid offset")
+		}
+		page.Paged = true
+		page.Offset = offset
+	}
+
+	return page, http.StatusOK, nil
+}
+
+// bounds clamps the page to a list of total items
+func (p pageRequest) bounds(total int) (int, int) {
+	start := p.Offset
+	if start > total {
+		start = total
+	}
+	end := start + p.Limit
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// encodeCursor builds the opaque cursor for the page starting at offset
+func encodeCursor(libraryVersion int64, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", libraryVersion, offset)))
+}
+
+// decodeCursor reverses encodeCursor
+func decodeCursor(cursor string) (int64, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid cursor")
+	}
+	version, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor")
+	}
+	offset, err := strconv.Atoi(parts[1])
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("invalid cursor")
+	}
+	return version, offset, nil
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"bma-cli/internal/models"
+	"github.com/google/uuid"
+)
+
+// Pairing works the same way as in BMA-Go. The /qr page (or POST /pair) hands out a
+// short-lived, one-time pairing code. A device exchanges it at POST /pair/claim for
+// its own long-lived credential; older clients that send the code straight back as
+// a bearer token claim it implicitly on first use. Codes and credentials are kept
+// hashed in a models.CredentialStore under ~/.bma-cli, so phones stay paired across
+// restarts of the CLI.
+
+// pairingCodeLifetime is how long an unclaimed pairing code stays valid
+const pairingCodeLifetime = 60 * time.Minute
+
+// deviceCredentialLifetime is how long a claimed device credential stays valid
+const deviceCredentialLifetime = 365 * 24 * time.Hour
+
+// errInvalidPairingCode is returned when a code is unknown, expired or already claimed
+var errInvalidPairingCode = errors.New("invalid or expired pairing code")
+
+// GeneratePairingToken creates a new one-time pairing code with expiration
+func (ms *MusicServer) GeneratePairingToken(expiresIn time.Duration) (string, time.Time) {
+	ms.tokensMutex.Lock()
+	defer ms.tokensMutex.Unlock()
+
+	code := uuid.New().String()
+	expiration := time.Now().Add(expiresIn)
+
+	// Also prunes expired codes and credentials
+	ms.credentials.AddPairingCode(code, expiration)
+	ms.currentPairingToken = code
+
+	log.Printf("🔑 Generated NEW pairing code: %s... (expires in %s)", code[:8], expiresIn)
+	return code, expiration
+}
+
+// currentPairingCode returns the code shown on the /qr page, issuing a new one when
+// the previous code was claimed or expired
+func (ms *MusicServer) currentPairingCode() (string, time.Time) {
+	ms.tokensMutex.RLock()
+	code := ms.currentPairingToken
+	ms.tokensMutex.RUnlock()
+
+	if code != "" {
+		if expiration, ok := ms.credentials.PairingCodeExpiry(code); ok {
+			return code, expiration
+		}
+	}
+	return ms.GeneratePairingToken(pairingCodeLifetime)
+}
+
+// ClaimPairingCode exchanges a one-time pairing code for a new device credential
+func (ms *MusicServer) ClaimPairingCode(code, deviceName string) (models.DeviceCredential, error) {
+	return ms.claimPairingCode(code, uuid.New().String(), deviceName)
+}
+
+// claimPairingCode consumes a pairing code and issues a credential with the given token
+func (ms *MusicServer) claimPairingCode(code, token, deviceName string) (models.DeviceCredential, error) {
+	deviceName = strings.TrimSpace(deviceName)
+	if deviceName == "" {
+		deviceName = "Unknown Device"
+	}
+
+	now := time.Now()
+	credential, ok := ms.credentials.ClaimPairingCode(code, token, models.DeviceCredential{
+		DeviceID:   uuid.New(),
+		DeviceName: deviceName,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(deviceCredentialLifetime),
+		LastUsedAt: now,
+	})
+	if !ok {
+		return models.DeviceCredential{}, errInvalidPairingCode
+	}
+
+	// The /qr page shows a spent code now, so the next visit needs a fresh one
+	ms.tokensMutex.Lock()
+	if ms.currentPairingToken == code {
+		ms.currentPairingToken = ""
+	}
+	ms.tokensMutex.Unlock()
+
+	log.Printf("🔐 Pairing code %s claimed by %s (device %s)", truncateToken(code), deviceName, credential.DeviceID)
+	return credential, nil
+}
+
+// AuthenticateToken resolves a bearer token to the device it belongs to. An unclaimed
+// pairing code is claimed on the spot for clients that skip /pair/claim.
+func (ms *MusicServer) AuthenticateToken(token, userAgent string) (models.DeviceCredential, bool) {
+	if credential, ok := ms.credentials.LookupDevice(token); ok {
+		return credential, true
+	}
+
+	credential, err := ms.claimPairingCode(token, token, parseDeviceName(userAgent))
+	if err != nil {
+		return models.DeviceCredential{}, false
+	}
+	return credential, true
+}
+
+// IsValidToken checks if a token is a live device credential or an unclaimed pairing code
+func (ms *MusicServer) IsValidToken(token string) bool {
+	if _, ok := ms.credentials.LookupDevice(token); ok {
+		return true
+	}
+	return ms.credentials.HasPairingCode(token)
+}
+
+// revokePairingToken removes a pairing code or a device credential, returning the
+// device the credential belonged to
+func (ms *MusicServer) revokePairingToken(token string) (models.DeviceCredential, bool) {
+	credential, wasDevice := ms.credentials.RevokeToken(token)
+	if wasDevice {
+		log.Printf("🔒 Revoked credential for %s (device %s)", credential.DeviceName, credential.DeviceID)
+		ms.events.Kick(func(subscriber *eventSubscriber) bool {
+			return subscriber.token == token
+		}, "token-revoked", map[string]interface{}{"deviceId": credential.DeviceID.String()})
+	}
+
+	ms.tokensMutex.Lock()
+	defer ms.tokensMutex.Unlock()
+
+	if ms.currentPairingToken == token {
+		ms.currentPairingToken = ""
+	}
+	log.Printf("🔒 Revoked pairing token: %s", truncateToken(token))
+	return credential, wasDevice
+}
+
+// RevokePairingToken removes a specific code or credential and disconnects the device
+// that held it (used by DELETE /pair/{token})
+func (ms *MusicServer) RevokePairingToken(token string) {
+	credential, wasDevice := ms.revokePairingToken(token)
+	ms.removeConnectedDevices(func(device models.ConnectedDevice) bool {
+		return device.Token == token || (wasDevice && device.DeviceID == credential.DeviceID)
+	})
+}
+
+// RevokeDevice revokes every credential held by a device and disconnects it
+func (ms *MusicServer) RevokeDevice(deviceID uuid.UUID) bool {
+	revoked := ms.credentials.RevokeDevice(deviceID)
+	for _, credential := range revoked {
+		log.Printf("🔒 Revoked credential for %s (device %s)", credential.DeviceName, deviceID)
+	}
+	ms.events.Kick(func(subscriber *eventSubscriber) bool {
+		return subscriber.deviceID == deviceID
+	}, "token-revoked", map[string]interface{}{"deviceId": deviceID.String()})
+
+	ms.removeConnectedDevices(func(device models.ConnectedDevice) bool {
+		return device.DeviceID == deviceID
+	})
+	return len(revoked) > 0
+}
+
+// revokePairingCodes invalidates every pending pairing code but keeps paired devices
+func (ms *MusicServer) revokePairingCodes() {
+	ms.credentials.RevokePairingCodes()
+
+	ms.tokensMutex.Lock()
+	defer ms.tokensMutex.Unlock()
+
+	ms.currentPairingToken = ""
+	log.Println("🔒 All pending pairing codes revoked")
+}
+
+// GetPairedDevices returns the devices holding a credential, without their tokens
+func (ms *MusicServer) GetPairedDevices() []models.DeviceCredential {
+	return ms.credentials.PairedDevices()
+}
+
+// SetDeviceAdmin grants or withdraws a paired device's right to revoke other devices
+func (ms *MusicServer) SetDeviceAdmin(deviceID uuid.UUID, admin bool) bool {
+	if !ms.credentials.SetAdmin(deviceID, admin) {
+		return false
+	}
+	log.Printf("🛡️ Admin rights for device %s set to %t", deviceID, admin)
+	return true
+}
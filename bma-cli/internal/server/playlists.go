@@ -0,0 +1,414 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bma-cli/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxPlaylistBodySize bounds playlist request bodies; 1 MB holds ~25k song IDs
+const maxPlaylistBodySize = 1 << 20
+
+// playlistPayload converts a playlist. songIds keeps every entry, including songs
+// that are currently missing from the library (offline folder, deleted file);
+// songs lists the ones that can be played, in order, when includeSongs is set.
+// Smart playlists also carry the rules, sort and limit that pick their songs.
+func playlistPayload(playlist models.Playlist, songs []*models.Song, includeSongs bool) map[string]interface{} {
+	songIDs := make([]string, len(playlist.SongIDs))
+	for i, id := range playlist.SongIDs {
+		songIDs[i] = id.String()
+	}
+
+	var available []*models.Song
+	var duration time.Duration
+	for _, song := range songs {
+		if song != nil {
+			available = append(available, song)
+			duration += song.Duration
+		}
+	}
+
+	payload := map[string]interface{}{
+		"id":           playlist.ID.String(),
+		"name":         playlist.Name,
+		"songIds":      songIDs,
+		"songCount":    len(playlist.SongIDs),
+		"missingCount": len(playlist.SongIDs) - len(available),
+		"durationMs":   duration.Milliseconds(),
+		"readOnly":     playlist.ReadOnly(),
+		"smart":        playlist.Smart != nil,
+		"createdAt":    playlist.CreatedAt.Format(time.RFC3339),
+		"updatedAt":    playlist.UpdatedAt.Format(time.RFC3339),
+	}
+	if playlist.ReadOnly() {
+		payload["sourcePath"] = playlist.SourcePath
+	}
+	if playlist.Smart != nil {
+		payload["rules"] = playlist.Smart.Rules
+		payload["sort"] = playlist.Smart.Sort
+		payload["limit"] = playlist.Smart.Limit
+	}
+	if includeSongs {
+		payload["songs"] = songsPayload(available)
+	}
+	return payload
+}
+
+// playlistRequest is the body of playlist create, update and add-tracks requests.
+// Rules make a smart playlist, whose songs can't be listed by hand.
+type playlistRequest struct {
+	Name     *string           `json:"name"`
+	SongIDs  []string          `json:"songIds"`
+	Position *int              `json:"position"` // add-tracks only; appends when omitted
+	Rules    *models.SmartRule `json:"rules"`
+	Sort     *string           `json:"sort"`
+	Limit    *int              `json:"limit"`
+}
+
+// isSmart reports whether the request sets any part of a smart playlist spec
+func (r *playlistRequest) isSmart() bool {
+	return r.Rules != nil || r.Sort != nil || r.Limit != nil
+}
+
+// smartSpec applies the request's rules, sort and limit to a spec
+func (r *playlistRequest) smartSpec(spec models.SmartSpec) models.SmartSpec {
+	if r.Rules != nil {
+		spec.Rules = *r.Rules
+	}
+	if r.Sort != nil {
+		spec.Sort = *r.Sort
+	}
+	if r.Limit != nil {
+		spec.Limit = *r.Limit
+	}
+	return spec
+}
+
+// decodePlaylistRequest reads a JSON request body into v
+func decodePlaylistRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPlaylistBodySize)).Decode(v); err != nil {
+		log.Printf("❌ [PLAYLISTS] Invalid request body: %v", err)
+		http.Error(w, "Expected a JSON body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// parseSongIDs checks that every ID is a song in the library, or one the playlist
+// already holds (songs in an offline folder must survive a reorder)
+func (ms *MusicServer) parseSongIDs(ids []string, existing []uuid.UUID) ([]uuid.UUID, error) {
+	parsed := make([]uuid.UUID, len(ids))
+	for i, id := range ids {
+		songID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid song ID %q", id)
+		}
+		parsed[i] = songID
+	}
+
+	known := make(map[uuid.UUID]bool, len(existing))
+	for _, id := range existing {
+		known[id] = true
+	}
+	for i, song := range ms.musicLibrary.GetSongsByIDs(parsed) {
+		if song == nil && !known[parsed[i]] {
+			return nil, fmt.Errorf("song %s is not in the library", parsed[i])
+		}
+	}
+	return parsed, nil
+}
+
+// writePlaylistError answers a failed playlist edit with a matching status code
+func writePlaylistError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrPlaylistNotFound):
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrPlaylistReadOnly), errors.Is(err, models.ErrPlaylistSmart):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// writePlaylist sends a playlist with its songs
+func (ms *MusicServer) writePlaylist(w http.ResponseWriter, playlist models.Playlist) {
+	songs := ms.musicLibrary.GetSongsByIDs(playlist.SongIDs)
+	if err := writeJSONResponse(w, playlistPayload(playlist, songs, true)); err != nil {
+		log.Printf("❌ Failed to encode playlist: %v", err)
+	}
+}
+
+// playlistStore returns the library's playlists, answering the request itself
+// when there's no library
+func (ms *MusicServer) playlistStore(w http.ResponseWriter) *models.PlaylistStore {
+	if ms.musicLibrary == nil {
+		http.Error(w, "Music library not available", http.StatusServiceUnavailable)
+		return nil
+	}
+	return ms.musicLibrary.Playlists()
+}
+
+// handlePlaylists lists every playlist, without their songs
+func (ms *MusicServer) handlePlaylists(w http.ResponseWriter, r *http.Request) {
+	log.Println("📜 Playlists list requested")
+
+	playlists := []map[string]interface{}{}
+	if ms.musicLibrary != nil {
+		for _, playlist := range ms.musicLibrary.Playlists().List() {
+			songs := ms.musicLibrary.GetSongsByIDs(playlist.SongIDs)
+			playlists = append(playlists, playlistPayload(playlist, songs, false))
+		}
+	}
+
+	log.Printf("📊 Returning %d playlists to client", len(playlists))
+	if err := writeJSONResponse(w, playlists); err != nil {
+		log.Printf("❌ Failed to encode playlists: %v", err)
+	}
+}
+
+// handleCreatePlaylist creates a playlist from {"name", "songIds"}, or a smart
+// playlist from {"name", "rules", "sort", "limit"}
+func (ms *MusicServer) handleCreatePlaylist(w http.ResponseWriter, r *http.Request) {
+	store := ms.playlistStore(w)
+	if store == nil {
+		return
+	}
+
+	var request playlistRequest
+	if !decodePlaylistRequest(w, r, &request) {
+		return
+	}
+	if request.Name == nil {
+		http.Error(w, models.ErrPlaylistNameEmpty.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var playlist models.Playlist
+	var err error
+	if request.isSmart() {
+		if request.SongIDs != nil {
+			http.Error(w, models.ErrPlaylistSmart.Error(), http.StatusBadRequest)
+			return
+		}
+		playlist, err = ms.musicLibrary.CreateSmartPlaylist(*request.Name, request.smartSpec(models.SmartSpec{}))
+	} else {
+		var songIDs []uuid.UUID
+		if songIDs, err = ms.parseSongIDs(request.SongIDs, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		playlist, err = store.Create(*request.Name, songIDs)
+	}
+	if err != nil {
+		writePlaylistError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/playlists/"+playlist.ID.String())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	ms.writePlaylist(w, playlist)
+}
+
+// handlePlaylist returns a playlist with its songs
+func (ms *MusicServer) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	store := ms.playlistStore(w)
+	if store == nil {
+		return
+	}
+
+	playlistID := mux.Vars(r)["playlistId"]
+	playlist, ok := store.Get(playlistID)
+	if !ok {
+		log.Printf("❌ Playlist not found: %s", playlistID)
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	}
+	ms.writePlaylist(w, playlist)
+}
+
+// handleUpdatePlaylist renames a playlist and/or replaces its songs, for clients
+// that edit a playlist locally and send back the result. Smart playlists take new
+// rules, sort or limit instead of songs.
+func (ms *MusicServer) handleUpdatePlaylist(w http.ResponseWriter, r *http.Request) {
+	store := ms.playlistStore(w)
+	if store == nil {
+		return
+	}
+
+	playlistID := mux.Vars(r)["playlistId"]
+	current, ok := store.Get(playlistID)
+	if !ok {
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	}
+
+	var request playlistRequest
+	if !decodePlaylistRequest(w, r, &request) {
+		return
+	}
+	switch {
+	case current.Smart != nil && request.SongIDs != nil:
+		writePlaylistError(w, models.ErrPlaylistSmart)
+		return
+	case current.Smart == nil && request.isSmart():
+		writePlaylistError(w, models.ErrPlaylistNotSmart)
+		return
+	case current.Smart != nil:
+		var spec *models.SmartSpec
+		if request.isSmart() {
+			updated := request.smartSpec(*current.Smart)
+			spec = &updated
+		}
+		playlist, err := ms.musicLibrary.UpdateSmartPlaylist(playlistID, request.Name, spec)
+		if err != nil {
+			writePlaylistError(w, err)
+			return
+		}
+		ms.writePlaylist(w, playlist)
+		return
+	}
+
+	var songIDs []uuid.UUID
+	if request.SongIDs != nil {
+		var err error
+		if songIDs, err = ms.parseSongIDs(request.SongIDs, current.SongIDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	playlist, err := store.Update(playlistID, request.Name, songIDs)
+	if err != nil {
+		writePlaylistError(w, err)
+		return
+	}
+	ms.writePlaylist(w, playlist)
+}
+
+// handleDeletePlaylist deletes a playlist
+func (ms *MusicServer) handleDeletePlaylist(w http.ResponseWriter, r *http.Request) {
+	store := ms.playlistStore(w)
+	if store == nil {
+		return
+	}
+
+	if err := store.Delete(mux.Vars(r)["playlistId"]); err != nil {
+		writePlaylistError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAddPlaylistTracks inserts {"songIds"} at {"position"}, or appends them
+func (ms *MusicServer) handleAddPlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	store := ms.playlistStore(w)
+	if store == nil {
+		return
+	}
+
+	var request playlistRequest
+	if !decodePlaylistRequest(w, r, &request) {
+		return
+	}
+	if len(request.SongIDs) == 0 {
+		http.Error(w, "Expected songIds to add", http.StatusBadRequest)
+		return
+	}
+	songIDs, err := ms.parseSongIDs(request.SongIDs, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	position := -1
+	if request.Position != nil {
+		position = *request.Position
+	}
+
+	playlist, err := store.AddTracks(mux.Vars(r)["playlistId"], songIDs, position)
+	if err != nil {
+		writePlaylistError(w, err)
+		return
+	}
+	ms.writePlaylist(w, playlist)
+}
+
+// handleRemovePlaylistTrack removes the track at a position
+func (ms *MusicServer) handleRemovePlaylistTrack(w http.ResponseWriter, r *http.Request) {
+	store := ms.playlistStore(w)
+	if store == nil {
+		return
+	}
+
+	position, err := strconv.Atoi(mux.Vars(r)["position"])
+	if err != nil {
+		http.Error(w, "Invalid track position", http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := store.RemoveTrack(mux.Vars(r)["playlistId"], position)
+	if err != nil {
+		writePlaylistError(w, err)
+		return
+	}
+	ms.writePlaylist(w, playlist)
+}
+
+// handleMovePlaylistTrack moves the track at {"from"} to {"to"}
+func (ms *MusicServer) handleMovePlaylistTrack(w http.ResponseWriter, r *http.Request) {
+	store := ms.playlistStore(w)
+	if store == nil {
+		return
+	}
+
+	var request struct {
+		From *int `json:"from"`
+		To   *int `json:"to"`
+	}
+	if !decodePlaylistRequest(w, r, &request) {
+		return
+	}
+	if request.From == nil || request.To == nil {
+		http.Error(w, "Expected from and to positions", http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := store.MoveTrack(mux.Vars(r)["playlistId"], *request.From, *request.To)
+	if err != nil {
+		writePlaylistError(w, err)
+		return
+	}
+	ms.writePlaylist(w, playlist)
+}
+
+// handleExportPlaylist sends a playlist as an M3U8 file
+func (ms *MusicServer) handleExportPlaylist(w http.ResponseWriter, r *http.Request) {
+	store := ms.playlistStore(w)
+	if store == nil {
+		return
+	}
+
+	playlist, ok := store.Get(mux.Vars(r)["playlistId"])
+	if !ok {
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", models.PlaylistFileName(playlist.Name)))
+	songs := ms.musicLibrary.GetSongsByIDs(playlist.SongIDs)
+	if err := models.WritePlaylistM3U8(w, playlist, songs); err != nil {
+		log.Printf("❌ [PLAYLISTS] Failed to export %q: %v", playlist.Name, err)
+		return
+	}
+	log.Printf("📜 [PLAYLISTS] Exported %q", playlist.Name)
+}
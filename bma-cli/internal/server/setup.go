@@ -199,6 +199,25 @@ func (ss *SetupServer) handleSetupPage(w http.ResponseWriter, r *http.Request) {
             text-align: center;
             padding: 20px;
         }
+        .folder-list {
+            list-style: none;
+            padding: 0;
+        }
+        .folder-list li {
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+            padding: 8px 12px;
+            margin-bottom: 8px;
+            background: white;
+            border: 1px solid #ddd;
+            border-radius: 4px;
+        }
+        .folder-list button {
+            background: #dc3545;
+            padding: 4px 12px;
+            font-size: 14px;
+        }
     </style>
 </head>
 <body>
@@ -226,17 +245,19 @@ func (ss *SetupServer) handleSetupPage(w http.ResponseWriter, r *http.Request) {
         
         <!-- Step 2: Music Directory -->
         <div id="step2" class="step">
-            <h3>Step 2: Music Directory</h3>
-            <p>Specify the directory containing your music files.</p>
+            <h3>Step 2: Music Directories</h3>
+            <p>Add each directory containing your music files, such as an internal disk, a USB drive or a NAS mount.</p>
             
             <div class="form-group">
                 <label for="music-path">Music Directory Path:</label>
                 <input type="text" id="music-path" placeholder="/path/to/your/music" value="">
             </div>
             
-            <button onclick="validateMusicDirectory()">Validate Directory</button>
+            <button onclick="validateMusicDirectory()">Add Directory</button>
             
             <div id="music-status" class="hidden"></div>
+            
+            <ul id="music-folders" class="folder-list"></ul>
         </div>
         
         <!-- Step 3: Complete Setup -->
@@ -247,7 +268,7 @@ func (ss *SetupServer) handleSetupPage(w http.ResponseWriter, r *http.Request) {
             <div id="setup-summary" class="hidden">
                 <ul>
                     <li>Tailscale: <span id="summary-tailscale">Pending</span></li>
-                    <li>Music Directory: <span id="summary-music">Pending</span></li>
+                    <li>Music Directories: <span id="summary-music">Pending</span></li>
                 </ul>
             </div>
             
@@ -259,7 +280,7 @@ func (ss *SetupServer) handleSetupPage(w http.ResponseWriter, r *http.Request) {
         let setupState = {
             tailscaleConfigured: false,
             musicDirectoryValid: false,
-            musicPath: ''
+            musicPaths: []
         };
 
         // Check Tailscale status on page load
@@ -332,21 +353,44 @@ func (ss *SetupServer) handleSetupPage(w http.ResponseWriter, r *http.Request) {
                 const data = await response.json();
                 
                 if (data.valid) {
-                    showMusicStatus('success', '✅ Valid music directory! Found ' + data.fileCount + ' music files.');
-                    setupState.musicDirectoryValid = true;
-                    setupState.musicPath = musicPath;
-                    updateSteps();
+                    showMusicStatus('success', '✅ Added! Found ' + data.fileCount + ' music files.');
+                    if (!setupState.musicPaths.includes(musicPath)) {
+                        setupState.musicPaths.push(musicPath);
+                    }
+                    document.getElementById('music-path').value = '';
+                    renderMusicFolders();
                 } else {
                     showMusicStatus('error', '❌ ' + (data.error || 'Invalid music directory'));
-                    setupState.musicDirectoryValid = false;
                 }
             } catch (error) {
                 console.error('Error validating music directory:', error);
                 showMusicStatus('error', '❌ Error validating directory.');
-                setupState.musicDirectoryValid = false;
             }
         }
 
+        function removeMusicFolder(index) {
+            setupState.musicPaths.splice(index, 1);
+            renderMusicFolders();
+        }
+
+        function renderMusicFolders() {
+            const list = document.getElementById('music-folders');
+            list.innerHTML = '';
+            setupState.musicPaths.forEach(function(path, index) {
+                const item = document.createElement('li');
+                const label = document.createElement('span');
+                label.textContent = path;
+                const remove = document.createElement('button');
+                remove.textContent = 'Remove';
+                remove.onclick = function() { removeMusicFolder(index); };
+                item.appendChild(label);
+                item.appendChild(remove);
+                list.appendChild(item);
+            });
+            setupState.musicDirectoryValid = setupState.musicPaths.length > 0;
+            updateSteps();
+        }
+
         function showMusicStatus(type, message) {
             const statusDiv = document.getElementById('music-status');
             statusDiv.className = 'status ' + type;
@@ -361,16 +405,19 @@ func (ss *SetupServer) handleSetupPage(w http.ResponseWriter, r *http.Request) {
                 document.getElementById('step2').className = 'step active';
             }
 
-            // Update step 2
+            // Update step 2 (more directories can still be added once one is in)
             if (setupState.musicDirectoryValid) {
-                document.getElementById('step2').className = 'step completed';
                 document.getElementById('step3').className = 'step active';
                 
                 // Update summary
                 document.getElementById('summary-tailscale').textContent = setupState.tailscaleConfigured ? 'Configured' : 'Skipped';
-                document.getElementById('summary-music').textContent = setupState.musicPath;
+                document.getElementById('summary-music').textContent = setupState.musicPaths.join(', ');
                 document.getElementById('setup-summary').classList.remove('hidden');
                 document.getElementById('complete-setup').disabled = false;
+            } else {
+                document.getElementById('step3').className = 'step';
+                document.getElementById('setup-summary').classList.add('hidden');
+                document.getElementById('complete-setup').disabled = true;
             }
         }
 
@@ -387,7 +434,7 @@ func (ss *SetupServer) handleSetupPage(w http.ResponseWriter, r *http.Request) {
                         'Content-Type': 'application/json',
                     },
                     body: JSON.stringify({
-                        musicPath: setupState.musicPath,
+                        musicPaths: setupState.musicPaths,
                         tailscaleConfigured: setupState.tailscaleConfigured
                     })
                 });
@@ -498,8 +545,8 @@ func (ss *SetupServer) handleSetupComplete(w http.ResponseWriter, r *http.Reques
 	log.Println("✅ Setup completion requested")
 	
 	var request struct {
-		MusicPath           string `json:"musicPath"`
-		TailscaleConfigured bool   `json:"tailscaleConfigured"`
+		MusicPaths          []string `json:"musicPaths"`
+		TailscaleConfigured bool     `json:"tailscaleConfigured"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -507,10 +554,14 @@ func (ss *SetupServer) handleSetupComplete(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	
-	log.Printf("✅ Completing setup with music path: %s", request.MusicPath)
+	log.Printf("✅ Completing setup with music paths: %s", strings.Join(request.MusicPaths, ", "))
 	
 	// Update configuration
-	ss.config.MusicFolder = request.MusicPath
+	roots := make([]models.LibraryRoot, len(request.MusicPaths))
+	for i, path := range request.MusicPaths {
+		roots[i] = models.LibraryRoot{Path: path}
+	}
+	ss.config.MusicFolders = models.CleanLibraryRoots(roots)
 	ss.config.SetupComplete = true
 	
 	if err := ss.config.SaveConfig(); err != nil {
@@ -625,11 +676,10 @@ func (ss *SetupServer) validateMusicDirectory(path string) map[string]interface{
 			return nil // Continue walking, ignore errors
 		}
 		
-		if !info.IsDir() {
-			ext := strings.ToLower(filepath.Ext(info.Name()))
-			if ext == ".mp3" || ext == ".m4a" || ext == ".flac" || ext == ".wav" {
-				musicCount++
-			}
+		// Use the same format registry as the scanner, so setup never counts files
+		// the server won't serve
+		if !info.IsDir() && models.IsSupportedAudioFile(info.Name()) {
+			musicCount++
 		}
 		
 		return nil
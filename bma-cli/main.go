@@ -73,21 +73,21 @@ func startMainServer(config *models.Config) {
 	
 	// Create music library
 	musicLibrary := models.NewMusicLibrary()
+	musicLibrary.SetArtworkFilenames(config.ArtworkFilenames)
+	if err := musicLibrary.SetLibraryRules(config.LibraryRules); err != nil {
+		log.Printf("❌ Invalid libraryRules in config, using the defaults: %v", err)
+	}
+	if err := musicLibrary.SetDuplicateHandling(config.DuplicatePolicy, config.FingerprintDuplicates); err != nil {
+		log.Printf("❌ Invalid duplicatePolicy in config, keeping the first copy: %v", err)
+	}
 	
-	// Create main server
+	// Create main server (it pushes library changes to connected clients over /events)
 	mainServer := server.NewMusicServer(config, musicLibrary)
 	
-	// Set up library change callback to notify connected clients
-	musicLibrary.SetLibraryChangedCallback(func() {
-		log.Println("🔄 [SERVER] Library changed - notifying connected clients")
-		// This will trigger the server to notify connected Android clients
-		// about the library update (if the server has such functionality)
-	})
-	
-	// Load music from configured folder
-	if config.MusicFolder != "" {
-		log.Printf("📁 Loading music from: %s", config.MusicFolder)
-		musicLibrary.SelectFolder(config.MusicFolder)
+	// Load music from the configured folders
+	if len(config.MusicFolders) > 0 {
+		log.Printf("📁 Loading music from: %s", strings.Join(config.MusicFolderPaths(), ", "))
+		musicLibrary.SetRoots(config.MusicFolders)
 	}
 	
 	// Handle graceful shutdown
@@ -108,12 +108,22 @@ func startMainServer(config *models.Config) {
 	fmt.Println("\n" + strings.Repeat("=", 60))
 	fmt.Println("🎵 BMA CLI Music Server")
 	fmt.Println(strings.Repeat("=", 60))
-	fmt.Printf("Music Library: %s\n", config.MusicFolder)
+	for _, root := range config.MusicFolders {
+		if root.Disabled {
+			fmt.Printf("Music Library: %s (disabled)\n", root.Path)
+		} else {
+			fmt.Printf("Music Library: %s\n", root.Path)
+		}
+	}
 	fmt.Printf("Server running at: http://localhost:8080\n")
 	if config.TailscaleIP != "" {
 		fmt.Printf("Tailscale access: http://%s:8080\n", config.TailscaleIP)
 	}
 	fmt.Println("Ready for connections from BMA mobile apps")
+	fmt.Println("")
+	fmt.Println("To pair a phone, open this link and scan the QR code:")
+	fmt.Printf("  %s\n", mainServer.PairingPageURL())
+	fmt.Println("(keep the link private - it lets anyone holding it pair a device)")
 	fmt.Println(strings.Repeat("=", 60) + "\n")
 	
 	// Start the music server (this will block)